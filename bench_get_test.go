@@ -1,4 +1,4 @@
-package stashlist
+package stashlist_test
 
 import (
 	"testing"
@@ -32,6 +32,20 @@ func BenchmarkSieveGetValue64B(b *testing.B) {
 	}
 }
 
+// ARC Get
+func BenchmarkArcGetValue64B(b *testing.B) {
+	initArcCache(b.N)
+	opLen := len(getOperations)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for n := 0; n < b.N; n++ {
+		op := getOperations[n%opLen]
+		arcCache.Get(op.key)
+	}
+}
+
 // Skiplist Get
 func BenchmarkSkiplistGetValue64B(b *testing.B) {
 	initSkiplist(b.N)
@@ -1,8 +1,10 @@
-package stashlist
+package stashlist_test
 
 import (
 	"testing"
 
+	"github.com/hey-kong/stashlist"
+	"github.com/hey-kong/stashlist/cache/arc"
 	"github.com/hey-kong/stashlist/cache/lru"
 	"github.com/hey-kong/stashlist/cache/sieve"
 	"github.com/hey-kong/stashlist/skiplist"
@@ -36,6 +38,20 @@ func BenchmarkSievePutValue64B(b *testing.B) {
 	}
 }
 
+// ARC Put
+func BenchmarkArcPutValue64B(b *testing.B) {
+	arcCache = arc.New(b.N / 2)
+	opLen := len(putOperations)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for n := 0; n < b.N; n++ {
+		op := putOperations[n%opLen]
+		arcCache.Add(op.key, op.value)
+	}
+}
+
 // Skiplist Put
 func BenchmarkSkiplistPutValue64B(b *testing.B) {
 	l = skiplist.NewSkipList()
@@ -51,7 +67,7 @@ func BenchmarkSkiplistPutValue64B(b *testing.B) {
 }
 
 func BenchmarkStashlistPutValue64B(b *testing.B) {
-	myList = NewStashList()
+	myList = stashlist.NewStashList()
 	opLen := len(putOperations)
 
 	b.ReportAllocs()
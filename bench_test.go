@@ -1,21 +1,20 @@
-package stashlist
+package stashlist_test
 
 import (
 	"math/rand"
 	"testing"
 
+	"github.com/hey-kong/stashlist"
+	"github.com/hey-kong/stashlist/cache"
+	"github.com/hey-kong/stashlist/cache/arc"
+	"github.com/hey-kong/stashlist/cache/lfu"
 	"github.com/hey-kong/stashlist/cache/lru"
 	"github.com/hey-kong/stashlist/cache/sieve"
+	"github.com/hey-kong/stashlist/cache/slru"
 	"github.com/hey-kong/stashlist/skiplist"
 	"github.com/hey-kong/stashlist/util"
 )
 
-// CacheInterface defines the interface for a cache
-type CacheInterface interface {
-	Add(key string, value []byte)
-	Get(key string) ([]byte, bool)
-}
-
 var (
 	putOperations []struct {
 		write bool
@@ -36,8 +35,11 @@ var (
 
 var lruCache *lru.Cache
 var sieveCache *sieve.Cache
+var arcCache *arc.Cache
+var slruCache *slru.Cache
+var lfuCache *lfu.Cache
 var l *skiplist.SkipList
-var myList *StashList
+var myList *stashlist.StashList
 
 func init() {
 	cacheSize := 10000
@@ -50,6 +52,9 @@ func init() {
 	operations = GenerateWorkload(numOperations, writeRatio, keyRange)
 	initLruCache(cacheSize)
 	initSieveCache(cacheSize)
+	initArcCache(cacheSize)
+	initSlruCache(cacheSize)
+	initLfuCache(cacheSize)
 	initSkiplist(cacheSize)
 	initStashlist(cacheSize)
 }
@@ -78,6 +83,42 @@ func initSieveCache(num int) {
 	}
 }
 
+func initArcCache(num int) {
+	arcCache = arc.New(num)
+	for n := 0; n < num; n++ {
+		key := util.GetFixedLengthKey(n)
+		val, err := util.GetValue(64)
+		if err != nil {
+			panic(err)
+		}
+		arcCache.Add(key, val)
+	}
+}
+
+func initSlruCache(num int) {
+	slruCache = slru.New(num)
+	for n := 0; n < num; n++ {
+		key := util.GetFixedLengthKey(n)
+		val, err := util.GetValue(64)
+		if err != nil {
+			panic(err)
+		}
+		slruCache.Add(key, val)
+	}
+}
+
+func initLfuCache(num int) {
+	lfuCache = lfu.New(num)
+	for n := 0; n < num; n++ {
+		key := util.GetFixedLengthKey(n)
+		val, err := util.GetValue(64)
+		if err != nil {
+			panic(err)
+		}
+		lfuCache.Add(key, val)
+	}
+}
+
 func initSkiplist(num int) {
 	l = skiplist.NewSkipList()
 	for n := 0; n < num; n++ {
@@ -91,7 +132,7 @@ func initSkiplist(num int) {
 }
 
 func initStashlist(num int) {
-	myList = NewStashList()
+	myList = stashlist.NewStashList()
 	for n := 0; n < num; n++ {
 		key := util.GetFixedLengthKey(n)
 		val, err := util.GetValue(64)
@@ -195,14 +236,20 @@ func GenerateWorkload(numOperations int, writeRatio float64, keyRange int) []str
 }
 
 // RunBenchmark runs the benchmark on the given cache with the provided workload
-func RunBenchmark(b *testing.B, cache CacheInterface) {
+func RunBenchmark(b *testing.B, c cache.Cache) {
+	runWorkload(b, c.Add, c.Get)
+}
+
+// runWorkload runs the workload through add and get, which the skiplist,
+// not being a cache.Cache, provides too
+func runWorkload(b *testing.B, add func(string, []byte), get func(string) ([]byte, bool)) {
 	opLen := len(operations)
 	for n := 0; n < b.N; n++ {
 		op := operations[n%opLen] // Use modulo to cycle through operations
 		if op.write {
-			cache.Add(op.key, op.value)
+			add(op.key, op.value)
 		} else {
-			cache.Get(op.key)
+			get(op.key)
 		}
 	}
 }
@@ -223,17 +270,41 @@ func BenchmarkSieveHybrid(b *testing.B) {
 	RunBenchmark(b, sieveCache)
 }
 
+// ARC Hybrid
+func BenchmarkArcHybrid(b *testing.B) {
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	RunBenchmark(b, arcCache)
+}
+
+// SLRU Hybrid
+func BenchmarkSlruHybrid(b *testing.B) {
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	RunBenchmark(b, slruCache)
+}
+
+// LFU Hybrid
+func BenchmarkLfuHybrid(b *testing.B) {
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	RunBenchmark(b, lfuCache)
+}
+
 // Skiplist Hybrid
 func BenchmarkSkiplistHybrid(b *testing.B) {
 	b.ReportAllocs()
 	b.ResetTimer()
 
-	RunBenchmark(b, l)
+	runWorkload(b, l.Add, l.Get)
 }
 
 func BenchmarkStashlistHybrid(b *testing.B) {
 	b.ReportAllocs()
 	b.ResetTimer()
 
-	RunBenchmark(b, myList)
+	RunBenchmark(b, cache.FromStashList(myList))
 }
@@ -0,0 +1,93 @@
+package bloom
+
+import "math"
+
+// Filter is a bloom filter over string keys. It never reports false negatives;
+// the false positive rate is about 1% for 10 bits per key.
+// A Filter can be serialized with Bytes and read back with FromBytes.
+type Filter struct {
+	bits []byte
+	k    uint8
+}
+
+// New creates a filter sized for n keys at bitsPerKey bits each.
+func New(n, bitsPerKey int) *Filter {
+	if bitsPerKey < 1 {
+		bitsPerKey = 1
+	}
+	nbits := n * bitsPerKey
+	if nbits < 64 {
+		nbits = 64
+	}
+
+	// k = ln(2) * bits per key minimizes the false positive rate
+	k := int(math.Round(float64(bitsPerKey) * math.Ln2))
+	if k < 1 {
+		k = 1
+	} else if k > 30 {
+		k = 30
+	}
+
+	return &Filter{
+		bits: make([]byte, (nbits+7)/8),
+		k:    uint8(k),
+	}
+}
+
+// FromBytes wraps a filter serialized by Bytes. The slice is not copied.
+// It returns nil if b is not a valid filter.
+func FromBytes(b []byte) *Filter {
+	if len(b) < 2 {
+		return nil
+	}
+	return &Filter{bits: b[:len(b)-1], k: b[len(b)-1]}
+}
+
+// Bytes returns the serialized filter: the bit array followed by k.
+func (f *Filter) Bytes() []byte {
+	return append(f.bits[:len(f.bits):len(f.bits)], f.k)
+}
+
+// Add inserts key into the filter.
+func (f *Filter) Add(key string) {
+	nbits := uint32(len(f.bits) * 8)
+	h1, h2 := hashes(key)
+	for i := uint8(0); i < f.k; i++ {
+		pos := h1 % nbits
+		f.bits[pos/8] |= 1 << (pos % 8)
+		h1 += h2
+	}
+}
+
+// MayContain reports whether key may have been added to the filter.
+func (f *Filter) MayContain(key string) bool {
+	nbits := uint32(len(f.bits) * 8)
+	h1, h2 := hashes(key)
+	for i := uint8(0); i < f.k; i++ {
+		pos := h1 % nbits
+		if f.bits[pos/8]&(1<<(pos%8)) == 0 {
+			return false
+		}
+		h1 += h2
+	}
+	return true
+}
+
+// Reset removes all the keys from the filter.
+func (f *Filter) Reset() {
+	for i := range f.bits {
+		f.bits[i] = 0
+	}
+}
+
+// hashes derives the two hashes used for double hashing
+// (Kirsch and Mitzenmacher) from a single 64-bit FNV-1a hash.
+// FNV is computed inline to keep lookups free of allocations.
+func hashes(key string) (uint32, uint32) {
+	sum := uint64(14695981039346656037)
+	for i := 0; i < len(key); i++ {
+		sum ^= uint64(key[i])
+		sum *= 1099511628211
+	}
+	return uint32(sum), uint32(sum>>32) | 1
+}
@@ -0,0 +1,304 @@
+// Package arc implements the Adaptive Replacement Cache of Megiddo and
+// Modha. It splits the cache between a list of keys seen once recently, T1,
+// and a list of keys seen at least twice, T2. Ghost lists B1 and B2 remember
+// the keys recently evicted from each, and a hit on a ghost moves the target
+// size p of T1 towards the list that would have kept the key.
+package arc
+
+import "container/list"
+
+// Cache is an ARC cache. It is not safe for concurrent access.
+type Cache struct {
+	// MaxEntries is the maximum number of cache entries before
+	// an item is evicted. Zero means no limit.
+	MaxEntries int
+
+	// OnEvicted optionally specifies a callback function to be
+	// executed when an entry is purged from the cache.
+	OnEvicted func(key string, value []byte)
+
+	// OnCapacityEvicted optionally specifies a callback function to be
+	// executed when an entry is evicted to make room, after OnEvicted.
+	// Entries dropped by Remove or Clear are not reported.
+	OnCapacityEvicted func(key string, value []byte)
+
+	// p is the target size of t1.
+	p int
+	// t1 and t2 hold the resident entries, b1 and b2 the ghosts evicted
+	// from them. The front of each list is its most recently used entry.
+	t1, t2, b1, b2 *list.List
+	items          map[string]*list.Element
+}
+
+type entry struct {
+	key   string
+	value []byte
+	// ll is the list holding the entry.
+	ll *list.List
+}
+
+// New creates a new Cache.
+// If maxEntries is zero, the cache has no limit and it's assumed
+// that eviction is done by the caller.
+func New(maxEntries int) *Cache {
+	c := &Cache{MaxEntries: maxEntries}
+	c.init()
+	return c
+}
+
+func (c *Cache) init() {
+	c.p = 0
+	c.t1 = list.New()
+	c.t2 = list.New()
+	c.b1 = list.New()
+	c.b2 = list.New()
+	c.items = make(map[string]*list.Element)
+}
+
+// Add adds a value to the cache.
+func (c *Cache) Add(key string, value []byte) {
+	if c.items == nil {
+		c.init()
+	}
+	if ele, ok := c.items[key]; ok {
+		kv := ele.Value.(*entry)
+		switch kv.ll {
+		case c.t1, c.t2:
+			kv.value = value
+			c.moveTo(ele, c.t2)
+			return
+		case c.b1:
+			// T1 was too small to keep the key: grow its target
+			c.p += delta(c.b2.Len(), c.b1.Len())
+			if c.p > c.MaxEntries {
+				c.p = c.MaxEntries
+			}
+			c.removeElement(ele)
+			c.makeRoom(false)
+		case c.b2:
+			// T2 was too small to keep the key: shrink the target of T1
+			c.p -= delta(c.b1.Len(), c.b2.Len())
+			if c.p < 0 {
+				c.p = 0
+			}
+			c.removeElement(ele)
+			c.makeRoom(true)
+		}
+		c.push(c.t2, key, value)
+		return
+	}
+
+	if c.MaxEntries != 0 {
+		if c.t1.Len()+c.b1.Len() >= c.MaxEntries {
+			if c.b1.Len() > 0 {
+				c.removeElement(c.b1.Back())
+			} else {
+				// T1 fills the cache alone: drop its oldest without a ghost
+				kv := c.removeElement(c.t1.Back())
+				c.evicted(kv.key, kv.value)
+			}
+		} else if c.t1.Len()+c.t2.Len()+c.b1.Len()+c.b2.Len() >= 2*c.MaxEntries {
+			c.removeElement(c.b2.Back())
+		}
+		c.makeRoom(false)
+	}
+	c.push(c.t1, key, value)
+}
+
+// Get looks up a key's value from the cache.
+func (c *Cache) Get(key string) (value []byte, ok bool) {
+	if c.items == nil {
+		return
+	}
+	if ele, hit := c.items[key]; hit {
+		kv := ele.Value.(*entry)
+		if kv.ll == c.t1 || kv.ll == c.t2 {
+			c.moveTo(ele, c.t2)
+			return kv.value, true
+		}
+	}
+	return
+}
+
+// Peek looks up a key's value without updating its recency.
+func (c *Cache) Peek(key string) (value []byte, ok bool) {
+	if c.items == nil {
+		return
+	}
+	if ele, hit := c.items[key]; hit {
+		kv := ele.Value.(*entry)
+		if kv.ll == c.t1 || kv.ll == c.t2 {
+			return kv.value, true
+		}
+	}
+	return
+}
+
+// Remove removes the provided key from the cache, along with its ghost.
+func (c *Cache) Remove(key string) {
+	if c.items == nil {
+		return
+	}
+	if ele, hit := c.items[key]; hit {
+		kv := c.removeElement(ele)
+		if c.OnEvicted != nil && (kv.ll == c.t1 || kv.ll == c.t2) {
+			c.OnEvicted(kv.key, kv.value)
+		}
+	}
+}
+
+// RemoveOldest evicts an item from the cache: the oldest of T1 if T1 is
+// over its target size, the oldest of T2 otherwise. The evicted key is
+// remembered as a ghost.
+func (c *Cache) RemoveOldest() {
+	if c.items == nil {
+		return
+	}
+	c.replace(false)
+}
+
+// makeRoom evicts an item if the cache is full.
+func (c *Cache) makeRoom(inB2 bool) {
+	if c.MaxEntries != 0 && c.Len() >= c.MaxEntries {
+		c.replace(inB2)
+	}
+}
+
+// replace moves the oldest entry of T1 or T2 to its ghost list. inB2 tells
+// that the key about to be added is a ghost of T2, which breaks the tie
+// when T1 is at its target size.
+func (c *Cache) replace(inB2 bool) {
+	from, ghost := c.t2, c.b2
+	if c.t1.Len() > 0 && (c.t1.Len() > c.p || (inB2 && c.t1.Len() == c.p) || c.t2.Len() == 0) {
+		from, ghost = c.t1, c.b1
+	}
+	ele := from.Back()
+	if ele == nil {
+		return
+	}
+	kv := ele.Value.(*entry)
+	value := kv.value
+	kv.value = nil
+	c.moveTo(ele, ghost)
+	c.evicted(kv.key, value)
+}
+
+// evicted reports an entry evicted to make room.
+func (c *Cache) evicted(key string, value []byte) {
+	if c.OnEvicted != nil {
+		c.OnEvicted(key, value)
+	}
+	if c.OnCapacityEvicted != nil {
+		c.OnCapacityEvicted(key, value)
+	}
+}
+
+// push adds a new entry in front of l.
+func (c *Cache) push(l *list.List, key string, value []byte) {
+	c.items[key] = l.PushFront(&entry{key, value, l})
+}
+
+// moveTo moves e in front of l.
+func (c *Cache) moveTo(e *list.Element, l *list.List) {
+	kv := e.Value.(*entry)
+	if kv.ll == l {
+		l.MoveToFront(e)
+		return
+	}
+	kv.ll.Remove(e)
+	kv.ll = l
+	c.items[kv.key] = l.PushFront(kv)
+}
+
+// delta is the step of p on a ghost hit: the ratio of the other ghost list
+// to the one hit, at least 1.
+func delta(other, hit int) int {
+	if d := other / hit; d > 1 {
+		return d
+	}
+	return 1
+}
+
+func (c *Cache) removeElement(e *list.Element) *entry {
+	kv := e.Value.(*entry)
+	kv.ll.Remove(e)
+	delete(c.items, kv.key)
+	return kv
+}
+
+// Len returns the number of items in the cache.
+func (c *Cache) Len() int {
+	if c.items == nil {
+		return 0
+	}
+	return c.t1.Len() + c.t2.Len()
+}
+
+// P returns the target size of T1, the part of the cache given to keys seen
+// once recently.
+func (c *Cache) P() int {
+	return c.p
+}
+
+// Clear purges all stored items from the cache, ghosts included.
+func (c *Cache) Clear() {
+	if c.OnEvicted != nil && c.items != nil {
+		for _, l := range []*list.List{c.t1, c.t2} {
+			for ele := l.Back(); ele != nil; ele = ele.Prev() {
+				kv := ele.Value.(*entry)
+				c.OnEvicted(kv.key, kv.value)
+			}
+		}
+	}
+	c.items = nil
+	c.p = 0
+}
+
+// Keys returns the keys of the cache: those of T1 then those of T2, each
+// from the oldest to the newest.
+func (c *Cache) Keys() []string {
+	keys := make([]string, 0, c.Len())
+	if c.items == nil {
+		return keys
+	}
+	for _, l := range []*list.List{c.t1, c.t2} {
+		for ele := l.Back(); ele != nil; ele = ele.Prev() {
+			keys = append(keys, ele.Value.(*entry).key)
+		}
+	}
+	return keys
+}
+
+// Resize changes MaxEntries and evicts the items beyond it. Returns the
+// number of items evicted.
+func (c *Cache) Resize(maxEntries int) int {
+	c.MaxEntries = maxEntries
+	if maxEntries == 0 || c.items == nil {
+		return 0
+	}
+	n := 0
+	for c.Len() > maxEntries {
+		c.replace(false)
+		n++
+	}
+	if c.p > maxEntries {
+		c.p = maxEntries
+	}
+	for c.t1.Len()+c.b1.Len() > maxEntries && c.b1.Len() > 0 {
+		c.removeElement(c.b1.Back())
+	}
+	for c.t1.Len()+c.t2.Len()+c.b1.Len()+c.b2.Len() > 2*maxEntries && c.b2.Len() > 0 {
+		c.removeElement(c.b2.Back())
+	}
+	return n
+}
+
+// SetOnEvicted sets OnCapacityEvicted, as cache.Cache requires.
+func (c *Cache) SetOnEvicted(fn func(key string, value []byte)) {
+	c.OnCapacityEvicted = fn
+}
+
+// SetOnPurged sets OnEvicted.
+func (c *Cache) SetOnPurged(fn func(key string, value []byte)) {
+	c.OnEvicted = fn
+}
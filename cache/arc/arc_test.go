@@ -0,0 +1,98 @@
+package arc
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/hey-kong/stashlist/cache"
+	"github.com/hey-kong/stashlist/cache/cachetest"
+)
+
+func TestCache(t *testing.T) {
+	cachetest.Run(t, func(size int) cache.Cache { return New(size) })
+}
+
+func key(i int) string {
+	return "key" + strconv.Itoa(i)
+}
+
+func TestAdapt(t *testing.T) {
+	c := New(4)
+	for i := 0; i < 4; i++ {
+		c.Add(key(i), nil)
+	}
+	c.Get(key(3))
+	// key0 is evicted from T1 to B1
+	c.Add(key(4), nil)
+	if _, ok := c.Peek(key(0)); ok || c.P() != 0 {
+		t.Fatal("key0 not evicted, or p moved:", c.P())
+	}
+	// the ghost hit grows T1
+	c.Add(key(0), nil)
+	if c.P() != 1 || c.t2.Len() != 2 {
+		t.Fatalf("p = %d, |T2| = %d after a hit on B1", c.P(), c.t2.Len())
+	}
+
+	// fill T2, then push one of its keys out to B2
+	for i := 1; i <= 4; i++ {
+		c.Get(key(i))
+	}
+	for i := 0; i <= 4; i++ {
+		c.Get(key(i))
+	}
+	for i := 10; i < 14; i++ {
+		c.Add(key(i), nil)
+	}
+	if c.b2.Len() == 0 {
+		t.Fatal("nothing was evicted from T2")
+	}
+	ghost := c.b2.Front().Value.(*entry).key
+	p := c.P()
+	c.Add(ghost, nil)
+	if c.P() >= p {
+		t.Fatalf("p went from %d to %d after a hit on B2", p, c.P())
+	}
+}
+
+func TestScanResistance(t *testing.T) {
+	c := New(100)
+	for i := 0; i < 50; i++ {
+		c.Add(key(i), nil)
+		c.Get(key(i))
+	}
+	// a scan of keys seen once does not flush the keys seen twice
+	for i := 1000; i < 2000; i++ {
+		c.Add(key(i), nil)
+	}
+	for i := 0; i < 50; i++ {
+		if _, ok := c.Peek(key(i)); !ok {
+			t.Fatalf("%s was flushed by the scan", key(i))
+		}
+	}
+	if c.Len() != 100 {
+		t.Fatal("Len is", c.Len())
+	}
+}
+
+func TestGhostBounds(t *testing.T) {
+	const size = 32
+	c := New(size)
+	for i := 0; i < 100*size; i++ {
+		k := key(i * 7919 % (4 * size))
+		if _, ok := c.Get(k); !ok {
+			c.Add(k, nil)
+		}
+		if c.t1.Len()+c.b1.Len() > size {
+			t.Fatalf("|T1|+|B1| = %d", c.t1.Len()+c.b1.Len())
+		}
+		if n := c.t1.Len() + c.t2.Len() + c.b1.Len() + c.b2.Len(); n > 2*size {
+			t.Fatal("the lists hold", n, "keys")
+		}
+		if c.P() < 0 || c.P() > size {
+			t.Fatal("p is", c.P())
+		}
+	}
+	if len(c.items) != c.t1.Len()+c.t2.Len()+c.b1.Len()+c.b2.Len() {
+		t.Fatal("the index and the lists disagree")
+	}
+}
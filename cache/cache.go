@@ -0,0 +1,40 @@
+// Package cache defines the interface the caches of this module share:
+// lru.Cache, sieve.Cache and the others under cache/, and a bounded
+// StashList through FromStashList. Package cachetest checks that an
+// implementation behaves.
+package cache
+
+// Cache is a key-value cache holding a bounded number of entries. Caches
+// are not safe for concurrent access.
+type Cache interface {
+	// Add stores value under key, replacing the value of an existing key.
+	// When the cache is full, an entry is evicted to make room; never the
+	// one just added.
+	Add(key string, value []byte)
+	// Get returns the value of key. It counts as an access for the
+	// eviction policy.
+	Get(key string) ([]byte, bool)
+	// Peek returns the value of key without counting as an access.
+	Peek(key string) ([]byte, bool)
+	// Remove drops key if present.
+	Remove(key string)
+	// Len returns the number of entries.
+	Len() int
+	// Clear drops every entry.
+	Clear()
+	// Keys returns the keys, in an order that depends on the cache.
+	Keys() []string
+	// Resize changes the capacity, evicting the entries beyond it, and
+	// returns the number evicted. Zero means no limit.
+	Resize(size int) int
+	// SetOnEvicted installs a function called with every entry the cache
+	// evicts to make room. Entries dropped by Remove, Clear or replaced by
+	// Add are not reported. It sets the OnCapacityEvicted field of the
+	// caches under cache/.
+	SetOnEvicted(fn func(key string, value []byte))
+	// SetOnPurged installs a function called with every entry the cache
+	// drops: evicted to make room, removed or cleared. Entries replaced by
+	// Add are not reported. It sets the OnEvicted field of the caches under
+	// cache/, which keeps the meaning it has in lru.Cache.
+	SetOnPurged(fn func(key string, value []byte))
+}
@@ -0,0 +1,17 @@
+package cache_test
+
+import (
+	"testing"
+
+	"github.com/hey-kong/stashlist"
+	"github.com/hey-kong/stashlist/cache"
+	"github.com/hey-kong/stashlist/cache/cachetest"
+)
+
+func TestStashList(t *testing.T) {
+	cachetest.Run(t, func(size int) cache.Cache {
+		list := stashlist.NewStashList()
+		list.MaxEntries = size
+		return cache.FromStashList(list)
+	})
+}
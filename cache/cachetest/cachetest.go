@@ -0,0 +1,297 @@
+// Package cachetest checks that a cache.Cache implementation honours the
+// contract of the interface. Implementations call Run from their tests:
+//
+//	func TestCache(t *testing.T) {
+//		cachetest.Run(t, func(size int) cache.Cache { return New(size) })
+//	}
+package cachetest
+
+import (
+	"math/rand"
+	"sort"
+	"strconv"
+	"testing"
+
+	"github.com/hey-kong/stashlist/cache"
+)
+
+// Factory returns an empty cache holding at most size entries.
+type Factory func(size int) cache.Cache
+
+const size = 16
+
+// Run runs the conformance tests as subtests of t.
+func Run(t *testing.T, factory Factory) {
+	t.Run("AddGet", func(t *testing.T) { testAddGet(t, factory) })
+	t.Run("Overwrite", func(t *testing.T) { testOverwrite(t, factory) })
+	t.Run("Remove", func(t *testing.T) { testRemove(t, factory) })
+	t.Run("Capacity", func(t *testing.T) { testCapacity(t, factory) })
+	t.Run("EvictionCallback", func(t *testing.T) { testEvictionCallback(t, factory) })
+	t.Run("Clear", func(t *testing.T) { testClear(t, factory) })
+	t.Run("Keys", func(t *testing.T) { testKeys(t, factory) })
+	t.Run("Resize", func(t *testing.T) { testResize(t, factory) })
+	t.Run("Purge", func(t *testing.T) { testPurge(t, factory) })
+	t.Run("Random", func(t *testing.T) { testRandom(t, factory) })
+}
+
+// recorder collects the evictions of a cache.
+type recorder struct {
+	evicted map[string][]byte
+	calls   int
+}
+
+func record(c cache.Cache) *recorder {
+	r := &recorder{evicted: make(map[string][]byte)}
+	c.SetOnEvicted(func(key string, value []byte) {
+		r.evicted[key] = value
+		r.calls++
+	})
+	return r
+}
+
+func key(i int) string {
+	return "key" + strconv.Itoa(i)
+}
+
+func value(i int) []byte {
+	return []byte("value" + strconv.Itoa(i))
+}
+
+func testAddGet(t *testing.T, factory Factory) {
+	c := factory(size)
+	if _, ok := c.Get("missing"); ok {
+		t.Fatal("Get found a missing key")
+	}
+	if _, ok := c.Peek("missing"); ok {
+		t.Fatal("Peek found a missing key")
+	}
+	for i := 0; i < size; i++ {
+		c.Add(key(i), value(i))
+	}
+	if c.Len() != size {
+		t.Fatalf("Len is %d after %d adds", c.Len(), size)
+	}
+	for i := 0; i < size; i++ {
+		if v, ok := c.Get(key(i)); !ok || string(v) != string(value(i)) {
+			t.Fatalf("Get(%q) = %q, %v", key(i), v, ok)
+		}
+		if v, ok := c.Peek(key(i)); !ok || string(v) != string(value(i)) {
+			t.Fatalf("Peek(%q) = %q, %v", key(i), v, ok)
+		}
+	}
+}
+
+func testOverwrite(t *testing.T, factory Factory) {
+	c := factory(size)
+	r := record(c)
+	for i := 0; i < size; i++ {
+		c.Add(key(i), value(i))
+	}
+	for i := 0; i < size; i++ {
+		c.Add(key(i), value(i+100))
+	}
+	if c.Len() != size || r.calls != 0 {
+		t.Fatalf("overwriting a full cache left %d entries and evicted %d", c.Len(), r.calls)
+	}
+	for i := 0; i < size; i++ {
+		if v, _ := c.Get(key(i)); string(v) != string(value(i+100)) {
+			t.Fatalf("Get(%q) = %q after an overwrite", key(i), v)
+		}
+	}
+}
+
+func testRemove(t *testing.T, factory Factory) {
+	c := factory(size)
+	r := record(c)
+	c.Add("a", value(1))
+	c.Add("b", value(2))
+	c.Remove("a")
+	c.Remove("missing")
+	if _, ok := c.Get("a"); ok {
+		t.Fatal("removed key is still readable")
+	}
+	if c.Len() != 1 {
+		t.Fatal("Len is", c.Len(), "after a Remove")
+	}
+	if r.calls != 0 {
+		t.Fatal("Remove was reported as an eviction")
+	}
+	c.Add("a", value(3))
+	if v, ok := c.Get("a"); !ok || string(v) != string(value(3)) {
+		t.Fatal("a removed key cannot be added back")
+	}
+}
+
+func testCapacity(t *testing.T, factory Factory) {
+	c := factory(size)
+	r := record(c)
+	for i := 0; i < 10*size; i++ {
+		c.Add(key(i), value(i))
+		if c.Len() > size {
+			t.Fatalf("cache of %d holds %d entries", size, c.Len())
+		}
+		if _, ok := c.Peek(key(i)); !ok {
+			t.Fatal("the key just added was evicted")
+		}
+		// keep a few keys hot, as a policy may favour them
+		if i%3 == 0 {
+			c.Get(key(i))
+		}
+	}
+	if c.Len() != size {
+		t.Fatalf("full cache of %d holds %d entries", size, c.Len())
+	}
+	if c.Len()+r.calls != 10*size {
+		t.Fatalf("%d entries and %d evictions after %d adds", c.Len(), r.calls, 10*size)
+	}
+}
+
+func testEvictionCallback(t *testing.T, factory Factory) {
+	c := factory(size)
+	r := record(c)
+	for i := 0; i < 3*size; i++ {
+		c.Add(key(i), value(i))
+	}
+	if len(r.evicted) != r.calls {
+		t.Fatal("a key was reported evicted twice")
+	}
+	for k, v := range r.evicted {
+		if _, ok := c.Peek(k); ok {
+			t.Fatalf("evicted key %q is still readable", k)
+		}
+		i, _ := strconv.Atoi(k[len("key"):])
+		if string(v) != string(value(i)) {
+			t.Fatalf("%q was evicted with value %q", k, v)
+		}
+	}
+	for _, k := range c.Keys() {
+		if _, ok := r.evicted[k]; ok {
+			t.Fatalf("key %q is both evicted and held", k)
+		}
+	}
+}
+
+func testClear(t *testing.T, factory Factory) {
+	c := factory(size)
+	r := record(c)
+	for i := 0; i < size; i++ {
+		c.Add(key(i), value(i))
+	}
+	c.Clear()
+	if c.Len() != 0 || len(c.Keys()) != 0 {
+		t.Fatal("Clear left", c.Len(), "entries")
+	}
+	if _, ok := c.Get(key(0)); ok {
+		t.Fatal("cleared key is still readable")
+	}
+	if r.calls != 0 {
+		t.Fatal("Clear was reported as evictions")
+	}
+	for i := 0; i < 2*size; i++ {
+		c.Add(key(i), value(i))
+	}
+	if c.Len() != size {
+		t.Fatal("cleared cache holds", c.Len(), "entries once refilled")
+	}
+}
+
+func testKeys(t *testing.T, factory Factory) {
+	c := factory(size)
+	want := []string{"a", "b", "c"}
+	for _, k := range want {
+		c.Add(k, nil)
+	}
+	c.Add("d", nil)
+	c.Remove("d")
+	got := c.Keys()
+	sort.Strings(got)
+	if len(got) != len(want) {
+		t.Fatalf("Keys = %q, want %q", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("Keys = %q, want %q", got, want)
+		}
+	}
+}
+
+func testResize(t *testing.T, factory Factory) {
+	c := factory(size)
+	r := record(c)
+	for i := 0; i < size; i++ {
+		c.Add(key(i), value(i))
+	}
+
+	if n := c.Resize(size / 2); n != size/2 || r.calls != size/2 || c.Len() != size/2 {
+		t.Fatalf("shrinking to %d evicted %d, reported %d, left %d", size/2, n, r.calls, c.Len())
+	}
+	if n := c.Resize(2 * size); n != 0 {
+		t.Fatal("growing evicted", n)
+	}
+	for i := size; i < 3*size; i++ {
+		c.Add(key(i), value(i))
+	}
+	if c.Len() != 2*size {
+		t.Fatalf("cache grown to %d holds %d entries", 2*size, c.Len())
+	}
+}
+
+func testPurge(t *testing.T, factory Factory) {
+	c := factory(2)
+	r := record(c)
+	purged := make(map[string]int)
+	c.SetOnPurged(func(key string, value []byte) { purged[key]++ })
+	c.Add("a", nil)
+	c.Add("b", nil)
+	c.Add("c", nil)
+	if r.calls != 1 || len(purged) != 1 {
+		t.Fatalf("an add to a full cache evicted %d and purged %d", r.calls, len(purged))
+	}
+	c.Remove(c.Keys()[0])
+	c.Clear()
+	if r.calls != 1 {
+		t.Fatal("Remove or Clear was reported as an eviction")
+	}
+	for _, k := range []string{"a", "b", "c"} {
+		if purged[k] != 1 {
+			t.Fatalf("%q was purged %d times", k, purged[k])
+		}
+	}
+}
+
+// testRandom runs random operations on caches of a few entries, resized
+// now and then, checking their invariants after each.
+func testRandom(t *testing.T, factory Factory) {
+	r := rand.New(rand.NewSource(1))
+	for initial := 1; initial <= 8; initial++ {
+		max := initial
+		c := factory(max)
+		for i := 0; i < 2000; i++ {
+			k := r.Intn(3 * max)
+			switch op := r.Intn(20); {
+			case op < 8:
+				c.Add(key(k), value(k))
+			case op < 16:
+				c.Get(key(k))
+			case op < 19:
+				c.Remove(key(k))
+			default:
+				max = 1 + r.Intn(8)
+				c.Resize(max)
+			}
+			keys := c.Keys()
+			if c.Len() != len(keys) || c.Len() > max {
+				t.Fatalf("cache of %d: Len is %d with %d keys", max, c.Len(), len(keys))
+			}
+			seen := make(map[string]bool)
+			for _, k := range keys {
+				v, ok := c.Peek(k)
+				i, _ := strconv.Atoi(k[len("key"):])
+				if seen[k] || !ok || string(v) != string(value(i)) {
+					t.Fatalf("cache of %d: key %q is listed twice or holds %q", max, k, v)
+				}
+				seen[k] = true
+			}
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package cachetest
+
+import (
+	"math/rand"
+	"strconv"
+
+	"github.com/hey-kong/stashlist/cache"
+)
+
+// Zipf returns n requests over keys keys, whose popularity follows a Zipf
+// law of parameter s.
+func Zipf(seed int64, s float64, keys uint64, n int) []string {
+	r := rand.New(rand.NewSource(seed))
+	z := rand.NewZipf(r, s, 1, keys-1)
+	trace := make([]string, n)
+	for i := range trace {
+		trace[i] = strconv.FormatUint(z.Uint64(), 10)
+	}
+	return trace
+}
+
+// HitRatio replays trace on c, adding the keys it misses.
+func HitRatio(c cache.Cache, trace []string) float64 {
+	hits := 0
+	for _, key := range trace {
+		if _, ok := c.Get(key); ok {
+			hits++
+		} else {
+			c.Add(key, nil)
+		}
+	}
+	return float64(hits) / float64(len(trace))
+}
+
+// Loop returns n passes over keys keys, always in the same order.
+func Loop(keys, n int) []string {
+	trace := make([]string, 0, keys*n)
+	for i := 0; i < n; i++ {
+		for k := 0; k < keys; k++ {
+			trace = append(trace, strconv.Itoa(k))
+		}
+	}
+	return trace
+}
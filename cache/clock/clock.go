@@ -0,0 +1,220 @@
+// Package clock implements CLOCK, the classic approximation of LRU. The
+// entries sit in a ring buffer with a reference bit each, set when they are
+// read. To evict, a hand sweeps the ring: referenced entries lose their bit
+// and are passed over, the first unreferenced one is replaced.
+package clock
+
+// Cache is a CLOCK cache. It is not safe for concurrent access.
+type Cache struct {
+	// MaxEntries is the maximum number of cache entries before
+	// an item is evicted. Zero means no limit.
+	MaxEntries int
+
+	// OnEvicted optionally specifies a callback function to be
+	// executed when an entry is purged from the cache.
+	OnEvicted func(key string, value []byte)
+
+	// OnCapacityEvicted optionally specifies a callback function to be
+	// executed when an entry is evicted to make room, after OnEvicted.
+	// Entries dropped by Remove or Clear are not reported.
+	OnCapacityEvicted func(key string, value []byte)
+
+	// ring holds the entries; free lists the slots emptied by Remove.
+	ring  []slot
+	free  []int
+	cache map[string]int
+	// hand is the slot the next sweep starts from.
+	hand int
+}
+
+type slot struct {
+	key   string
+	value []byte
+	ref   bool
+	used  bool
+}
+
+// New creates a new Cache.
+// If maxEntries is zero, the cache has no limit and it's assumed
+// that eviction is done by the caller.
+func New(maxEntries int) *Cache {
+	return &Cache{
+		MaxEntries: maxEntries,
+		ring:       make([]slot, 0, maxEntries),
+		cache:      make(map[string]int),
+	}
+}
+
+// Add adds a value to the cache.
+func (c *Cache) Add(key string, value []byte) {
+	if c.cache == nil {
+		c.cache = make(map[string]int)
+	}
+	if i, ok := c.cache[key]; ok {
+		c.ring[i].value = value
+		c.ring[i].ref = true
+		return
+	}
+
+	var i int
+	switch {
+	case c.MaxEntries != 0 && c.Len() >= c.MaxEntries:
+		i = c.sweep()
+		c.evict(i)
+	case len(c.free) > 0:
+		i = c.free[len(c.free)-1]
+		c.free = c.free[:len(c.free)-1]
+	default:
+		c.ring = append(c.ring, slot{})
+		i = len(c.ring) - 1
+	}
+	c.ring[i] = slot{key: key, value: value, used: true}
+	c.cache[key] = i
+}
+
+// Get looks up a key's value from the cache.
+func (c *Cache) Get(key string) (value []byte, ok bool) {
+	if c.cache == nil {
+		return
+	}
+	if i, hit := c.cache[key]; hit {
+		c.ring[i].ref = true
+		return c.ring[i].value, true
+	}
+	return
+}
+
+// Peek looks up a key's value without setting its reference bit.
+func (c *Cache) Peek(key string) (value []byte, ok bool) {
+	if c.cache == nil {
+		return
+	}
+	if i, hit := c.cache[key]; hit {
+		return c.ring[i].value, true
+	}
+	return
+}
+
+// Remove removes the provided key from the cache.
+func (c *Cache) Remove(key string) {
+	if c.cache == nil {
+		return
+	}
+	if i, hit := c.cache[key]; hit {
+		delete(c.cache, key)
+		if c.OnEvicted != nil {
+			c.OnEvicted(key, c.ring[i].value)
+		}
+		c.ring[i] = slot{}
+		c.free = append(c.free, i)
+	}
+}
+
+// RemoveOldest evicts the entry the hand stops at.
+func (c *Cache) RemoveOldest() {
+	if c.Len() == 0 {
+		return
+	}
+	i := c.sweep()
+	c.evict(i)
+	c.ring[i] = slot{}
+	c.free = append(c.free, i)
+}
+
+// sweep moves the hand to the first unreferenced entry, clearing the bits
+// it passes, and returns its slot. The hand is left past it.
+func (c *Cache) sweep() int {
+	for {
+		if c.hand >= len(c.ring) {
+			c.hand = 0
+		}
+		s := &c.ring[c.hand]
+		c.hand++
+		if !s.used {
+			continue
+		}
+		if !s.ref {
+			return c.hand - 1
+		}
+		s.ref = false
+	}
+}
+
+func (c *Cache) evict(i int) {
+	s := c.ring[i]
+	delete(c.cache, s.key)
+	if c.OnEvicted != nil {
+		c.OnEvicted(s.key, s.value)
+	}
+	if c.OnCapacityEvicted != nil {
+		c.OnCapacityEvicted(s.key, s.value)
+	}
+}
+
+// Len returns the number of items in the cache.
+func (c *Cache) Len() int {
+	return len(c.cache)
+}
+
+// Clear purges all stored items from the cache.
+func (c *Cache) Clear() {
+	if c.OnEvicted != nil {
+		for _, s := range c.ring {
+			if s.used {
+				c.OnEvicted(s.key, s.value)
+			}
+		}
+	}
+	c.ring = c.ring[:0]
+	c.free = nil
+	c.cache = nil
+	c.hand = 0
+}
+
+// Keys returns the keys of the cache in the order the hand visits them.
+func (c *Cache) Keys() []string {
+	keys := make([]string, 0, c.Len())
+	for n := range c.ring {
+		if s := c.ring[(c.hand+n)%len(c.ring)]; s.used {
+			keys = append(keys, s.key)
+		}
+	}
+	return keys
+}
+
+// Resize changes MaxEntries and evicts the items beyond it. Returns the
+// number of items evicted.
+func (c *Cache) Resize(maxEntries int) int {
+	c.MaxEntries = maxEntries
+	n := 0
+	for maxEntries != 0 && c.Len() > maxEntries {
+		c.RemoveOldest()
+		n++
+	}
+	if len(c.free) > 0 {
+		c.compact()
+	}
+	return n
+}
+
+// compact rebuilds the ring without its free slots, starting at the hand.
+func (c *Cache) compact() {
+	ring := make([]slot, 0, c.MaxEntries)
+	for n := range c.ring {
+		if s := c.ring[(c.hand+n)%len(c.ring)]; s.used {
+			c.cache[s.key] = len(ring)
+			ring = append(ring, s)
+		}
+	}
+	c.ring, c.free, c.hand = ring, nil, 0
+}
+
+// SetOnEvicted sets OnCapacityEvicted, as cache.Cache requires.
+func (c *Cache) SetOnEvicted(fn func(key string, value []byte)) {
+	c.OnCapacityEvicted = fn
+}
+
+// SetOnPurged sets OnEvicted.
+func (c *Cache) SetOnPurged(fn func(key string, value []byte)) {
+	c.OnEvicted = fn
+}
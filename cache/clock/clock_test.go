@@ -0,0 +1,56 @@
+package clock
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/hey-kong/stashlist/cache"
+	"github.com/hey-kong/stashlist/cache/cachetest"
+)
+
+func TestCache(t *testing.T) {
+	cachetest.Run(t, func(size int) cache.Cache { return New(size) })
+}
+
+func TestSecondChance(t *testing.T) {
+	c := New(4)
+	for i := 0; i < 4; i++ {
+		c.Add(strconv.Itoa(i), nil)
+	}
+	c.Get("0")
+	c.Get("2")
+	// the hand passes over 0, clearing its bit, and replaces 1
+	c.Add("4", nil)
+	if _, ok := c.Peek("1"); ok {
+		t.Fatal("the first unreferenced key was not evicted")
+	}
+	if c.ring[1].key != "4" || c.ring[0].ref {
+		t.Fatal("the new key did not take the slot of the evicted one")
+	}
+	// then 2 loses its bit, and 3 goes
+	c.Add("5", nil)
+	if got := c.Keys(); len(got) != 4 || got[0] != "0" || got[3] != "5" {
+		t.Fatal("keys from the hand are", got)
+	}
+}
+
+func TestCompact(t *testing.T) {
+	c := New(8)
+	for i := 0; i < 8; i++ {
+		c.Add(strconv.Itoa(i), nil)
+	}
+	c.Remove("3")
+	c.Remove("6")
+	if n := c.Resize(4); n != 2 || len(c.ring) != 4 || len(c.free) != 0 {
+		t.Fatalf("resize evicted %d and left %d slots", n, len(c.ring))
+	}
+	for _, key := range c.Keys() {
+		if i := c.cache[key]; c.ring[i].key != key {
+			t.Fatal("the index is off after compaction")
+		}
+	}
+	c.Add("8", nil)
+	if c.Len() != 4 {
+		t.Fatal("Len is", c.Len())
+	}
+}
@@ -0,0 +1,347 @@
+// Package clockpro implements CLOCK-Pro, from "CLOCK-Pro: An Effective
+// Improvement of the CLOCK Replacement" by Jiang, Chen and Zhang. It brings
+// the reuse distances of LIRS to CLOCK. Entries are hot, with a short reuse
+// distance, or cold; cold entries are evicted first, but stay on the clock
+// as non-resident test entries for a while. A cold entry reused during its
+// test period becomes hot, and grows the share of the cache given to cold
+// entries, since a larger one would have kept it.
+//
+// Three hands move around a single clock: the cold hand evicts cold entries
+// or promotes the referenced ones, the hot hand demotes unreferenced hot
+// entries, and the test hand ends test periods.
+package clockpro
+
+// Cache is a CLOCK-Pro cache. It is not safe for concurrent access.
+type Cache struct {
+	// MaxEntries is the maximum number of cache entries before
+	// an item is evicted. Zero means no limit.
+	MaxEntries int
+
+	// OnEvicted optionally specifies a callback function to be
+	// executed when an entry is purged from the cache.
+	OnEvicted func(key string, value []byte)
+
+	// OnCapacityEvicted optionally specifies a callback function to be
+	// executed when an entry is evicted to make room, after OnEvicted.
+	// Entries dropped by Remove or Clear are not reported.
+	OnCapacityEvicted func(key string, value []byte)
+
+	cache map[string]*entry
+	// handHot, handCold and handTest are on the clock, nil if it is empty.
+	// New entries are linked just behind handHot.
+	handHot, handCold, handTest *entry
+	countHot, countCold         int
+	countTest                   int
+	// coldTarget is the number of resident cold entries aimed for.
+	coldTarget int
+}
+
+type kind uint8
+
+const (
+	cold kind = iota
+	hot
+	// test is a cold entry evicted during its test period.
+	test
+)
+
+type entry struct {
+	key        string
+	value      []byte
+	kind       kind
+	ref        bool
+	prev, next *entry
+}
+
+// New creates a new Cache.
+// If maxEntries is zero, the cache has no limit and it's assumed
+// that eviction is done by the caller.
+func New(maxEntries int) *Cache {
+	return &Cache{
+		MaxEntries: maxEntries,
+		cache:      make(map[string]*entry),
+		coldTarget: maxEntries,
+	}
+}
+
+// Add adds a value to the cache. A new key enters cold; a key in its test
+// period comes back hot.
+func (c *Cache) Add(key string, value []byte) {
+	if c.cache == nil {
+		c.cache = make(map[string]*entry)
+		c.coldTarget = c.MaxEntries
+	}
+	e, ok := c.cache[key]
+	if ok && e.kind != test {
+		e.value = value
+		e.ref = true
+		return
+	}
+	if !ok {
+		c.link(&entry{key: key, value: value, kind: cold})
+		c.countCold++
+		return
+	}
+	// a reuse within the test period: cold entries deserve more room
+	if c.coldTarget < c.MaxEntries {
+		c.coldTarget++
+	}
+	c.unlink(e)
+	c.countTest--
+	c.link(&entry{key: key, value: value, kind: hot})
+	c.countHot++
+}
+
+// Get looks up a key's value from the cache.
+func (c *Cache) Get(key string) (value []byte, ok bool) {
+	if c.cache == nil {
+		return
+	}
+	if e, hit := c.cache[key]; hit && e.kind != test {
+		e.ref = true
+		return e.value, true
+	}
+	return
+}
+
+// Peek looks up a key's value without setting its reference bit.
+func (c *Cache) Peek(key string) (value []byte, ok bool) {
+	if c.cache == nil {
+		return
+	}
+	if e, hit := c.cache[key]; hit && e.kind != test {
+		return e.value, true
+	}
+	return
+}
+
+// Remove removes the provided key from the cache, ending its test period
+// if it is evicted.
+func (c *Cache) Remove(key string) {
+	if c.cache == nil {
+		return
+	}
+	if e, hit := c.cache[key]; hit {
+		switch e.kind {
+		case hot:
+			c.countHot--
+		case cold:
+			c.countCold--
+		case test:
+			c.countTest--
+		}
+		c.unlink(e)
+		if c.OnEvicted != nil && e.kind != test {
+			c.OnEvicted(e.key, e.value)
+		}
+	}
+}
+
+// RemoveOldest runs the cold hand until it evicts an entry.
+func (c *Cache) RemoveOldest() {
+	if c.Len() == 0 {
+		return
+	}
+	for c.countCold == 0 {
+		// every entry is hot: the hot hand demotes one within two turns
+		c.runHandHot()
+	}
+	for n := c.Len(); c.Len() == n; {
+		c.runHandCold()
+	}
+}
+
+// link makes room for e if the cache is full, then puts e on the clock
+// behind the hot hand.
+func (c *Cache) link(e *entry) {
+	if c.MaxEntries != 0 {
+		for c.countHot+c.countCold >= c.MaxEntries {
+			c.RemoveOldest()
+		}
+	}
+	c.cache[e.key] = e
+	if c.handHot == nil {
+		e.prev, e.next = e, e
+		c.handHot, c.handCold, c.handTest = e, e, e
+		return
+	}
+	e.next = c.handHot
+	e.prev = c.handHot.prev
+	e.prev.next = e
+	c.handHot.prev = e
+	if c.handCold == c.handHot {
+		c.handCold = e
+	}
+}
+
+// unlink takes e off the clock, moving back the hands on it.
+func (c *Cache) unlink(e *entry) {
+	delete(c.cache, e.key)
+	if e.next == e {
+		c.handHot, c.handCold, c.handTest = nil, nil, nil
+		return
+	}
+	if c.handHot == e {
+		c.handHot = e.prev
+	}
+	if c.handCold == e {
+		c.handCold = e.prev
+	}
+	if c.handTest == e {
+		c.handTest = e.prev
+	}
+	e.prev.next = e.next
+	e.next.prev = e.prev
+}
+
+// runHandCold handles the entry under the cold hand, then moves it on. A
+// referenced cold entry is promoted; an unreferenced one is evicted and
+// starts its test period.
+func (c *Cache) runHandCold() {
+	e := c.handCold
+	if e.kind == cold {
+		if e.ref {
+			e.kind = hot
+			e.ref = false
+			c.countCold--
+			c.countHot++
+		} else {
+			value := e.value
+			e.kind = test
+			e.value = nil
+			c.countCold--
+			c.countTest++
+			c.evicted(e.key, value)
+			for c.countTest > c.MaxEntries {
+				c.runHandTest()
+			}
+			if c.handCold == nil {
+				// the clock emptied as test periods ended
+				return
+			}
+		}
+	}
+	c.handCold = c.handCold.next
+	for c.countHot > c.MaxEntries-c.coldTarget {
+		c.runHandHot()
+	}
+}
+
+// evicted reports an entry evicted to make room.
+func (c *Cache) evicted(key string, value []byte) {
+	if c.OnEvicted != nil {
+		c.OnEvicted(key, value)
+	}
+	if c.OnCapacityEvicted != nil {
+		c.OnCapacityEvicted(key, value)
+	}
+}
+
+// runHandHot demotes the hot entry under the hot hand if it was not
+// referenced since the last pass, then moves it on, pushing the test hand
+// ahead of it: test periods the hand goes past end.
+func (c *Cache) runHandHot() {
+	if c.handHot == c.handTest {
+		c.runHandTest()
+		if c.handHot == nil {
+			return
+		}
+	}
+	e := c.handHot
+	if e.kind == hot {
+		if e.ref {
+			e.ref = false
+		} else {
+			e.kind = cold
+			c.countHot--
+			c.countCold++
+		}
+	}
+	c.handHot = c.handHot.next
+}
+
+// runHandTest ends the test period of the entry under the test hand, then
+// moves it on. A test period ending without a reuse shrinks the share of
+// cold entries. Unlike the other hands, it runs no other hand: with a
+// single entry on the clock, the three hands coincide and would run each
+// other forever.
+func (c *Cache) runHandTest() {
+	if e := c.handTest; e.kind == test {
+		c.unlink(e)
+		c.countTest--
+		if c.coldTarget > 1 {
+			c.coldTarget--
+		}
+	}
+	if c.handTest != nil {
+		c.handTest = c.handTest.next
+	}
+}
+
+// Len returns the number of items in the cache.
+func (c *Cache) Len() int {
+	return c.countHot + c.countCold
+}
+
+// Clear purges all stored items from the cache, and ends test periods.
+func (c *Cache) Clear() {
+	if c.OnEvicted != nil {
+		for _, key := range c.Keys() {
+			c.OnEvicted(key, c.cache[key].value)
+		}
+	}
+	c.cache = nil
+	c.handHot, c.handCold, c.handTest = nil, nil, nil
+	c.countHot, c.countCold, c.countTest = 0, 0, 0
+}
+
+// Keys returns the keys of the cache in clock order, from the hot hand.
+func (c *Cache) Keys() []string {
+	keys := make([]string, 0, c.Len())
+	if c.handHot == nil {
+		return keys
+	}
+	e := c.handHot
+	for {
+		if e.kind != test {
+			keys = append(keys, e.key)
+		}
+		if e = e.next; e == c.handHot {
+			return keys
+		}
+	}
+}
+
+// Resize changes MaxEntries and evicts the items beyond it. Returns the
+// number of items evicted.
+func (c *Cache) Resize(maxEntries int) int {
+	c.MaxEntries = maxEntries
+	if maxEntries == 0 {
+		return 0
+	}
+	if c.coldTarget > maxEntries {
+		c.coldTarget = maxEntries
+	}
+	if c.coldTarget < 1 {
+		c.coldTarget = 1
+	}
+	// a sweep of the cold hand may evict more than one entry
+	before := c.Len()
+	for c.Len() > maxEntries {
+		c.RemoveOldest()
+	}
+	for c.countTest > maxEntries {
+		c.runHandTest()
+	}
+	return before - c.Len()
+}
+
+// SetOnEvicted sets OnCapacityEvicted, as cache.Cache requires.
+func (c *Cache) SetOnEvicted(fn func(key string, value []byte)) {
+	c.OnCapacityEvicted = fn
+}
+
+// SetOnPurged sets OnEvicted.
+func (c *Cache) SetOnPurged(fn func(key string, value []byte)) {
+	c.OnEvicted = fn
+}
@@ -0,0 +1,75 @@
+package clockpro
+
+import (
+	"math/rand"
+	"strconv"
+	"testing"
+
+	"github.com/hey-kong/stashlist/cache"
+	"github.com/hey-kong/stashlist/cache/cachetest"
+)
+
+func TestCache(t *testing.T) {
+	cachetest.Run(t, func(size int) cache.Cache { return New(size) })
+}
+
+func TestLoop(t *testing.T) {
+	// CLOCK never hits a loop larger than the cache; the cold keys in test
+	// periods let CLOCK-Pro keep part of it
+	if r := cachetest.HitRatio(New(100), cachetest.Loop(150, 20)); r < 0.4 {
+		t.Fatal("hit ratio of a loop is", r)
+	}
+}
+
+func TestTestPeriod(t *testing.T) {
+	c := New(4)
+	var evicted string
+	c.OnEvicted = func(key string, value []byte) { evicted = key }
+	for i := 0; i < 5; i++ {
+		c.Add(strconv.Itoa(i), nil)
+	}
+	// the evicted key is in its test period
+	if e := c.cache[evicted]; e == nil || e.kind != test || c.countTest != 1 {
+		t.Fatal("the evicted key is not tested")
+	}
+	key := evicted
+	c.Add(key, nil)
+	if e := c.cache[key]; e.kind != hot || c.countHot != 1 {
+		t.Fatal("a key reused in its test period is not hot")
+	}
+	if c.coldTarget > c.MaxEntries {
+		t.Fatal("cold target grew to", c.coldTarget)
+	}
+	if c.Len() != 4 {
+		t.Fatal("Len is", c.Len())
+	}
+}
+
+func TestSingleEntry(t *testing.T) {
+	// the three hands stay on the same entry
+	c := New(1)
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 1000; i++ {
+		key := strconv.Itoa(r.Intn(4))
+		if _, ok := c.Get(key); !ok {
+			c.Add(key, nil)
+		}
+		if c.Len() != 1 || c.countTest > 1 {
+			t.Fatal(c.Len(), "entries and", c.countTest, "test entries")
+		}
+	}
+}
+
+func TestResizeGrowsColdTarget(t *testing.T) {
+	c := New(0)
+	c.Add("a", nil)
+	c.Add("b", nil)
+	c.Resize(2)
+	c.Get("a")
+	c.Get("b")
+	// the cold hand promotes both entries: the hot hand must demote one
+	c.Add("c", nil)
+	if c.Len() != 2 || c.coldTarget < 1 {
+		t.Fatal(c.Len(), "entries with a cold target of", c.coldTarget)
+	}
+}
@@ -0,0 +1,280 @@
+// Package lfu implements an LFU cache with O(1) operations, after "An O(1)
+// algorithm for implementing the LFU cache eviction scheme" by Shah, Mitra
+// and Matani. Entries are grouped in buckets of equal access counts, kept in
+// increasing order, so that the least frequently used entry is always in the
+// first bucket; ties go to the least recently used.
+//
+// Plain LFU never forgets: keys that were popular once stay in the cache
+// long after they stopped being read. Counts are therefore halved
+// periodically, so that the cache follows shifts in popularity.
+package lfu
+
+import "container/list"
+
+// DefaultDecayFactor is the number of accesses between two decays, per
+// entry of the cache, that New sets.
+const DefaultDecayFactor = 10
+
+// Cache is an LFU cache. It is not safe for concurrent access.
+type Cache struct {
+	// MaxEntries is the maximum number of cache entries before
+	// an item is evicted. Zero means no limit.
+	MaxEntries int
+
+	// DecayEvery is the number of accesses, adds and hits, after which
+	// every count is halved. Zero disables the decay.
+	DecayEvery int
+
+	// OnEvicted optionally specifies a callback function to be
+	// executed when an entry is purged from the cache.
+	OnEvicted func(key string, value []byte)
+
+	// OnCapacityEvicted optionally specifies a callback function to be
+	// executed when an entry is evicted to make room, after OnEvicted.
+	// Entries dropped by Remove or Clear are not reported.
+	OnCapacityEvicted func(key string, value []byte)
+
+	// buckets holds the buckets by increasing count.
+	buckets *list.List
+	cache   map[string]*entry
+	// accesses counts the accesses since the last decay.
+	accesses int
+}
+
+// bucket holds the entries of a count, newest in front.
+type bucket struct {
+	count   int
+	entries *list.List
+}
+
+type entry struct {
+	key    string
+	value  []byte
+	bucket *list.Element
+	elem   *list.Element
+}
+
+// New creates a new Cache that decays every DefaultDecayFactor*maxEntries
+// accesses.
+// If maxEntries is zero, the cache has no limit and it's assumed
+// that eviction is done by the caller.
+func New(maxEntries int) *Cache {
+	return &Cache{
+		MaxEntries: maxEntries,
+		DecayEvery: DefaultDecayFactor * maxEntries,
+		buckets:    list.New(),
+		cache:      make(map[string]*entry),
+	}
+}
+
+// Add adds a value to the cache. A new key starts with a count of one.
+func (c *Cache) Add(key string, value []byte) {
+	if c.cache == nil {
+		c.cache = make(map[string]*entry)
+		c.buckets = list.New()
+	}
+	if e, ok := c.cache[key]; ok {
+		e.value = value
+		c.access(e)
+		return
+	}
+	// make room first, so that the new item is not the one evicted
+	if c.MaxEntries != 0 && c.Len() >= c.MaxEntries {
+		c.RemoveOldest()
+	}
+	e := &entry{key: key, value: value}
+	c.cache[key] = e
+	first := c.buckets.Front()
+	if first == nil || first.Value.(*bucket).count != 1 {
+		first = c.buckets.PushFront(&bucket{1, list.New()})
+	}
+	c.put(e, first)
+	c.tick()
+}
+
+// Get looks up a key's value from the cache.
+func (c *Cache) Get(key string) (value []byte, ok bool) {
+	if c.cache == nil {
+		return
+	}
+	if e, hit := c.cache[key]; hit {
+		c.access(e)
+		return e.value, true
+	}
+	return
+}
+
+// access moves e to the bucket of the next count.
+func (c *Cache) access(e *entry) {
+	cur := e.bucket
+	count := cur.Value.(*bucket).count + 1
+	next := cur.Next()
+	if next == nil || next.Value.(*bucket).count != count {
+		next = c.buckets.InsertAfter(&bucket{count, list.New()}, cur)
+	}
+	c.take(e)
+	c.put(e, next)
+	c.tick()
+}
+
+// put adds e in front of bucket b.
+func (c *Cache) put(e *entry, b *list.Element) {
+	e.bucket = b
+	e.elem = b.Value.(*bucket).entries.PushFront(e)
+}
+
+// take removes e from its bucket, dropping the bucket if it empties.
+func (c *Cache) take(e *entry) {
+	entries := e.bucket.Value.(*bucket).entries
+	entries.Remove(e.elem)
+	if entries.Len() == 0 {
+		c.buckets.Remove(e.bucket)
+	}
+	e.bucket, e.elem = nil, nil
+}
+
+// tick counts an access, and decays the counts every DecayEvery.
+func (c *Cache) tick() {
+	if c.DecayEvery <= 0 {
+		return
+	}
+	if c.accesses++; c.accesses >= c.DecayEvery {
+		c.decay()
+	}
+}
+
+// decay halves the counts, keeping them at one at least, and merges the
+// buckets that end up with the same count.
+func (c *Cache) decay() {
+	c.accesses = 0
+	old := c.buckets
+	c.buckets = list.New()
+	for b := old.Front(); b != nil; b = b.Next() {
+		count := b.Value.(*bucket).count / 2
+		if count < 1 {
+			count = 1
+		}
+		last := c.buckets.Back()
+		if last == nil || last.Value.(*bucket).count != count {
+			last = c.buckets.PushBack(&bucket{count, list.New()})
+		}
+		entries := b.Value.(*bucket).entries
+		for ele := entries.Back(); ele != nil; ele = ele.Prev() {
+			c.put(ele.Value.(*entry), last)
+		}
+	}
+}
+
+// Peek looks up a key's value without counting an access.
+func (c *Cache) Peek(key string) (value []byte, ok bool) {
+	if c.cache == nil {
+		return
+	}
+	if e, hit := c.cache[key]; hit {
+		return e.value, true
+	}
+	return
+}
+
+// Count returns the access count of key, as decayed, or 0 if it is not in
+// the cache.
+func (c *Cache) Count(key string) int {
+	if e, hit := c.cache[key]; hit {
+		return e.bucket.Value.(*bucket).count
+	}
+	return 0
+}
+
+// Remove removes the provided key from the cache.
+func (c *Cache) Remove(key string) {
+	if c.cache == nil {
+		return
+	}
+	if e, hit := c.cache[key]; hit {
+		c.take(e)
+		delete(c.cache, key)
+		if c.OnEvicted != nil {
+			c.OnEvicted(e.key, e.value)
+		}
+	}
+}
+
+// RemoveOldest evicts the least frequently used item, the least recently
+// used of them on a tie.
+func (c *Cache) RemoveOldest() {
+	if c.cache == nil {
+		return
+	}
+	first := c.buckets.Front()
+	if first == nil {
+		return
+	}
+	e := first.Value.(*bucket).entries.Back().Value.(*entry)
+	c.take(e)
+	delete(c.cache, e.key)
+	c.evicted(e.key, e.value)
+}
+
+// evicted reports an entry evicted to make room.
+func (c *Cache) evicted(key string, value []byte) {
+	if c.OnEvicted != nil {
+		c.OnEvicted(key, value)
+	}
+	if c.OnCapacityEvicted != nil {
+		c.OnCapacityEvicted(key, value)
+	}
+}
+
+// Len returns the number of items in the cache.
+func (c *Cache) Len() int {
+	return len(c.cache)
+}
+
+// Clear purges all stored items from the cache.
+func (c *Cache) Clear() {
+	if c.OnEvicted != nil {
+		for _, key := range c.Keys() {
+			c.OnEvicted(key, c.cache[key].value)
+		}
+	}
+	c.buckets = nil
+	c.cache = nil
+	c.accesses = 0
+}
+
+// Keys returns the keys of the cache, from the least to the most
+// frequently used.
+func (c *Cache) Keys() []string {
+	keys := make([]string, 0, c.Len())
+	if c.cache == nil {
+		return keys
+	}
+	for b := c.buckets.Front(); b != nil; b = b.Next() {
+		for ele := b.Value.(*bucket).entries.Back(); ele != nil; ele = ele.Prev() {
+			keys = append(keys, ele.Value.(*entry).key)
+		}
+	}
+	return keys
+}
+
+// Resize changes MaxEntries and evicts the items beyond it. Returns the
+// number of items evicted. DecayEvery is left as it is.
+func (c *Cache) Resize(maxEntries int) int {
+	c.MaxEntries = maxEntries
+	n := 0
+	for maxEntries != 0 && c.Len() > maxEntries {
+		c.RemoveOldest()
+		n++
+	}
+	return n
+}
+
+// SetOnEvicted sets OnCapacityEvicted, as cache.Cache requires.
+func (c *Cache) SetOnEvicted(fn func(key string, value []byte)) {
+	c.OnCapacityEvicted = fn
+}
+
+// SetOnPurged sets OnEvicted.
+func (c *Cache) SetOnPurged(fn func(key string, value []byte)) {
+	c.OnEvicted = fn
+}
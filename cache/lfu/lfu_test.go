@@ -0,0 +1,80 @@
+package lfu
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/hey-kong/stashlist/cache"
+	"github.com/hey-kong/stashlist/cache/cachetest"
+)
+
+func TestCache(t *testing.T) {
+	cachetest.Run(t, func(size int) cache.Cache { return New(size) })
+}
+
+func TestFrequency(t *testing.T) {
+	c := New(3)
+	c.DecayEvery = 0
+	c.Add("a", nil)
+	c.Add("b", nil)
+	c.Add("c", nil)
+	c.Get("a")
+	c.Get("a")
+	c.Get("c")
+	// b is the least used
+	c.Add("d", nil)
+	if _, ok := c.Peek("b"); ok {
+		t.Fatal("the least frequently used key was not evicted")
+	}
+	// then d, read less than c
+	c.Add("e", nil)
+	if _, ok := c.Peek("d"); ok {
+		t.Fatal("the least frequently used key was not evicted")
+	}
+	if got := c.Keys(); got[0] != "e" || got[2] != "a" || c.Count("a") != 3 {
+		t.Fatal("keys by frequency are", got)
+	}
+	if c.buckets.Len() != 3 {
+		t.Fatal("there are", c.buckets.Len(), "buckets for 3 counts")
+	}
+}
+
+func TestDecay(t *testing.T) {
+	c := New(10)
+	c.DecayEvery = 0
+	for i := 0; i < 10; i++ {
+		key := strconv.Itoa(i)
+		c.Add(key, nil)
+		for j := 0; j < 20; j++ {
+			c.Get(key)
+		}
+	}
+	// without decay, the old favourites are never displaced
+	for j := 0; j < 5; j++ {
+		for i := 100; i < 105; i++ {
+			if _, ok := c.Get(strconv.Itoa(i)); !ok {
+				c.Add(strconv.Itoa(i), nil)
+			}
+		}
+	}
+	if _, ok := c.Peek("100"); ok {
+		t.Fatal("a new key displaced a frequent one without decay")
+	}
+
+	c.DecayEvery = 50
+	for j := 0; j < 50; j++ {
+		for i := 100; i < 105; i++ {
+			if _, ok := c.Get(strconv.Itoa(i)); !ok {
+				c.Add(strconv.Itoa(i), nil)
+			}
+		}
+	}
+	for i := 100; i < 105; i++ {
+		if _, ok := c.Peek(strconv.Itoa(i)); !ok {
+			t.Fatal("new popular key", i, "is not cached after decays")
+		}
+	}
+	if n := c.Count("0"); n > 2 {
+		t.Fatal("old count is still", n)
+	}
+}
@@ -0,0 +1,353 @@
+// Package lirs implements LIRS, from "LIRS: An Efficient Low Inter-reference
+// Recency Set Replacement Policy" by Jiang and Zhang. Keys whose last two
+// accesses are close (a low inter-reference recency) are LIR and fill most
+// of the cache; the others are HIR and share a small resident part, from
+// which evictions are made.
+//
+// A recency stack S holds the LIR keys and the HIR keys seen since the
+// oldest LIR one, resident or not; a queue Q holds the resident HIR keys. An
+// HIR key accessed while still in S was reused sooner than the oldest LIR
+// key, and takes its place.
+package lirs
+
+import "container/list"
+
+// hirRatio is the share of the cache given to resident HIR keys, in percent.
+const hirRatio = 1
+
+// Cache is a LIRS cache. It is not safe for concurrent access.
+type Cache struct {
+	// MaxEntries is the maximum number of cache entries before
+	// an item is evicted. Zero means no limit.
+	MaxEntries int
+
+	// OnEvicted optionally specifies a callback function to be
+	// executed when an entry is purged from the cache.
+	OnEvicted func(key string, value []byte)
+
+	// OnCapacityEvicted optionally specifies a callback function to be
+	// executed when an entry is evicted to make room, after OnEvicted.
+	// Entries dropped by Remove or Clear are not reported.
+	OnCapacityEvicted func(key string, value []byte)
+
+	// s is the recency stack, top in front. q is the queue of resident HIR
+	// entries, the next to evict in front. ghosts holds the non-resident
+	// entries of s, oldest in front, to bound their number.
+	s, q, ghosts *list.List
+	cache        map[string]*entry
+	resident     int
+	lir          int
+}
+
+type entry struct {
+	key      string
+	value    []byte
+	lir      bool
+	resident bool
+	// s, q and ghost are the elements of the entry in the lists, or nil.
+	s, q, ghost *list.Element
+}
+
+// New creates a new Cache.
+// If maxEntries is zero, the cache has no limit and it's assumed
+// that eviction is done by the caller.
+func New(maxEntries int) *Cache {
+	c := &Cache{MaxEntries: maxEntries}
+	c.init()
+	return c
+}
+
+func (c *Cache) init() {
+	c.s = list.New()
+	c.q = list.New()
+	c.ghosts = list.New()
+	c.cache = make(map[string]*entry)
+	c.resident = 0
+	c.lir = 0
+}
+
+// Add adds a value to the cache.
+func (c *Cache) Add(key string, value []byte) {
+	if c.cache == nil {
+		c.init()
+	}
+	e, ok := c.cache[key]
+	if ok && e.resident {
+		e.value = value
+		c.access(e)
+		return
+	}
+	if c.MaxEntries != 0 && c.resident >= c.MaxEntries {
+		c.RemoveOldest()
+		// the eviction may have pruned the ghost of key
+		e, ok = c.cache[key]
+	}
+	c.resident++
+	if ok {
+		// a non-resident HIR key still in S: it becomes LIR
+		c.ghosts.Remove(e.ghost)
+		e.ghost = nil
+		e.value = value
+		e.resident = true
+		c.s.MoveToFront(e.s)
+		e.lir = true
+		c.lir++
+		c.prune()
+		c.shrinkLIR()
+		return
+	}
+	e = &entry{key: key, value: value, resident: true}
+	c.cache[key] = e
+	e.s = c.s.PushFront(e)
+	if c.lir < c.lirSize() {
+		// the cache is warming up, or a Remove made room: S may hold no
+		// LIR entry yet, only HIR ones
+		e.lir = true
+		c.lir++
+		c.prune()
+		return
+	}
+	e.q = c.q.PushBack(e)
+}
+
+// Get looks up a key's value from the cache.
+func (c *Cache) Get(key string) (value []byte, ok bool) {
+	if c.cache == nil {
+		return
+	}
+	if e, hit := c.cache[key]; hit && e.resident {
+		c.access(e)
+		return e.value, true
+	}
+	return
+}
+
+// access records a hit on the resident entry e.
+func (c *Cache) access(e *entry) {
+	switch {
+	case e.lir:
+		bottom := e.s == c.s.Back()
+		c.s.MoveToFront(e.s)
+		if bottom {
+			c.prune()
+		}
+	case e.s != nil:
+		// reused while in S: sooner than the oldest LIR key
+		c.s.MoveToFront(e.s)
+		c.lirFromQ(e)
+	case c.lir < c.lirSize():
+		// a Remove left room for LIR entries
+		e.s = c.s.PushFront(e)
+		c.lirFromQ(e)
+	default:
+		e.s = c.s.PushFront(e)
+		c.q.MoveToBack(e.q)
+	}
+}
+
+// lirFromQ turns the resident HIR entry e, on top of S, into a LIR entry.
+func (c *Cache) lirFromQ(e *entry) {
+	c.q.Remove(e.q)
+	e.q = nil
+	e.lir = true
+	c.lir++
+	c.prune()
+	c.shrinkLIR()
+}
+
+// Peek looks up a key's value without updating its recency.
+func (c *Cache) Peek(key string) (value []byte, ok bool) {
+	if c.cache == nil {
+		return
+	}
+	if e, hit := c.cache[key]; hit && e.resident {
+		return e.value, true
+	}
+	return
+}
+
+// Remove removes the provided key from the cache, along with its history.
+func (c *Cache) Remove(key string) {
+	if c.cache == nil {
+		return
+	}
+	e, hit := c.cache[key]
+	if !hit {
+		return
+	}
+	delete(c.cache, key)
+	if e.resident {
+		c.resident--
+		if c.OnEvicted != nil {
+			c.OnEvicted(e.key, e.value)
+		}
+	}
+	if e.lir {
+		c.lir--
+	}
+	if e.q != nil {
+		c.q.Remove(e.q)
+	}
+	if e.ghost != nil {
+		c.ghosts.Remove(e.ghost)
+	}
+	if e.s != nil {
+		c.s.Remove(e.s)
+		c.prune()
+	}
+}
+
+// RemoveOldest evicts the resident HIR entry at the front of Q. It stays in
+// S, if it is there, as a non-resident entry.
+func (c *Cache) RemoveOldest() {
+	if c.cache == nil || c.resident == 0 {
+		return
+	}
+	if c.q.Len() == 0 {
+		// every resident entry is LIR, which happens after a Resize
+		c.demote()
+	}
+	e := c.q.Remove(c.q.Front()).(*entry)
+	e.q = nil
+	value := e.value
+	e.value = nil
+	e.resident = false
+	c.resident--
+	if e.s == nil {
+		delete(c.cache, e.key)
+	} else {
+		e.ghost = c.ghosts.PushBack(e)
+		c.trimGhosts()
+	}
+	c.evicted(e.key, value)
+}
+
+// evicted reports an entry evicted to make room.
+func (c *Cache) evicted(key string, value []byte) {
+	if c.OnEvicted != nil {
+		c.OnEvicted(key, value)
+	}
+	if c.OnCapacityEvicted != nil {
+		c.OnCapacityEvicted(key, value)
+	}
+}
+
+// lirSize is the number of LIR entries aimed for. A cache of one entry
+// has no room for a resident HIR entry: its only entry is LIR.
+func (c *Cache) lirSize() int {
+	if c.MaxEntries == 0 {
+		return int(^uint(0) >> 1)
+	}
+	if c.MaxEntries == 1 {
+		return 1
+	}
+	hir := c.MaxEntries * hirRatio / 100
+	if hir < 1 {
+		hir = 1
+	}
+	return c.MaxEntries - hir
+}
+
+// shrinkLIR demotes the oldest LIR entries while there are too many.
+func (c *Cache) shrinkLIR() {
+	for c.lir > c.lirSize() {
+		c.demote()
+	}
+}
+
+// demote turns the LIR entry at the bottom of S into a resident HIR entry,
+// at the back of Q.
+func (c *Cache) demote() {
+	e := c.s.Remove(c.s.Back()).(*entry)
+	e.s = nil
+	e.lir = false
+	c.lir--
+	e.q = c.q.PushBack(e)
+	c.prune()
+}
+
+// prune removes the HIR entries from the bottom of S, so that it ends with
+// a LIR entry. The non-resident ones are forgotten.
+func (c *Cache) prune() {
+	for back := c.s.Back(); back != nil && !back.Value.(*entry).lir; back = c.s.Back() {
+		e := c.s.Remove(back).(*entry)
+		e.s = nil
+		if !e.resident {
+			c.ghosts.Remove(e.ghost)
+			delete(c.cache, e.key)
+		}
+	}
+}
+
+// trimGhosts forgets the oldest non-resident entries beyond MaxEntries.
+func (c *Cache) trimGhosts() {
+	for c.ghosts.Len() > c.MaxEntries {
+		e := c.ghosts.Remove(c.ghosts.Front()).(*entry)
+		c.s.Remove(e.s)
+		delete(c.cache, e.key)
+	}
+}
+
+// Len returns the number of items in the cache.
+func (c *Cache) Len() int {
+	return c.resident
+}
+
+// Clear purges all stored items from the cache, along with their history.
+func (c *Cache) Clear() {
+	if c.OnEvicted != nil {
+		for _, key := range c.Keys() {
+			c.OnEvicted(key, c.cache[key].value)
+		}
+	}
+	c.cache = nil
+	c.resident = 0
+	c.lir = 0
+}
+
+// Keys returns the keys of the cache: those in S from the bottom up, then
+// the resident HIR keys out of S, in queue order.
+func (c *Cache) Keys() []string {
+	keys := make([]string, 0, c.Len())
+	if c.cache == nil {
+		return keys
+	}
+	for ele := c.s.Back(); ele != nil; ele = ele.Prev() {
+		if e := ele.Value.(*entry); e.resident {
+			keys = append(keys, e.key)
+		}
+	}
+	for ele := c.q.Front(); ele != nil; ele = ele.Next() {
+		if e := ele.Value.(*entry); e.s == nil {
+			keys = append(keys, e.key)
+		}
+	}
+	return keys
+}
+
+// Resize changes MaxEntries and evicts the items beyond it. Returns the
+// number of items evicted.
+func (c *Cache) Resize(maxEntries int) int {
+	c.MaxEntries = maxEntries
+	if maxEntries == 0 || c.cache == nil {
+		return 0
+	}
+	n := 0
+	for c.resident > maxEntries {
+		c.RemoveOldest()
+		n++
+	}
+	c.shrinkLIR()
+	c.trimGhosts()
+	return n
+}
+
+// SetOnEvicted sets OnCapacityEvicted, as cache.Cache requires.
+func (c *Cache) SetOnEvicted(fn func(key string, value []byte)) {
+	c.OnCapacityEvicted = fn
+}
+
+// SetOnPurged sets OnEvicted.
+func (c *Cache) SetOnPurged(fn func(key string, value []byte)) {
+	c.OnEvicted = fn
+}
@@ -0,0 +1,72 @@
+package lirs
+
+import (
+	"math/rand"
+	"strconv"
+	"testing"
+
+	"github.com/hey-kong/stashlist/cache"
+	"github.com/hey-kong/stashlist/cache/cachetest"
+)
+
+func TestCache(t *testing.T) {
+	cachetest.Run(t, func(size int) cache.Cache { return New(size) })
+}
+
+func TestLoop(t *testing.T) {
+	// LRU never hits a loop larger than the cache; LIRS keeps its LIR keys
+	// resident while the rest of the loop cycles through the HIR slots
+	if r := cachetest.HitRatio(New(100), cachetest.Loop(150, 20)); r < 0.6 {
+		t.Fatal("hit ratio of a loop is", r)
+	}
+}
+
+func TestHistory(t *testing.T) {
+	for _, size := range []int{1, 2, 4, 50} {
+		c := New(size)
+		r := rand.New(rand.NewSource(1))
+		for i := 0; i < 100*size+1000; i++ {
+			key := strconv.Itoa(r.Intn(4 * size))
+			if _, ok := c.Get(key); !ok {
+				c.Add(key, nil)
+			}
+			if i%7 == 0 {
+				c.Remove(strconv.Itoa(r.Intn(4 * size)))
+			}
+			checkInvariants(t, c, size)
+		}
+	}
+}
+
+func TestRemoveThenWarmUp(t *testing.T) {
+	c := New(2)
+	for _, key := range []string{"0", "1", "3"} {
+		c.Add(key, nil)
+	}
+	// the only LIR entry goes: the next new ones are LIR again, above the
+	// HIR entries left in S
+	c.Remove("0")
+	for _, key := range []string{"3", "4", "0", "0"} {
+		c.Add(key, nil)
+		checkInvariants(t, c, 2)
+	}
+	if keys := c.Keys(); len(keys) != c.Len() || c.Len() != 2 {
+		t.Fatal("keys", keys, "for a length of", c.Len())
+	}
+}
+
+func checkInvariants(t *testing.T, c *Cache, size int) {
+	t.Helper()
+	if c.ghosts.Len() > size || len(c.cache) != c.resident+c.ghosts.Len() {
+		t.Fatalf("size %d: %d entries, %d resident and %d ghosts", size, len(c.cache), c.resident, c.ghosts.Len())
+	}
+	if c.lir > c.lirSize() || c.resident != c.lir+c.q.Len() || c.resident > size {
+		t.Fatalf("size %d: %d resident, %d LIR and %d HIR", size, c.resident, c.lir, c.q.Len())
+	}
+	if back := c.s.Back(); back != nil && !back.Value.(*entry).lir {
+		t.Fatalf("size %d: the bottom of S is HIR", size)
+	}
+	if keys := c.Keys(); len(keys) != c.resident {
+		t.Fatalf("size %d: %d keys for %d resident entries", size, len(keys), c.resident)
+	}
+}
@@ -28,6 +28,11 @@ type Cache struct {
 	// executed when an entry is purged from the cache.
 	OnEvicted func(key string, value []byte)
 
+	// OnCapacityEvicted optionally specifies a callback function to be
+	// executed when an entry is evicted to make room, after OnEvicted.
+	// Entries dropped by Remove or Clear are not reported.
+	OnCapacityEvicted func(key string, value []byte)
+
 	ll    *list.List
 	cache map[interface{}]*list.Element
 }
@@ -88,24 +93,32 @@ func (c *Cache) Remove(key string) {
 	}
 }
 
-// RemoveOldest removes the oldest item from the cache.
+// RemoveOldest evicts the oldest item from the cache.
 func (c *Cache) RemoveOldest() {
 	if c.cache == nil {
 		return
 	}
 	ele := c.ll.Back()
 	if ele != nil {
-		c.removeElement(ele)
+		c.evict(ele)
 	}
 }
 
-func (c *Cache) removeElement(e *list.Element) {
+func (c *Cache) evict(e *list.Element) {
+	kv := c.removeElement(e)
+	if c.OnCapacityEvicted != nil {
+		c.OnCapacityEvicted(kv.key, kv.value)
+	}
+}
+
+func (c *Cache) removeElement(e *list.Element) *entry {
 	c.ll.Remove(e)
 	kv := e.Value.(*entry)
 	delete(c.cache, kv.key)
 	if c.OnEvicted != nil {
 		c.OnEvicted(kv.key, kv.value)
 	}
+	return kv
 }
 
 // Len returns the number of items in the cache.
@@ -127,3 +140,48 @@ func (c *Cache) Clear() {
 	c.ll = nil
 	c.cache = nil
 }
+
+// Peek looks up a key's value without updating its recency.
+func (c *Cache) Peek(key string) (value []byte, ok bool) {
+	if c.cache == nil {
+		return
+	}
+	if ele, hit := c.cache[key]; hit {
+		return ele.Value.(*entry).value, true
+	}
+	return
+}
+
+// Keys returns the keys of the cache, from the oldest to the newest.
+func (c *Cache) Keys() []string {
+	keys := make([]string, 0, c.Len())
+	if c.cache == nil {
+		return keys
+	}
+	for ele := c.ll.Back(); ele != nil; ele = ele.Prev() {
+		keys = append(keys, ele.Value.(*entry).key)
+	}
+	return keys
+}
+
+// Resize changes MaxEntries and evicts the items beyond it. Returns the
+// number of items evicted.
+func (c *Cache) Resize(maxEntries int) int {
+	c.MaxEntries = maxEntries
+	n := 0
+	for maxEntries != 0 && c.Len() > maxEntries {
+		c.RemoveOldest()
+		n++
+	}
+	return n
+}
+
+// SetOnEvicted sets OnCapacityEvicted, as cache.Cache requires.
+func (c *Cache) SetOnEvicted(fn func(key string, value []byte)) {
+	c.OnCapacityEvicted = fn
+}
+
+// SetOnPurged sets OnEvicted.
+func (c *Cache) SetOnPurged(fn func(key string, value []byte)) {
+	c.OnEvicted = fn
+}
@@ -0,0 +1,147 @@
+// Package opt computes the hit ratio of Belady's optimal policy on a trace.
+// Knowing every future request, OPT evicts the key whose next use is the
+// furthest away. No online policy does better, so OPT is the reference the
+// hit ratios of the other policies are measured against.
+//
+//	results := opt.Simulate(trace, 100, 1000, 10000)
+//	fmt.Println(results[0].HitRatio())
+package opt
+
+import "container/heap"
+
+// never is the next use of a key that is not requested again.
+const never = int(^uint(0) >> 1)
+
+// Result is the outcome of the optimal policy for a cache size.
+type Result struct {
+	Size     int
+	Requests int
+	Hits     int
+}
+
+// HitRatio returns the share of the requests that were hits.
+func (r Result) HitRatio() float64 {
+	if r.Requests == 0 {
+		return 0
+	}
+	return float64(r.Hits) / float64(r.Requests)
+}
+
+// Trace is a trace prepared for simulations: its keys are numbered, and the
+// position of the next request of the key is known for every request.
+type Trace struct {
+	ids  []int32
+	next []int
+	keys int
+}
+
+// NewTrace prepares the requests of trace, in order, given by their keys.
+func NewTrace(trace []string) *Trace {
+	t := &Trace{ids: make([]int32, len(trace)), next: make([]int, len(trace))}
+	ids := make(map[string]int32)
+	for i, key := range trace {
+		id, ok := ids[key]
+		if !ok {
+			id = int32(len(ids))
+			ids[key] = id
+		}
+		t.ids[i] = id
+	}
+	t.keys = len(ids)
+
+	last := make([]int, t.keys)
+	for i := range last {
+		last[i] = never
+	}
+	for i := len(t.ids) - 1; i >= 0; i-- {
+		id := t.ids[i]
+		t.next[i] = last[id]
+		last[id] = i
+	}
+	return t
+}
+
+// Len returns the number of requests of the trace.
+func (t *Trace) Len() int {
+	return len(t.ids)
+}
+
+// Keys returns the number of distinct keys of the trace.
+func (t *Trace) Keys() int {
+	return t.keys
+}
+
+// NextUse returns the position of the next request of the key requested at
+// i, or -1 if there is none.
+func (t *Trace) NextUse(i int) int {
+	if t.next[i] == never {
+		return -1
+	}
+	return t.next[i]
+}
+
+// Simulate replays trace with the optimal policy for each of sizes.
+func Simulate(trace []string, sizes ...int) []Result {
+	t := NewTrace(trace)
+	results := make([]Result, len(sizes))
+	for i, size := range sizes {
+		results[i] = t.Simulate(size)
+	}
+	return results
+}
+
+// Simulate replays the trace with the optimal policy in a cache of size
+// keys.
+func (t *Trace) Simulate(size int) Result {
+	r := Result{Size: size, Requests: len(t.ids)}
+	if size <= 0 {
+		return r
+	}
+	// cached holds the next use of the cached keys, -1 for the others. The
+	// heap may hold outdated next uses, skipped when they come up.
+	cached := make([]int, t.keys)
+	for i := range cached {
+		cached[i] = -1
+	}
+	h := &uses{}
+	n := 0
+	for i, id := range t.ids {
+		if cached[id] >= 0 {
+			r.Hits++
+		} else if n < size {
+			n++
+		} else {
+			for {
+				u := heap.Pop(h).(use)
+				if cached[u.id] == u.next {
+					cached[u.id] = -1
+					break
+				}
+			}
+		}
+		cached[id] = t.next[i]
+		heap.Push(h, use{t.next[i], id})
+	}
+	return r
+}
+
+// use is a cached key and its next use.
+type use struct {
+	next int
+	id   int32
+}
+
+// uses is a max-heap of uses by next use.
+type uses []use
+
+func (h uses) Len() int           { return len(h) }
+func (h uses) Less(i, j int) bool { return h[i].next > h[j].next }
+func (h uses) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *uses) Push(x any)        { *h = append(*h, x.(use)) }
+
+func (h *uses) Pop() any {
+	old := *h
+	u := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return u
+}
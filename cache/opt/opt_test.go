@@ -0,0 +1,56 @@
+package opt
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/hey-kong/stashlist/cache"
+	"github.com/hey-kong/stashlist/cache/cachetest"
+	"github.com/hey-kong/stashlist/cache/lru"
+	"github.com/hey-kong/stashlist/cache/sieve"
+)
+
+func TestNextUse(t *testing.T) {
+	tr := NewTrace(strings.Split("a b a c b a", " "))
+	want := []int{2, 4, 5, -1, -1, -1}
+	for i, w := range want {
+		if got := tr.NextUse(i); got != w {
+			t.Fatalf("NextUse(%d) = %d, want %d", i, got, w)
+		}
+	}
+	if tr.Len() != 6 || tr.Keys() != 3 {
+		t.Fatal(tr.Len(), "requests of", tr.Keys(), "keys")
+	}
+}
+
+func TestSimulate(t *testing.T) {
+	// with room for 2, OPT evicts b for c, as b comes back after a
+	trace := strings.Split("a b c a b c a b", " ")
+	results := Simulate(trace, 0, 1, 2, 3)
+	for i, hits := range []int{0, 0, 3, 5} {
+		if results[i].Hits != hits || results[i].Requests != len(trace) {
+			t.Fatalf("size %d: %d hits, want %d", results[i].Size, results[i].Hits, hits)
+		}
+	}
+}
+
+func TestBound(t *testing.T) {
+	trace := cachetest.Zipf(1, 1.1, 10000, 100000)
+	tr := NewTrace(trace)
+	prev := 0.0
+	for _, size := range []int{10, 100, 1000} {
+		o := tr.Simulate(size).HitRatio()
+		for name, c := range map[string]cache.Cache{"lru": lru.New(size), "sieve": sieve.New(size)} {
+			if h := cachetest.HitRatio(c, trace); h > o {
+				t.Fatalf("size %d: %s hit ratio %.4f above OPT %.4f", size, name, h, o)
+			}
+		}
+		if o < prev {
+			t.Fatal("OPT hit ratio fell with a larger cache")
+		}
+		prev = o
+	}
+	if r := tr.Simulate(tr.Keys()); r.Hits != tr.Len()-tr.Keys() {
+		t.Fatal("a cache holding every key missed", r.Requests-r.Hits, "times")
+	}
+}
@@ -0,0 +1,282 @@
+// Package s3fifo implements S3-FIFO, from "FIFO queues are all you need for
+// cache eviction" by Yang et al. New keys enter a small FIFO queue, where
+// most of them, seen once, are soon evicted. The keys read while in the
+// small queue move to a main FIFO queue, which evicts like CLOCK with a 2-bit
+// frequency. A ghost queue remembers the keys evicted from the small queue,
+// so that they go straight to the main queue if they come back.
+package s3fifo
+
+import "container/list"
+
+const (
+	// maxFreq caps the access count of an entry.
+	maxFreq = 3
+	// smallRatio is the share of the cache given to the small queue, in
+	// percent.
+	smallRatio = 10
+)
+
+// Cache is an S3-FIFO cache. It is not safe for concurrent access.
+type Cache struct {
+	// MaxEntries is the maximum number of cache entries before
+	// an item is evicted. Zero means no limit.
+	MaxEntries int
+
+	// OnEvicted optionally specifies a callback function to be
+	// executed when an entry is purged from the cache.
+	OnEvicted func(key string, value []byte)
+
+	// OnCapacityEvicted optionally specifies a callback function to be
+	// executed when an entry is evicted to make room, after OnEvicted.
+	// Entries dropped by Remove or Clear are not reported.
+	OnCapacityEvicted func(key string, value []byte)
+
+	// small and main hold the entries, newest in front.
+	small, main *list.List
+	cache       map[string]*list.Element
+	// ghost holds the keys evicted from small, newest in front.
+	ghost  *list.List
+	ghosts map[string]*list.Element
+}
+
+type entry struct {
+	key   string
+	value []byte
+	freq  uint8
+	// ll is the queue holding the entry.
+	ll *list.List
+}
+
+// New creates a new Cache.
+// If maxEntries is zero, the cache has no limit and it's assumed
+// that eviction is done by the caller.
+func New(maxEntries int) *Cache {
+	c := &Cache{MaxEntries: maxEntries}
+	c.init()
+	return c
+}
+
+func (c *Cache) init() {
+	c.small = list.New()
+	c.main = list.New()
+	c.cache = make(map[string]*list.Element)
+	c.ghost = list.New()
+	c.ghosts = make(map[string]*list.Element)
+}
+
+// Add adds a value to the cache. A key evicted recently from the small
+// queue enters the main queue.
+func (c *Cache) Add(key string, value []byte) {
+	if c.cache == nil {
+		c.init()
+	}
+	if ee, ok := c.cache[key]; ok {
+		kv := ee.Value.(*entry)
+		kv.value = value
+		if kv.freq < maxFreq {
+			kv.freq++
+		}
+		return
+	}
+	// make room first, so that the new item is not the one evicted
+	if c.MaxEntries != 0 && c.Len() >= c.MaxEntries {
+		c.RemoveOldest()
+	}
+	ll := c.small
+	if g, ok := c.ghosts[key]; ok {
+		c.ghost.Remove(g)
+		delete(c.ghosts, key)
+		ll = c.main
+	}
+	c.cache[key] = ll.PushFront(&entry{key, value, 0, ll})
+}
+
+// Get looks up a key's value from the cache.
+func (c *Cache) Get(key string) (value []byte, ok bool) {
+	if c.cache == nil {
+		return
+	}
+	if ele, hit := c.cache[key]; hit {
+		kv := ele.Value.(*entry)
+		if kv.freq < maxFreq {
+			kv.freq++
+		}
+		return kv.value, true
+	}
+	return
+}
+
+// Peek looks up a key's value without counting an access.
+func (c *Cache) Peek(key string) (value []byte, ok bool) {
+	if c.cache == nil {
+		return
+	}
+	if ele, hit := c.cache[key]; hit {
+		return ele.Value.(*entry).value, true
+	}
+	return
+}
+
+// Remove removes the provided key from the cache, and forgets it was
+// evicted.
+func (c *Cache) Remove(key string) {
+	if c.cache == nil {
+		return
+	}
+	if ele, hit := c.cache[key]; hit {
+		kv := c.removeElement(ele)
+		if c.OnEvicted != nil {
+			c.OnEvicted(kv.key, kv.value)
+		}
+	}
+	if g, ok := c.ghosts[key]; ok {
+		c.ghost.Remove(g)
+		delete(c.ghosts, key)
+	}
+}
+
+// RemoveOldest evicts an item from the cache. The small queue is evicted
+// from while it holds its share of the cache: its oldest entry moves to the
+// main queue if it was read, or leaves, its key joining the ghosts. Else the
+// oldest entry of the main queue is evicted, unless it was read, in which
+// case it is reinserted with its count decremented.
+func (c *Cache) RemoveOldest() {
+	if c.cache == nil {
+		return
+	}
+	for {
+		if c.small.Len() > 0 && (c.small.Len() >= c.smallSize() || c.main.Len() == 0) {
+			ele := c.small.Back()
+			kv := ele.Value.(*entry)
+			if kv.freq > 0 {
+				kv.freq = 0
+				c.small.Remove(ele)
+				kv.ll = c.main
+				c.cache[kv.key] = c.main.PushFront(kv)
+				continue
+			}
+			c.removeElement(ele)
+			c.addGhost(kv.key)
+			c.evicted(kv)
+			return
+		}
+		ele := c.main.Back()
+		if ele == nil {
+			return
+		}
+		kv := ele.Value.(*entry)
+		if kv.freq > 0 {
+			kv.freq--
+			c.main.MoveToFront(ele)
+			continue
+		}
+		c.removeElement(ele)
+		c.evicted(kv)
+		return
+	}
+}
+
+// smallSize is the target length of the small queue.
+func (c *Cache) smallSize() int {
+	if n := c.MaxEntries * smallRatio / 100; n > 1 {
+		return n
+	}
+	return 1
+}
+
+// ghostSize is the number of ghosts kept: as many as the main queue holds.
+func (c *Cache) ghostSize() int {
+	if n := c.MaxEntries - c.smallSize(); n > 1 {
+		return n
+	}
+	return 1
+}
+
+func (c *Cache) addGhost(key string) {
+	c.ghosts[key] = c.ghost.PushFront(key)
+	c.trimGhosts()
+}
+
+func (c *Cache) trimGhosts() {
+	for c.ghost.Len() > c.ghostSize() {
+		g := c.ghost.Back()
+		c.ghost.Remove(g)
+		delete(c.ghosts, g.Value.(string))
+	}
+}
+
+// evicted reports an entry evicted to make room.
+func (c *Cache) evicted(kv *entry) {
+	if c.OnEvicted != nil {
+		c.OnEvicted(kv.key, kv.value)
+	}
+	if c.OnCapacityEvicted != nil {
+		c.OnCapacityEvicted(kv.key, kv.value)
+	}
+}
+
+func (c *Cache) removeElement(e *list.Element) *entry {
+	kv := e.Value.(*entry)
+	kv.ll.Remove(e)
+	delete(c.cache, kv.key)
+	return kv
+}
+
+// Len returns the number of items in the cache.
+func (c *Cache) Len() int {
+	if c.cache == nil {
+		return 0
+	}
+	return c.small.Len() + c.main.Len()
+}
+
+// Clear purges all stored items from the cache, ghosts included.
+func (c *Cache) Clear() {
+	if c.OnEvicted != nil {
+		for _, key := range c.Keys() {
+			c.OnEvicted(key, c.cache[key].Value.(*entry).value)
+		}
+	}
+	c.cache = nil
+}
+
+// Keys returns the keys of the cache: those of the small queue then those
+// of the main queue, each from the oldest to the newest.
+func (c *Cache) Keys() []string {
+	keys := make([]string, 0, c.Len())
+	if c.cache == nil {
+		return keys
+	}
+	for _, l := range []*list.List{c.small, c.main} {
+		for ele := l.Back(); ele != nil; ele = ele.Prev() {
+			keys = append(keys, ele.Value.(*entry).key)
+		}
+	}
+	return keys
+}
+
+// Resize changes MaxEntries and evicts the items beyond it. Returns the
+// number of items evicted.
+func (c *Cache) Resize(maxEntries int) int {
+	c.MaxEntries = maxEntries
+	if maxEntries == 0 || c.cache == nil {
+		return 0
+	}
+	n := 0
+	for c.Len() > maxEntries {
+		c.RemoveOldest()
+		n++
+	}
+	c.trimGhosts()
+	return n
+}
+
+// SetOnEvicted sets OnCapacityEvicted, as cache.Cache requires.
+func (c *Cache) SetOnEvicted(fn func(key string, value []byte)) {
+	c.OnCapacityEvicted = fn
+}
+
+// SetOnPurged sets OnEvicted.
+func (c *Cache) SetOnPurged(fn func(key string, value []byte)) {
+	c.OnEvicted = fn
+}
@@ -0,0 +1,61 @@
+package s3fifo
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/hey-kong/stashlist"
+	"github.com/hey-kong/stashlist/cache"
+	"github.com/hey-kong/stashlist/cache/cachetest"
+	"github.com/hey-kong/stashlist/cache/lru"
+	"github.com/hey-kong/stashlist/cache/sieve"
+)
+
+func TestCache(t *testing.T) {
+	cachetest.Run(t, func(size int) cache.Cache { return New(size) })
+}
+
+func TestHitRatio(t *testing.T) {
+	const keys = 20000
+	for _, s := range []float64{1.01, 1.2} {
+		trace := cachetest.Zipf(1, s, keys, 100000)
+		for _, size := range []int{keys / 1000, keys / 100, keys / 10} {
+			s3 := cachetest.HitRatio(New(size), trace)
+			l := cachetest.HitRatio(lru.New(size), trace)
+			sv := cachetest.HitRatio(sieve.New(size), trace)
+			list := stashlist.NewStashList()
+			list.MaxEntries = size
+			sl := cachetest.HitRatio(cache.FromStashList(list), trace)
+			t.Logf("zipf %.2f, size %d: s3fifo %.4f, lru %.4f, sieve %.4f, stashlist %.4f", s, size, s3, l, sv, sl)
+			if s3 < l {
+				t.Errorf("zipf %.2f, size %d: s3fifo hit ratio %.4f below lru %.4f", s, size, s3, l)
+			}
+		}
+	}
+}
+
+func TestScan(t *testing.T) {
+	c := New(100)
+	for i := 0; i < 50; i++ {
+		c.Add(strconv.Itoa(i), nil)
+		c.Get(strconv.Itoa(i))
+	}
+	// keys seen once pass through the small queue only
+	for i := 1000; i < 2000; i++ {
+		c.Add(strconv.Itoa(i), nil)
+	}
+	for i := 0; i < 50; i++ {
+		if _, ok := c.Peek(strconv.Itoa(i)); !ok {
+			t.Fatalf("%d was flushed by the scan", i)
+		}
+	}
+	if c.main.Len() != 50 || c.ghost.Len() != c.ghostSize() {
+		t.Fatalf("main queue holds %d keys and the ghosts %d", c.main.Len(), c.ghost.Len())
+	}
+
+	// an evicted key comes back to the main queue
+	c.Add("1900", nil)
+	if ele := c.cache["1900"]; ele.Value.(*entry).ll != c.main {
+		t.Fatal("a ghost was added to the small queue")
+	}
+}
@@ -18,7 +18,7 @@ limitations under the License.
 
 import "container/list"
 
-// Cache is an LRU cache. It is not safe for concurrent access.
+// Cache is a SIEVE cache. It is not safe for concurrent access.
 type Cache struct {
 	// MaxEntries is the maximum number of cache entries before
 	// an item is evicted. Zero means no limit.
@@ -28,6 +28,11 @@ type Cache struct {
 	// executed when an entry is purged from the cache.
 	OnEvicted func(key string, value []byte)
 
+	// OnCapacityEvicted optionally specifies a callback function to be
+	// executed when an entry is evicted to make room, after OnEvicted.
+	// Entries dropped by Remove or Clear are not reported.
+	OnCapacityEvicted func(key string, value []byte)
+
 	ptr   *list.Element
 	ll    *list.List
 	cache map[interface{}]*list.Element
@@ -63,11 +68,12 @@ func (c *Cache) Add(key string, value []byte) {
 		ee.Value.(*entry).value = value
 		return
 	}
-	ele := c.ll.PushFront(&entry{key, value, false})
-	c.cache[key] = ele
-	if c.MaxEntries != 0 && c.ll.Len() > c.MaxEntries {
+	// make room first, so that the new item is not the one evicted
+	if c.MaxEntries != 0 && c.ll.Len() >= c.MaxEntries {
 		c.RemoveOldest()
 	}
+	ele := c.ll.PushFront(&entry{key, value, false})
+	c.cache[key] = ele
 }
 
 // Get looks up a key's value from the cache.
@@ -92,33 +98,45 @@ func (c *Cache) Remove(key string) {
 	}
 }
 
-// RemoveOldest removes the oldest item from the cache.
+// RemoveOldest evicts an item from the cache. The hand moves from the
+// oldest item towards the newest, wrapping around: visited items lose
+// their mark and are spared, the first unvisited one is evicted.
 func (c *Cache) RemoveOldest() {
-	if c.cache == nil {
+	if c.cache == nil || c.ll.Len() == 0 {
 		return
 	}
 	ele := c.ptr
 	if ele == nil {
 		ele = c.ll.Back()
 	}
-	for ele != nil && ele.Value.(*entry).visited {
+	for ele.Value.(*entry).visited {
 		ele.Value.(*entry).visited = false
-		ele = ele.Prev()
-	}
-	if ele == nil {
-		println("Error: RemoveOldest cannot find element")
+		if ele = ele.Prev(); ele == nil {
+			ele = c.ll.Back()
+		}
 	}
 	c.ptr = ele.Prev()
-	c.removeElement(ele)
+	c.evict(ele)
 }
 
-func (c *Cache) removeElement(e *list.Element) {
+func (c *Cache) evict(e *list.Element) {
+	kv := c.removeElement(e)
+	if c.OnCapacityEvicted != nil {
+		c.OnCapacityEvicted(kv.key, kv.value)
+	}
+}
+
+func (c *Cache) removeElement(e *list.Element) *entry {
+	if e == c.ptr {
+		c.ptr = e.Prev()
+	}
 	c.ll.Remove(e)
 	kv := e.Value.(*entry)
 	delete(c.cache, kv.key)
 	if c.OnEvicted != nil {
 		c.OnEvicted(kv.key, kv.value)
 	}
+	return kv
 }
 
 // Len returns the number of items in the cache.
@@ -139,4 +157,50 @@ func (c *Cache) Clear() {
 	}
 	c.ll = nil
 	c.cache = nil
+	c.ptr = nil
+}
+
+// Peek looks up a key's value without marking it visited.
+func (c *Cache) Peek(key string) (value []byte, ok bool) {
+	if c.cache == nil {
+		return
+	}
+	if ele, hit := c.cache[key]; hit {
+		return ele.Value.(*entry).value, true
+	}
+	return
+}
+
+// Keys returns the keys of the cache, from the oldest to the newest.
+func (c *Cache) Keys() []string {
+	keys := make([]string, 0, c.Len())
+	if c.cache == nil {
+		return keys
+	}
+	for ele := c.ll.Back(); ele != nil; ele = ele.Prev() {
+		keys = append(keys, ele.Value.(*entry).key)
+	}
+	return keys
+}
+
+// Resize changes MaxEntries and evicts the items beyond it. Returns the
+// number of items evicted.
+func (c *Cache) Resize(maxEntries int) int {
+	c.MaxEntries = maxEntries
+	n := 0
+	for maxEntries != 0 && c.Len() > maxEntries {
+		c.RemoveOldest()
+		n++
+	}
+	return n
+}
+
+// SetOnEvicted sets OnCapacityEvicted, as cache.Cache requires.
+func (c *Cache) SetOnEvicted(fn func(key string, value []byte)) {
+	c.OnCapacityEvicted = fn
+}
+
+// SetOnPurged sets OnEvicted.
+func (c *Cache) SetOnPurged(fn func(key string, value []byte)) {
+	c.OnEvicted = fn
 }
@@ -0,0 +1,235 @@
+// Package slru implements a segmented LRU cache. New keys enter a
+// probationary segment; keys read while on probation move to a protected
+// segment, whose oldest keys fall back to probation when it is full.
+// Evictions are made from probation, so that keys read once cannot push
+// out the keys read repeatedly.
+package slru
+
+import "container/list"
+
+// DefaultProtectedRatio is the share of the cache New gives to the
+// protected segment.
+const DefaultProtectedRatio = 0.8
+
+// Cache is a segmented LRU cache. It is not safe for concurrent access.
+type Cache struct {
+	// MaxEntries is the maximum number of cache entries before
+	// an item is evicted. Zero means no limit.
+	MaxEntries int
+
+	// ProtectedRatio is the share of MaxEntries the protected segment may
+	// hold, between 0 and 1; the probationary segment holds the rest.
+	ProtectedRatio float64
+
+	// OnEvicted optionally specifies a callback function to be
+	// executed when an entry is purged from the cache.
+	OnEvicted func(key string, value []byte)
+
+	// OnCapacityEvicted optionally specifies a callback function to be
+	// executed when an entry is evicted to make room, after OnEvicted.
+	// Entries dropped by Remove or Clear are not reported.
+	OnCapacityEvicted func(key string, value []byte)
+
+	// probation and protected hold the entries, newest in front.
+	probation, protected *list.List
+	cache                map[string]*list.Element
+}
+
+type entry struct {
+	key       string
+	value     []byte
+	protected bool
+}
+
+// New creates a new Cache.
+// If maxEntries is zero, the cache has no limit and it's assumed
+// that eviction is done by the caller.
+func New(maxEntries int) *Cache {
+	return &Cache{
+		MaxEntries:     maxEntries,
+		ProtectedRatio: DefaultProtectedRatio,
+		probation:      list.New(),
+		protected:      list.New(),
+		cache:          make(map[string]*list.Element),
+	}
+}
+
+// Add adds a value to the cache, on probation if the key is new.
+func (c *Cache) Add(key string, value []byte) {
+	if c.cache == nil {
+		c.cache = make(map[string]*list.Element)
+		c.probation = list.New()
+		c.protected = list.New()
+	}
+	if ee, ok := c.cache[key]; ok {
+		ee.Value.(*entry).value = value
+		c.access(ee)
+		return
+	}
+	// make room first, so that the new item is not the one evicted
+	if c.MaxEntries != 0 && c.Len() >= c.MaxEntries {
+		c.RemoveOldest()
+	}
+	c.cache[key] = c.probation.PushFront(&entry{key, value, false})
+}
+
+// Get looks up a key's value from the cache.
+func (c *Cache) Get(key string) (value []byte, ok bool) {
+	if c.cache == nil {
+		return
+	}
+	if ele, hit := c.cache[key]; hit {
+		c.access(ele)
+		return ele.Value.(*entry).value, true
+	}
+	return
+}
+
+// access records a hit on e: a key on probation is protected, which may
+// send the oldest protected key back on probation.
+func (c *Cache) access(e *list.Element) {
+	kv := e.Value.(*entry)
+	if kv.protected {
+		c.protected.MoveToFront(e)
+		return
+	}
+	c.probation.Remove(e)
+	kv.protected = true
+	c.cache[kv.key] = c.protected.PushFront(kv)
+	c.fitProtected()
+}
+
+// fitProtected moves the oldest protected entries back on probation while
+// the protected segment is over its share.
+func (c *Cache) fitProtected() {
+	if c.MaxEntries == 0 {
+		return
+	}
+	max := int(float64(c.MaxEntries) * c.ProtectedRatio)
+	for c.protected.Len() > max {
+		kv := c.protected.Remove(c.protected.Back()).(*entry)
+		kv.protected = false
+		c.cache[kv.key] = c.probation.PushFront(kv)
+	}
+}
+
+// Peek looks up a key's value without updating its recency.
+func (c *Cache) Peek(key string) (value []byte, ok bool) {
+	if c.cache == nil {
+		return
+	}
+	if ele, hit := c.cache[key]; hit {
+		return ele.Value.(*entry).value, true
+	}
+	return
+}
+
+// Remove removes the provided key from the cache.
+func (c *Cache) Remove(key string) {
+	if c.cache == nil {
+		return
+	}
+	if ele, hit := c.cache[key]; hit {
+		kv := c.removeElement(ele)
+		if c.OnEvicted != nil {
+			c.OnEvicted(kv.key, kv.value)
+		}
+	}
+}
+
+// RemoveOldest evicts the oldest item on probation, or the oldest
+// protected one if the probationary segment is empty.
+func (c *Cache) RemoveOldest() {
+	if c.cache == nil {
+		return
+	}
+	ele := c.probation.Back()
+	if ele == nil {
+		ele = c.protected.Back()
+	}
+	if ele != nil {
+		kv := c.removeElement(ele)
+		c.evicted(kv.key, kv.value)
+	}
+}
+
+// evicted reports an entry evicted to make room.
+func (c *Cache) evicted(key string, value []byte) {
+	if c.OnEvicted != nil {
+		c.OnEvicted(key, value)
+	}
+	if c.OnCapacityEvicted != nil {
+		c.OnCapacityEvicted(key, value)
+	}
+}
+
+func (c *Cache) removeElement(e *list.Element) *entry {
+	kv := e.Value.(*entry)
+	if kv.protected {
+		c.protected.Remove(e)
+	} else {
+		c.probation.Remove(e)
+	}
+	delete(c.cache, kv.key)
+	return kv
+}
+
+// Len returns the number of items in the cache.
+func (c *Cache) Len() int {
+	if c.cache == nil {
+		return 0
+	}
+	return c.probation.Len() + c.protected.Len()
+}
+
+// Clear purges all stored items from the cache.
+func (c *Cache) Clear() {
+	if c.OnEvicted != nil {
+		for _, key := range c.Keys() {
+			c.OnEvicted(key, c.cache[key].Value.(*entry).value)
+		}
+	}
+	c.probation = nil
+	c.protected = nil
+	c.cache = nil
+}
+
+// Keys returns the keys of the cache: those on probation, then the
+// protected ones, each from the oldest to the newest.
+func (c *Cache) Keys() []string {
+	keys := make([]string, 0, c.Len())
+	if c.cache == nil {
+		return keys
+	}
+	for _, l := range []*list.List{c.probation, c.protected} {
+		for ele := l.Back(); ele != nil; ele = ele.Prev() {
+			keys = append(keys, ele.Value.(*entry).key)
+		}
+	}
+	return keys
+}
+
+// Resize changes MaxEntries and evicts the items beyond it. Returns the
+// number of items evicted.
+func (c *Cache) Resize(maxEntries int) int {
+	c.MaxEntries = maxEntries
+	n := 0
+	for maxEntries != 0 && c.Len() > maxEntries {
+		c.RemoveOldest()
+		n++
+	}
+	if c.cache != nil {
+		c.fitProtected()
+	}
+	return n
+}
+
+// SetOnEvicted sets OnCapacityEvicted, as cache.Cache requires.
+func (c *Cache) SetOnEvicted(fn func(key string, value []byte)) {
+	c.OnCapacityEvicted = fn
+}
+
+// SetOnPurged sets OnEvicted.
+func (c *Cache) SetOnPurged(fn func(key string, value []byte)) {
+	c.OnEvicted = fn
+}
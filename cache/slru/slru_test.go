@@ -0,0 +1,41 @@
+package slru
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/hey-kong/stashlist/cache"
+	"github.com/hey-kong/stashlist/cache/cachetest"
+)
+
+func TestCache(t *testing.T) {
+	cachetest.Run(t, func(size int) cache.Cache { return New(size) })
+}
+
+func TestSegments(t *testing.T) {
+	c := New(10)
+	c.ProtectedRatio = 0.5
+	for i := 0; i < 10; i++ {
+		c.Add(strconv.Itoa(i), nil)
+	}
+	for i := 0; i < 8; i++ {
+		c.Get(strconv.Itoa(i))
+	}
+	// 0, 1 and 2 were pushed back on probation by the later reads
+	if c.protected.Len() != 5 || c.probation.Len() != 5 {
+		t.Fatal("segments hold", c.protected.Len(), "and", c.probation.Len())
+	}
+	if c.cache["2"].Value.(*entry).protected || !c.cache["3"].Value.(*entry).protected {
+		t.Fatal("the oldest protected keys were not demoted")
+	}
+
+	// a scan only churns the probationary segment
+	for i := 100; i < 200; i++ {
+		c.Add(strconv.Itoa(i), nil)
+	}
+	for i := 3; i < 8; i++ {
+		if _, ok := c.Peek(strconv.Itoa(i)); !ok {
+			t.Fatal("protected key", i, "was evicted by a scan")
+		}
+	}
+}
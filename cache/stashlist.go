@@ -0,0 +1,65 @@
+package cache
+
+import "github.com/hey-kong/stashlist"
+
+// FromStashList adapts list to Cache. Its capacity is MaxEntries, and its
+// keys come in key order. The adapter takes over the OnEvicted callback of
+// list.
+func FromStashList(list *stashlist.StashList) Cache {
+	c := &stashCache{list: list}
+	list.OnEvicted = c.evicted
+	return c
+}
+
+type stashCache struct {
+	list                *stashlist.StashList
+	onEvicted, onPurged func(key string, value []byte)
+}
+
+func (c *stashCache) Add(key string, value []byte)   { c.list.Add(key, value) }
+func (c *stashCache) Get(key string) ([]byte, bool)  { return c.list.Get(key) }
+func (c *stashCache) Peek(key string) ([]byte, bool) { return c.list.Peek(key) }
+func (c *stashCache) Len() int                       { return c.list.Length }
+func (c *stashCache) Resize(size int) int            { return c.list.Resize(size) }
+
+func (c *stashCache) SetOnEvicted(fn func(key string, value []byte)) {
+	c.onEvicted = fn
+}
+
+func (c *stashCache) SetOnPurged(fn func(key string, value []byte)) {
+	c.onPurged = fn
+}
+
+// evicted reports an entry the list evicted to make room.
+func (c *stashCache) evicted(key string, value []byte) {
+	if c.onPurged != nil {
+		c.onPurged(key, value)
+	}
+	if c.onEvicted != nil {
+		c.onEvicted(key, value)
+	}
+}
+
+func (c *stashCache) Remove(key string) {
+	if c.onPurged != nil {
+		if value, ok := c.list.Peek(key); ok {
+			c.onPurged(key, value)
+		}
+	}
+	c.list.Remove(key)
+}
+
+func (c *stashCache) Keys() []string {
+	keys := make([]string, 0, c.list.Length)
+	it := c.list.NewIterator()
+	for it.SeekToFirst(); it.Valid(); it.Next() {
+		keys = append(keys, it.Key())
+	}
+	return keys
+}
+
+func (c *stashCache) Clear() {
+	for _, key := range c.Keys() {
+		c.Remove(key)
+	}
+}
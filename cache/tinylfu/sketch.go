@@ -0,0 +1,118 @@
+package tinylfu
+
+import "github.com/hey-kong/stashlist/bloom"
+
+const (
+	// depth is the number of rows of the sketch.
+	depth = 4
+	// maxCount is the largest value of a 4-bit counter.
+	maxCount = 15
+	// resetFactor is the number of increments per counter of a row after
+	// which all the counts are halved.
+	resetFactor = 10
+)
+
+// Sketch estimates how often keys were seen recently. It is a Count-Min
+// sketch of 4-bit counters, fronted by a bloom filter doorkeeper: the first
+// occurrence of a key only goes to the doorkeeper, so that keys seen once do
+// not take counters from the others. After a sample of increments, every
+// counter is halved and the doorkeeper cleared, so that the estimates follow
+// recent popularity. A Sketch is not safe for concurrent access.
+type Sketch struct {
+	// rows holds depth rows of width counters, 16 per word.
+	rows  [depth][]uint64
+	width uint64
+	door  *bloom.Filter
+	// increments counts the increments since the last reset.
+	increments int
+	sampleSize int
+}
+
+// NewSketch returns a sketch sized for about n distinct keys.
+func NewSketch(n int) *Sketch {
+	width := uint64(16)
+	for width < uint64(n) {
+		width <<= 1
+	}
+	s := &Sketch{
+		width:      width,
+		sampleSize: resetFactor * int(width),
+	}
+	// a sample may hold as many distinct keys as increments
+	s.door = bloom.New(s.sampleSize, 4)
+	for i := range s.rows {
+		s.rows[i] = make([]uint64, width/16)
+	}
+	return s
+}
+
+// Increment records an occurrence of key.
+func (s *Sketch) Increment(key string) {
+	if !s.door.MayContain(key) {
+		s.door.Add(key)
+	} else {
+		h1, h2 := hash(key)
+		for i := range s.rows {
+			word, shift := s.counter(h1 + uint64(i)*h2)
+			if (s.rows[i][word]>>shift)&maxCount < maxCount {
+				s.rows[i][word] += 1 << shift
+			}
+		}
+	}
+	s.increments++
+	if s.increments >= s.sampleSize {
+		s.Reset()
+	}
+}
+
+// Estimate returns about how many times key was seen since the last
+// halvings, at most 16. Collisions with other keys may inflate it.
+func (s *Sketch) Estimate(key string) int {
+	h1, h2 := hash(key)
+	min := uint64(maxCount)
+	for i := range s.rows {
+		word, shift := s.counter(h1 + uint64(i)*h2)
+		if c := (s.rows[i][word] >> shift) & maxCount; c < min {
+			min = c
+		}
+	}
+	if s.door.MayContain(key) {
+		min++
+	}
+	return int(min)
+}
+
+// Reset halves every counter and clears the doorkeeper.
+func (s *Sketch) Reset() {
+	for i := range s.rows {
+		for j, w := range s.rows[i] {
+			s.rows[i][j] = (w >> 1) & 0x7777777777777777
+		}
+	}
+	s.door.Reset()
+	s.increments /= 2
+}
+
+// counter locates the counter of hash h in a row: the index of its word and
+// its shift in the word.
+func (s *Sketch) counter(h uint64) (int, uint) {
+	i := h & (s.width - 1)
+	return int(i / 16), uint(i%16) * 4
+}
+
+// hash returns two hashes of key for double hashing: FNV-1a, finalized as
+// in MurmurHash3 so that the bloom filter, which uses plain FNV-1a, probes
+// independent positions.
+func hash(key string) (uint64, uint64) {
+	h := uint64(14695981039346656037)
+	for i := 0; i < len(key); i++ {
+		h ^= uint64(key[i])
+		h *= 1099511628211
+	}
+	h ^= h >> 33
+	h *= 0xff51afd7ed558ccd
+	h ^= h >> 33
+	h *= 0xc4ceb9fe1a85ec53
+	h ^= h >> 33
+	return h, h>>32 | 1
+}
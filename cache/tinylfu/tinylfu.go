@@ -0,0 +1,286 @@
+// Package tinylfu implements W-TinyLFU, the policy of Caffeine, from
+// "TinyLFU: A Highly Efficient Cache Admission Policy" by Einziger et al.
+// New keys enter a small LRU window. The key the window pushes out is only
+// admitted to the main cache if a frequency Sketch estimates it more popular
+// than the key the main cache would evict for it. The main cache is a
+// segmented LRU: keys read while on probation move to a protected segment.
+//
+// The Sketch can be used on its own, for instance as the Admission of a
+// bounded StashList.
+package tinylfu
+
+import "container/list"
+
+const (
+	// windowRatio and protectedRatio size the window, in percent of the
+	// cache, and the protected segment, in percent of the main cache.
+	windowRatio    = 1
+	protectedRatio = 80
+)
+
+// Cache is a W-TinyLFU cache. It is not safe for concurrent access.
+type Cache struct {
+	// MaxEntries is the maximum number of cache entries before
+	// an item is evicted. Zero means no limit.
+	MaxEntries int
+
+	// OnEvicted optionally specifies a callback function to be
+	// executed when an entry is purged from the cache.
+	OnEvicted func(key string, value []byte)
+
+	// OnCapacityEvicted optionally specifies a callback function to be
+	// executed when an entry is evicted to make room, or is not admitted, after OnEvicted.
+	// Entries dropped by Remove or Clear are not reported.
+	OnCapacityEvicted func(key string, value []byte)
+
+	sketch *Sketch
+	// window, probation and protected hold the entries, newest in front.
+	window, probation, protected *list.List
+	cache                        map[string]*list.Element
+}
+
+type entry struct {
+	key   string
+	value []byte
+	// ll is the segment holding the entry.
+	ll *list.List
+}
+
+// New creates a new Cache.
+// If maxEntries is zero, the cache has no limit and it's assumed
+// that eviction is done by the caller.
+func New(maxEntries int) *Cache {
+	c := &Cache{
+		MaxEntries: maxEntries,
+		sketch:     NewSketch(maxEntries),
+	}
+	c.init()
+	return c
+}
+
+func (c *Cache) init() {
+	c.window = list.New()
+	c.probation = list.New()
+	c.protected = list.New()
+	c.cache = make(map[string]*list.Element)
+	if c.sketch == nil {
+		c.sketch = NewSketch(c.MaxEntries)
+	}
+}
+
+// Add adds a value to the cache. A new key enters the window; the key the
+// window pushes out competes for admission to the main cache.
+func (c *Cache) Add(key string, value []byte) {
+	if c.cache == nil {
+		c.init()
+	}
+	c.sketch.Increment(key)
+	if ee, ok := c.cache[key]; ok {
+		ee.Value.(*entry).value = value
+		c.access(ee)
+		return
+	}
+	c.cache[key] = c.window.PushFront(&entry{key, value, c.window})
+	// after a Remove and a Resize, the main cache may be full while the
+	// window is not
+	if c.MaxEntries != 0 && (c.window.Len() > c.windowSize() || c.Len() > c.MaxEntries) {
+		c.admit(c.window.Back())
+	}
+}
+
+// admit moves candidate from the window to probation if there is room,
+// else keeps the most frequent of candidate and the victim of the main
+// cache, evicting the other.
+func (c *Cache) admit(candidate *list.Element) {
+	if c.Len() <= c.MaxEntries {
+		c.moveTo(candidate, c.probation)
+		return
+	}
+	victim := c.probation.Back()
+	if victim == nil {
+		victim = c.protected.Back()
+	}
+	if victim == nil || c.estimate(candidate) <= c.estimate(victim) {
+		c.evict(candidate)
+		return
+	}
+	c.evict(victim)
+	c.moveTo(candidate, c.probation)
+}
+
+func (c *Cache) estimate(e *list.Element) int {
+	return c.sketch.Estimate(e.Value.(*entry).key)
+}
+
+// Get looks up a key's value from the cache.
+func (c *Cache) Get(key string) (value []byte, ok bool) {
+	if c.cache == nil {
+		return
+	}
+	c.sketch.Increment(key)
+	if ele, hit := c.cache[key]; hit {
+		c.access(ele)
+		return ele.Value.(*entry).value, true
+	}
+	return
+}
+
+// access records a hit on e: probation entries are promoted to the
+// protected segment, whose oldest entry may be demoted to make room.
+func (c *Cache) access(e *list.Element) {
+	switch e.Value.(*entry).ll {
+	case c.window, c.protected:
+		e.Value.(*entry).ll.MoveToFront(e)
+	case c.probation:
+		c.moveTo(e, c.protected)
+		if c.MaxEntries != 0 && c.protected.Len() > c.protectedSize() {
+			c.moveTo(c.protected.Back(), c.probation)
+		}
+	}
+}
+
+// Peek looks up a key's value without counting an access.
+func (c *Cache) Peek(key string) (value []byte, ok bool) {
+	if c.cache == nil {
+		return
+	}
+	if ele, hit := c.cache[key]; hit {
+		return ele.Value.(*entry).value, true
+	}
+	return
+}
+
+// Remove removes the provided key from the cache.
+func (c *Cache) Remove(key string) {
+	if c.cache == nil {
+		return
+	}
+	if ele, hit := c.cache[key]; hit {
+		kv := c.removeElement(ele)
+		if c.OnEvicted != nil {
+			c.OnEvicted(kv.key, kv.value)
+		}
+	}
+}
+
+// RemoveOldest evicts the oldest item of the main cache: on probation if
+// any, else protected. An empty main cache evicts from the window.
+func (c *Cache) RemoveOldest() {
+	if c.cache == nil {
+		return
+	}
+	for _, l := range []*list.List{c.probation, c.protected, c.window} {
+		if ele := l.Back(); ele != nil {
+			c.evict(ele)
+			return
+		}
+	}
+}
+
+// windowSize is the target length of the window.
+func (c *Cache) windowSize() int {
+	if n := c.MaxEntries * windowRatio / 100; n > 1 {
+		return n
+	}
+	return 1
+}
+
+// protectedSize is the maximum length of the protected segment.
+func (c *Cache) protectedSize() int {
+	return (c.MaxEntries - c.windowSize()) * protectedRatio / 100
+}
+
+// moveTo moves e in front of l.
+func (c *Cache) moveTo(e *list.Element, l *list.List) {
+	kv := e.Value.(*entry)
+	kv.ll.Remove(e)
+	kv.ll = l
+	c.cache[kv.key] = l.PushFront(kv)
+}
+
+// evict drops e to make room, reporting it.
+func (c *Cache) evict(e *list.Element) {
+	kv := c.removeElement(e)
+	if c.OnEvicted != nil {
+		c.OnEvicted(kv.key, kv.value)
+	}
+	if c.OnCapacityEvicted != nil {
+		c.OnCapacityEvicted(kv.key, kv.value)
+	}
+}
+
+func (c *Cache) removeElement(e *list.Element) *entry {
+	kv := e.Value.(*entry)
+	kv.ll.Remove(e)
+	delete(c.cache, kv.key)
+	return kv
+}
+
+// Len returns the number of items in the cache.
+func (c *Cache) Len() int {
+	if c.cache == nil {
+		return 0
+	}
+	return c.window.Len() + c.probation.Len() + c.protected.Len()
+}
+
+// Clear purges all stored items from the cache. The frequencies seen so
+// far are kept.
+func (c *Cache) Clear() {
+	if c.OnEvicted != nil {
+		for _, key := range c.Keys() {
+			c.OnEvicted(key, c.cache[key].Value.(*entry).value)
+		}
+	}
+	c.cache = nil
+}
+
+// Keys returns the keys of the cache: those of the window, then those on
+// probation, then the protected ones, each from the oldest to the newest.
+func (c *Cache) Keys() []string {
+	keys := make([]string, 0, c.Len())
+	if c.cache == nil {
+		return keys
+	}
+	for _, l := range []*list.List{c.window, c.probation, c.protected} {
+		for ele := l.Back(); ele != nil; ele = ele.Prev() {
+			keys = append(keys, ele.Value.(*entry).key)
+		}
+	}
+	return keys
+}
+
+// Resize changes MaxEntries and evicts the items beyond it. Returns the
+// number of items evicted. Growing the cache past the size its sketch was
+// made for starts a new sketch.
+func (c *Cache) Resize(maxEntries int) int {
+	if c.sketch == nil || uint64(maxEntries) > c.sketch.width {
+		c.sketch = NewSketch(maxEntries)
+	}
+	c.MaxEntries = maxEntries
+	if maxEntries == 0 || c.cache == nil {
+		return 0
+	}
+	n := 0
+	for c.Len() > maxEntries {
+		c.RemoveOldest()
+		n++
+	}
+	for c.window.Len() > c.windowSize() {
+		c.moveTo(c.window.Back(), c.probation)
+	}
+	for c.protected.Len() > c.protectedSize() {
+		c.moveTo(c.protected.Back(), c.probation)
+	}
+	return n
+}
+
+// SetOnEvicted sets OnCapacityEvicted, as cache.Cache requires.
+func (c *Cache) SetOnEvicted(fn func(key string, value []byte)) {
+	c.OnCapacityEvicted = fn
+}
+
+// SetOnPurged sets OnEvicted.
+func (c *Cache) SetOnPurged(fn func(key string, value []byte)) {
+	c.OnEvicted = fn
+}
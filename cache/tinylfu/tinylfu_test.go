@@ -0,0 +1,111 @@
+package tinylfu
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/hey-kong/stashlist/cache"
+	"github.com/hey-kong/stashlist/cache/cachetest"
+	"github.com/hey-kong/stashlist/cache/lru"
+)
+
+func TestCache(t *testing.T) {
+	cachetest.Run(t, func(size int) cache.Cache { return New(size) })
+}
+
+func TestSketch(t *testing.T) {
+	s := NewSketch(1000)
+	if n := s.Estimate("a"); n != 0 {
+		t.Fatal("unseen key estimated at", n)
+	}
+	s.Increment("a")
+	if n := s.Estimate("a"); n != 1 {
+		t.Fatal("key seen once estimated at", n)
+	}
+	for i := 0; i < 4; i++ {
+		s.Increment("a")
+	}
+	if n := s.Estimate("a"); n != 5 {
+		t.Fatal("key seen 5 times estimated at", n)
+	}
+	for i := 0; i < 100; i++ {
+		s.Increment("a")
+	}
+	if n := s.Estimate("a"); n != maxCount+1 {
+		t.Fatal("counters did not saturate:", n)
+	}
+
+	s.Reset()
+	if n := s.Estimate("a"); n != maxCount/2 {
+		t.Fatal("halved estimate is", n)
+	}
+}
+
+func TestSketchAging(t *testing.T) {
+	s := NewSketch(100)
+	for i := 0; i < 10; i++ {
+		s.Increment("old")
+	}
+	// a full sample of other keys halves the old counts
+	for i := 0; i < s.sampleSize; i++ {
+		s.Increment(strconv.Itoa(i % 50))
+	}
+	if n := s.Estimate("old"); n >= 9 {
+		t.Fatal("old key still estimated at", n)
+	}
+	if s.increments >= s.sampleSize {
+		t.Fatal("the sketch was never reset")
+	}
+}
+
+func TestAdmission(t *testing.T) {
+	c := New(100)
+	var evicted []string
+	c.OnEvicted = func(key string, value []byte) { evicted = append(evicted, key) }
+	for i := 0; i < 100; i++ {
+		c.Add(strconv.Itoa(i), nil)
+		c.Get(strconv.Itoa(i))
+		c.Get(strconv.Itoa(i))
+	}
+	// keys seen once are turned away at the window; only the last frequent
+	// key, still in the window, may lose its tie with the main cache
+	for i := 1000; i < 1500; i++ {
+		c.Add(strconv.Itoa(i), nil)
+	}
+	kept := 0
+	for i := 0; i < 100; i++ {
+		if _, ok := c.Peek(strconv.Itoa(i)); ok {
+			kept++
+		}
+	}
+	if kept < 99 || len(evicted) != 500 {
+		t.Fatalf("a scan flushed %d frequent keys and %d were evicted", 100-kept, len(evicted))
+	}
+}
+
+func TestHitRatio(t *testing.T) {
+	trace := cachetest.Zipf(1, 1.01, 20000, 100000)
+	for _, size := range []int{20, 200, 2000} {
+		tl := cachetest.HitRatio(New(size), trace)
+		l := cachetest.HitRatio(lru.New(size), trace)
+		t.Logf("size %d: tinylfu %.4f, lru %.4f", size, tl, l)
+		if tl < l {
+			t.Errorf("size %d: tinylfu hit ratio %.4f below lru %.4f", size, tl, l)
+		}
+	}
+}
+
+func TestResizeAfterRemove(t *testing.T) {
+	c := New(2)
+	for _, key := range []string{"1", "4", "2"} {
+		c.Add(key, nil)
+	}
+	c.Remove("2")
+	c.Resize(1)
+	for _, key := range []string{"2", "3", "5", "6"} {
+		c.Add(key, nil)
+		if c.Len() != 1 {
+			t.Fatalf("Len is %d after adding %q to a cache of 1", c.Len(), key)
+		}
+	}
+}
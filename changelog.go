@@ -0,0 +1,330 @@
+package stashlist
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"os"
+	"sync"
+)
+
+// ErrTruncated is returned by ChangesSince when changes after the requested
+// sequence number were already dropped from the changelog. The consumer has
+// to start over from a fresh Snapshot.
+var ErrTruncated = errors.New("stashlist: changelog truncated, resync from a snapshot")
+
+// maxChangeSize bounds the payload of a change record in the file, as the
+// replication frames are bounded, so that a corrupt length is not trusted.
+const maxChangeSize = 64 << 20
+
+var errChangeTooLarge = errors.New("stashlist: change too large for the changelog file")
+
+// Change is one mutation of a StashList. Value is the new value of a Put and
+// nil otherwise; it is shared with the list and must not be modified.
+type Change struct {
+	Seq   uint64
+	Type  EventType
+	Key   string
+	Value []byte
+}
+
+// Changelog records the mutations of a StashList in order, under strictly
+// increasing sequence numbers, so that consumers can resume from the last
+// change they have seen. It keeps the latest changes in a bounded ring and
+// can also append every change to a file, which then serves the changes
+// the ring has dropped.
+//
+// For a list written with Add and Remove, the sequence number of a change is
+// the sequence number of the list after it, so Snapshot.Seq tells which
+// changes a snapshot already contains. A Changelog is safe for concurrent
+// use: consumers may read it while the list is written.
+type Changelog struct {
+	mu    sync.Mutex
+	ring  []Change
+	start int
+	n     int
+	last  uint64
+
+	f     *os.File
+	w     *bufio.Writer
+	first uint64 // first sequence number in the file
+	err   error  // sticky file error
+
+	// wait is closed and replaced when a change is appended
+	wait chan struct{}
+}
+
+// NewChangelog creates an in-memory changelog keeping the last capacity changes.
+func NewChangelog(capacity int) *Changelog {
+	if capacity < 1 {
+		capacity = 1
+	}
+	return &Changelog{ring: make([]Change, capacity), wait: make(chan struct{})}
+}
+
+// OpenChangelog creates a changelog that also appends every change to the
+// file at path. Changes already in the file are kept and can be read back,
+// the last capacity of them from memory.
+func OpenChangelog(path string, capacity int) (*Changelog, error) {
+	cl := NewChangelog(capacity)
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+	size, err := readChanges(f, func(c Change) bool {
+		if cl.first == 0 {
+			cl.first = c.Seq
+		}
+		cl.push(c)
+		return true
+	})
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	// drop a torn record at the end of the file
+	if err := f.Truncate(size); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if _, err := f.Seek(size, io.SeekStart); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	cl.f, cl.w = f, bufio.NewWriter(f)
+	return cl, nil
+}
+
+// SetChangelog makes the list record its mutations in cl. A nil cl stops
+// the recording.
+func (list *StashList) SetChangelog(cl *Changelog) {
+	list.changelog = cl
+}
+
+// Apply writes a change recorded in the changelog of another list, such as
+// a replication leader. Unlike Add it never marks elements visited, so the
+// towers of the list adapt to its own reads: a rewrite promotes the element
+// if a Get visited it, and the search for the key demotes the unvisited
+// towers on its way, as for Add and Remove.
+// The change gets a sequence number of this list.
+func (list *StashList) Apply(c Change) {
+	prevs := list.getPrevElementNodes(c.Key)
+	element := prevs[0].next[0]
+	found := element != nil && element.key == c.Key
+
+	switch {
+	case c.Type == EventPut && found:
+		if element.visited && !element.deleted {
+			list.promote(prevs, element)
+		}
+		list.setVersion(element, c.Value, list.nextSeq(), false, len(list.snapshots) > 0 || list.versioned)
+	case c.Type == EventPut:
+		// only reads of this list mark the new element
+		list.link(prevs, c.Key, c.Value, list.nextSeq(), false).visited = false
+	case found && !element.deleted:
+		list.removeElement(prevs, element, c.Type)
+	}
+}
+
+// Seq returns the sequence number the snapshot was taken at.
+func (s *Snapshot) Seq() uint64 {
+	return s.seq
+}
+
+// LastSeq returns the sequence number of the latest change.
+func (cl *Changelog) LastSeq() uint64 {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	return cl.last
+}
+
+// Wait returns a channel that is closed once a change after seq is recorded.
+func (cl *Changelog) Wait(seq uint64) <-chan struct{} {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	if cl.last > seq {
+		closed := make(chan struct{})
+		close(closed)
+		return closed
+	}
+	return cl.wait
+}
+
+// ChangesSince returns the changes with a sequence number greater than seq,
+// in order. It returns ErrTruncated if some of them are no longer available.
+func (cl *Changelog) ChangesSince(seq uint64) ([]Change, error) {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+
+	if seq >= cl.last {
+		return nil, nil
+	}
+	if cl.n > 0 && seq+1 >= cl.ring[cl.start].Seq {
+		changes := make([]Change, 0, cl.last-seq)
+		for i := 0; i < cl.n; i++ {
+			if c := cl.ring[(cl.start+i)%len(cl.ring)]; c.Seq > seq {
+				changes = append(changes, c)
+			}
+		}
+		return changes, nil
+	}
+	if cl.f == nil || cl.first == 0 || seq+1 < cl.first {
+		return nil, ErrTruncated
+	}
+
+	// the ring has dropped some of them: read the file from the start
+	if err := cl.flush(); err != nil {
+		return nil, err
+	}
+	var changes []Change
+	_, err := readChanges(io.NewSectionReader(cl.f, 0, 1<<62), func(c Change) bool {
+		if c.Seq > seq {
+			changes = append(changes, c)
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return changes, nil
+}
+
+// Close flushes and closes the file of a file-backed changelog.
+func (cl *Changelog) Close() error {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	if cl.f == nil {
+		return nil
+	}
+	err := cl.flush()
+	if cerr := cl.f.Close(); err == nil {
+		err = cerr
+	}
+	cl.f, cl.w = nil, nil
+	return err
+}
+
+// Err returns the first error met while appending to the file, if any.
+func (cl *Changelog) Err() error {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	return cl.err
+}
+
+// append records a change. Sequence numbers that do not increase, as left by
+// versioned writes of old sequence numbers, are moved past the last one.
+func (cl *Changelog) append(c Change) {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+
+	if c.Seq <= cl.last {
+		c.Seq = cl.last + 1
+	}
+	cl.push(c)
+
+	if cl.w != nil && cl.err == nil {
+		if cl.first == 0 {
+			cl.first = c.Seq
+		}
+		if b := encodeChange(c); len(b)-8 > maxChangeSize {
+			// it could not be read back
+			cl.err = errChangeTooLarge
+		} else if _, err := cl.w.Write(b); err != nil {
+			cl.err = err
+		}
+	}
+
+	close(cl.wait)
+	cl.wait = make(chan struct{})
+}
+
+func (cl *Changelog) push(c Change) {
+	if cl.n == len(cl.ring) {
+		cl.ring[cl.start] = Change{}
+		cl.start = (cl.start + 1) % len(cl.ring)
+		cl.n--
+	}
+	cl.ring[(cl.start+cl.n)%len(cl.ring)] = c
+	cl.n++
+	cl.last = c.Seq
+}
+
+func (cl *Changelog) flush() error {
+	if cl.err != nil {
+		return cl.err
+	}
+	if err := cl.w.Flush(); err != nil {
+		cl.err = err
+	}
+	return cl.err
+}
+
+// A change record is [payload length u32][crc32 u32][payload], where the
+// payload is [seq uvarint][type u8][key length uvarint][key][value].
+func encodeChange(c Change) []byte {
+	b := make([]byte, 8, 8+binary.MaxVarintLen64*2+1+len(c.Key)+len(c.Value))
+	b = binary.AppendUvarint(b, c.Seq)
+	b = append(b, byte(c.Type))
+	b = binary.AppendUvarint(b, uint64(len(c.Key)))
+	b = append(b, c.Key...)
+	b = append(b, c.Value...)
+	binary.LittleEndian.PutUint32(b[0:], uint32(len(b)-8))
+	binary.LittleEndian.PutUint32(b[4:], crc32.ChecksumIEEE(b[8:]))
+	return b
+}
+
+// readChanges calls fn for every intact record of r and returns the size of
+// the intact prefix. It stops at the first torn or corrupt record.
+func readChanges(r io.Reader, fn func(Change) bool) (int64, error) {
+	br := bufio.NewReader(r)
+	var size int64
+	header := make([]byte, 8)
+	for {
+		if _, err := io.ReadFull(br, header); err != nil {
+			if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+				return size, nil
+			}
+			return size, err
+		}
+		length := binary.LittleEndian.Uint32(header)
+		if length > maxChangeSize {
+			// a corrupt length, taken as a torn record
+			return size, nil
+		}
+		payload := make([]byte, length)
+		if _, err := io.ReadFull(br, payload); err != nil {
+			if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+				return size, nil
+			}
+			return size, err
+		}
+		if crc32.ChecksumIEEE(payload) != binary.LittleEndian.Uint32(header[4:]) {
+			return size, nil
+		}
+
+		var c Change
+		seq, n := binary.Uvarint(payload)
+		if n <= 0 || len(payload) < n+1 {
+			return size, nil
+		}
+		c.Seq, c.Type = seq, EventType(payload[n])
+		p := payload[n+1:]
+		klen, n := binary.Uvarint(p)
+		if n <= 0 || uint64(len(p)-n) < klen {
+			return size, nil
+		}
+		c.Key = string(p[n : n+int(klen)])
+		if value := p[n+int(klen):]; c.Type == EventPut {
+			c.Value = value
+		}
+
+		size += int64(len(header) + len(payload))
+		if !fn(c) {
+			return size, nil
+		}
+	}
+}
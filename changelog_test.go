@@ -0,0 +1,140 @@
+package stashlist
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"testing"
+)
+
+func TestChangelogResume(t *testing.T) {
+	list := NewStashList()
+	cl := NewChangelog(4)
+	list.SetChangelog(cl)
+
+	list.Add("a", []byte("1"))
+	snap := list.Snapshot()
+	defer snap.Release()
+	list.Add("b", []byte("2"))
+	list.Remove("a")
+
+	changes, err := cl.ChangesSince(snap.Seq())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 2 || changes[0].Key != "b" || changes[1].Type != EventDelete || changes[1].Key != "a" {
+		t.Fatalf("wrong changes since the snapshot: %+v", changes)
+	}
+	if changes[1].Seq != list.seq || changes[0].Seq+1 != changes[1].Seq {
+		t.Fatalf("changes are not numbered after the list: %+v", changes)
+	}
+
+	for i := 0; i < 10; i++ {
+		list.Add(strconv.Itoa(i), nil)
+	}
+	if _, err := cl.ChangesSince(snap.Seq()); err != ErrTruncated {
+		t.Fatal("reading dropped changes returned", err)
+	}
+	if changes, err := cl.ChangesSince(cl.LastSeq() - 4); err != nil || len(changes) != 4 {
+		t.Fatal("wrong number of retained changes", len(changes), err)
+	}
+	if changes, _ := cl.ChangesSince(cl.LastSeq()); len(changes) != 0 {
+		t.Fatal("changes after the last one", changes)
+	}
+
+	select {
+	case <-cl.Wait(cl.LastSeq()):
+		t.Fatal("Wait fired without a new change")
+	default:
+	}
+	wait := cl.Wait(cl.LastSeq())
+	list.Add("c", nil)
+	<-wait
+}
+
+func TestChangelogFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "changes.log")
+	cl, err := OpenChangelog(path, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	list := NewStashList()
+	list.SetChangelog(cl)
+	for i := 0; i < 10; i++ {
+		list.Add(strconv.Itoa(i), []byte(strconv.Itoa(i)))
+	}
+
+	// served from the file, past what the ring keeps
+	changes, err := cl.ChangesSince(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 7 || changes[0].Seq != 4 || string(changes[0].Value) != "3" {
+		t.Fatalf("wrong changes from the file: %+v", changes)
+	}
+	if err := cl.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	cl, err = OpenChangelog(path, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cl.Close()
+	if cl.LastSeq() != 10 {
+		t.Fatal("wrong last sequence number after reopening", cl.LastSeq())
+	}
+	if changes, err := cl.ChangesSince(0); err != nil || len(changes) != 10 {
+		t.Fatal("wrong changes after reopening", len(changes), err)
+	}
+}
+
+func TestChangelogCorruptLength(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "changes.log")
+	cl, err := OpenChangelog(path, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	list := NewStashList()
+	list.SetChangelog(cl)
+	list.Add("a", []byte("1"))
+	if err := cl.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// a header claiming a 4 GiB record, then some garbage
+	corrupt := []byte{0xff, 0xff, 0xff, 0xff, 0, 0, 0, 0, 1, 2, 3}
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	if size, err := readChanges(bytes.NewReader(corrupt), func(Change) bool { return true }); size != 0 || err != nil {
+		t.Fatal("a corrupt record was read", size, err)
+	}
+	runtime.ReadMemStats(&after)
+	if n := after.TotalAlloc - before.TotalAlloc; n > 1<<20 {
+		t.Fatal("a corrupt length allocated", n, "bytes")
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write(corrupt); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	cl, err = OpenChangelog(path, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cl.Close()
+	if cl.LastSeq() != 1 {
+		t.Fatal("wrong last sequence number after a corrupt record", cl.LastSeq())
+	}
+	list.SetChangelog(cl)
+	list.Add("b", []byte("2"))
+	if changes, err := cl.ChangesSince(0); err != nil || len(changes) != 2 || changes[1].Key != "b" {
+		t.Fatalf("wrong changes after dropping the corrupt record: %+v, %v", changes, err)
+	}
+}
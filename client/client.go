@@ -0,0 +1,307 @@
+// Package client talks to a stashd server over the Redis protocol.
+//
+// A Client keeps a pool of connections and is safe for concurrent use.
+// Every call takes a context: its deadline bounds the call, and cancelling
+// it aborts the call. Calls that fail on the network are retried on a
+// fresh connection, with exponential backoff, if their commands never left
+// the client or only read; errors sent by the server are returned as they
+// are, as resp.Error.
+//
+//	c := client.New("localhost:6379")
+//	defer c.Close()
+//	err := c.Set(ctx, "k", []byte("v"), time.Minute)
+//	value, ok, err := c.Get(ctx, "k")
+package client
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hey-kong/stashlist/resp"
+)
+
+const (
+	DefaultPoolSize    = 8
+	DefaultDialTimeout = 5 * time.Second
+	DefaultMaxRetries  = 3
+	DefaultMinBackoff  = 10 * time.Millisecond
+	DefaultMaxBackoff  = 500 * time.Millisecond
+)
+
+// ErrClosed is returned by the calls made after Close.
+var ErrClosed = errors.New("client: closed")
+
+// Client is a pool of connections to one server. The exported fields may
+// be changed until the first call.
+type Client struct {
+	// PoolSize is the maximum number of open connections, watches aside.
+	PoolSize int
+	// DialTimeout bounds the connection to the server, within the deadline
+	// of the call.
+	DialTimeout time.Duration
+	// MaxRetries is the number of times a call is retried after a network
+	// error. A call whose commands may have reached the server is only
+	// retried if they all are reads, so that no write runs twice. Negative
+	// means never.
+	MaxRetries int
+	// MinBackoff and MaxBackoff bound the wait before a retry, which
+	// doubles at every attempt.
+	MinBackoff, MaxBackoff time.Duration
+
+	addr string
+	once sync.Once
+	idle chan *conn
+	// open holds a token for every open connection of the pool.
+	open chan struct{}
+
+	mu     sync.Mutex
+	closed bool
+}
+
+// conn is a connection to the server.
+type conn struct {
+	nc net.Conn
+	r  *resp.Reader
+	w  *resp.Writer
+	// sent records that a byte of the current round trip went out.
+	sent bool
+}
+
+// New returns a client for the server at addr. Connections are made as
+// they are needed.
+func New(addr string) *Client {
+	return &Client{
+		PoolSize:    DefaultPoolSize,
+		DialTimeout: DefaultDialTimeout,
+		MaxRetries:  DefaultMaxRetries,
+		MinBackoff:  DefaultMinBackoff,
+		MaxBackoff:  DefaultMaxBackoff,
+		addr:        addr,
+	}
+}
+
+func (c *Client) init() {
+	c.once.Do(func() {
+		if c.PoolSize < 1 {
+			c.PoolSize = 1
+		}
+		c.idle = make(chan *conn, c.PoolSize)
+		c.open = make(chan struct{}, c.PoolSize)
+	})
+}
+
+// Close closes the idle connections; the busy ones are closed as their
+// calls end. Watches are not affected.
+func (c *Client) Close() error {
+	c.init()
+	c.mu.Lock()
+	c.closed = true
+	c.mu.Unlock()
+	for {
+		select {
+		case cn := <-c.idle:
+			cn.nc.Close()
+			<-c.open
+		default:
+			return nil
+		}
+	}
+}
+
+// Do sends a command and returns its reply, decoded as resp.Reader's
+// ReadReply does. An error reply is returned as the error.
+func (c *Client) Do(ctx context.Context, args ...string) (any, error) {
+	bargs := make([][]byte, len(args))
+	for i, arg := range args {
+		bargs[i] = []byte(arg)
+	}
+	replies, err := c.exec(ctx, [][][]byte{bargs})
+	if err != nil {
+		return nil, err
+	}
+	return replyErr(replies[0])
+}
+
+// exec sends commands in one write and reads their replies, retrying the
+// lot on network errors if it is safe to.
+func (c *Client) exec(ctx context.Context, cmds [][][]byte) ([]any, error) {
+	c.init()
+	backoff := c.MinBackoff
+	for attempt := 0; ; attempt++ {
+		replies, sent, err := c.try(ctx, cmds)
+		if err == nil || attempt >= c.MaxRetries || ctx.Err() != nil || errors.Is(err, ErrClosed) || sent && !readOnly(cmds) {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return nil, ctxErr
+			}
+			return replies, err
+		}
+
+		t := time.NewTimer(backoff)
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			return nil, ctx.Err()
+		}
+		if backoff *= 2; backoff > c.MaxBackoff {
+			backoff = c.MaxBackoff
+		}
+	}
+}
+
+// try makes one attempt at a round trip. sent reports whether the commands
+// may have reached the server.
+func (c *Client) try(ctx context.Context, cmds [][][]byte) (replies []any, sent bool, err error) {
+	cn, err := c.get(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+	replies, err = cn.roundTrip(ctx, cmds)
+	sent = cn.sent
+	c.put(cn, err != nil)
+	return replies, sent, err
+}
+
+// reads are the commands that do not change the data, which may be sent
+// twice.
+var reads = map[string]bool{
+	"PING": true, "ECHO": true, "GET": true, "EXISTS": true, "TTL": true,
+	"PTTL": true, "DBSIZE": true, "KEYS": true, "SCAN": true, "RANGE": true,
+	"INFO": true, "TOWERS": true,
+}
+
+func readOnly(cmds [][][]byte) bool {
+	for _, args := range cmds {
+		if len(args) == 0 || !reads[strings.ToUpper(string(args[0]))] {
+			return false
+		}
+	}
+	return true
+}
+
+// get takes an idle connection, or opens one if the pool is not full.
+func (c *Client) get(ctx context.Context) (*conn, error) {
+	c.mu.Lock()
+	closed := c.closed
+	c.mu.Unlock()
+	if closed {
+		return nil, ErrClosed
+	}
+
+	select {
+	case cn := <-c.idle:
+		return cn, nil
+	default:
+	}
+	select {
+	case cn := <-c.idle:
+		return cn, nil
+	case c.open <- struct{}{}:
+		cn, err := c.dial(ctx)
+		if err != nil {
+			<-c.open
+			return nil, err
+		}
+		return cn, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// put returns a connection to the pool, or closes it if it is broken or
+// the client is closed.
+func (c *Client) put(cn *conn, broken bool) {
+	// hand the connection back under the lock, so that Close either sees
+	// it in idle or is seen to have run
+	c.mu.Lock()
+	if !broken && !c.closed {
+		c.idle <- cn
+		c.mu.Unlock()
+		return
+	}
+	c.mu.Unlock()
+	cn.nc.Close()
+	<-c.open
+}
+
+func (c *Client) dial(ctx context.Context) (*conn, error) {
+	d := net.Dialer{Timeout: c.DialTimeout}
+	nc, err := d.DialContext(ctx, "tcp", c.addr)
+	if err != nil {
+		return nil, err
+	}
+	cn := &conn{nc: nc, r: resp.NewReader(nc)}
+	cn.w = resp.NewWriter(cn)
+	return cn, nil
+}
+
+// Write writes to the network, recording whether anything went out.
+func (cn *conn) Write(p []byte) (int, error) {
+	n, err := cn.nc.Write(p)
+	if n > 0 {
+		cn.sent = true
+	}
+	return n, err
+}
+
+// roundTrip writes commands and reads as many replies. The connection must
+// be dropped if it fails: replies may be left unread.
+func (cn *conn) roundTrip(ctx context.Context, cmds [][][]byte) ([]any, error) {
+	stop := cn.bind(ctx)
+	defer stop()
+
+	cn.sent = false
+	for _, args := range cmds {
+		cn.w.WriteCommand(args...)
+	}
+	if err := cn.w.Flush(); err != nil {
+		return nil, err
+	}
+	replies := make([]any, len(cmds))
+	for i := range replies {
+		reply, err := cn.r.ReadReply()
+		if err != nil {
+			return nil, err
+		}
+		replies[i] = reply
+	}
+	return replies, nil
+}
+
+// bind applies the deadline of ctx to the connection and interrupts its
+// reads and writes if ctx is cancelled, until stop is called.
+func (cn *conn) bind(ctx context.Context) (stop func()) {
+	deadline, _ := ctx.Deadline()
+	cn.nc.SetDeadline(deadline)
+	if ctx.Done() == nil {
+		return func() {}
+	}
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		select {
+		case <-ctx.Done():
+			cn.nc.SetDeadline(time.Unix(1, 0))
+		case <-done:
+		}
+	}()
+	return func() {
+		close(done)
+		wg.Wait()
+	}
+}
+
+// replyErr turns an error reply into an error.
+func replyErr(reply any) (any, error) {
+	if err, ok := reply.(resp.Error); ok {
+		return nil, err
+	}
+	return reply, nil
+}
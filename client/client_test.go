@@ -0,0 +1,287 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hey-kong/stashlist"
+	"github.com/hey-kong/stashlist/resp"
+	"github.com/hey-kong/stashlist/server"
+)
+
+// serve starts a server on loopback and returns its address.
+func serve(t *testing.T, addr string) (*server.Server, string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := server.New(stashlist.NewStashList())
+	go srv.Serve(ln)
+	t.Cleanup(func() { srv.Close() })
+	return srv, ln.Addr().String()
+}
+
+func newClient(t *testing.T) *Client {
+	t.Helper()
+	_, addr := serve(t, "127.0.0.1:0")
+	c := New(addr)
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func TestGetSetDelete(t *testing.T) {
+	c := newClient(t)
+	ctx := context.Background()
+
+	if _, ok, err := c.Get(ctx, "a"); ok || err != nil {
+		t.Fatal("Get of a missing key returned", ok, err)
+	}
+	if err := c.Set(ctx, "a", []byte("1"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if value, ok, err := c.Get(ctx, "a"); !ok || err != nil || string(value) != "1" {
+		t.Fatal("Get returned", value, ok, err)
+	}
+	if err := c.Set(ctx, "b", []byte("2"), time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(5 * time.Millisecond)
+	if _, ok, _ := c.Get(ctx, "b"); ok {
+		t.Fatal("key outlived its TTL")
+	}
+	if n, err := c.Delete(ctx, "a", "b"); n != 1 || err != nil {
+		t.Fatal("Delete returned", n, err)
+	}
+
+	var serverErr resp.Error
+	if _, err := c.Do(ctx, "NOPE"); !errors.As(err, &serverErr) {
+		t.Fatal("unknown command returned", err)
+	}
+}
+
+func TestRange(t *testing.T) {
+	c := newClient(t)
+	ctx := context.Background()
+	p := c.Pipeline()
+	for i := 0; i < 1000; i++ {
+		p.Set("k"+strconv.Itoa(1000+i), []byte(strconv.Itoa(i)), 0)
+	}
+	if err := p.Exec(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	n := 0
+	it := c.Range(ctx, "k1100", "k1700")
+	for it.Next() {
+		if it.Key() != "k"+strconv.Itoa(1100+n) || string(it.Value()) != strconv.Itoa(100+n) {
+			t.Fatal("wrong pair", it.Key(), string(it.Value()))
+		}
+		n++
+	}
+	if it.Err() != nil || n != 600 {
+		t.Fatal("Range returned", n, "pairs,", it.Err())
+	}
+}
+
+func TestPipeline(t *testing.T) {
+	c := newClient(t)
+	ctx := context.Background()
+
+	p := c.Pipeline()
+	p.Set("a", []byte("1"), 0)
+	get := p.Get("a")
+	miss := p.Get("b")
+	bad := p.Do("NOPE")
+	del := p.Delete("a", "b")
+	if err := p.Exec(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if value, ok, err := get.Bytes(); string(value) != "1" || !ok || err != nil {
+		t.Fatal("pipelined GET returned", value, ok, err)
+	}
+	if _, ok, err := miss.Bytes(); ok || err != nil {
+		t.Fatal("pipelined GET of a missing key returned", ok, err)
+	}
+	if bad.Err() == nil {
+		t.Fatal("unknown command succeeded")
+	}
+	if n, err := del.Int(); n != 1 || err != nil {
+		t.Fatal("pipelined DEL returned", n, err)
+	}
+}
+
+func TestPoolConcurrency(t *testing.T) {
+	c := newClient(t)
+	c.PoolSize = 4
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	for g := 0; g < 32; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				key := strconv.Itoa(g) + ":" + strconv.Itoa(i)
+				if err := c.Set(ctx, key, []byte(key), 0); err != nil {
+					t.Error(err)
+					return
+				}
+				if value, ok, err := c.Get(ctx, key); !ok || err != nil || string(value) != key {
+					t.Error("Get returned", string(value), ok, err)
+					return
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	if n := len(c.open); n > 4 {
+		t.Fatal(n, "connections open")
+	}
+}
+
+func TestContext(t *testing.T) {
+	// a server that never answers
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	c := New(ln.Addr().String())
+	defer c.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	began := time.Now()
+	if _, _, err := c.Get(ctx, "a"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatal("Get returned", err)
+	}
+	if elapsed := time.Since(began); elapsed > time.Second {
+		t.Fatal("Get took", elapsed)
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+	if _, _, err := c.Get(ctx, "a"); !errors.Is(err, context.Canceled) {
+		t.Fatal("Get returned", err)
+	}
+}
+
+func TestRetry(t *testing.T) {
+	srv, addr := serve(t, "127.0.0.1:0")
+	c := New(addr)
+	defer c.Close()
+	ctx := context.Background()
+	if err := c.Set(ctx, "a", []byte("1"), 0); err != nil {
+		t.Fatal(err)
+	}
+
+	// restart the server: the pooled connection is dead
+	srv.Close()
+	srv, _ = serve(t, addr)
+	if _, ok, err := c.Get(ctx, "a"); ok || err != nil {
+		t.Fatal("Get after a restart returned", ok, err)
+	}
+
+	// a write that went out is not sent again
+	srv.Close()
+	srv, _ = serve(t, addr)
+	if err := c.Set(ctx, "a", []byte("2"), 0); err == nil {
+		t.Fatal("Set on a dead connection was retried")
+	}
+	if err := c.Set(ctx, "a", []byte("2"), 0); err != nil {
+		t.Fatal("Set on a fresh connection failed:", err)
+	}
+
+	c.Close()
+	if _, _, err := c.Get(ctx, "a"); err != ErrClosed {
+		t.Fatal("Get after Close returned", err)
+	}
+}
+
+func TestWatch(t *testing.T) {
+	c := newClient(t)
+	ctx := context.Background()
+
+	w, err := c.Watch(ctx, "user:", "user;")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Set(ctx, "post:1", []byte("x"), 0)
+	c.Set(ctx, "user:1", []byte("ann"), 0)
+	c.Delete(ctx, "user:1")
+
+	want := []stashlist.Event{
+		{Type: stashlist.EventPut, Key: "user:1", NewValue: []byte("ann")},
+		{Type: stashlist.EventDelete, Key: "user:1"},
+	}
+	for _, ev := range want {
+		select {
+		case got := <-w.Events():
+			// a slow reader may see the put coalesced into the delete
+			if got.Type == stashlist.EventDelete && ev.Type == stashlist.EventPut {
+				ev = got
+			}
+			if got.Type != ev.Type || got.Key != ev.Key || string(got.NewValue) != string(ev.NewValue) {
+				t.Fatalf("got %+v, want %+v", got, ev)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("no event")
+		}
+		if ev.Type == stashlist.EventDelete {
+			break
+		}
+	}
+
+	w.Close()
+	for range w.Events() {
+	}
+	if w.Err() != nil {
+		t.Fatal("closed watch failed with", w.Err())
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	w, err = c.Watch(ctx, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	for range w.Events() {
+	}
+	if !errors.Is(w.Err(), context.Canceled) {
+		t.Fatal("cancelled watch failed with", w.Err())
+	}
+}
+
+func TestCloseWhileBusy(t *testing.T) {
+	c := newClient(t)
+	ctx := context.Background()
+	var wg sync.WaitGroup
+	for i := 0; i < 4*DefaultPoolSize; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			c.Set(ctx, strconv.Itoa(i), nil, 0)
+		}(i)
+	}
+	c.Close()
+	wg.Wait()
+	if len(c.idle) != 0 || len(c.open) != 0 {
+		t.Fatal(len(c.idle), "idle and", len(c.open), "open connections after Close")
+	}
+}
@@ -0,0 +1,157 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// rangePage is the number of pairs a Range iterator fetches at a time.
+const rangePage = 256
+
+// Get returns the value of key, and whether it exists.
+func (c *Client) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	reply, err := c.Do(ctx, "GET", key)
+	if err != nil || reply == nil {
+		return nil, false, err
+	}
+	value, ok := reply.([]byte)
+	if !ok {
+		return nil, false, unexpected(reply)
+	}
+	return value, true, nil
+}
+
+// Set stores value under key. A positive ttl makes the key expire after
+// it, rounded to the millisecond; otherwise the key does not expire.
+func (c *Client) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	args := setArgs(key, value, ttl)
+	replies, err := c.exec(ctx, [][][]byte{args})
+	if err != nil {
+		return err
+	}
+	_, err = replyErr(replies[0])
+	return err
+}
+
+func setArgs(key string, value []byte, ttl time.Duration) [][]byte {
+	args := [][]byte{[]byte("SET"), []byte(key), value}
+	if ttl > 0 {
+		ms := ttl.Milliseconds()
+		if ms == 0 {
+			ms = 1
+		}
+		args = append(args, []byte("PX"), []byte(strconv.FormatInt(ms, 10)))
+	}
+	return args
+}
+
+// Delete removes keys and returns the number of keys that existed.
+func (c *Client) Delete(ctx context.Context, keys ...string) (int, error) {
+	reply, err := c.Do(ctx, append([]string{"DEL"}, keys...)...)
+	if err != nil {
+		return 0, err
+	}
+	n, ok := reply.(int64)
+	if !ok {
+		return 0, unexpected(reply)
+	}
+	return int(n), nil
+}
+
+// RangeIterator walks the pairs of a key range in key order, fetching them
+// from the server a page at a time. Pages are read at different times:
+// the iterator does not see a snapshot of the range.
+//
+//	it := c.Range(ctx, "user:", "user;")
+//	for it.Next() {
+//		fmt.Println(it.Key(), it.Value())
+//	}
+//	if err := it.Err(); err != nil {
+//		...
+//	}
+type RangeIterator struct {
+	c     *Client
+	ctx   context.Context
+	start string
+	end   string
+
+	pairs []any
+	done  bool
+	err   error
+	key   string
+	value []byte
+}
+
+// Range returns an iterator over the pairs with start <= key < end. An
+// empty end means no upper bound.
+func (c *Client) Range(ctx context.Context, start, end string) *RangeIterator {
+	return &RangeIterator{c: c, ctx: ctx, start: start, end: end}
+}
+
+// Next moves to the next pair. It returns false at the end of the range
+// or on error.
+func (it *RangeIterator) Next() bool {
+	if it.err != nil {
+		return false
+	}
+	if len(it.pairs) == 0 {
+		if it.done {
+			return false
+		}
+		it.fetch()
+		if it.err != nil || len(it.pairs) == 0 {
+			return false
+		}
+	}
+
+	key, ok1 := it.pairs[0].([]byte)
+	value, ok2 := it.pairs[1].([]byte)
+	if !ok1 || !ok2 {
+		it.err = unexpected(it.pairs[0])
+		return false
+	}
+	it.key, it.value = string(key), value
+	it.pairs = it.pairs[2:]
+	return true
+}
+
+func (it *RangeIterator) fetch() {
+	reply, err := it.c.Do(it.ctx, "RANGE", it.start, it.end, "LIMIT", strconv.Itoa(rangePage))
+	if err != nil {
+		it.err = err
+		return
+	}
+	pairs, ok := reply.([]any)
+	if !ok || len(pairs)%2 != 0 {
+		it.err = unexpected(reply)
+		return
+	}
+	it.pairs = pairs
+	it.done = len(pairs) < 2*rangePage
+	if len(pairs) > 0 {
+		last, _ := pairs[len(pairs)-2].([]byte)
+		// resume right after the last key
+		it.start = string(last) + "\x00"
+	}
+}
+
+// Key returns the key of the current pair.
+func (it *RangeIterator) Key() string {
+	return it.key
+}
+
+// Value returns the value of the current pair.
+func (it *RangeIterator) Value() []byte {
+	return it.value
+}
+
+// Err returns the error that stopped the iteration, if any.
+func (it *RangeIterator) Err() error {
+	return it.err
+}
+
+func unexpected(reply any) error {
+	return fmt.Errorf("client: unexpected reply %v", reply)
+}
@@ -0,0 +1,119 @@
+package client
+
+import (
+	"context"
+	"time"
+)
+
+// Pipeline queues commands and sends them in one write, reading all the
+// replies at once. Its results are valid after Exec.
+//
+//	p := c.Pipeline()
+//	get := p.Get("a")
+//	p.Set("b", []byte("2"), 0)
+//	if err := p.Exec(ctx); err != nil {
+//		...
+//	}
+//	value, ok, err := get.Bytes()
+type Pipeline struct {
+	c       *Client
+	cmds    [][][]byte
+	results []*Result
+}
+
+// Result is the reply to a command of a pipeline.
+type Result struct {
+	reply any
+	err   error
+}
+
+// Pipeline returns an empty pipeline.
+func (c *Client) Pipeline() *Pipeline {
+	return &Pipeline{c: c}
+}
+
+// Do queues a command.
+func (p *Pipeline) Do(args ...string) *Result {
+	bargs := make([][]byte, len(args))
+	for i, arg := range args {
+		bargs[i] = []byte(arg)
+	}
+	return p.queue(bargs)
+}
+
+// Get queues a GET of key.
+func (p *Pipeline) Get(key string) *Result {
+	return p.Do("GET", key)
+}
+
+// Set queues a SET of key, with Client.Set's ttl.
+func (p *Pipeline) Set(key string, value []byte, ttl time.Duration) *Result {
+	return p.queue(setArgs(key, value, ttl))
+}
+
+// Delete queues a DEL of keys.
+func (p *Pipeline) Delete(keys ...string) *Result {
+	return p.Do(append([]string{"DEL"}, keys...)...)
+}
+
+func (p *Pipeline) queue(args [][]byte) *Result {
+	r := &Result{}
+	p.cmds = append(p.cmds, args)
+	p.results = append(p.results, r)
+	return r
+}
+
+// Exec sends the queued commands and empties the pipeline. Its error is
+// that of the round trip; the errors of single commands are left in their
+// results.
+func (p *Pipeline) Exec(ctx context.Context) error {
+	cmds, results := p.cmds, p.results
+	p.cmds, p.results = nil, nil
+	if len(cmds) == 0 {
+		return nil
+	}
+
+	replies, err := p.c.exec(ctx, cmds)
+	for i, r := range results {
+		if err != nil {
+			r.err = err
+			continue
+		}
+		r.reply, r.err = replyErr(replies[i])
+	}
+	return err
+}
+
+// Reply returns the reply, decoded as Client.Do does.
+func (r *Result) Reply() (any, error) {
+	return r.reply, r.err
+}
+
+// Err returns the error of the command.
+func (r *Result) Err() error {
+	return r.err
+}
+
+// Bytes returns the reply to a GET: the value and whether it exists.
+func (r *Result) Bytes() ([]byte, bool, error) {
+	if r.err != nil || r.reply == nil {
+		return nil, false, r.err
+	}
+	value, ok := r.reply.([]byte)
+	if !ok {
+		return nil, false, unexpected(r.reply)
+	}
+	return value, true, nil
+}
+
+// Int returns an integer reply, such as the count of a DEL.
+func (r *Result) Int() (int64, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+	n, ok := r.reply.(int64)
+	if !ok {
+		return 0, unexpected(r.reply)
+	}
+	return n, nil
+}
@@ -0,0 +1,148 @@
+package client
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/hey-kong/stashlist"
+)
+
+var eventTypes = map[string]stashlist.EventType{
+	"put":    stashlist.EventPut,
+	"delete": stashlist.EventDelete,
+	"expire": stashlist.EventExpire,
+	"evict":  stashlist.EventEvict,
+}
+
+// Watch is a stream of the changes to a key range, on a connection of its
+// own.
+type Watch struct {
+	cn     *conn
+	events chan stashlist.Event
+	done   chan struct{}
+	once   sync.Once
+	err    error
+}
+
+// Watch subscribes to the changes to the keys in [start, end). An empty
+// end means no upper bound. The events carry no OldValue. A watcher that
+// falls behind gets only the latest change of each key.
+//
+// The stream lasts until Close is called, ctx is done or the connection
+// is lost: the channel is then closed and Err tells why. Watches are not
+// retried.
+func (c *Client) Watch(ctx context.Context, start, end string) (*Watch, error) {
+	c.mu.Lock()
+	closed := c.closed
+	c.mu.Unlock()
+	if closed {
+		return nil, ErrClosed
+	}
+	cn, err := c.dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+	replies, err := cn.roundTrip(ctx, [][][]byte{{[]byte("WATCHRANGE"), []byte(start), []byte(end)}})
+	if err == nil {
+		_, err = replyErr(replies[0])
+	}
+	if err != nil {
+		cn.nc.Close()
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, err
+	}
+	// the stream has no deadline: only cancelling ctx interrupts it
+	cn.nc.SetDeadline(time.Time{})
+
+	w := &Watch{cn: cn, events: make(chan stashlist.Event), done: make(chan struct{})}
+	go func() {
+		select {
+		case <-ctx.Done():
+			cn.nc.Close()
+		case <-w.done:
+		}
+	}()
+	go w.read(ctx)
+	return w, nil
+}
+
+// Events returns the channel of the changes.
+func (w *Watch) Events() <-chan stashlist.Event {
+	return w.events
+}
+
+// Close ends the stream.
+func (w *Watch) Close() error {
+	w.once.Do(func() {
+		close(w.done)
+		w.cn.nc.Close()
+	})
+	return nil
+}
+
+// Err returns the reason the stream ended, once the channel is closed. It
+// is nil after Close.
+func (w *Watch) Err() error {
+	return w.err
+}
+
+func (w *Watch) read(ctx context.Context) {
+	defer close(w.events)
+	defer w.Close()
+
+	for {
+		reply, err := w.cn.r.ReadReply()
+		if err != nil {
+			w.fail(ctx, err)
+			return
+		}
+		ev, ok := parseEvent(reply)
+		if !ok {
+			w.fail(ctx, unexpected(reply))
+			return
+		}
+
+		select {
+		case w.events <- ev:
+		case <-w.done:
+			return
+		case <-ctx.Done():
+			w.err = ctx.Err()
+			return
+		}
+	}
+}
+
+// fail records why the stream ended, unless it was closed.
+func (w *Watch) fail(ctx context.Context, err error) {
+	select {
+	case <-w.done:
+		return
+	default:
+	}
+	if ctx.Err() != nil {
+		err = ctx.Err()
+	}
+	w.err = err
+}
+
+// parseEvent decodes an [event, type, key, value] array.
+func parseEvent(reply any) (stashlist.Event, bool) {
+	fields, ok := reply.([]any)
+	if !ok || len(fields) != 4 || string(asBytes(fields[0])) != "event" {
+		return stashlist.Event{}, false
+	}
+	t, ok := eventTypes[string(asBytes(fields[1]))]
+	if !ok {
+		return stashlist.Event{}, false
+	}
+	return stashlist.Event{Type: t, Key: string(asBytes(fields[2])), NewValue: asBytes(fields[3])}, true
+}
+
+func asBytes(v any) []byte {
+	b, _ := v.([]byte)
+	return b
+}
@@ -0,0 +1,196 @@
+// Command cachesim replays a trace against cache policies at several sizes
+// and reports their hit ratio, byte hit ratio, evictions and speed, as CSV
+// or JSON. Without a trace file it generates a Zipf trace. Apart from the
+// speed, the output only depends on the trace and the seed. The trace is
+// streamed, unless -opt asks for the hit ratio of the optimal policy.
+//
+// With -mrc, it writes miss ratio curves as CSV instead, and plots them to
+// an SVG file with -svg: the LRU curve is computed over every size in one
+// pass, the other policies are replayed at the given sizes.
+//
+//	cachesim -sizes 1000,10000 -policies lru,sieve,stashlist
+//	cachesim -trace requests.txt -format json
+//	cachesim -trace w01.oracleGeneral.bin.gz -trace-format oracle
+//	cachesim -mrc -sample-rate 0.01 -sizes 100,1000,10000,100000 -svg mrc.svg
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/hey-kong/stashlist/mrc"
+	"github.com/hey-kong/stashlist/sim"
+	"github.com/hey-kong/stashlist/trace"
+)
+
+func main() {
+	traceFile := flag.String("trace", "", "trace file, possibly gzip or bzip2 compressed, - for stdin; a Zipf trace is generated if empty")
+	traceFormat := flag.String("trace-format", "plain", "format of the trace file: "+strings.Join(trace.Formats(), ", "))
+	policies := flag.String("policies", "all", "comma separated policies to replay: "+strings.Join(sim.Policies(), ", "))
+	sizes := flag.String("sizes", "1000,10000", "comma separated cache sizes, in entries")
+	format := flag.String("format", "csv", "output format: csv or json")
+	seed := flag.Int64("seed", 1, "seed of the generated trace and of the policies")
+	withOpt := flag.Bool("opt", false, "report the hit ratio of the optimal policy, which reads the whole trace in memory")
+	requests := flag.Int("requests", 1000000, "requests of the generated trace")
+	keys := flag.Uint64("keys", 100000, "keys of the generated trace")
+	alpha := flag.Float64("alpha", 1.01, "Zipf parameter of the generated trace, above 1")
+	minSize := flag.Int("min-size", 64, "smallest object size of the generated trace")
+	maxSize := flag.Int("max-size", 64, "largest object size of the generated trace")
+	curves := flag.Bool("mrc", false, "write miss ratio curves as CSV instead of a report")
+	rate := flag.Float64("sample-rate", 1, "share of the keys the miss ratio curves are computed on")
+	svg := flag.String("svg", "", "file to plot the miss ratio curves to")
+	flag.Parse()
+
+	names := sim.Policies()
+	if *policies != "all" {
+		names = strings.Split(*policies, ",")
+	}
+	var capacities []int
+	for _, s := range strings.Split(*sizes, ",") {
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 {
+			log.Fatalf("bad size %q", s)
+		}
+		capacities = append(capacities, n)
+	}
+
+	// open returns a new reader of the trace, from its start
+	open := func() (trace.ReadCloser, error) {
+		return trace.Open(*traceFile, *traceFormat)
+	}
+	if *traceFile == "" {
+		if *alpha <= 1 || *keys < 2 || *minSize < 0 || *maxSize < *minSize {
+			log.Fatal("the generated trace needs -alpha above 1, 2 keys or more and 0 <= -min-size <= -max-size")
+		}
+		open = func() (trace.ReadCloser, error) {
+			return nopCloser{trace.NewZipfReader(*seed, *alpha, *keys, *requests, *minSize, *maxSize)}, nil
+		}
+	}
+
+	if *curves {
+		if *traceFile == "-" && len(names) > 1 {
+			log.Fatal("-mrc reads the trace once per policy, which the standard input cannot be")
+		}
+		if err := writeCurves(open, names, capacities, *seed, *rate, *svg); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	results, err := report(open, names, capacities, *seed, *withOpt)
+	if err != nil {
+		log.Fatal(err)
+	}
+	switch *format {
+	case "csv":
+		err = writeCSV(os.Stdout, results, *withOpt)
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(results)
+	default:
+		log.Fatalf("unknown format %s", *format)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// report replays the trace in a single pass. Only the optimal policy needs
+// the whole trace in memory.
+func report(open func() (trace.ReadCloser, error), names []string, sizes []int, seed int64, withOpt bool) ([]sim.Result, error) {
+	r, err := open()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	if !withOpt {
+		return sim.Sweep(names, sizes, seed, r)
+	}
+	reqs, err := trace.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	results, err := sim.Sweep(names, sizes, seed, trace.NewSliceReader(reqs))
+	if err != nil {
+		return nil, err
+	}
+	sim.AddOpt(results, reqs)
+	return results, nil
+}
+
+type nopCloser struct {
+	trace.Reader
+}
+
+func (nopCloser) Close() error { return nil }
+
+// writeCurves reads the trace once per policy.
+func writeCurves(open func() (trace.ReadCloser, error), names []string, sizes []int, seed int64, rate float64, svg string) error {
+	var curves []mrc.Curve
+	for _, policy := range names {
+		r, err := open()
+		if err != nil {
+			return err
+		}
+		var c mrc.Curve
+		if policy == "lru" {
+			c, err = mrc.Sample(r, rate)
+		} else {
+			c, err = mrc.Approximate(policy, r, sizes, rate, seed)
+		}
+		r.Close()
+		if err != nil {
+			return err
+		}
+		curves = append(curves, c)
+	}
+	if err := mrc.WriteCSV(os.Stdout, curves...); err != nil {
+		return err
+	}
+	if svg == "" {
+		return nil
+	}
+	f, err := os.Create(svg)
+	if err != nil {
+		return err
+	}
+	if err := mrc.WriteSVG(f, curves...); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// writeCSV writes results to w. The hit ratio of the optimal policy is left
+// empty unless withOpt is set.
+func writeCSV(w io.Writer, results []sim.Result, withOpt bool) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"policy", "size", "requests", "hits", "hit_ratio", "byte_hit_ratio", "evictions", "ops_per_sec", "opt_hit_ratio"})
+	for _, r := range results {
+		best := ""
+		if withOpt {
+			best = fmt.Sprintf("%.6f", r.OptHitRatio)
+		}
+		cw.Write([]string{
+			r.Policy,
+			strconv.Itoa(r.Size),
+			strconv.Itoa(r.Requests),
+			strconv.Itoa(r.Hits),
+			fmt.Sprintf("%.6f", r.HitRatio),
+			fmt.Sprintf("%.6f", r.ByteHitRatio),
+			strconv.Itoa(r.Evictions),
+			fmt.Sprintf("%.0f", r.OpsPerSec),
+			best,
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
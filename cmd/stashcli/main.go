@@ -0,0 +1,64 @@
+// Command stashcli is an interactive shell for exploring a StashList, in
+// process or served by stashd. It shows how reads and writes reshape the
+// towers of the list.
+//
+//	stashcli
+//	stashcli -addr localhost:6379
+//
+// Type help for the list of commands. Commands can also be piped in:
+//
+//	printf 'put a 1\nget a\nget a\nlevels\n' | stashcli
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/hey-kong/stashlist"
+	"github.com/hey-kong/stashlist/client"
+)
+
+func main() {
+	addr := flag.String("addr", "", "address of a stashd server, instead of a list in process")
+	maxLevel := flag.Int("maxlevel", stashlist.DefaultMaxLevel, "maximum tower height of the list in process")
+	flag.Parse()
+
+	var st store
+	if *addr != "" {
+		c := client.New(*addr)
+		defer c.Close()
+		st = remote{c: c}
+	} else {
+		st = local{list: stashlist.NewWithMaxLevel(*maxLevel)}
+	}
+
+	// only prompt people, not pipes
+	prompt := ""
+	if fi, err := os.Stdin.Stat(); err == nil && fi.Mode()&os.ModeCharDevice != 0 {
+		prompt = "stashcli> "
+	}
+	repl(&shell{st: st, out: os.Stdout}, os.Stdin, prompt)
+}
+
+// repl runs the commands read from in until it ends or quit is typed.
+func repl(sh *shell, in io.Reader, prompt string) {
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(nil, 1<<20)
+	for {
+		fmt.Fprint(sh.out, prompt)
+		if !scanner.Scan() {
+			break
+		}
+		if err := sh.run(scanner.Text()); err == errQuit {
+			return
+		} else if err != nil {
+			fmt.Fprintln(sh.out, "error:", err)
+		}
+	}
+	if prompt != "" {
+		fmt.Fprintln(sh.out)
+	}
+}
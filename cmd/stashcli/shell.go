@@ -0,0 +1,472 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hey-kong/stashlist"
+)
+
+var errQuit = errors.New("quit")
+
+const (
+	defaultScanLimit   = 20
+	defaultLevelsLimit = 16
+	// maxColumn is the width beyond which keys are cut in the diagram.
+	maxColumn = 10
+	pageSize  = 1000
+)
+
+type shellCommand struct {
+	usage string
+	run   func(sh *shell, args []string) error
+}
+
+var shellCommands map[string]shellCommand
+
+func init() {
+	shellCommands = map[string]shellCommand{
+		"put":     {"put <key> <value>      store a value and show the key's tower", (*shell).put},
+		"get":     {"get <key>              read a value and show the key's tower", (*shell).get},
+		"del":     {"del <key>              remove a key", (*shell).del},
+		"scan":    {"scan [start [end [n]]] list n pairs in [start, end)", (*shell).scan},
+		"seek":    {"seek <key>             show the first pair at or after key", (*shell).seek},
+		"stats":   {"stats                  show the length, level histogram and counters", (*shell).stats},
+		"levels":  {"levels [start [n]]     draw the towers of n keys from start on", (*shell).levels},
+		"load":    {"load <file>            add the pairs of an image file", (*shell).load},
+		"save":    {"save <file>            write the list to an image file", (*shell).save},
+		"promote": {"promote <key>          raise the key's tower by one level", (*shell).promote},
+		"demote":  {"demote <key>           lower the key's tower by one level", (*shell).demote},
+		"trace":   {"trace <file>           replay a workload of put, get and del lines", (*shell).trace},
+		"help":    {"help                   show this list", (*shell).help},
+		"quit":    {"quit                   leave", func(*shell, []string) error { return errQuit }},
+	}
+	shellCommands["exit"] = shellCommands["quit"]
+	shellCommands["set"] = shellCommands["put"]
+}
+
+// shell runs commands against a store and prints their results to out.
+type shell struct {
+	st  store
+	out io.Writer
+}
+
+// run executes one command line. Blank lines and lines starting with #
+// are ignored.
+func (sh *shell) run(line string) error {
+	args := strings.Fields(line)
+	if len(args) == 0 || strings.HasPrefix(args[0], "#") {
+		return nil
+	}
+	cmd, ok := shellCommands[strings.ToLower(args[0])]
+	if !ok {
+		return fmt.Errorf("unknown command %q, try help", args[0])
+	}
+	return cmd.run(sh, args[1:])
+}
+
+// usage returns the synopsis of a command as an error.
+func usage(name string) error {
+	synopsis := shellCommands[name].usage
+	if i := strings.Index(synopsis, "  "); i >= 0 {
+		synopsis = synopsis[:i]
+	}
+	return errors.New("usage: " + synopsis)
+}
+
+func (sh *shell) put(args []string) error {
+	if len(args) < 2 {
+		return usage("put")
+	}
+	// the value is the rest of the line
+	if err := sh.st.Put(args[0], []byte(strings.Join(args[1:], " "))); err != nil {
+		return err
+	}
+	return sh.showTower(args[0])
+}
+
+func (sh *shell) get(args []string) error {
+	if len(args) != 1 {
+		return usage("get")
+	}
+	value, ok, err := sh.st.Get(args[0])
+	if err != nil {
+		return err
+	}
+	if !ok {
+		fmt.Fprintln(sh.out, "(nil)")
+		return nil
+	}
+	fmt.Fprintf(sh.out, "%q\n", value)
+	return sh.showTower(args[0])
+}
+
+// showTower prints the height and visited mark of key.
+func (sh *shell) showTower(key string) error {
+	return sh.st.Towers(key, 1, func(k string, level int, visited bool) {
+		if k != key {
+			return
+		}
+		mark := ""
+		if visited {
+			mark = ", visited"
+		}
+		fmt.Fprintf(sh.out, "  tower: %d level(s)%s\n", level, mark)
+	})
+}
+
+func (sh *shell) del(args []string) error {
+	if len(args) != 1 {
+		return usage("del")
+	}
+	removed, err := sh.st.Del(args[0])
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(sh.out, "removed:", removed)
+	return nil
+}
+
+func (sh *shell) scan(args []string) error {
+	if len(args) > 3 {
+		return usage("scan")
+	}
+	var start, end string
+	limit := defaultScanLimit
+	if len(args) > 0 {
+		start = args[0]
+	}
+	if len(args) > 1 {
+		end = args[1]
+	}
+	if len(args) > 2 {
+		n, err := strconv.Atoi(args[2])
+		if err != nil || n < 1 {
+			return usage("scan")
+		}
+		limit = n
+	}
+	return sh.st.Scan(start, end, limit, func(key string, value []byte) {
+		fmt.Fprintf(sh.out, "%q\t%q\n", key, value)
+	})
+}
+
+func (sh *shell) seek(args []string) error {
+	if len(args) != 1 {
+		return usage("seek")
+	}
+	found := false
+	err := sh.st.Scan(args[0], "", 1, func(key string, value []byte) {
+		fmt.Fprintf(sh.out, "%q\t%q\n", key, value)
+		found = true
+	})
+	if err == nil && !found {
+		fmt.Fprintln(sh.out, "(end of list)")
+	}
+	return err
+}
+
+func (sh *shell) stats(args []string) error {
+	stats, err := sh.st.Stats()
+	if err != nil {
+		return err
+	}
+	visitedRatio := 0.0
+	if stats.Length > 0 {
+		visitedRatio = float64(stats.Visited) / float64(stats.Length)
+	}
+	fmt.Fprintf(sh.out, "length      %d\nmax level   %d\nvisited     %d (%.1f%%)\npromotions  %d\ndemotions   %d\nevictions   %d\n",
+		stats.Length, stats.MaxLevel, stats.Visited, 100*visitedRatio, stats.Promotions, stats.Demotions, stats.Evictions)
+	top := 0
+	for i, n := range stats.Levels {
+		if n > 0 {
+			top = i + 1
+		}
+	}
+	for i := top - 1; i >= 0; i-- {
+		fmt.Fprintf(sh.out, "level %-4d  %d\n", i+1, stats.Levels[i])
+	}
+	return nil
+}
+
+type tower struct {
+	key     string
+	level   int
+	visited bool
+}
+
+// levels draws the towers side by side, the highest level on top, with
+// the links of each level running between them:
+//
+//	L3  o-------------->o
+//	L2  o-------------->o
+//	L1  o------>o-->o-->o-->o
+//	    apple*  b*  c   d*  e*
+//
+// A * marks the visited keys.
+func (sh *shell) levels(args []string) error {
+	if len(args) > 2 {
+		return usage("levels")
+	}
+	var start string
+	limit := defaultLevelsLimit
+	if len(args) > 0 {
+		start = args[0]
+	}
+	if len(args) > 1 {
+		n, err := strconv.Atoi(args[1])
+		if err != nil || n < 1 {
+			return usage("levels")
+		}
+		limit = n
+	}
+
+	var towers []tower
+	err := sh.st.Towers(start, limit, func(key string, level int, visited bool) {
+		towers = append(towers, tower{key, level, visited})
+	})
+	if err != nil || len(towers) == 0 {
+		return err
+	}
+	drawTowers(sh.out, towers)
+	return nil
+}
+
+func drawTowers(w io.Writer, towers []tower) {
+	const margin = 4
+	labels := make([]string, len(towers))
+	columns := make([]int, len(towers))
+	width, top := margin, 0
+	for i, t := range towers {
+		label := t.key
+		if len(label) > maxColumn {
+			label = label[:maxColumn-1] + "~"
+		}
+		if t.visited {
+			label += "*"
+		}
+		labels[i] = label
+		columns[i] = width
+		// room for the label, or at least for an arrow
+		width += len(label) + 2
+		if len(label) < 2 {
+			width += 2 - len(label)
+		}
+		if t.level > top {
+			top = t.level
+		}
+	}
+
+	row := make([]byte, width)
+	for level := top; level >= 1; level-- {
+		for i := range row {
+			row[i] = ' '
+		}
+		copy(row, fmt.Sprintf("L%d", level))
+		// links enter from the left, from keys out of the picture
+		from := margin
+		for i, t := range towers {
+			if t.level < level {
+				continue
+			}
+			for j := from; j < columns[i]; j++ {
+				row[j] = '-'
+			}
+			if columns[i] > from {
+				row[columns[i]-1] = '>'
+			}
+			row[columns[i]] = 'o'
+			from = columns[i] + 1
+		}
+		fmt.Fprintln(w, strings.TrimRight(string(row), " "))
+	}
+
+	for i := range row {
+		row[i] = ' '
+	}
+	for i, label := range labels {
+		copy(row[columns[i]:], label)
+	}
+	fmt.Fprintln(w, strings.TrimRight(string(row), " "))
+}
+
+func (sh *shell) load(args []string) error {
+	if len(args) != 1 {
+		return usage("load")
+	}
+	img, err := stashlist.OpenImage(args[0])
+	if err != nil {
+		return err
+	}
+	defer img.Close()
+
+	n := 0
+	img.Ascend("", "", func(key, value []byte) bool {
+		// the image is unmapped on return: the list keeps copies
+		if err = sh.st.Put(string(key), append([]byte(nil), value...)); err != nil {
+			return false
+		}
+		n++
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	if err := img.Err(); err != nil {
+		return err
+	}
+	fmt.Fprintf(sh.out, "loaded %d keys\n", n)
+	return nil
+}
+
+func (sh *shell) save(args []string) error {
+	if len(args) != 1 {
+		return usage("save")
+	}
+	list, ok := sh.st.(local)
+	if !ok {
+		// copy the remote pairs into a list first, page by page
+		list = local{list: stashlist.NewStashList()}
+		for start := ""; ; {
+			n := 0
+			err := sh.st.Scan(start, "", pageSize, func(key string, value []byte) {
+				list.list.Add(key, value)
+				start = key + "\x00"
+				n++
+			})
+			if err != nil {
+				return err
+			}
+			if n < pageSize {
+				break
+			}
+		}
+	}
+	if err := stashlist.BuildImage(list.list, args[0]); err != nil {
+		return err
+	}
+	fmt.Fprintf(sh.out, "saved %d keys\n", list.list.Length)
+	return nil
+}
+
+func (sh *shell) promote(args []string) error {
+	if len(args) != 1 {
+		return usage("promote")
+	}
+	ok, err := sh.st.Promote(args[0])
+	if err != nil {
+		return err
+	}
+	if !ok {
+		fmt.Fprintln(sh.out, "not promoted: no such key, or the tower is at the maximum level")
+		return nil
+	}
+	return sh.showTower(args[0])
+}
+
+func (sh *shell) demote(args []string) error {
+	if len(args) != 1 {
+		return usage("demote")
+	}
+	ok, err := sh.st.Demote(args[0])
+	if err != nil {
+		return err
+	}
+	if !ok {
+		fmt.Fprintln(sh.out, "not demoted: no such key, or the tower has a single level")
+		return nil
+	}
+	return sh.showTower(args[0])
+}
+
+// trace replays a workload file. Each line is put <key> <value>,
+// get <key> or del <key>; a line holding a bare key is a get. It reports
+// the hit ratio and how much the towers moved.
+func (sh *shell) trace(args []string) error {
+	if len(args) != 1 {
+		return usage("trace")
+	}
+	f, err := os.Open(args[0])
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	before, err := sh.st.Stats()
+	if err != nil {
+		return err
+	}
+	var gets, hits, puts, dels int
+	began := time.Now()
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1<<20)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if len(fields) == 1 {
+			fields = []string{"get", fields[0]}
+		}
+		switch op := strings.ToLower(fields[0]); {
+		case op == "get" && len(fields) == 2:
+			gets++
+			_, ok, err := sh.st.Get(fields[1])
+			if err != nil {
+				return err
+			}
+			if ok {
+				hits++
+			}
+		case (op == "put" || op == "set") && len(fields) >= 3:
+			puts++
+			err = sh.st.Put(fields[1], []byte(strings.Join(fields[2:], " ")))
+		case op == "del" && len(fields) == 2:
+			dels++
+			_, err = sh.st.Del(fields[1])
+		default:
+			return fmt.Errorf("%s:%d: bad operation %q", args[0], lineNo, scanner.Text())
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	elapsed := time.Since(began)
+
+	after, err := sh.st.Stats()
+	if err != nil {
+		return err
+	}
+	hitRatio := 0.0
+	if gets > 0 {
+		hitRatio = float64(hits) / float64(gets)
+	}
+	fmt.Fprintf(sh.out, "%d gets (%.1f%% hits), %d puts, %d dels in %v\n", gets, 100*hitRatio, puts, dels, elapsed.Round(time.Microsecond))
+	fmt.Fprintf(sh.out, "%d promotions, %d demotions, length %d -> %d\n",
+		after.Promotions-before.Promotions, after.Demotions-before.Demotions, before.Length, after.Length)
+	return nil
+}
+
+func (sh *shell) help(args []string) error {
+	names := make([]string, 0, len(shellCommands))
+	for name := range shellCommands {
+		if name != "exit" && name != "set" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintln(sh.out, shellCommands[name].usage)
+	}
+	return nil
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hey-kong/stashlist"
+)
+
+func newShell() (*shell, *bytes.Buffer) {
+	var out bytes.Buffer
+	return &shell{st: local{list: stashlist.NewStashList()}, out: &out}, &out
+}
+
+func TestShell(t *testing.T) {
+	sh, out := newShell()
+	cases := []struct {
+		line string
+		// out is a prefix of the output, err a part of the error
+		out, err string
+	}{
+		{line: "", out: ""},
+		{line: "# a comment", out: ""},
+		{line: "put a 1", out: "  tower: "},
+		{line: "SET b two words", out: "  tower: "},
+		{line: "get b", out: "\"two words\"\n  tower: "},
+		{line: "get zz", out: "(nil)\n"},
+		{line: "scan", out: "\"a\"\t\"1\"\n\"b\"\t\"two words\"\n"},
+		{line: "scan a b", out: "\"a\"\t\"1\"\n"},
+		{line: "scan \"\" \"\" 1", out: ""},
+		{line: "seek aa", out: "\"b\"\t\"two words\"\n"},
+		{line: "seek z", out: "(end of list)\n"},
+		{line: "del b", out: "removed: true\n"},
+		{line: "del b", out: "removed: false\n"},
+		{line: "stats", out: "length      1\n"},
+		{line: "promote zz", out: "not promoted"},
+		{line: "demote zz", out: "not demoted"},
+		{line: "levels", out: "L"},
+		{line: "levels zz", out: ""},
+		{line: "help", out: "del <key>"},
+
+		{line: "frob", err: `unknown command "frob"`},
+		{line: "put a", err: "usage: put <key> <value>"},
+		{line: "get", err: "usage: get <key>"},
+		{line: "del a b", err: "usage: del <key>"},
+		{line: "scan a b c d", err: "usage: scan"},
+		{line: "scan a b none", err: "usage: scan"},
+		{line: "seek", err: "usage: seek <key>"},
+		{line: "levels a 0", err: "usage: levels"},
+		{line: "load", err: "usage: load <file>"},
+		{line: "save a b", err: "usage: save <file>"},
+		{line: "promote", err: "usage: promote <key>"},
+		{line: "demote", err: "usage: demote <key>"},
+		{line: "trace", err: "usage: trace <file>"},
+		{line: "quit", err: errQuit.Error()},
+		{line: "exit", err: errQuit.Error()},
+	}
+	for _, c := range cases {
+		out.Reset()
+		err := sh.run(c.line)
+		switch {
+		case c.err == "" && err != nil:
+			t.Errorf("%q failed: %v", c.line, err)
+		case c.err != "" && (err == nil || !strings.Contains(err.Error(), c.err)):
+			t.Errorf("%q returned %v, want %q", c.line, err, c.err)
+		case !strings.HasPrefix(out.String(), c.out):
+			t.Errorf("%q printed %q, want %q first", c.line, out.String(), c.out)
+		}
+	}
+}
+
+func TestDrawTowers(t *testing.T) {
+	var out bytes.Buffer
+	drawTowers(&out, []tower{
+		{"apple", 3, true},
+		{"b", 1, true},
+		{"c", 1, false},
+		{"d", 3, true},
+		{"e", 1, true},
+		{"a-very-long-key", 2, false},
+	})
+	want := "" +
+		"L3  o-------------->o\n" +
+		"L2  o-------------->o------>o\n" +
+		"L1  o------>o-->o-->o-->o-->o\n" +
+		"    apple*  b*  c   d*  e*  a-very-lo~\n"
+	if out.String() != want {
+		t.Fatalf("drew\n%s\nwant\n%s", out.String(), want)
+	}
+}
+
+func TestLoadSave(t *testing.T) {
+	sh, out := newShell()
+	for _, line := range []string{"put a 1", "put b 2", "put c 3", "del b"} {
+		if err := sh.run(line); err != nil {
+			t.Fatal(err)
+		}
+	}
+	path := filepath.Join(t.TempDir(), "list.img")
+	out.Reset()
+	if err := sh.run("save " + path); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "saved 2 keys\n" {
+		t.Fatalf("save printed %q", out.String())
+	}
+
+	sh2, out2 := newShell()
+	if err := sh2.run("load " + path); err != nil {
+		t.Fatal(err)
+	}
+	if out2.String() != "loaded 2 keys\n" {
+		t.Fatalf("load printed %q", out2.String())
+	}
+	out2.Reset()
+	sh2.run("scan")
+	if out2.String() != "\"a\"\t\"1\"\n\"c\"\t\"3\"\n" {
+		t.Fatalf("loaded list holds %q", out2.String())
+	}
+
+	if err := sh2.run("load shell_test.go"); err != stashlist.ErrBadImage {
+		t.Fatal("loading a file that is not an image returned", err)
+	}
+}
+
+func TestTrace(t *testing.T) {
+	sh, out := newShell()
+	dir := t.TempDir()
+	path := filepath.Join(dir, "workload")
+	workload := "# warm up\nput a 1\nget a\nb\n\nset b 2 3\nGET b\ndel a\nget a\n"
+	if err := os.WriteFile(path, []byte(workload), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := sh.run("trace " + path); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(out.String(), "\n")
+	if !strings.HasPrefix(lines[0], "4 gets (50.0% hits), 2 puts, 1 dels in ") {
+		t.Fatalf("trace printed %q", out.String())
+	}
+	if !strings.HasSuffix(lines[1], "length 0 -> 1") {
+		t.Fatalf("trace printed %q", out.String())
+	}
+
+	bad := filepath.Join(dir, "bad")
+	if err := os.WriteFile(bad, []byte("put a 1\nfrob a\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := sh.run("trace " + bad); err == nil || !strings.Contains(err.Error(), "bad:2: bad operation") {
+		t.Fatal("a bad workload line returned", err)
+	}
+	if err := sh.run("trace " + filepath.Join(dir, "missing")); !os.IsNotExist(err) {
+		t.Fatal("a missing workload returned", err)
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/hey-kong/stashlist"
+	"github.com/hey-kong/stashlist/client"
+)
+
+// store is the list the shell works on, in process or behind a stashd
+// server.
+type store interface {
+	Put(key string, value []byte) error
+	Get(key string) ([]byte, bool, error)
+	Del(key string) (bool, error)
+	// Scan calls fn for the pairs with start <= key < end, at most limit of
+	// them. An empty end means no upper bound.
+	Scan(start, end string, limit int, fn func(key string, value []byte)) error
+	Stats() (stashlist.Stats, error)
+	// Towers calls fn for the towers of at most limit keys from start on.
+	Towers(start string, limit int, fn func(key string, level int, visited bool)) error
+	Promote(key string) (bool, error)
+	Demote(key string) (bool, error)
+}
+
+// local is a store over a list in this process.
+type local struct {
+	list *stashlist.StashList
+}
+
+func (l local) Put(key string, value []byte) error {
+	l.list.Add(key, value)
+	return nil
+}
+
+func (l local) Get(key string) ([]byte, bool, error) {
+	value, ok := l.list.Get(key)
+	return value, ok, nil
+}
+
+func (l local) Del(key string) (bool, error) {
+	return l.list.Remove(key) != nil, nil
+}
+
+func (l local) Scan(start, end string, limit int, fn func(key string, value []byte)) error {
+	it := l.list.NewIterator()
+	for it.Seek(start); it.Valid() && (end == "" || it.Key() < end) && limit > 0; it.Next() {
+		fn(it.Key(), it.Value())
+		limit--
+	}
+	return nil
+}
+
+func (l local) Stats() (stashlist.Stats, error) {
+	return l.list.Stats(), nil
+}
+
+func (l local) Towers(start string, limit int, fn func(key string, level int, visited bool)) error {
+	l.list.Towers(start, func(key string, level int, visited bool) bool {
+		if limit == 0 {
+			return false
+		}
+		fn(key, level, visited)
+		limit--
+		return true
+	})
+	return nil
+}
+
+func (l local) Promote(key string) (bool, error) {
+	return l.list.Promote(key), nil
+}
+
+func (l local) Demote(key string) (bool, error) {
+	return l.list.Demote(key), nil
+}
+
+// remote is a store served by stashd.
+type remote struct {
+	c *client.Client
+}
+
+func (r remote) Put(key string, value []byte) error {
+	return r.c.Set(context.Background(), key, value, 0)
+}
+
+func (r remote) Get(key string) ([]byte, bool, error) {
+	return r.c.Get(context.Background(), key)
+}
+
+func (r remote) Del(key string) (bool, error) {
+	n, err := r.c.Delete(context.Background(), key)
+	return n == 1, err
+}
+
+func (r remote) Scan(start, end string, limit int, fn func(key string, value []byte)) error {
+	it := r.c.Range(context.Background(), start, end)
+	for ; limit > 0 && it.Next(); limit-- {
+		fn(it.Key(), it.Value())
+	}
+	return it.Err()
+}
+
+// Stats parses the stashlist section of INFO.
+func (r remote) Stats() (stashlist.Stats, error) {
+	var stats stashlist.Stats
+	reply, err := r.c.Do(context.Background(), "INFO", "stashlist")
+	if err != nil {
+		return stats, err
+	}
+	info, _ := reply.([]byte)
+	for _, line := range strings.Split(string(info), "\r\n") {
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		n, _ := strconv.ParseUint(value, 10, 64)
+		switch name {
+		case "length":
+			stats.Length = int(n)
+		case "max_level":
+			stats.MaxLevel = int(n)
+			for len(stats.Levels) < stats.MaxLevel {
+				stats.Levels = append(stats.Levels, 0)
+			}
+		case "visited":
+			stats.Visited = int(n)
+		case "promotions":
+			stats.Promotions = n
+		case "demotions":
+			stats.Demotions = n
+		case "evictions":
+			stats.Evictions = n
+		default:
+			if level, err := strconv.Atoi(strings.TrimPrefix(name, "level_")); err == nil && level >= 1 && level <= len(stats.Levels) {
+				stats.Levels[level-1] = int(n)
+			}
+		}
+	}
+	return stats, nil
+}
+
+func (r remote) Towers(start string, limit int, fn func(key string, level int, visited bool)) error {
+	reply, err := r.c.Do(context.Background(), "TOWERS", start, "LIMIT", strconv.Itoa(limit))
+	if err != nil {
+		return err
+	}
+	towers, _ := reply.([]any)
+	for _, t := range towers {
+		fields, ok := t.([]any)
+		if !ok || len(fields) != 3 {
+			return fmt.Errorf("unexpected reply %v", reply)
+		}
+		key, _ := fields[0].([]byte)
+		level, _ := fields[1].(int64)
+		fn(string(key), int(level), fields[2] == int64(1))
+	}
+	return nil
+}
+
+func (r remote) Promote(key string) (bool, error) {
+	reply, err := r.c.Do(context.Background(), "PROMOTE", key)
+	return reply == int64(1), err
+}
+
+func (r remote) Demote(key string) (bool, error) {
+	reply, err := r.c.Do(context.Background(), "DEMOTE", key)
+	return reply == int64(1), err
+}
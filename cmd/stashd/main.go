@@ -0,0 +1,80 @@
+// Command stashd serves a StashList over the Redis protocol, or a cache
+// over the memcached protocol.
+//
+//	stashd -addr localhost:6379
+//	redis-benchmark -p 6379 -t set,get
+//
+//	stashd -protocol memcache -addr localhost:11211 -policy sieve -max-entries 100000
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/hey-kong/stashlist"
+	"github.com/hey-kong/stashlist/cache"
+	"github.com/hey-kong/stashlist/cache/lru"
+	"github.com/hey-kong/stashlist/cache/sieve"
+	"github.com/hey-kong/stashlist/memcache"
+	"github.com/hey-kong/stashlist/server"
+)
+
+type listener interface {
+	ListenAndServe(addr string) error
+	Close() error
+}
+
+func main() {
+	addr := flag.String("addr", "localhost:6379", "address to listen on")
+	protocol := flag.String("protocol", "resp", "protocol to serve: resp or memcache")
+	policy := flag.String("policy", "stashlist", "eviction policy of the memcache protocol: stashlist, lru or sieve")
+	maxEntries := flag.Int("max-entries", 0, "maximum number of keys, 0 for no limit")
+	maxLevel := flag.Int("maxlevel", stashlist.DefaultMaxLevel, "maximum tower height of the list")
+	flag.Parse()
+
+	var srv listener
+	switch *protocol {
+	case "resp":
+		if *policy != "stashlist" {
+			log.Fatalf("the resp protocol needs the ordered stashlist policy, not %s", *policy)
+		}
+		list := stashlist.NewWithMaxLevel(*maxLevel)
+		list.MaxEntries = *maxEntries
+		srv = server.New(list)
+	case "memcache":
+		var c cache.Cache
+		switch *policy {
+		case "stashlist":
+			list := stashlist.NewWithMaxLevel(*maxLevel)
+			list.MaxEntries = *maxEntries
+			c = cache.FromStashList(list)
+		case "lru":
+			c = lru.New(*maxEntries)
+		case "sieve":
+			c = sieve.New(*maxEntries)
+		default:
+			log.Fatalf("unknown policy %s", *policy)
+		}
+		mc := memcache.New(c)
+		c.SetOnEvicted(mc.Evicted)
+		mc.Policy = *policy
+		srv = mc
+	default:
+		log.Fatalf("unknown protocol %s", *protocol)
+	}
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sig
+		srv.Close()
+	}()
+
+	log.Printf("stashd serving %s on %s", *protocol, *addr)
+	if err := srv.ListenAndServe(*addr); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,107 @@
+package stashlist
+
+// Frequency estimates how often keys are used, such as the Count-Min
+// sketch of cache/tinylfu.
+type Frequency interface {
+	// Increment records a use of key.
+	Increment(key string)
+	// Estimate returns about how many times key was used recently.
+	Estimate(key string) int
+}
+
+// evict removes elements until the list fits in MaxEntries. Like SIEVE, a
+// hand sweeps the bottom level, in key order, wrapping around at the end:
+// visited elements get a second chance and lose their mark, the first
+// unvisited one is evicted. keep, the element just written, is spared.
+func (list *StashList) evict(keep *Element) {
+	for list.MaxEntries > 0 && list.Length > list.MaxEntries {
+		element := list.victim(keep)
+		list.hand = element.next[0]
+		key, value := element.key, element.value
+		list.removeElement(list.findPrevElementNodes(key), element, EventEvict)
+		list.evictions++
+		if list.OnEvicted != nil {
+			list.OnEvicted(key, value)
+		}
+	}
+}
+
+// victim sweeps the hand to the next element to evict, clearing the visited
+// marks it passes, and returns it. The hand itself is not moved, so evict
+// picks the same element next.
+func (list *StashList) victim(keep *Element) *Element {
+	element := list.hand
+	for {
+		if element == nil {
+			element = list.next[0]
+		}
+		if element.deleted || element == keep {
+			element = element.next[0]
+			continue
+		}
+		if !element.visited {
+			return element
+		}
+		element.visited = false
+		element = element.next[0]
+	}
+}
+
+// candidate returns the element victim would pick, without clearing the
+// visited marks on the way: a rejected key must not cost the others their
+// second chance.
+func (list *StashList) candidate() *Element {
+	var first *Element
+	sweep := func(from, to *Element) *Element {
+		for element := from; element != to; element = element.next[0] {
+			if element.deleted {
+				continue
+			}
+			if first == nil {
+				first = element
+			}
+			if !element.visited {
+				return element
+			}
+		}
+		return nil
+	}
+	if element := sweep(list.hand, nil); element != nil {
+		return element
+	}
+	if element := sweep(list.next[0], list.hand); element != nil {
+		return element
+	}
+	// every element is visited: victim clears them all and comes back
+	return first
+}
+
+// admit reports whether a new key may enter the list. With an Admission
+// set, a full list only takes in a key estimated more frequent than the
+// victim of the next eviction.
+func (list *StashList) admit(key string) bool {
+	if list.Admission == nil || list.MaxEntries <= 0 || list.Length < list.MaxEntries {
+		return true
+	}
+	if list.Admission.Estimate(key) > list.Admission.Estimate(list.candidate().key) {
+		return true
+	}
+	list.rejections++
+	return false
+}
+
+// Resize sets MaxEntries and evicts the keys beyond it. Returns the number
+// of keys evicted.
+func (list *StashList) Resize(maxEntries int) int {
+	before := list.evictions
+	list.MaxEntries = maxEntries
+	list.evict(nil)
+	return int(list.evictions - before)
+}
+
+// moveHand keeps the eviction hand off an element leaving the list.
+func (list *StashList) moveHand(element *Element) {
+	if list.hand == element {
+		list.hand = element.next[0]
+	}
+}
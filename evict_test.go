@@ -0,0 +1,152 @@
+package stashlist
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/hey-kong/stashlist/cache/tinylfu"
+)
+
+func TestMaxEntries(t *testing.T) {
+	list := NewStashList()
+	list.MaxEntries = 100
+	var evicted []string
+	list.OnEvicted = func(key string, value []byte) {
+		evicted = append(evicted, key)
+	}
+
+	for i := 0; i < 100; i++ {
+		list.Add(strconv.Itoa(i), []byte("v"))
+	}
+	// keep half of the keys hot
+	for i := 0; i < 100; i += 2 {
+		list.Get(strconv.Itoa(i))
+	}
+	for i := 100; i < 150; i++ {
+		list.Add(strconv.Itoa(i), []byte("v"))
+		if _, ok := list.Get(strconv.Itoa(i)); !ok {
+			t.Fatal("the key just added was evicted")
+		}
+	}
+
+	if list.Length != 100 || len(evicted) != 50 || list.Stats().Evictions != 50 {
+		t.Fatal("wrong number of evictions", list.Length, len(evicted))
+	}
+	n := 0
+	for element := list.Front(); element != nil; element = element.Next() {
+		n++
+	}
+	if n != 100 {
+		t.Fatal("list holds", n, "elements")
+	}
+	for _, key := range evicted {
+		if _, ok := list.Get(key); ok {
+			t.Fatal("evicted key", key, "is still readable")
+		}
+	}
+}
+
+func TestEvictWithSnapshot(t *testing.T) {
+	list := NewStashList()
+	list.MaxEntries = 2
+	list.Add("a", nil)
+	list.Add("b", nil)
+	snap := list.Snapshot()
+	list.Add("c", nil)
+	list.Add("d", nil)
+	if list.Length != 2 {
+		t.Fatal("list holds", list.Length, "keys")
+	}
+	if _, ok := snap.Get("a"); !ok {
+		t.Fatal("snapshot lost an evicted key")
+	}
+	snap.Release()
+	list.Add("e", nil)
+	if list.Length != 2 {
+		t.Fatal("list holds", list.Length, "keys")
+	}
+}
+
+func TestResize(t *testing.T) {
+	list := NewStashList()
+	evicted := 0
+	list.OnEvicted = func(string, []byte) { evicted++ }
+	for i := 0; i < 10; i++ {
+		list.Add(strconv.Itoa(i), nil)
+	}
+	list.Get("3")
+	if v, ok := list.Peek("3"); !ok || v != nil {
+		t.Fatal("Peek missed a key")
+	}
+
+	if n := list.Resize(4); n != 6 || evicted != 6 || list.Length != 4 {
+		t.Fatal("Resize evicted", n, "keys, called back", evicted, "times, left", list.Length)
+	}
+	if n := list.Resize(0); n != 0 {
+		t.Fatal("unbounding evicted", n, "keys")
+	}
+}
+
+func TestAdmission(t *testing.T) {
+	list := NewStashList()
+	list.MaxEntries = 100
+	list.Admission = tinylfu.NewSketch(100)
+	for i := 0; i < 100; i++ {
+		list.Add(strconv.Itoa(i), nil)
+		list.Get(strconv.Itoa(i))
+		list.Get(strconv.Itoa(i))
+	}
+
+	// keys seen once do not displace the frequent ones
+	for i := 1000; i < 1400; i++ {
+		list.Add(strconv.Itoa(i), nil)
+		if _, ok := list.Peek(strconv.Itoa(i)); ok {
+			t.Fatal("one-hit wonder", i, "was admitted")
+		}
+	}
+	stats := list.Stats()
+	if list.Length != 100 || stats.Evictions != 0 || stats.Rejections != 400 {
+		t.Fatal(list.Length, "keys,", stats.Evictions, "evictions,", stats.Rejections, "rejections")
+	}
+	if stats.Visited != 100 {
+		t.Fatal("rejections cleared the visited marks of", 100-stats.Visited, "keys")
+	}
+
+	// a key seen often enough gets in
+	for i := 0; i < 8; i++ {
+		list.Add("hot", nil)
+	}
+	if _, ok := list.Peek("hot"); !ok || list.Stats().Evictions != 1 {
+		t.Fatal("a frequent key was not admitted")
+	}
+}
+
+func TestAdmissionPromotion(t *testing.T) {
+	list := NewStashList()
+	list.Admission = tinylfu.NewSketch(100)
+	// a taller key in front, for k to be promoted up to
+	list.Add("a", nil)
+	for list.Promote("a") {
+	}
+	list.Add("k", nil)
+	for list.Front().Next().level < 4 {
+		list.Promote("k")
+	}
+	for list.Front().Next().level > 4 {
+		list.Demote("k")
+	}
+
+	// a rewrite only promotes a key more frequent than its height
+	before := list.Stats().Promotions
+	list.Add("k", nil)
+	if list.Stats().Promotions != before {
+		t.Fatal("a key seen twice was promoted to level", list.Front().Next().level)
+	}
+	for i := 0; i < 4; i++ {
+		list.Get("k")
+	}
+	list.Add("k", nil)
+	if list.Stats().Promotions != before+1 || list.Front().Next().level != 5 {
+		t.Fatal("a frequent key was not promoted")
+	}
+}
@@ -0,0 +1,322 @@
+// Package httpapi serves a StashList over HTTP with JSON responses:
+//
+//	PUT    /kv/{key}              store the request body, ?ttl=30s sets a TTL
+//	GET    /kv/{key}              the value, as application/octet-stream
+//	DELETE /kv/{key}
+//	GET    /range?start=&end=&limit=&token=
+//	GET    /admin/stats           level histogram, promotions, visited ratio
+//	GET    /admin/dump?start=&limit=&format=text
+//
+// Range and dump responses carry a continuation token in "next" when they
+// stop early; pass it back as token to resume. Tokens are stateless.
+package httpapi
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/hey-kong/stashlist"
+)
+
+const (
+	defaultLimit = 100
+	maxLimit     = 10000
+	maxValueSize = 32 << 20
+)
+
+// Handler serves one StashList. Requests are executed one at a time.
+type Handler struct {
+	mu   sync.Mutex
+	list *stashlist.StashList
+}
+
+// New returns a handler for list. The list must not be used directly while
+// the handler serves requests.
+func New(list *stashlist.StashList) *Handler {
+	return &Handler{list: list}
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := r.URL.Path
+	switch {
+	case strings.HasPrefix(path, "/kv/") && len(path) > len("/kv/"):
+		h.serveKey(w, r, path[len("/kv/"):])
+	case path == "/range":
+		if allow(w, r, http.MethodGet) {
+			h.serveRange(w, r)
+		}
+	case path == "/admin/stats":
+		if allow(w, r, http.MethodGet) {
+			h.serveStats(w)
+		}
+	case path == "/admin/dump":
+		if allow(w, r, http.MethodGet) {
+			h.serveDump(w, r)
+		}
+	default:
+		writeError(w, http.StatusNotFound, "not found")
+	}
+}
+
+func (h *Handler) serveKey(w http.ResponseWriter, r *http.Request, key string) {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		h.mu.Lock()
+		value, ok := h.list.Get(key)
+		h.mu.Unlock()
+		if !ok {
+			writeError(w, http.StatusNotFound, "key not found")
+			return
+		}
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("Content-Length", strconv.Itoa(len(value)))
+		w.Write(value)
+
+	case http.MethodPut:
+		var ttl time.Duration
+		if s := r.URL.Query().Get("ttl"); s != "" {
+			var err error
+			if ttl, err = time.ParseDuration(s); err != nil || ttl <= 0 {
+				writeError(w, http.StatusBadRequest, "invalid ttl")
+				return
+			}
+		}
+		value, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxValueSize))
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				writeError(w, http.StatusRequestEntityTooLarge, "value too large")
+				return
+			}
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		h.mu.Lock()
+		h.list.Add(key, value)
+		if ttl > 0 {
+			h.list.Expire(key, ttl)
+		}
+		h.mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+
+	case http.MethodDelete:
+		h.mu.Lock()
+		removed := h.list.Remove(key) != nil
+		h.mu.Unlock()
+		if !removed {
+			writeError(w, http.StatusNotFound, "key not found")
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		w.Header().Set("Allow", "GET, HEAD, PUT, DELETE")
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// item is a key-value pair in a range response. Values that are not valid
+// UTF-8 are sent in base64.
+type item struct {
+	Key         string `json:"key"`
+	Value       string `json:"value,omitempty"`
+	ValueBase64 string `json:"value_base64,omitempty"`
+}
+
+type rangeResponse struct {
+	Items []item `json:"items"`
+	Next  string `json:"next,omitempty"`
+}
+
+// serveRange returns the pairs with start <= key < end. An empty end means
+// no upper bound.
+func (h *Handler) serveRange(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	start, end := q.Get("start"), q.Get("end")
+	limit, err := parseLimit(q.Get("limit"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if token := q.Get("token"); token != "" {
+		if start, err = decodeToken(token); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	resp := rangeResponse{Items: []item{}}
+	h.mu.Lock()
+	it := h.list.NewIterator()
+	for it.Seek(start); it.Valid() && (end == "" || it.Key() < end); it.Next() {
+		if len(resp.Items) == limit {
+			resp.Next = encodeToken(it.Key())
+			break
+		}
+		entry := item{Key: it.Key()}
+		if utf8.Valid(it.Value()) {
+			entry.Value = string(it.Value())
+		} else {
+			entry.ValueBase64 = base64.StdEncoding.EncodeToString(it.Value())
+		}
+		resp.Items = append(resp.Items, entry)
+	}
+	h.mu.Unlock()
+
+	writeJSON(w, resp)
+}
+
+type statsResponse struct {
+	Length       int            `json:"length"`
+	MaxLevel     int            `json:"max_level"`
+	Levels       map[string]int `json:"levels"`
+	Visited      int            `json:"visited"`
+	VisitedRatio float64        `json:"visited_ratio"`
+	Promotions   uint64         `json:"promotions"`
+	Demotions    uint64         `json:"demotions"`
+	Evictions    uint64         `json:"evictions"`
+	Expiring     int            `json:"expiring"`
+}
+
+func (h *Handler) serveStats(w http.ResponseWriter) {
+	h.mu.Lock()
+	stats := h.list.Stats()
+	h.mu.Unlock()
+
+	resp := statsResponse{
+		Length:     stats.Length,
+		MaxLevel:   stats.MaxLevel,
+		Levels:     make(map[string]int),
+		Visited:    stats.Visited,
+		Promotions: stats.Promotions,
+		Demotions:  stats.Demotions,
+		Evictions:  stats.Evictions,
+		Expiring:   stats.Expiring,
+	}
+	for i, n := range stats.Levels {
+		if n > 0 {
+			resp.Levels[strconv.Itoa(i+1)] = n
+		}
+	}
+	if stats.Length > 0 {
+		resp.VisitedRatio = float64(stats.Visited) / float64(stats.Length)
+	}
+	writeJSON(w, resp)
+}
+
+type tower struct {
+	Key     string `json:"key"`
+	Level   int    `json:"level"`
+	Visited bool   `json:"visited"`
+}
+
+type dumpResponse struct {
+	Towers []tower `json:"towers"`
+	Next   string  `json:"next,omitempty"`
+}
+
+// serveDump lists the towers in key order. With format=text it draws them,
+// one line per key, a * marking visited elements.
+func (h *Handler) serveDump(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	start := q.Get("start")
+	limit, err := parseLimit(q.Get("limit"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if token := q.Get("token"); token != "" {
+		if start, err = decodeToken(token); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	resp := dumpResponse{Towers: []tower{}}
+	h.mu.Lock()
+	h.list.Towers(start, func(key string, level int, visited bool) bool {
+		if len(resp.Towers) == limit {
+			resp.Next = encodeToken(key)
+			return false
+		}
+		resp.Towers = append(resp.Towers, tower{Key: key, Level: level, Visited: visited})
+		return true
+	})
+	h.mu.Unlock()
+
+	if q.Get("format") != "text" {
+		writeJSON(w, resp)
+		return
+	}
+	width := 0
+	for _, t := range resp.Towers {
+		if t.Level > width {
+			width = t.Level
+		}
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	for _, t := range resp.Towers {
+		mark := " "
+		if t.Visited {
+			mark = "*"
+		}
+		fmt.Fprintf(w, "%-*s %s %q\n", width, strings.Repeat("#", t.Level), mark, t.Key)
+	}
+	if resp.Next != "" {
+		fmt.Fprintf(w, "next: %s\n", resp.Next)
+	}
+}
+
+func parseLimit(s string) (int, error) {
+	if s == "" {
+		return defaultLimit, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 1 || n > maxLimit {
+		return 0, fmt.Errorf("limit must be between 1 and %d", maxLimit)
+	}
+	return n, nil
+}
+
+// A continuation token is the key to resume from, in URL-safe base64.
+func encodeToken(key string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(key))
+}
+
+func decodeToken(token string) (string, error) {
+	key, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return "", errors.New("invalid token")
+	}
+	return string(key), nil
+}
+
+func allow(w http.ResponseWriter, r *http.Request, method string) bool {
+	if r.Method == method || method == http.MethodGet && r.Method == http.MethodHead {
+		return true
+	}
+	w.Header().Set("Allow", method)
+	writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	return false
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": msg})
+}
@@ -0,0 +1,134 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/hey-kong/stashlist"
+)
+
+func do(t *testing.T, h http.Handler, method, target, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	var r io.Reader
+	if body != "" {
+		r = strings.NewReader(body)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(method, target, r))
+	return w
+}
+
+func TestKeys(t *testing.T) {
+	h := New(stashlist.NewStashList())
+
+	if w := do(t, h, "GET", "/kv/a", ""); w.Code != http.StatusNotFound {
+		t.Fatal("GET of a missing key returned", w.Code)
+	}
+	if w := do(t, h, "PUT", "/kv/a/b", "hello"); w.Code != http.StatusNoContent {
+		t.Fatal("PUT returned", w.Code, w.Body)
+	}
+	if w := do(t, h, "GET", "/kv/a/b", ""); w.Code != http.StatusOK || w.Body.String() != "hello" {
+		t.Fatal("GET returned", w.Code, w.Body)
+	}
+	if w := do(t, h, "PUT", "/kv/t?ttl=bogus", "x"); w.Code != http.StatusBadRequest {
+		t.Fatal("PUT with a bad TTL returned", w.Code)
+	}
+	if w := do(t, h, "DELETE", "/kv/a/b", ""); w.Code != http.StatusNoContent {
+		t.Fatal("DELETE returned", w.Code)
+	}
+	if w := do(t, h, "DELETE", "/kv/a/b", ""); w.Code != http.StatusNotFound {
+		t.Fatal("second DELETE returned", w.Code)
+	}
+	if w := do(t, h, "POST", "/kv/a", "x"); w.Code != http.StatusMethodNotAllowed {
+		t.Fatal("POST returned", w.Code)
+	}
+	if w := do(t, h, "GET", "/nope", ""); w.Code != http.StatusNotFound {
+		t.Fatal("unknown path returned", w.Code)
+	}
+}
+
+func TestRangePagination(t *testing.T) {
+	list := stashlist.NewStashList()
+	for i := 0; i < 25; i++ {
+		list.Add("k"+strconv.Itoa(100+i), []byte(strconv.Itoa(i)))
+	}
+	list.Add("z", []byte{0xff})
+	h := New(list)
+
+	var keys []string
+	target := "/range?start=k105&end=k120&limit=4"
+	for pages := 0; ; pages++ {
+		w := do(t, h, "GET", target, "")
+		var resp rangeResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || w.Code != http.StatusOK {
+			t.Fatal(w.Code, w.Body, err)
+		}
+		for _, it := range resp.Items {
+			keys = append(keys, it.Key)
+		}
+		if resp.Next == "" {
+			break
+		}
+		if pages > 10 {
+			t.Fatal("pagination does not end")
+		}
+		target = "/range?end=k120&limit=4&token=" + resp.Next
+	}
+	if len(keys) != 15 || keys[0] != "k105" || keys[14] != "k119" {
+		t.Fatal("range returned", keys)
+	}
+
+	w := do(t, h, "GET", "/range?start=z", "")
+	var resp rangeResponse
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if len(resp.Items) != 1 || resp.Items[0].ValueBase64 != "/w==" {
+		t.Fatal("binary value returned as", w.Body)
+	}
+	if w := do(t, h, "GET", "/range?limit=0", ""); w.Code != http.StatusBadRequest {
+		t.Fatal("zero limit returned", w.Code)
+	}
+}
+
+func TestAdmin(t *testing.T) {
+	list := stashlist.NewStashList()
+	for i := 0; i < 50; i++ {
+		list.Add(strconv.Itoa(i), nil)
+	}
+	list.Get("1")
+	h := New(list)
+
+	w := do(t, h, "GET", "/admin/stats", "")
+	var stats statsResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &stats); err != nil {
+		t.Fatal(err)
+	}
+	total := 0
+	for _, n := range stats.Levels {
+		total += n
+	}
+	if stats.Length != 50 || total != 50 || stats.VisitedRatio <= 0 {
+		t.Fatalf("wrong stats %+v", stats)
+	}
+
+	w = do(t, h, "GET", "/admin/dump?limit=10", "")
+	var dump dumpResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &dump); err != nil {
+		t.Fatal(err)
+	}
+	if len(dump.Towers) != 10 || dump.Next == "" || dump.Towers[0].Key != "0" {
+		t.Fatalf("wrong dump %+v", dump)
+	}
+
+	w = do(t, h, "GET", "/admin/dump?format=text&start=9", "")
+	if lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n"); len(lines) != 1 || !strings.HasSuffix(lines[0], `"9"`) {
+		t.Fatalf("wrong text dump %q", w.Body)
+	}
+	if w := do(t, h, "PUT", "/admin/stats", ""); w.Code != http.StatusMethodNotAllowed {
+		t.Fatal("PUT on stats returned", w.Code)
+	}
+}
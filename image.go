@@ -0,0 +1,316 @@
+package stashlist
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"os"
+	"sync/atomic"
+)
+
+// An image is a StashList flattened into a file, with towers stored as
+// file offsets, so that it can be searched in place once mapped in memory.
+// All integers are little-endian. The layout is:
+//
+//	header  magic u64, element count u64, file size u64, max level u32,
+//	        reserved u32
+//	head    max level u64 offsets, the first element of each level
+//	element level u8, reserved 3 bytes, key length u32, value length u32,
+//	        level u64 offsets of the next element on each level,
+//	        key, value
+//
+// An offset of 0 means the end of the level. Elements are stored in key
+// order and keep the height their tower had in the list, so that every
+// offset points further into the file than the element holding it.
+const (
+	imageMagic      = 0x474d494853415453 // "STASHIMG"
+	imageHeaderSize = 32
+	imageNodeSize   = 12
+)
+
+// ErrBadImage is returned by OpenImage for files that are not images, or
+// whose size is not the one recorded, and by Image.Err once a read came
+// across a corrupt element.
+var ErrBadImage = errors.New("stashlist: bad image file")
+
+// BuildImage writes the live elements of list to an image file at path,
+// leaving out those whose time to live has run out. The file is written to
+// a temporary name first and renamed into place.
+func BuildImage(list *StashList, path string) error {
+	var elements []*Element
+	var levels []uint8
+	var offsets []uint64
+
+	// first pass: lay out the elements
+	maxLevel := list.maxLevel
+	offset := uint64(imageHeaderSize + 8*maxLevel)
+	towers := 0
+	for e := list.Front(); e != nil; e = e.Next() {
+		if list.expired(e) {
+			continue
+		}
+		level := e.level
+		if level < 1 {
+			level = 1
+		} else if level > maxLevel {
+			level = maxLevel
+		}
+		elements = append(elements, e)
+		levels = append(levels, uint8(level))
+		offsets = append(offsets, offset)
+		offset += uint64(imageNodeSize + 8*level + len(e.key) + len(e.value))
+		towers += level
+	}
+
+	// second pass, backwards: resolve the next offsets of every tower
+	nexts := make([]uint64, towers)
+	head := make([]uint64, maxLevel)
+	for i := len(elements) - 1; i >= 0; i-- {
+		towers -= int(levels[i])
+		for l := 0; l < int(levels[i]); l++ {
+			nexts[towers+l] = head[l]
+			head[l] = offsets[i]
+		}
+	}
+
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+
+	buf := make([]byte, 0, imageHeaderSize+8*maxLevel)
+	buf = binary.LittleEndian.AppendUint64(buf, imageMagic)
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(len(elements)))
+	buf = binary.LittleEndian.AppendUint64(buf, offset)
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(maxLevel))
+	buf = binary.LittleEndian.AppendUint32(buf, 0)
+	for _, off := range head {
+		buf = binary.LittleEndian.AppendUint64(buf, off)
+	}
+	w.Write(buf)
+
+	for i, e := range elements {
+		level := int(levels[i])
+		buf = append(buf[:0], levels[i], 0, 0, 0)
+		buf = binary.LittleEndian.AppendUint32(buf, uint32(len(e.key)))
+		buf = binary.LittleEndian.AppendUint32(buf, uint32(len(e.value)))
+		for _, off := range nexts[towers : towers+level] {
+			buf = binary.LittleEndian.AppendUint64(buf, off)
+		}
+		towers += level
+		w.Write(buf)
+		w.WriteString(e.key)
+		w.Write(e.value)
+	}
+
+	if err := w.Flush(); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Image is a read-only StashList served straight from a memory-mapped image
+// file. Opening it costs no more than mapping the file: pages are loaded by
+// the operating system as they are searched. Lookups and scans do not
+// allocate, and the key and value slices they return point into the
+// mapping, so they must not be modified or used after Close.
+//
+// An Image is safe for concurrent use. It never promotes or demotes: the
+// towers are the ones the list had when the image was built.
+//
+// Only the header is checked when the image is opened. The elements are
+// checked as they are read: a read that comes across a corrupt one stops
+// there, as if the list ended, and Err reports it.
+type Image struct {
+	data     []byte
+	count    int
+	maxLevel int
+	corrupt  atomic.Bool
+}
+
+// OpenImage maps the image file at path.
+func OpenImage(path string) (*Image, error) {
+	data, err := mapFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < imageHeaderSize || binary.LittleEndian.Uint64(data) != imageMagic {
+		unmapFile(data)
+		return nil, ErrBadImage
+	}
+	size := binary.LittleEndian.Uint64(data[16:])
+	maxLevel := int(binary.LittleEndian.Uint32(data[24:]))
+	if size != uint64(len(data)) || maxLevel < 1 || maxLevel > 255 || len(data) < imageHeaderSize+8*maxLevel {
+		unmapFile(data)
+		return nil, ErrBadImage
+	}
+	return &Image{
+		data:     data,
+		count:    int(binary.LittleEndian.Uint64(data[8:])),
+		maxLevel: maxLevel,
+	}, nil
+}
+
+// Err returns ErrBadImage if a read came across a corrupt element, nil
+// otherwise.
+func (img *Image) Err() error {
+	if img.corrupt.Load() {
+		return ErrBadImage
+	}
+	return nil
+}
+
+// Close unmaps the image.
+func (img *Image) Close() error {
+	data := img.data
+	img.data = nil
+	if data == nil {
+		return nil
+	}
+	return unmapFile(data)
+}
+
+// Len returns the number of elements in the image.
+func (img *Image) Len() int {
+	return img.count
+}
+
+// Get finds the value of key.
+func (img *Image) Get(key string) ([]byte, bool) {
+	off := img.seek(key)
+	if off != 0 && compareKey(img.key(off), key) == 0 {
+		return img.value(off), true
+	}
+	return nil, false
+}
+
+// Ascend calls fn for every element with a key in [start, end), in key
+// order, until fn returns false. An empty end means no upper bound.
+func (img *Image) Ascend(start, end string, fn func(key, value []byte) bool) {
+	for off := img.seek(start); off != 0; off = img.next(off, 0) {
+		key := img.key(off)
+		if end != "" && compareKey(key, end) >= 0 {
+			return
+		}
+		if !fn(key, img.value(off)) {
+			return
+		}
+	}
+}
+
+// seek returns the offset of the first element whose key is greater than
+// or equal to key, or 0.
+func (img *Image) seek(key string) uint64 {
+	// off is the current element, starting with the head at 0
+	var off, next uint64
+
+	for i := img.maxLevel - 1; i >= 0; i-- {
+		next = img.next(off, i)
+
+		for next != 0 && compareKey(img.key(next), key) < 0 {
+			off = next
+			next = img.next(off, i)
+		}
+	}
+
+	return next
+}
+
+// next returns the offset of the element following the one at off on
+// level, off being 0 for the head, or 0 at the end of the level. Elements
+// that are corrupt or lead to one end the level too, so that the elements
+// returned can be decoded safely.
+func (img *Image) next(off uint64, level int) uint64 {
+	tower := uint64(imageHeaderSize)
+	if off != 0 {
+		height, _, _, ok := img.node(off)
+		if !ok || uint64(level) >= height {
+			img.corrupt.Store(true)
+			return 0
+		}
+		tower = off + imageNodeSize
+	}
+	next := binary.LittleEndian.Uint64(img.data[tower+8*uint64(level):])
+	if next == 0 {
+		return 0
+	}
+	// the elements are in file order, which also rules out cycles
+	if _, _, _, ok := img.node(next); !ok || next <= off {
+		img.corrupt.Store(true)
+		return 0
+	}
+	return next
+}
+
+// node decodes the element at off, and reports whether it lies within the
+// file.
+func (img *Image) node(off uint64) (level, klen, vlen uint64, ok bool) {
+	size := uint64(len(img.data))
+	if off < imageHeaderSize || off > size-imageNodeSize {
+		return 0, 0, 0, false
+	}
+	level = uint64(img.data[off])
+	klen = uint64(binary.LittleEndian.Uint32(img.data[off+4:]))
+	vlen = uint64(binary.LittleEndian.Uint32(img.data[off+8:]))
+	if level < 1 || level > uint64(img.maxLevel) || size-off-imageNodeSize < 8*level+klen+vlen {
+		return 0, 0, 0, false
+	}
+	return level, klen, vlen, true
+}
+
+func (img *Image) key(off uint64) []byte {
+	level, klen, _, ok := img.node(off)
+	if !ok {
+		img.corrupt.Store(true)
+		return nil
+	}
+	start := off + imageNodeSize + 8*level
+	return img.data[start : start+klen : start+klen]
+}
+
+func (img *Image) value(off uint64) []byte {
+	level, klen, vlen, ok := img.node(off)
+	if !ok {
+		img.corrupt.Store(true)
+		return nil
+	}
+	start := off + imageNodeSize + 8*level + klen
+	return img.data[start : start+vlen : start+vlen]
+}
+
+// compareKey compares a mapped key with a string key without converting
+// either of them.
+func compareKey(a []byte, b string) int {
+	n := len(a)
+	if len(b) < n {
+		n = len(b)
+	}
+	for i := 0; i < n; i++ {
+		if a[i] != b[i] {
+			if a[i] < b[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	switch {
+	case len(a) < len(b):
+		return -1
+	case len(a) > len(b):
+		return 1
+	}
+	return 0
+}
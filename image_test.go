@@ -0,0 +1,150 @@
+package stashlist
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestImage(t *testing.T) {
+	list := NewStashList()
+	for i := 0; i < 1000; i++ {
+		list.Add(strconv.Itoa(i), []byte(strconv.Itoa(i*2)))
+	}
+	list.Remove("500")
+
+	path := filepath.Join(t.TempDir(), "list.img")
+	if err := BuildImage(list, path); err != nil {
+		t.Fatal(err)
+	}
+	img, err := OpenImage(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer img.Close()
+
+	if img.Len() != list.Length {
+		t.Fatal("wrong image length", img.Len())
+	}
+	for i := 0; i < 1000; i++ {
+		v, ok := img.Get(strconv.Itoa(i))
+		if i == 500 {
+			if ok {
+				t.Fatal(`image has removed key "500"`)
+			}
+			continue
+		}
+		if !ok || !bytes.Equal(v, []byte(strconv.Itoa(i*2))) {
+			t.Fatalf("Get(%d) = %q, %v", i, v, ok)
+		}
+	}
+
+	var keys []string
+	img.Ascend("498", "502", func(key, value []byte) bool {
+		keys = append(keys, string(key))
+		return true
+	})
+	if len(keys) != 5 || keys[0] != "498" || keys[4] != "501" {
+		t.Fatal("wrong range scan result", keys)
+	}
+
+	allocs := testing.AllocsPerRun(100, func() {
+		img.Get("777")
+		img.Ascend("1", "2", func(key, value []byte) bool { return true })
+	})
+	if allocs != 0 {
+		t.Fatal("image reads allocate", allocs)
+	}
+}
+
+func TestImageSkipsExpired(t *testing.T) {
+	clock := fakeClock(t)
+	list := NewStashList()
+	list.Add("a", []byte("1"))
+	list.Add("b", []byte("2"))
+	list.Add("c", []byte("3"))
+	list.Expire("b", time.Second)
+	list.Expire("c", time.Minute)
+	*clock = clock.Add(time.Second)
+
+	path := filepath.Join(t.TempDir(), "list.img")
+	if err := BuildImage(list, path); err != nil {
+		t.Fatal(err)
+	}
+	img, err := OpenImage(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer img.Close()
+	if _, ok := img.Get("b"); ok || img.Len() != 2 {
+		t.Fatal("the image holds an expired key, or", img.Len(), "keys")
+	}
+	if v, ok := img.Get("c"); !ok || string(v) != "3" {
+		t.Fatal("the image lost a key yet to expire")
+	}
+}
+
+func TestOpenImageRejectsOtherFiles(t *testing.T) {
+	if _, err := OpenImage("image_test.go"); err != ErrBadImage {
+		t.Fatal("opening a non-image file returned", err)
+	}
+}
+
+func TestCorruptImage(t *testing.T) {
+	list := NewStashList()
+	for i := 0; i < 100; i++ {
+		list.Add(strconv.Itoa(i), []byte("value"))
+	}
+	path := filepath.Join(t.TempDir(), "list.img")
+	if err := BuildImage(list, path); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a truncated file is turned away from its recorded size
+	if err := os.WriteFile(path, data[:len(data)-10], 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OpenImage(path); err != ErrBadImage {
+		t.Fatal("opening a truncated image returned", err)
+	}
+
+	// corrupt lengths and offsets end the reads instead of panicking
+	first := binary.LittleEndian.Uint64(data[imageHeaderSize:])
+	for _, corrupt := range []func(b []byte){
+		func(b []byte) { binary.LittleEndian.PutUint32(b[first+4:], 1<<31) },
+		func(b []byte) { binary.LittleEndian.PutUint64(b[first+imageNodeSize:], uint64(len(b)-4)) },
+		func(b []byte) { binary.LittleEndian.PutUint64(b[first+imageNodeSize:], first) },
+		func(b []byte) { b[first] = 0 },
+	} {
+		b := append([]byte(nil), data...)
+		corrupt(b)
+		if err := os.WriteFile(path, b, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		img, err := OpenImage(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 100; i++ {
+			img.Get(strconv.Itoa(i))
+		}
+		img.Get("")
+		n := 0
+		img.Ascend("", "", func(key, value []byte) bool {
+			n++
+			return true
+		})
+		if n == 100 || img.Err() != ErrBadImage {
+			t.Fatal("corrupt image read without error", n, img.Err())
+		}
+		img.Close()
+	}
+}
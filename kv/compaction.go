@@ -0,0 +1,218 @@
+package kv
+
+import (
+	"os"
+	"sort"
+)
+
+// compaction merges the input tables of level and the overlapping tables of
+// level+1 into new tables of level+1.
+type compaction struct {
+	level  int
+	inputs [2][]*table
+	// bottom is set when no deeper level holds the key range, so that
+	// tombstones can be dropped.
+	bottom bool
+}
+
+func maxLevelBytes(opts Options, level int) int64 {
+	size := opts.BaseLevelSize
+	for ; level > 1; level-- {
+		size *= 10
+	}
+	return size
+}
+
+func totalSize(tables []*table) int64 {
+	var size int64
+	for _, t := range tables {
+		size += t.size
+	}
+	return size
+}
+
+func keyRange(tables ...[]*table) (smallest, largest string) {
+	first := true
+	for _, ts := range tables {
+		for _, t := range ts {
+			if first || t.smallest < smallest {
+				smallest = t.smallest
+			}
+			if first || t.largest > largest {
+				largest = t.largest
+			}
+			first = false
+		}
+	}
+	return smallest, largest
+}
+
+func overlapping(tables []*table, smallest, largest string) []*table {
+	var ts []*table
+	for _, t := range tables {
+		if t.overlaps(smallest, largest) {
+			ts = append(ts, t)
+		}
+	}
+	return ts
+}
+
+// pickCompaction returns the most urgent compaction, or nil if every level
+// is within its budget. Called with db.mu held.
+func (db *DB) pickCompaction() *compaction {
+	var c *compaction
+
+	if len(db.levels[0]) >= db.opts.L0CompactionTrigger {
+		c = &compaction{level: 0}
+		c.inputs[0] = append(c.inputs[0], db.levels[0]...)
+	} else {
+		for level := 1; level < numLevels-1; level++ {
+			ts := db.levels[level]
+			if totalSize(ts) <= maxLevelBytes(db.opts, level) {
+				continue
+			}
+
+			// rotate through the key space of the level
+			i := sort.Search(len(ts), func(i int) bool { return ts[i].smallest > db.compactPointer[level] })
+			if i == len(ts) {
+				i = 0
+			}
+			c = &compaction{level: level}
+			c.inputs[0] = []*table{ts[i]}
+			break
+		}
+	}
+	if c == nil {
+		return nil
+	}
+
+	smallest, largest := keyRange(c.inputs[0])
+	c.inputs[1] = overlapping(db.levels[c.level+1], smallest, largest)
+
+	smallest, largest = keyRange(c.inputs[:]...)
+	c.bottom = true
+	for level := c.level + 2; level < numLevels; level++ {
+		if len(overlapping(db.levels[level], smallest, largest)) > 0 {
+			c.bottom = false
+		}
+	}
+	return c
+}
+
+// runCompaction writes the merged tables and installs them.
+// Called with db.mu held; it is released during the merge.
+func (db *DB) runCompaction(c *compaction) error {
+	db.mu.Unlock()
+	outputs, err := db.mergeTables(c)
+	db.mu.Lock()
+	if err != nil {
+		return err
+	}
+
+	inputs := append(append([]*table(nil), c.inputs[0]...), c.inputs[1]...)
+	removed := make(map[*table]bool, len(inputs))
+	for _, t := range inputs {
+		removed[t] = true
+	}
+	for _, level := range []int{c.level, c.level + 1} {
+		kept := db.levels[level][:0]
+		for _, t := range db.levels[level] {
+			if !removed[t] {
+				kept = append(kept, t)
+			}
+		}
+		db.levels[level] = kept
+	}
+
+	next := append(db.levels[c.level+1], outputs...)
+	sort.Slice(next, func(i, j int) bool { return next[i].smallest < next[j].smallest })
+	db.levels[c.level+1] = next
+	_, db.compactPointer[c.level] = keyRange(c.inputs[0])
+
+	if err := db.saveManifest(); err != nil {
+		return err
+	}
+	for _, t := range inputs {
+		t.obsolete = true
+	}
+	db.unref(inputs)
+	return nil
+}
+
+// mergeTables merges the inputs of c into tables of about TableSize bytes.
+// Only the newest entry of each key survives, and tombstones are dropped
+// at the bottom of the tree.
+func (db *DB) mergeTables(c *compaction) ([]*table, error) {
+	var its []internalIterator
+	for _, ts := range c.inputs {
+		for _, t := range ts {
+			it := t.newIterator()
+			it.load(0)
+			its = append(its, it)
+		}
+	}
+
+	var outputs []*table
+	var w *tableWriter
+	var num uint64
+
+	finish := func() error {
+		if err := w.finish(); err != nil {
+			os.Remove(w.f.Name())
+			return err
+		}
+		t, err := openTable(w.f.Name(), num)
+		if err != nil {
+			return err
+		}
+		t.refs = 1
+		outputs = append(outputs, t)
+		w = nil
+		return nil
+	}
+	fail := func(err error) ([]*table, error) {
+		if w != nil {
+			w.abort()
+		}
+		for _, t := range outputs {
+			t.close()
+			os.Remove(t.path)
+		}
+		return nil, err
+	}
+
+	m := newMergingIterator(its)
+	for ; m.valid(); m.next() {
+		e := m.entry()
+		if e.kind == kindDelete && c.bottom {
+			continue
+		}
+		if w == nil {
+			db.mu.Lock()
+			num = db.newFileNum()
+			db.mu.Unlock()
+
+			var err error
+			if w, err = newTableWriter(db.filePath(num, "sst"), db.opts.BlockSize, db.opts.BloomBitsPerKey); err != nil {
+				return fail(err)
+			}
+		}
+		if err := w.add(e); err != nil {
+			return fail(err)
+		}
+		if int64(w.size()) >= db.opts.TableSize {
+			if err := finish(); err != nil {
+				return fail(err)
+			}
+		}
+	}
+	if err := m.err(); err != nil {
+		return fail(err)
+	}
+	if w != nil {
+		if err := finish(); err != nil {
+			return fail(err)
+		}
+	}
+	return outputs, nil
+}
@@ -0,0 +1,651 @@
+// Package kv is an embedded, persistent key-value store built as a
+// log-structured merge tree. Writes go to a write-ahead log and to a
+// StashList memtable, so recently written and frequently read keys are
+// served from memory. Full memtables are flushed to immutable table files
+// that a background goroutine merges level by level.
+package kv
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/hey-kong/stashlist"
+)
+
+var (
+	// ErrNotFound is returned by Get when the key does not exist.
+	ErrNotFound = errors.New("kv: not found")
+	// ErrClosed is returned by operations on a closed DB.
+	ErrClosed = errors.New("kv: closed")
+)
+
+const (
+	kindDelete byte = 0
+	kindPut    byte = 1
+
+	numLevels = 4
+
+	manifestName = "MANIFEST"
+)
+
+// Options configures a DB. Zero fields take their default value.
+type Options struct {
+	// MemtableSize is the approximate size in bytes at which the memtable
+	// is frozen and flushed to a table. Defaults to 4 MiB.
+	MemtableSize int
+
+	// BlockSize is the size of the data blocks of a table. Defaults to 4 KiB.
+	BlockSize int
+
+	// BloomBitsPerKey sizes the bloom filter of a table. Defaults to 10.
+	BloomBitsPerKey int
+
+	// L0CompactionTrigger is the number of level-0 tables that triggers
+	// their compaction into level 1. Defaults to 4.
+	L0CompactionTrigger int
+
+	// BaseLevelSize is the maximum size of level 1 in bytes. Each following
+	// level is ten times larger. Defaults to 10 MiB.
+	BaseLevelSize int64
+
+	// TableSize is the target size of the tables written by compactions.
+	// Defaults to 2 MiB.
+	TableSize int64
+
+	// SyncWrites makes every write wait for the WAL to reach stable storage.
+	SyncWrites bool
+}
+
+func (o *Options) withDefaults() Options {
+	opts := Options{}
+	if o != nil {
+		opts = *o
+	}
+	if opts.MemtableSize <= 0 {
+		opts.MemtableSize = 4 << 20
+	}
+	if opts.BlockSize <= 0 {
+		opts.BlockSize = 4 << 10
+	}
+	if opts.BloomBitsPerKey <= 0 {
+		opts.BloomBitsPerKey = 10
+	}
+	if opts.L0CompactionTrigger <= 0 {
+		opts.L0CompactionTrigger = 4
+	}
+	if opts.BaseLevelSize <= 0 {
+		opts.BaseLevelSize = 10 << 20
+	}
+	if opts.TableSize <= 0 {
+		opts.TableSize = 2 << 20
+	}
+	return opts
+}
+
+// DB is a persistent key-value store. It is safe for concurrent access.
+type DB struct {
+	dir  string
+	opts Options
+
+	mu sync.Mutex
+	// cond is signalled whenever background work completes.
+	cond *sync.Cond
+
+	mem     *stashlist.StashList
+	memSize int
+	wal     *walWriter
+	walNum  uint64
+
+	// imm is the frozen memtable being flushed, immNum its WAL.
+	imm    *stashlist.StashList
+	immNum uint64
+
+	// levels[0] is sorted by file number, the other levels by key range.
+	levels         [numLevels][]*table
+	compactPointer [numLevels]string
+
+	seq     uint64
+	nextNum uint64
+	bgErr   error
+	closed  bool
+
+	work chan struct{}
+	done chan struct{}
+}
+
+// Open opens the database stored in dir, creating it if needed.
+// Writes found in the WAL are recovered into a level-0 table.
+func Open(dir string, opts *Options) (*DB, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	db := &DB{
+		dir:     dir,
+		opts:    opts.withDefaults(),
+		mem:     stashlist.NewStashList(),
+		nextNum: 1,
+		work:    make(chan struct{}, 1),
+		done:    make(chan struct{}),
+	}
+	db.cond = sync.NewCond(&db.mu)
+
+	live, err := db.loadManifest()
+	if err != nil {
+		db.closeTables()
+		return nil, err
+	}
+	if err := db.recover(live); err != nil {
+		db.closeTables()
+		return nil, err
+	}
+
+	db.walNum = db.newFileNum()
+	if db.wal, err = createWAL(db.filePath(db.walNum, "log"), db.opts.SyncWrites); err != nil {
+		db.closeTables()
+		return nil, err
+	}
+
+	go db.background()
+	db.schedule()
+	return db, nil
+}
+
+// Put sets the value of key. The DB keeps its own copy of value.
+func (db *DB) Put(key string, value []byte) error {
+	return db.write(kindPut, key, append([]byte(nil), value...))
+}
+
+// Delete removes key. Deleting a missing key is not an error.
+func (db *DB) Delete(key string) error {
+	return db.write(kindDelete, key, nil)
+}
+
+func (db *DB) write(kind byte, key string, value []byte) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if err := db.makeRoomForWrite(false); err != nil {
+		return err
+	}
+
+	seq := db.seq + 1
+	if err := db.wal.append(kind, seq, key, value); err != nil {
+		return err
+	}
+	db.seq = seq
+	if kind == kindDelete {
+		db.mem.DeleteAt(key, seq)
+	} else {
+		db.mem.AddAt(key, value, seq)
+	}
+	db.memSize += len(key) + len(value) + 64
+	return nil
+}
+
+// makeRoomForWrite freezes the memtable once it is full, or when force is
+// set and it is not empty. Writers wait while the previous one is flushed.
+func (db *DB) makeRoomForWrite(force bool) error {
+	for {
+		switch {
+		case db.closed:
+			return ErrClosed
+		case db.bgErr != nil:
+			return db.bgErr
+		case db.memSize < db.opts.MemtableSize && !(force && db.memSize > 0):
+			return nil
+		case db.imm != nil:
+			db.cond.Wait()
+			continue
+		}
+
+		num := db.newFileNum()
+		wal, err := createWAL(db.filePath(num, "log"), db.opts.SyncWrites)
+		if err != nil {
+			return err
+		}
+		if err := db.wal.close(); err != nil {
+			wal.close()
+			return err
+		}
+		db.imm, db.immNum = db.mem, db.walNum
+		db.mem, db.memSize = stashlist.NewStashList(), 0
+		db.wal, db.walNum = wal, num
+		db.schedule()
+		return nil
+	}
+}
+
+// Get returns the value of key, or ErrNotFound.
+// The returned slice must not be modified.
+func (db *DB) Get(key string) ([]byte, error) {
+	db.mu.Lock()
+	if db.closed {
+		db.mu.Unlock()
+		return nil, ErrClosed
+	}
+	for _, list := range []*stashlist.StashList{db.mem, db.imm} {
+		if list == nil {
+			continue
+		}
+		if value, deleted, ok := memtableGet(list, key); ok {
+			db.mu.Unlock()
+			if deleted {
+				return nil, ErrNotFound
+			}
+			return value, nil
+		}
+	}
+
+	// newest level-0 tables first, then at most one table per level
+	var tables []*table
+	for i := len(db.levels[0]) - 1; i >= 0; i-- {
+		if t := db.levels[0][i]; key >= t.smallest && key <= t.largest {
+			tables = append(tables, t)
+		}
+	}
+	for level := 1; level < numLevels; level++ {
+		ts := db.levels[level]
+		i := sort.Search(len(ts), func(i int) bool { return ts[i].largest >= key })
+		if i < len(ts) && ts[i].smallest <= key {
+			tables = append(tables, ts[i])
+		}
+	}
+	db.ref(tables)
+	db.mu.Unlock()
+	defer db.unrefLocked(tables)
+
+	for _, t := range tables {
+		e, ok, err := t.get(key)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			if e.kind == kindDelete {
+				return nil, ErrNotFound
+			}
+			return e.value, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// memtableGet looks key up in a memtable. Found keys are marked as visited,
+// so hot keys keep their towers.
+func memtableGet(list *stashlist.StashList, key string) (value []byte, deleted, ok bool) {
+	if value, ok := list.GetAt(key, list.LastSeq()); ok {
+		return value, false, true
+	}
+	list.AscendVersions(key, func(ik stashlist.InternalKey, _ []byte) bool {
+		deleted = ik.UserKey == key && ik.Deleted
+		return false
+	})
+	return nil, deleted, deleted
+}
+
+// Scan calls fn for every key in [start, end) in order, until fn returns
+// false. An empty end means no upper bound. Scan sees the writes made before
+// it started; fn may call other methods of the DB.
+func (db *DB) Scan(start, end string, fn func(key string, value []byte) bool) error {
+	db.mu.Lock()
+	if db.closed {
+		db.mu.Unlock()
+		return ErrClosed
+	}
+	var its []internalIterator
+	for _, list := range []*stashlist.StashList{db.mem, db.imm} {
+		if list != nil {
+			its = append(its, &sliceIterator{entries: memtableEntries(list, start, end)})
+		}
+	}
+	var tables []*table
+	for level := range db.levels {
+		for _, t := range db.levels[level] {
+			if t.largest >= start && (end == "" || t.smallest < end) {
+				tables = append(tables, t)
+			}
+		}
+	}
+	db.ref(tables)
+	db.mu.Unlock()
+	defer db.unrefLocked(tables)
+
+	for _, t := range tables {
+		it := t.newIterator()
+		it.seek(start)
+		its = append(its, it)
+	}
+
+	m := newMergingIterator(its)
+	for ; m.valid(); m.next() {
+		e := m.entry()
+		if end != "" && e.key >= end {
+			break
+		}
+		if e.kind == kindDelete {
+			continue
+		}
+		if !fn(e.key, e.value) {
+			break
+		}
+	}
+	return m.err()
+}
+
+// Flush freezes the memtable and waits until it is written to a table.
+func (db *DB) Flush() error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if err := db.makeRoomForWrite(true); err != nil {
+		return err
+	}
+	for db.imm != nil && db.bgErr == nil && !db.closed {
+		db.cond.Wait()
+	}
+	return db.bgErr
+}
+
+// Close stops background work and closes the DB. Writes that were not
+// flushed yet are recovered from the WAL by the next Open.
+func (db *DB) Close() error {
+	db.mu.Lock()
+	if db.closed {
+		db.mu.Unlock()
+		return ErrClosed
+	}
+	db.closed = true
+	close(db.work)
+	db.cond.Broadcast()
+	db.mu.Unlock()
+
+	<-db.done
+
+	err := db.wal.close()
+	db.mu.Lock()
+	db.closeTables()
+	db.mu.Unlock()
+	return err
+}
+
+// closeTables drops the tables from the level layout. Each table is closed
+// when the last Get or Scan using it is done. Called with db.mu held.
+func (db *DB) closeTables() {
+	for level := range db.levels {
+		db.unref(db.levels[level])
+		db.levels[level] = nil
+	}
+}
+
+func (db *DB) schedule() {
+	select {
+	case db.work <- struct{}{}:
+	default:
+	}
+}
+
+// background flushes frozen memtables and runs compactions.
+func (db *DB) background() {
+	defer close(db.done)
+
+	for range db.work {
+		db.mu.Lock()
+		for !db.closed && db.bgErr == nil {
+			var err error
+			if db.imm != nil {
+				err = db.flushImm()
+			} else if c := db.pickCompaction(); c != nil {
+				err = db.runCompaction(c)
+			} else {
+				break
+			}
+			if err != nil {
+				db.bgErr = err
+			}
+			db.cond.Broadcast()
+		}
+		db.mu.Unlock()
+	}
+}
+
+// flushImm writes the frozen memtable to a level-0 table.
+// Called with db.mu held; it is released during the write.
+func (db *DB) flushImm() error {
+	num := db.newFileNum()
+	db.mu.Unlock()
+	t, err := db.writeMemtable(db.imm, num)
+	db.mu.Lock()
+	if err != nil {
+		return err
+	}
+
+	if t != nil {
+		t.refs = 1
+		db.levels[0] = append(db.levels[0], t)
+	}
+	if err := db.saveManifest(); err != nil {
+		return err
+	}
+	os.Remove(db.filePath(db.immNum, "log"))
+	db.imm = nil
+	return nil
+}
+
+// writeMemtable writes the newest version of every key of list to table
+// num. It returns a nil table if the list is empty.
+func (db *DB) writeMemtable(list *stashlist.StashList, num uint64) (*table, error) {
+	entries := memtableEntries(list, "", "")
+	if len(entries) == 0 {
+		return nil, nil
+	}
+
+	path := db.filePath(num, "sst")
+	w, err := newTableWriter(path, db.opts.BlockSize, db.opts.BloomBitsPerKey)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		if err := w.add(e); err != nil {
+			w.abort()
+			return nil, err
+		}
+	}
+	if err := w.finish(); err != nil {
+		os.Remove(path)
+		return nil, err
+	}
+	return openTable(path, num)
+}
+
+func (db *DB) ref(tables []*table) {
+	for _, t := range tables {
+		t.refs++
+	}
+}
+
+// unref drops a reference to each table, closing the tables nobody uses
+// any more and deleting their files if they are obsolete. Called with db.mu
+// held.
+func (db *DB) unref(tables []*table) {
+	for _, t := range tables {
+		if t.refs--; t.refs == 0 {
+			t.close()
+			if t.obsolete {
+				os.Remove(t.path)
+			}
+		}
+	}
+}
+
+func (db *DB) unrefLocked(tables []*table) {
+	db.mu.Lock()
+	db.unref(tables)
+	db.mu.Unlock()
+}
+
+func (db *DB) newFileNum() uint64 {
+	num := db.nextNum
+	db.nextNum++
+	return num
+}
+
+func (db *DB) filePath(num uint64, ext string) string {
+	return filepath.Join(db.dir, fmt.Sprintf("%06d.%s", num, ext))
+}
+
+// saveManifest atomically records the table layout, the next file number and
+// the last sequence number. Called with db.mu held.
+func (db *DB) saveManifest() error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "seq %d\nnext %d\n", db.seq, db.nextNum)
+	for level := range db.levels {
+		for _, t := range db.levels[level] {
+			fmt.Fprintf(&b, "table %d %d\n", level, t.num)
+		}
+	}
+
+	tmp := filepath.Join(db.dir, manifestName+".tmp")
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteString(b.String()); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(db.dir, manifestName))
+}
+
+// loadManifest opens the tables listed in the manifest, if there is one.
+// It returns the set of live table numbers.
+func (db *DB) loadManifest() (map[uint64]bool, error) {
+	live := make(map[uint64]bool)
+	f, err := os.Open(filepath.Join(db.dir, manifestName))
+	if errors.Is(err, os.ErrNotExist) {
+		return live, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		switch {
+		case len(fields) == 2 && fields[0] == "seq":
+			db.seq, err = strconv.ParseUint(fields[1], 10, 64)
+		case len(fields) == 2 && fields[0] == "next":
+			db.nextNum, err = strconv.ParseUint(fields[1], 10, 64)
+		case len(fields) == 3 && fields[0] == "table":
+			var level int
+			var num uint64
+			if level, err = strconv.Atoi(fields[1]); err != nil || level < 0 || level >= numLevels {
+				return nil, fmt.Errorf("kv: bad manifest line %q", scanner.Text())
+			}
+			if num, err = strconv.ParseUint(fields[2], 10, 64); err != nil {
+				break
+			}
+			var t *table
+			if t, err = openTable(db.filePath(num, "sst"), num); err != nil {
+				return nil, err
+			}
+			t.refs = 1
+			db.levels[level] = append(db.levels[level], t)
+			live[num] = true
+		default:
+			err = fmt.Errorf("kv: bad manifest line %q", scanner.Text())
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(db.levels[0], func(i, j int) bool { return db.levels[0][i].num < db.levels[0][j].num })
+	for level := 1; level < numLevels; level++ {
+		ts := db.levels[level]
+		sort.Slice(ts, func(i, j int) bool { return ts[i].smallest < ts[j].smallest })
+	}
+	return live, nil
+}
+
+// recover replays the WAL files into a level-0 table and removes the files
+// that are not part of the database any more.
+func (db *DB) recover(live map[uint64]bool) error {
+	names, err := os.ReadDir(db.dir)
+	if err != nil {
+		return err
+	}
+
+	var logs []uint64
+	for _, de := range names {
+		name := de.Name()
+		ext := filepath.Ext(name)
+		num, err := strconv.ParseUint(strings.TrimSuffix(name, ext), 10, 64)
+		if err != nil {
+			continue
+		}
+		if num >= db.nextNum {
+			db.nextNum = num + 1
+		}
+		switch {
+		case ext == ".log":
+			logs = append(logs, num)
+		case ext == ".sst" && !live[num]:
+			os.Remove(filepath.Join(db.dir, name))
+		}
+	}
+	sort.Slice(logs, func(i, j int) bool { return logs[i] < logs[j] })
+
+	for _, num := range logs {
+		err := replayWAL(db.filePath(num, "log"), func(kind byte, seq uint64, key string, value []byte) {
+			if kind == kindDelete {
+				db.mem.DeleteAt(key, seq)
+			} else {
+				db.mem.AddAt(key, value, seq)
+			}
+			if seq > db.seq {
+				db.seq = seq
+			}
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if len(logs) == 0 {
+		return nil
+	}
+
+	t, err := db.writeMemtable(db.mem, db.newFileNum())
+	if err != nil {
+		return err
+	}
+	if t != nil {
+		t.refs = 1
+		db.levels[0] = append(db.levels[0], t)
+	}
+	if err := db.saveManifest(); err != nil {
+		return err
+	}
+	for _, num := range logs {
+		os.Remove(db.filePath(num, "log"))
+	}
+	db.mem = stashlist.NewStashList()
+	return nil
+}
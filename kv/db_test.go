@@ -0,0 +1,178 @@
+package kv
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+func smallOptions() *Options {
+	return &Options{
+		MemtableSize:        4 << 10,
+		BlockSize:           256,
+		L0CompactionTrigger: 2,
+		BaseLevelSize:       16 << 10,
+		TableSize:           8 << 10,
+	}
+}
+
+func key(i int) string {
+	return fmt.Sprintf("key_%05d", i)
+}
+
+func checkContents(t *testing.T, db *DB, n int) {
+	for i := 0; i < n; i++ {
+		v, err := db.Get(key(i))
+		if i%3 == 0 {
+			if err != ErrNotFound {
+				t.Fatalf("Get(%q) = %q, %v (expected ErrNotFound)", key(i), v, err)
+			}
+			continue
+		}
+		if err != nil || !bytes.Equal(v, []byte(fmt.Sprint(i*10))) {
+			t.Fatalf("Get(%q) = %q, %v (expected %d)", key(i), v, err, i*10)
+		}
+	}
+
+	cnt := 0
+	err := db.Scan("", "", func(k string, v []byte) bool {
+		if k != key(cnt/2*3+cnt%2+1) {
+			t.Fatalf("Scan returned %q at position %d", k, cnt)
+		}
+		cnt++
+		return true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cnt != n-(n+2)/3 {
+		t.Fatal("wrong number of keys in Scan", cnt)
+	}
+}
+
+func TestPutGetDeleteAcrossLevels(t *testing.T) {
+	dir := t.TempDir()
+	db, err := Open(dir, smallOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const n = 3000
+	for i := 0; i < n; i++ {
+		if err := db.Put(key(i), []byte(fmt.Sprint(i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < n; i++ {
+		if i%3 == 0 {
+			err = db.Delete(key(i))
+		} else {
+			err = db.Put(key(i), []byte(fmt.Sprint(i*10)))
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	checkContents(t, db, n)
+
+	db.mu.Lock()
+	deeper := 0
+	for level := 1; level < numLevels; level++ {
+		deeper += len(db.levels[level])
+	}
+	db.mu.Unlock()
+	if deeper == 0 {
+		t.Fatal("no table was compacted out of level 0")
+	}
+
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Get(key(1)); err != ErrClosed {
+		t.Fatal("Get on a closed DB returned", err)
+	}
+
+	db, err = Open(dir, smallOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	checkContents(t, db, n)
+}
+
+func TestRecoverFromWAL(t *testing.T) {
+	dir := t.TempDir()
+	db, err := Open(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Put("a", []byte("1"))
+	db.Put("b", []byte("2"))
+	db.Delete("a")
+	db.Close()
+
+	db, err = Open(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if _, err := db.Get("a"); err != ErrNotFound {
+		t.Fatal(`deleted key "a" came back after recovery`, err)
+	}
+	if v, err := db.Get("b"); err != nil || string(v) != "2" {
+		t.Fatalf(`Get("b") = %q, %v after recovery`, v, err)
+	}
+
+	db.Put("c", []byte("3"))
+	if v, err := db.Get("c"); err != nil || string(v) != "3" {
+		t.Fatalf(`Get("c") = %q, %v`, v, err)
+	}
+}
+
+func TestCloseDuringScan(t *testing.T) {
+	dir := t.TempDir()
+	db, err := Open(dir, smallOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	const n = 1000
+	for i := 0; i < n; i++ {
+		if err := db.Put(key(i), []byte(fmt.Sprint(i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the tables stay open until the scan that uses them is done
+	cnt := 0
+	err = db.Scan("", "", func(k string, v []byte) bool {
+		if cnt == 0 {
+			if err := db.Close(); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if k != key(cnt) {
+			t.Fatalf("Scan returned %q at position %d", k, cnt)
+		}
+		cnt++
+		return true
+	})
+	if err != nil || cnt != n {
+		t.Fatal("Scan interrupted by Close saw", cnt, "keys:", err)
+	}
+
+	db, err = Open(dir, smallOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if v, err := db.Get(key(n - 1)); err != nil || string(v) != fmt.Sprint(n-1) {
+		t.Fatalf("Get after reopening = %q, %v", v, err)
+	}
+}
@@ -0,0 +1,123 @@
+package kv
+
+import (
+	"container/heap"
+
+	"github.com/hey-kong/stashlist"
+)
+
+// internalIterator walks entries in key order. For a given key it yields
+// at most one entry, the newest one the source holds.
+type internalIterator interface {
+	valid() bool
+	entry() entry
+	next()
+	err() error
+}
+
+// sliceIterator walks entries collected from a memtable.
+type sliceIterator struct {
+	entries []entry
+}
+
+func (it *sliceIterator) valid() bool  { return len(it.entries) > 0 }
+func (it *sliceIterator) entry() entry { return it.entries[0] }
+func (it *sliceIterator) next()        { it.entries = it.entries[1:] }
+func (it *sliceIterator) err() error   { return nil }
+
+// memtableEntries collects the newest version of every key of list in
+// [start, end), tombstones included. An empty end means no upper bound.
+func memtableEntries(list *stashlist.StashList, start, end string) []entry {
+	var entries []entry
+	list.AscendVersions(start, func(ik stashlist.InternalKey, value []byte) bool {
+		if end != "" && ik.UserKey >= end {
+			return false
+		}
+		if len(entries) > 0 && entries[len(entries)-1].key == ik.UserKey {
+			return true
+		}
+		e := entry{key: ik.UserKey, seq: ik.Seq, kind: kindPut, value: value}
+		if ik.Deleted {
+			e.kind = kindDelete
+		}
+		entries = append(entries, e)
+		return true
+	})
+	return entries
+}
+
+// mergingIterator merges several sources. When more than one source holds
+// a key, only the entry with the highest sequence number is returned.
+type mergingIterator struct {
+	h      iteratorHeap
+	cur    entry
+	ok     bool
+	failed error
+}
+
+func newMergingIterator(its []internalIterator) *mergingIterator {
+	m := &mergingIterator{}
+	for _, it := range its {
+		if it.err() != nil {
+			m.failed = it.err()
+			return m
+		}
+		if it.valid() {
+			m.h = append(m.h, it)
+		}
+	}
+	heap.Init(&m.h)
+	m.next()
+	return m
+}
+
+func (m *mergingIterator) valid() bool  { return m.ok }
+func (m *mergingIterator) entry() entry { return m.cur }
+func (m *mergingIterator) err() error   { return m.failed }
+
+func (m *mergingIterator) next() {
+	if len(m.h) == 0 || m.failed != nil {
+		m.ok = false
+		return
+	}
+	m.cur, m.ok = m.h[0].entry(), true
+
+	// skip the older entries of the same key in the other sources
+	for len(m.h) > 0 && m.h[0].entry().key == m.cur.key {
+		it := m.h[0]
+		it.next()
+		if err := it.err(); err != nil {
+			m.failed = err
+			return
+		}
+		if it.valid() {
+			heap.Fix(&m.h, 0)
+		} else {
+			heap.Pop(&m.h)
+		}
+	}
+}
+
+// iteratorHeap orders sources by their current key, newest entry first.
+type iteratorHeap []internalIterator
+
+func (h iteratorHeap) Len() int { return len(h) }
+
+func (h iteratorHeap) Less(i, j int) bool {
+	a, b := h[i].entry(), h[j].entry()
+	if a.key != b.key {
+		return a.key < b.key
+	}
+	return a.seq > b.seq
+}
+
+func (h iteratorHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *iteratorHeap) Push(x interface{}) { *h = append(*h, x.(internalIterator)) }
+
+func (h *iteratorHeap) Pop() interface{} {
+	old := *h
+	it := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return it
+}
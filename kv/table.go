@@ -0,0 +1,408 @@
+package kv
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"sort"
+
+	"github.com/hey-kong/stashlist/bloom"
+)
+
+// A table file is immutable and sorted by key. Its layout is:
+//
+//	data blocks   entries followed by a crc32 of the entries
+//	index         block count, then the last key, offset and size of each
+//	              block, then the smallest key of the table
+//	bloom filter  over all the keys of the table
+//	footer        index offset and length, filter offset and length, magic
+//
+// An entry is [kind u8][seq uvarint][key length uvarint][value length uvarint]
+// [key][value]. All integers in the footer are little-endian u64s.
+const (
+	footerSize = 40
+	tableMagic = 0x7374617368746162 // "stashtab"
+)
+
+var errCorruptTable = errors.New("kv: corrupt table")
+
+// entry is one record of a memtable, a table or the WAL.
+type entry struct {
+	key   string
+	seq   uint64
+	kind  byte
+	value []byte
+}
+
+type blockHandle struct {
+	lastKey string
+	offset  uint64
+	size    uint64
+}
+
+type tableWriter struct {
+	f          *os.File
+	w          *bufio.Writer
+	offset     uint64
+	blockSize  int
+	bitsPerKey int
+
+	block    []byte
+	lastKey  string
+	smallest string
+	keys     []string
+	index    []blockHandle
+}
+
+func newTableWriter(path string, blockSize, bitsPerKey int) (*tableWriter, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &tableWriter{
+		f:          f,
+		w:          bufio.NewWriter(f),
+		blockSize:  blockSize,
+		bitsPerKey: bitsPerKey,
+	}, nil
+}
+
+// add appends an entry. Entries must be added in strictly increasing key order.
+func (w *tableWriter) add(e entry) error {
+	if len(w.keys) == 0 {
+		w.smallest = e.key
+	}
+	w.keys = append(w.keys, e.key)
+	w.lastKey = e.key
+
+	w.block = append(w.block, e.kind)
+	w.block = binary.AppendUvarint(w.block, e.seq)
+	w.block = binary.AppendUvarint(w.block, uint64(len(e.key)))
+	w.block = binary.AppendUvarint(w.block, uint64(len(e.value)))
+	w.block = append(w.block, e.key...)
+	w.block = append(w.block, e.value...)
+
+	if len(w.block) >= w.blockSize {
+		return w.flushBlock()
+	}
+	return nil
+}
+
+// size returns the number of bytes written so far.
+func (w *tableWriter) size() uint64 {
+	return w.offset + uint64(len(w.block))
+}
+
+func (w *tableWriter) flushBlock() error {
+	if len(w.block) == 0 {
+		return nil
+	}
+	w.block = binary.LittleEndian.AppendUint32(w.block, crc32.ChecksumIEEE(w.block))
+	if _, err := w.w.Write(w.block); err != nil {
+		return err
+	}
+	w.index = append(w.index, blockHandle{lastKey: w.lastKey, offset: w.offset, size: uint64(len(w.block))})
+	w.offset += uint64(len(w.block))
+	w.block = w.block[:0]
+	return nil
+}
+
+// finish writes the index, the filter and the footer, and syncs the file.
+func (w *tableWriter) finish() error {
+	if err := w.flushBlock(); err != nil {
+		w.f.Close()
+		return err
+	}
+
+	var index []byte
+	index = binary.AppendUvarint(index, uint64(len(w.index)))
+	for _, h := range w.index {
+		index = binary.AppendUvarint(index, uint64(len(h.lastKey)))
+		index = append(index, h.lastKey...)
+		index = binary.AppendUvarint(index, h.offset)
+		index = binary.AppendUvarint(index, h.size)
+	}
+	index = binary.AppendUvarint(index, uint64(len(w.smallest)))
+	index = append(index, w.smallest...)
+
+	filter := bloom.New(len(w.keys), w.bitsPerKey)
+	for _, key := range w.keys {
+		filter.Add(key)
+	}
+	filterBytes := filter.Bytes()
+
+	footer := make([]byte, 0, footerSize)
+	footer = binary.LittleEndian.AppendUint64(footer, w.offset)
+	footer = binary.LittleEndian.AppendUint64(footer, uint64(len(index)))
+	footer = binary.LittleEndian.AppendUint64(footer, w.offset+uint64(len(index)))
+	footer = binary.LittleEndian.AppendUint64(footer, uint64(len(filterBytes)))
+	footer = binary.LittleEndian.AppendUint64(footer, tableMagic)
+
+	for _, b := range [][]byte{index, filterBytes, footer} {
+		if _, err := w.w.Write(b); err != nil {
+			w.f.Close()
+			return err
+		}
+	}
+	if err := w.w.Flush(); err != nil {
+		w.f.Close()
+		return err
+	}
+	if err := w.f.Sync(); err != nil {
+		w.f.Close()
+		return err
+	}
+	return w.f.Close()
+}
+
+// abort closes and removes a table that was not finished.
+func (w *tableWriter) abort() {
+	w.f.Close()
+	os.Remove(w.f.Name())
+}
+
+// table is an open, immutable table file. The index and the filter are kept
+// in memory, data blocks are read on demand.
+type table struct {
+	num      uint64
+	path     string
+	f        *os.File
+	size     int64
+	index    []blockHandle
+	filter   *bloom.Filter
+	smallest string
+	largest  string
+
+	// refs counts the readers using the table, plus one while it is part
+	// of the current level layout. Guarded by DB.mu.
+	refs int
+	// obsolete marks a table compacted away: its file is deleted along
+	// with its last reference.
+	obsolete bool
+}
+
+func openTable(path string, num uint64) (*table, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	t, err := readTable(f)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	t.num, t.path = num, path
+	return t, nil
+}
+
+func readTable(f *os.File) (*table, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() < footerSize {
+		return nil, errCorruptTable
+	}
+
+	footer := make([]byte, footerSize)
+	if _, err := f.ReadAt(footer, info.Size()-footerSize); err != nil {
+		return nil, err
+	}
+	if binary.LittleEndian.Uint64(footer[32:]) != tableMagic {
+		return nil, errCorruptTable
+	}
+	indexOff := binary.LittleEndian.Uint64(footer[0:])
+	indexLen := binary.LittleEndian.Uint64(footer[8:])
+	filterOff := binary.LittleEndian.Uint64(footer[16:])
+	filterLen := binary.LittleEndian.Uint64(footer[24:])
+	if filterOff+filterLen+footerSize != uint64(info.Size()) || indexOff+indexLen != filterOff {
+		return nil, errCorruptTable
+	}
+
+	meta := make([]byte, indexLen+filterLen)
+	if _, err := f.ReadAt(meta, int64(indexOff)); err != nil {
+		return nil, err
+	}
+
+	t := &table{f: f, size: info.Size(), filter: bloom.FromBytes(meta[indexLen:])}
+	p := meta[:indexLen]
+	count, p, err := readUvarint(p)
+	if err != nil {
+		return nil, err
+	}
+	for i := uint64(0); i < count; i++ {
+		var h blockHandle
+		if h.lastKey, p, err = readString(p); err != nil {
+			return nil, err
+		}
+		if h.offset, p, err = readUvarint(p); err != nil {
+			return nil, err
+		}
+		if h.size, p, err = readUvarint(p); err != nil {
+			return nil, err
+		}
+		t.index = append(t.index, h)
+	}
+	if t.smallest, _, err = readString(p); err != nil {
+		return nil, err
+	}
+	if len(t.index) > 0 {
+		t.largest = t.index[len(t.index)-1].lastKey
+	}
+	if t.filter == nil {
+		return nil, errCorruptTable
+	}
+	return t, nil
+}
+
+func (t *table) close() error {
+	return t.f.Close()
+}
+
+// overlaps reports whether the table may hold keys in [smallest, largest].
+func (t *table) overlaps(smallest, largest string) bool {
+	return t.smallest <= largest && smallest <= t.largest
+}
+
+// readBlock reads and verifies the i-th data block.
+func (t *table) readBlock(i int) ([]byte, error) {
+	h := t.index[i]
+	b := make([]byte, h.size)
+	if _, err := t.f.ReadAt(b, int64(h.offset)); err != nil {
+		return nil, err
+	}
+	if len(b) < 4 {
+		return nil, errCorruptTable
+	}
+	data := b[:len(b)-4]
+	if crc32.ChecksumIEEE(data) != binary.LittleEndian.Uint32(b[len(b)-4:]) {
+		return nil, fmt.Errorf("%s: block %d: %w", t.path, i, errCorruptTable)
+	}
+	return data, nil
+}
+
+// get looks key up. It returns false if the table has no entry for key.
+func (t *table) get(key string) (entry, bool, error) {
+	if key < t.smallest || key > t.largest || !t.filter.MayContain(key) {
+		return entry{}, false, nil
+	}
+	i := sort.Search(len(t.index), func(i int) bool { return t.index[i].lastKey >= key })
+	if i == len(t.index) {
+		return entry{}, false, nil
+	}
+	block, err := t.readBlock(i)
+	if err != nil {
+		return entry{}, false, err
+	}
+	for len(block) > 0 {
+		var e entry
+		if e, block, err = decodeEntry(block); err != nil {
+			return entry{}, false, err
+		}
+		if e.key == key {
+			return e, true, nil
+		}
+		if e.key > key {
+			break
+		}
+	}
+	return entry{}, false, nil
+}
+
+func decodeEntry(p []byte) (entry, []byte, error) {
+	var e entry
+	if len(p) < 1 {
+		return e, nil, errCorruptTable
+	}
+	e.kind = p[0]
+	seq, p, err := readUvarint(p[1:])
+	if err != nil {
+		return e, nil, err
+	}
+	klen, p, err := readUvarint(p)
+	if err != nil {
+		return e, nil, err
+	}
+	vlen, p, err := readUvarint(p)
+	if err != nil {
+		return e, nil, err
+	}
+	if uint64(len(p)) < klen+vlen {
+		return e, nil, errCorruptTable
+	}
+	e.seq = seq
+	e.key = string(p[:klen])
+	e.value = p[klen : klen+vlen : klen+vlen]
+	return e, p[klen+vlen:], nil
+}
+
+func readUvarint(p []byte) (uint64, []byte, error) {
+	v, n := binary.Uvarint(p)
+	if n <= 0 {
+		return 0, nil, errCorruptTable
+	}
+	return v, p[n:], nil
+}
+
+func readString(p []byte) (string, []byte, error) {
+	n, p, err := readUvarint(p)
+	if err != nil {
+		return "", nil, err
+	}
+	if uint64(len(p)) < n {
+		return "", nil, errCorruptTable
+	}
+	return string(p[:n]), p[n:], nil
+}
+
+// tableIterator walks the entries of a table in key order.
+type tableIterator struct {
+	t      *table
+	block  int
+	rest   []byte
+	cur    entry
+	ok     bool
+	failed error
+}
+
+func (t *table) newIterator() *tableIterator {
+	return &tableIterator{t: t, block: -1}
+}
+
+// seek positions the iterator at the first entry with a key >= key.
+func (it *tableIterator) seek(key string) {
+	i := sort.Search(len(it.t.index), func(i int) bool { return it.t.index[i].lastKey >= key })
+	it.load(i)
+	for it.ok && it.cur.key < key {
+		it.next()
+	}
+}
+
+func (it *tableIterator) load(i int) {
+	it.block, it.rest, it.ok = i, nil, false
+	for ; it.block < len(it.t.index); it.block++ {
+		if it.rest, it.failed = it.t.readBlock(it.block); it.failed != nil {
+			return
+		}
+		if len(it.rest) > 0 {
+			it.next()
+			return
+		}
+	}
+}
+
+func (it *tableIterator) valid() bool  { return it.ok }
+func (it *tableIterator) entry() entry { return it.cur }
+func (it *tableIterator) err() error   { return it.failed }
+
+func (it *tableIterator) next() {
+	if len(it.rest) == 0 {
+		it.load(it.block + 1)
+		return
+	}
+	it.cur, it.rest, it.failed = decodeEntry(it.rest)
+	it.ok = it.failed == nil
+}
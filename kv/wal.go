@@ -0,0 +1,110 @@
+package kv
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"os"
+)
+
+// A WAL record is [crc32 u32][length u32][payload] where the payload is
+// [kind u8][seq uvarint][key length uvarint][key][value].
+// The CRC covers the payload.
+const walHeaderSize = 8
+
+type walWriter struct {
+	f    *os.File
+	w    *bufio.Writer
+	sync bool
+	buf  []byte
+}
+
+func createWAL(path string, sync bool) (*walWriter, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &walWriter{f: f, w: bufio.NewWriter(f), sync: sync}, nil
+}
+
+// append writes a record and flushes it to the operating system,
+// and to stable storage if the WAL was created with sync set.
+func (w *walWriter) append(kind byte, seq uint64, key string, value []byte) error {
+	b := append(w.buf[:0], 0, 0, 0, 0, 0, 0, 0, 0)
+	b = append(b, kind)
+	b = binary.AppendUvarint(b, seq)
+	b = binary.AppendUvarint(b, uint64(len(key)))
+	b = append(b, key...)
+	b = append(b, value...)
+
+	payload := b[walHeaderSize:]
+	binary.LittleEndian.PutUint32(b[0:], crc32.ChecksumIEEE(payload))
+	binary.LittleEndian.PutUint32(b[4:], uint32(len(payload)))
+	w.buf = b
+
+	if _, err := w.w.Write(b); err != nil {
+		return err
+	}
+	if err := w.w.Flush(); err != nil {
+		return err
+	}
+	if w.sync {
+		return w.f.Sync()
+	}
+	return nil
+}
+
+func (w *walWriter) close() error {
+	if err := w.w.Flush(); err != nil {
+		w.f.Close()
+		return err
+	}
+	return w.f.Close()
+}
+
+// replayWAL calls fn for every intact record of the log at path.
+// A torn or corrupt record ends the replay: it can only be the tail of a
+// write that never completed.
+func replayWAL(path string, fn func(kind byte, seq uint64, key string, value []byte)) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	header := make([]byte, walHeaderSize)
+	for {
+		if _, err := io.ReadFull(r, header); err != nil {
+			if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+				return nil
+			}
+			return err
+		}
+		payload := make([]byte, binary.LittleEndian.Uint32(header[4:]))
+		if _, err := io.ReadFull(r, payload); err != nil {
+			if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+				return nil
+			}
+			return err
+		}
+		if crc32.ChecksumIEEE(payload) != binary.LittleEndian.Uint32(header) || len(payload) < 1 {
+			return nil
+		}
+
+		kind := payload[0]
+		seq, n := binary.Uvarint(payload[1:])
+		if n <= 0 {
+			return nil
+		}
+		p := payload[1+n:]
+		klen, n := binary.Uvarint(p)
+		if n <= 0 || uint64(len(p)-n) < klen {
+			return nil
+		}
+		p = p[n:]
+		fn(kind, seq, string(p[:klen]), p[klen:])
+	}
+}
@@ -0,0 +1,152 @@
+package loader
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrClosed is returned by the writes made after Close.
+var ErrClosed = errors.New("loader: closed")
+
+// queue applies op to the cache and queues it for the store. A queued op
+// replaces the pending one of the same key.
+func (lc *LoadingCache) queue(op Op) error {
+	lc.once.Do(lc.start)
+
+	lc.mu.Lock()
+	if lc.closed {
+		lc.mu.Unlock()
+		return ErrClosed
+	}
+	lc.invalidate(op.Key)
+	if !op.Delete {
+		lc.cache.Add(op.Key, op.Value)
+	}
+	if _, ok := lc.pending[op.Key]; !ok {
+		lc.order = append(lc.order, op.Key)
+	}
+	lc.pending[op.Key] = op
+	full := len(lc.pending) >= lc.BatchSize
+	lc.mu.Unlock()
+
+	if full {
+		select {
+		case lc.kick <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+func (lc *LoadingCache) start() {
+	lc.kick = make(chan struct{}, 1)
+	lc.done = make(chan struct{})
+	lc.stopped = make(chan struct{})
+	go lc.flusher()
+}
+
+// flusher flushes the pending writes every WriteBehind, or sooner when a
+// batch is full.
+func (lc *LoadingCache) flusher() {
+	defer close(lc.stopped)
+	ticker := time.NewTicker(lc.WriteBehind)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-lc.done:
+			return
+		case <-ticker.C:
+		case <-lc.kick:
+		}
+		if err := lc.Flush(context.Background()); err != nil && lc.OnError != nil {
+			lc.OnError(err)
+		}
+	}
+}
+
+// Flush writes the pending writes to the store, BatchSize at a time, and
+// returns the first error. The writes of a failed batch stay pending,
+// unless newer writes of their keys were queued meanwhile.
+func (lc *LoadingCache) Flush(ctx context.Context) error {
+	lc.flushMu.Lock()
+	defer lc.flushMu.Unlock()
+
+	for {
+		lc.mu.Lock()
+		n := len(lc.order)
+		if n > lc.BatchSize {
+			n = lc.BatchSize
+		}
+		if n == 0 {
+			lc.mu.Unlock()
+			return nil
+		}
+		batch := make([]Op, n)
+		lc.flushing = make(map[string]Op, n)
+		for i, key := range lc.order[:n] {
+			batch[i] = lc.pending[key]
+			lc.flushing[key] = batch[i]
+			delete(lc.pending, key)
+		}
+		lc.order = lc.order[n:]
+		lc.mu.Unlock()
+
+		err := lc.writeBatch(ctx, batch)
+		lc.mu.Lock()
+		lc.flushing = nil
+		if err != nil {
+			lc.requeue(batch)
+		}
+		lc.mu.Unlock()
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (lc *LoadingCache) writeBatch(ctx context.Context, batch []Op) error {
+	if bw, ok := lc.writer.(BatchWriter); ok {
+		return bw.WriteBatch(ctx, batch)
+	}
+	for _, op := range batch {
+		var err error
+		if op.Delete {
+			err = lc.writer.Delete(ctx, op.Key)
+		} else {
+			err = lc.writer.Store(ctx, op.Key, op.Value)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// requeue puts the ops of a failed batch back in front of the queue.
+func (lc *LoadingCache) requeue(batch []Op) {
+	var keys []string
+	for _, op := range batch {
+		if _, ok := lc.pending[op.Key]; !ok {
+			lc.pending[op.Key] = op
+			keys = append(keys, op.Key)
+		}
+	}
+	lc.order = append(keys, lc.order...)
+}
+
+// Close stops the background flushes and flushes the pending writes.
+// Writes made after Close fail with ErrClosed.
+func (lc *LoadingCache) Close(ctx context.Context) error {
+	// no flusher may start once Close began
+	lc.once.Do(func() {})
+	lc.mu.Lock()
+	wasClosed := lc.closed
+	lc.closed = true
+	lc.mu.Unlock()
+	if lc.done != nil && !wasClosed {
+		close(lc.done)
+		<-lc.stopped
+	}
+	return lc.Flush(ctx)
+}
@@ -0,0 +1,281 @@
+// Package loader puts a cache in front of a slower store. Misses are
+// read through a Loader, with concurrent misses of a key sharing one load,
+// and keys the store lacks are remembered for a while. Writes go through
+// a Writer, right away or batched in the background.
+//
+//	lc := loader.New(lru.New(10000), db, db)
+//	lc.NegativeTTL = time.Minute
+//	value, err := lc.GetOrLoad(ctx, "user:1")
+package loader
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrNotFound is returned by a Loader for keys the store lacks, and by
+// GetOrLoad for those keys.
+var ErrNotFound = errors.New("loader: key not found")
+
+// ErrReadOnly is returned by Set and Delete without a Writer.
+var ErrReadOnly = errors.New("loader: no writer")
+
+// Loader reads values from the store behind a cache.
+type Loader interface {
+	// Load returns the value of key, or ErrNotFound.
+	Load(ctx context.Context, key string) ([]byte, error)
+}
+
+// Writer writes values to the store behind a cache.
+type Writer interface {
+	Store(ctx context.Context, key string, value []byte) error
+	Delete(ctx context.Context, key string) error
+}
+
+// BatchWriter is implemented by writers that can apply many writes at
+// once. Write-behind batches go through it when the writer has it.
+type BatchWriter interface {
+	Writer
+	// WriteBatch applies ops, which hold at most one op per key.
+	WriteBatch(ctx context.Context, ops []Op) error
+}
+
+// Op is a pending write: a store of Value, or a delete if Delete is set.
+type Op struct {
+	Key    string
+	Value  []byte
+	Delete bool
+}
+
+// Cache holds the cached values. Any cache.Cache satisfies it, a StashList
+// through cache.FromStashList.
+type Cache interface {
+	Add(key string, value []byte)
+	Get(key string) ([]byte, bool)
+	Remove(key string)
+}
+
+const (
+	DefaultBatchSize   = 100
+	DefaultMaxNegative = 10000
+)
+
+// now is the clock of negative entries, replaced in tests.
+var now = time.Now
+
+// LoadingCache is a cache that loads its misses and writes to the store
+// behind it. It is safe for concurrent use; the cache it wraps must not be
+// used directly. The exported fields may be changed until the first call.
+type LoadingCache struct {
+	// NegativeTTL is how long a key the loader reports missing is
+	// answered with ErrNotFound without asking again. Zero disables it.
+	NegativeTTL time.Duration
+	// MaxNegative bounds the number of keys remembered as missing.
+	MaxNegative int
+	// WriteBehind, if positive, makes Set and Delete return once the cache
+	// is updated, the writes being flushed to the store in batches at
+	// least that often. Otherwise writes go to the store first.
+	WriteBehind time.Duration
+	// BatchSize is the number of pending writes that triggers a flush
+	// before WriteBehind elapses.
+	BatchSize int
+	// OnError, if set, is called with the errors of background flushes.
+	// Their writes are kept and retried with the next batch.
+	OnError func(err error)
+
+	mu       sync.Mutex
+	cache    Cache
+	loader   Loader
+	writer   Writer
+	calls    map[string]*call
+	negative map[string]time.Time
+	// writing holds the locks of the keys being written through, so that
+	// the cache ends with the value of the last store write.
+	writing map[string]*keyLock
+
+	// write-behind state, started by the first write
+	once    sync.Once
+	pending map[string]Op
+	order   []string
+	// flushing holds the batch being written to the store.
+	flushing map[string]Op
+	kick     chan struct{}
+	done     chan struct{}
+	stopped  chan struct{}
+	closed   bool
+	// flushMu serializes flushes, so that batches reach the store in order.
+	flushMu sync.Mutex
+}
+
+// call is a load in flight. stale is set if the key is written meanwhile:
+// the loaded value must not replace the written one.
+type call struct {
+	done  chan struct{}
+	value []byte
+	err   error
+	stale bool
+}
+
+// keyLock serializes the writes of a key; n counts the writers holding or
+// waiting for it.
+type keyLock struct {
+	sync.Mutex
+	n int
+}
+
+// New returns a LoadingCache over cache. writer may be nil for a read-only
+// store.
+func New(cache Cache, loader Loader, writer Writer) *LoadingCache {
+	return &LoadingCache{
+		MaxNegative: DefaultMaxNegative,
+		BatchSize:   DefaultBatchSize,
+		cache:       cache,
+		loader:      loader,
+		writer:      writer,
+		calls:       make(map[string]*call),
+		negative:    make(map[string]time.Time),
+		writing:     make(map[string]*keyLock),
+		pending:     make(map[string]Op),
+	}
+}
+
+// GetOrLoad returns the value of key from the cache, or from the loader on
+// a miss, caching it. Concurrent misses of a key share the load of the
+// first one, and its context. Keys the store lacks yield ErrNotFound; other
+// load errors are returned as they are and not cached.
+func (lc *LoadingCache) GetOrLoad(ctx context.Context, key string) ([]byte, error) {
+	lc.mu.Lock()
+	if value, ok := lc.cache.Get(key); ok {
+		lc.mu.Unlock()
+		return value, nil
+	}
+	// a write not yet flushed is newer than the store
+	op, ok := lc.pending[key]
+	if !ok {
+		op, ok = lc.flushing[key]
+	}
+	if ok {
+		lc.mu.Unlock()
+		if op.Delete {
+			return nil, ErrNotFound
+		}
+		return op.Value, nil
+	}
+	if expiry, ok := lc.negative[key]; ok {
+		if now().Before(expiry) {
+			lc.mu.Unlock()
+			return nil, ErrNotFound
+		}
+		delete(lc.negative, key)
+	}
+	if c, ok := lc.calls[key]; ok {
+		lc.mu.Unlock()
+		select {
+		case <-c.done:
+			return c.value, c.err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	c := &call{done: make(chan struct{})}
+	lc.calls[key] = c
+	lc.mu.Unlock()
+
+	c.value, c.err = lc.loader.Load(ctx, key)
+
+	lc.mu.Lock()
+	delete(lc.calls, key)
+	if !c.stale {
+		switch {
+		case c.err == nil:
+			lc.cache.Add(key, c.value)
+		case errors.Is(c.err, ErrNotFound):
+			lc.remember(key)
+		}
+	}
+	lc.mu.Unlock()
+	close(c.done)
+	return c.value, c.err
+}
+
+// remember records key as missing.
+func (lc *LoadingCache) remember(key string) {
+	if lc.NegativeTTL <= 0 {
+		return
+	}
+	t := now()
+	if len(lc.negative) >= lc.MaxNegative {
+		for k, expiry := range lc.negative {
+			if !t.Before(expiry) {
+				delete(lc.negative, k)
+			}
+		}
+		if len(lc.negative) >= lc.MaxNegative {
+			return
+		}
+	}
+	lc.negative[key] = t.Add(lc.NegativeTTL)
+}
+
+// Set writes value under key, to the store then the cache, or to the cache
+// with the store write queued in write-behind mode. If the store write
+// fails, the key is dropped from the cache.
+func (lc *LoadingCache) Set(ctx context.Context, key string, value []byte) error {
+	return lc.write(ctx, Op{Key: key, Value: value})
+}
+
+// Delete removes key from the store and the cache, like Set.
+func (lc *LoadingCache) Delete(ctx context.Context, key string) error {
+	return lc.write(ctx, Op{Key: key, Delete: true})
+}
+
+func (lc *LoadingCache) write(ctx context.Context, op Op) error {
+	if lc.writer == nil {
+		return ErrReadOnly
+	}
+	if lc.WriteBehind > 0 {
+		return lc.queue(op)
+	}
+
+	// concurrent writes of the key must update the cache in the order
+	// they reach the store
+	lc.mu.Lock()
+	l, ok := lc.writing[op.Key]
+	if !ok {
+		l = &keyLock{}
+		lc.writing[op.Key] = l
+	}
+	l.n++
+	lc.mu.Unlock()
+	l.Lock()
+
+	var err error
+	if op.Delete {
+		err = lc.writer.Delete(ctx, op.Key)
+	} else {
+		err = lc.writer.Store(ctx, op.Key, op.Value)
+	}
+
+	lc.mu.Lock()
+	lc.invalidate(op.Key)
+	if err == nil && !op.Delete {
+		lc.cache.Add(op.Key, op.Value)
+	}
+	if l.n--; l.n == 0 {
+		delete(lc.writing, op.Key)
+	}
+	l.Unlock()
+	lc.mu.Unlock()
+	return err
+}
+
+// invalidate drops what is known about key before a write.
+func (lc *LoadingCache) invalidate(key string) {
+	lc.cache.Remove(key)
+	delete(lc.negative, key)
+	if c, ok := lc.calls[key]; ok {
+		c.stale = true
+	}
+}
@@ -0,0 +1,352 @@
+package loader
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hey-kong/stashlist"
+	"github.com/hey-kong/stashlist/cache"
+	"github.com/hey-kong/stashlist/cache/lru"
+	"github.com/hey-kong/stashlist/cache/sieve"
+)
+
+// backend is an in-memory store that counts its calls.
+type backend struct {
+	mu      sync.Mutex
+	data    map[string][]byte
+	loads   atomic.Int64
+	batches [][]Op
+	// gate, if set, holds loads until it is closed
+	gate    chan struct{}
+	loadErr error
+	failing bool
+}
+
+func newBackend() *backend {
+	return &backend{data: make(map[string][]byte)}
+}
+
+func (b *backend) Load(ctx context.Context, key string) ([]byte, error) {
+	b.loads.Add(1)
+	if b.gate != nil {
+		select {
+		case <-b.gate:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.loadErr != nil {
+		return nil, b.loadErr
+	}
+	value, ok := b.data[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return value, nil
+}
+
+func (b *backend) Store(ctx context.Context, key string, value []byte) error {
+	return b.WriteBatch(ctx, []Op{{Key: key, Value: value}})
+}
+
+func (b *backend) Delete(ctx context.Context, key string) error {
+	return b.WriteBatch(ctx, []Op{{Key: key, Delete: true}})
+}
+
+func (b *backend) WriteBatch(ctx context.Context, ops []Op) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.failing {
+		return errors.New("backend down")
+	}
+	b.batches = append(b.batches, ops)
+	for _, op := range ops {
+		if op.Delete {
+			delete(b.data, op.Key)
+		} else {
+			b.data[op.Key] = op.Value
+		}
+	}
+	return nil
+}
+
+func (b *backend) get(key string) ([]byte, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	value, ok := b.data[key]
+	return value, ok
+}
+
+func TestReadThrough(t *testing.T) {
+	caches := map[string]Cache{
+		"stashlist": cache.FromStashList(stashlist.NewStashList()),
+		"lru":       lru.New(100),
+		"sieve":     sieve.New(100),
+	}
+	for name, cache := range caches {
+		t.Run(name, func(t *testing.T) {
+			b := newBackend()
+			b.data["a"] = []byte("1")
+			lc := New(cache, b, b)
+			ctx := context.Background()
+
+			for i := 0; i < 3; i++ {
+				if value, err := lc.GetOrLoad(ctx, "a"); err != nil || string(value) != "1" {
+					t.Fatal("GetOrLoad returned", value, err)
+				}
+			}
+			if n := b.loads.Load(); n != 1 {
+				t.Fatal(n, "loads for a cached key")
+			}
+
+			b.loadErr = errors.New("backend down")
+			if _, err := lc.GetOrLoad(ctx, "b"); err != b.loadErr {
+				t.Fatal("load error returned as", err)
+			}
+			b.loadErr = nil
+			if _, err := lc.GetOrLoad(ctx, "b"); err != ErrNotFound {
+				t.Fatal("missing key returned", err)
+			}
+			if n := b.loads.Load(); n != 3 {
+				t.Fatal("errors were cached:", n, "loads")
+			}
+		})
+	}
+}
+
+func TestSingleflight(t *testing.T) {
+	b := newBackend()
+	b.data["a"] = []byte("1")
+	b.gate = make(chan struct{})
+	lc := New(lru.New(0), b, nil)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if value, err := lc.GetOrLoad(context.Background(), "a"); err != nil || string(value) != "1" {
+				t.Error("GetOrLoad returned", value, err)
+			}
+		}()
+	}
+	// let every goroutine join the load before it ends
+	for b.loads.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(b.gate)
+	wg.Wait()
+	if n := b.loads.Load(); n != 1 {
+		t.Fatal(n, "loads for concurrent misses")
+	}
+
+	// a waiter gives up with its own context
+	b.gate = make(chan struct{})
+	defer close(b.gate)
+	go lc.GetOrLoad(context.Background(), "b")
+	for b.loads.Load() == 1 {
+		time.Sleep(time.Millisecond)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := lc.GetOrLoad(ctx, "b"); err != context.DeadlineExceeded {
+		t.Fatal("waiter returned", err)
+	}
+}
+
+func TestNegativeCache(t *testing.T) {
+	clock := time.Unix(0, 0)
+	now = func() time.Time { return clock }
+	defer func() { now = time.Now }()
+
+	b := newBackend()
+	lc := New(lru.New(0), b, b)
+	lc.NegativeTTL = time.Minute
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		if _, err := lc.GetOrLoad(ctx, "a"); err != ErrNotFound {
+			t.Fatal("missing key returned", err)
+		}
+	}
+	if n := b.loads.Load(); n != 1 {
+		t.Fatal(n, "loads for a missing key")
+	}
+	clock = clock.Add(time.Minute)
+	lc.GetOrLoad(ctx, "a")
+	if n := b.loads.Load(); n != 2 {
+		t.Fatal("negative entry outlived its TTL")
+	}
+
+	// a write makes the key exist at once
+	if err := lc.Set(ctx, "a", []byte("1")); err != nil {
+		t.Fatal(err)
+	}
+	if value, err := lc.GetOrLoad(ctx, "a"); err != nil || string(value) != "1" {
+		t.Fatal("GetOrLoad after Set returned", value, err)
+	}
+
+	lc.MaxNegative = 10
+	for i := 0; i < 20; i++ {
+		lc.GetOrLoad(ctx, "missing"+strconv.Itoa(i))
+	}
+	if len(lc.negative) > 10 {
+		t.Fatal(len(lc.negative), "negative entries")
+	}
+}
+
+func TestWriteThrough(t *testing.T) {
+	b := newBackend()
+	lc := New(lru.New(0), b, b)
+	ctx := context.Background()
+
+	if err := lc.Set(ctx, "a", []byte("1")); err != nil {
+		t.Fatal(err)
+	}
+	if value, ok := b.get("a"); !ok || string(value) != "1" {
+		t.Fatal("Set did not reach the store")
+	}
+	if value, err := lc.GetOrLoad(ctx, "a"); err != nil || string(value) != "1" || b.loads.Load() != 0 {
+		t.Fatal("Set did not fill the cache", value, err)
+	}
+
+	b.failing = true
+	if err := lc.Set(ctx, "a", []byte("2")); err == nil {
+		t.Fatal("failed store write succeeded")
+	}
+	b.failing = false
+	if value, _ := lc.GetOrLoad(ctx, "a"); string(value) != "1" {
+		t.Fatal("failed write left", string(value), "in the cache")
+	}
+
+	if err := lc.Delete(ctx, "a"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := lc.GetOrLoad(ctx, "a"); err != ErrNotFound {
+		t.Fatal("deleted key returned", err)
+	}
+	if err := New(lru.New(0), b, nil).Set(ctx, "a", nil); err != ErrReadOnly {
+		t.Fatal("Set without a writer returned", err)
+	}
+}
+
+// slowWriter stores through a backend, then pauses for a random time, so
+// that concurrent writes return in another order than they were stored.
+type slowWriter struct {
+	*backend
+}
+
+func (w slowWriter) Store(ctx context.Context, key string, value []byte) error {
+	err := w.backend.Store(ctx, key, value)
+	time.Sleep(time.Duration(rand.Intn(100)) * time.Microsecond)
+	return err
+}
+
+func TestConcurrentWriteThrough(t *testing.T) {
+	b := newBackend()
+	lc := New(lru.New(0), b, slowWriter{b})
+	ctx := context.Background()
+	for round := 0; round < 50; round++ {
+		var wg sync.WaitGroup
+		for i := 0; i < 4; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				lc.Set(ctx, "a", []byte(strconv.Itoa(i)))
+			}(i)
+		}
+		wg.Wait()
+		stored, _ := b.get("a")
+		if value, _ := lc.GetOrLoad(ctx, "a"); string(value) != string(stored) {
+			t.Fatalf("round %d: the cache holds %q, the store %q", round, value, stored)
+		}
+	}
+	if len(lc.writing) != 0 {
+		t.Fatal(len(lc.writing), "key locks left")
+	}
+}
+
+func TestWriteBehind(t *testing.T) {
+	b := newBackend()
+	lc := New(lru.New(2), b, b)
+	lc.WriteBehind = time.Hour
+	lc.BatchSize = 10
+	var flushErrs atomic.Int64
+	lc.OnError = func(error) { flushErrs.Add(1) }
+	ctx := context.Background()
+
+	for i := 0; i < 5; i++ {
+		lc.Set(ctx, "k"+strconv.Itoa(i), []byte("v1"))
+	}
+	lc.Set(ctx, "k0", []byte("v2"))
+	lc.Delete(ctx, "k1")
+	if _, ok := b.get("k0"); ok {
+		t.Fatal("write reached the store before a flush")
+	}
+	// evicted from the small cache, still answered from the queue
+	if value, err := lc.GetOrLoad(ctx, "k0"); err != nil || string(value) != "v2" {
+		t.Fatal("pending write read as", value, err)
+	}
+	if _, err := lc.GetOrLoad(ctx, "k1"); err != ErrNotFound {
+		t.Fatal("pending delete read as", err)
+	}
+	if b.loads.Load() != 0 {
+		t.Fatal("pending keys were loaded")
+	}
+
+	// a full batch flushes in the background
+	for i := 5; i < 10; i++ {
+		lc.Set(ctx, "k"+strconv.Itoa(i), []byte("v1"))
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, ok := b.get("k9"); ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("full batch was not flushed")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	b.mu.Lock()
+	if len(b.batches) != 1 || len(b.batches[0]) != 10 {
+		t.Fatal("writes were not batched:", b.batches)
+	}
+	b.mu.Unlock()
+	if value, _ := b.get("k0"); string(value) != "v2" {
+		t.Fatal("coalesced write stored as", string(value))
+	}
+	if _, ok := b.get("k1"); ok {
+		t.Fatal("pending delete was not applied")
+	}
+
+	// failed writes stay queued until a flush succeeds
+	b.mu.Lock()
+	b.failing = true
+	b.mu.Unlock()
+	lc.Set(ctx, "x", []byte("1"))
+	if err := lc.Flush(ctx); err == nil {
+		t.Fatal("flush to a failing store succeeded")
+	}
+	b.mu.Lock()
+	b.failing = false
+	b.mu.Unlock()
+	if err := lc.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := b.get("x"); !ok {
+		t.Fatal("failed write was lost")
+	}
+	if err := lc.Set(ctx, "y", nil); err != ErrClosed {
+		t.Fatal("Set after Close returned", err)
+	}
+}
@@ -0,0 +1,158 @@
+package memcache
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hey-kong/stashlist"
+	"github.com/hey-kong/stashlist/cache"
+	"github.com/hey-kong/stashlist/cache/lru"
+	"github.com/hey-kong/stashlist/cache/sieve"
+)
+
+type testConn struct {
+	t    *testing.T
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func dial(t *testing.T, cache Cache) *testConn {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := New(cache)
+	go srv.Serve(ln)
+	t.Cleanup(func() { srv.Close() })
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return &testConn{t: t, conn: conn, r: bufio.NewReader(conn)}
+}
+
+// expect sends a request and checks that the reply is the given lines.
+func (c *testConn) expect(request string, lines ...string) {
+	c.t.Helper()
+	if _, err := fmt.Fprint(c.conn, request); err != nil {
+		c.t.Fatal(err)
+	}
+	for _, want := range lines {
+		c.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		got, err := c.r.ReadString('\n')
+		if err != nil {
+			c.t.Fatalf("%q: %v", request, err)
+		}
+		if got = strings.TrimSuffix(got, "\r\n"); got != want {
+			c.t.Fatalf("%q: got %q, want %q", request, got, want)
+		}
+	}
+}
+
+func caches() map[string]func() Cache {
+	return map[string]func() Cache{
+		"stashlist": func() Cache { return cache.FromStashList(stashlist.NewStashList()) },
+		"lru":       func() Cache { return lru.New(0) },
+		"sieve":     func() Cache { return sieve.New(0) },
+	}
+}
+
+func TestTextProtocol(t *testing.T) {
+	for name, newCache := range caches() {
+		t.Run(name, func(t *testing.T) {
+			c := dial(t, newCache())
+			c.expect("get a\r\n", "END")
+			c.expect("set a 5 0 3\r\nabc\r\n", "STORED")
+			c.expect("get a b\r\n", "VALUE a 5 3", "abc", "END")
+			c.expect("add a 0 0 1\r\nx\r\n", "NOT_STORED")
+			c.expect("replace b 0 0 1\r\nx\r\n", "NOT_STORED")
+			c.expect("append a 0 0 2\r\nde\r\n", "STORED")
+			c.expect("prepend a 0 0 1\r\n_\r\n", "STORED")
+			c.expect("gets a\r\n", "VALUE a 5 6 3", "_abcde", "END")
+			c.expect("cas a 0 0 1 2\r\nx\r\n", "EXISTS")
+			c.expect("cas a 0 0 1 3\r\nx\r\n", "STORED")
+			c.expect("cas b 0 0 1 4\r\nx\r\n", "NOT_FOUND")
+
+			c.expect("set n 0 0 2 noreply\r\n10\r\nincr n 5\r\n", "15")
+			c.expect("decr n 100\r\n", "0")
+			c.expect("incr a 1\r\n", "CLIENT_ERROR cannot increment or decrement non-numeric value")
+			c.expect("incr b 1\r\n", "NOT_FOUND")
+
+			c.expect("touch a 100\r\n", "TOUCHED")
+			c.expect("gets a\r\n", "VALUE a 0 1 4", "x", "END")
+			c.expect("touch a -1\r\n", "TOUCHED")
+			c.expect("get a\r\n", "END")
+			c.expect("delete n\r\n", "DELETED")
+			c.expect("delete n\r\n", "NOT_FOUND")
+			c.expect("bogus\r\n", "ERROR")
+			c.expect(fmt.Sprintf("set big 0 0 %d\r\n%s\r\nget big\r\n", maxItemSize+1, strings.Repeat("x", maxItemSize+1)),
+				"SERVER_ERROR object too large for cache", "END")
+		})
+	}
+}
+
+func TestMetaProtocol(t *testing.T) {
+	c := dial(t, cache.FromStashList(stashlist.NewStashList()))
+	c.expect("mg a v\r\n", "EN")
+	c.expect("mg a v q\r\nmn\r\n", "MN")
+	c.expect("ms a 2 F7 T100 c\r\nhi\r\n", "HD c1")
+	c.expect("mg a v f t s k Oxyz\r\n", "VA 2 f7 t100 s2 ka Oxyz", "hi")
+	c.expect("mg a c\r\n", "HD c1")
+	c.expect("mg a T50 t c\r\n", "HD t50 c1")
+	c.expect("ms a 1 C9\r\nx\r\n", "EX")
+	c.expect("ms a 1 C1 q\r\nx\r\nmn\r\n", "MN")
+	c.expect("ms a 1 ME\r\ny\r\n", "NS")
+	c.expect("ms a 1 MA\r\ny\r\n", "HD")
+	c.expect("mg a v\r\n", "VA 2", "xy")
+	c.expect("md a C1\r\n", "EX")
+	c.expect("md a q\r\nmd a\r\n", "NF")
+	c.expect("mg a T-1\r\n", "EN")
+}
+
+func TestEvictionStats(t *testing.T) {
+	list := stashlist.NewStashList()
+	list.MaxEntries = 10
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := New(cache.FromStashList(list))
+	srv.Policy = "stashlist"
+	list.OnEvicted = srv.Evicted
+	go srv.Serve(ln)
+	defer srv.Close()
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	c := &testConn{t: t, conn: conn, r: bufio.NewReader(conn)}
+	for i := 0; i < 15; i++ {
+		c.expect(fmt.Sprintf("set k%d 0 0 1\r\nx\r\n", i), "STORED")
+	}
+
+	fmt.Fprint(conn, "stats\r\n")
+	stats := map[string]string{}
+	for {
+		line, err := c.r.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		if line == "END\r\n" {
+			break
+		}
+		f := strings.Fields(line)
+		stats[f[1]] = f[2]
+	}
+	if stats["curr_items"] != "10" || stats["evictions"] != "5" || stats["policy"] != "stashlist" {
+		t.Fatal("wrong stats", stats)
+	}
+}
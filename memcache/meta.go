@@ -0,0 +1,224 @@
+package memcache
+
+import (
+	"strconv"
+)
+
+var metaResults = [...]string{"HD", "NS", "EX", "NF"}
+
+// metaFlags holds the flags of a meta command. Each flag is a letter
+// followed by an optional token.
+type metaFlags struct {
+	flags  []byte
+	tokens map[byte]string
+}
+
+func parseMetaFlags(args [][]byte) metaFlags {
+	var m metaFlags
+	m.tokens = make(map[byte]string)
+	for _, arg := range args {
+		m.flags = append(m.flags, arg[0])
+		m.tokens[arg[0]] = string(arg[1:])
+	}
+	return m
+}
+
+func (m metaFlags) has(flag byte) bool {
+	_, ok := m.tokens[flag]
+	return ok
+}
+
+// returned appends the flags the client asked to get back: the opaque value
+// and the key, plus the ones the command fills in with fill.
+func (m metaFlags) returned(b []byte, key string, fill func(b []byte, flag byte) []byte) []byte {
+	for _, flag := range m.flags {
+		switch flag {
+		case 'O':
+			b = append(b, " O"+m.tokens['O']...)
+		case 'k':
+			b = append(b, " k"+key...)
+		default:
+			if fill != nil {
+				b = fill(b, flag)
+			}
+		}
+	}
+	return b
+}
+
+// metaGet implements mg <key> <flags>*. Flags: v value, f client flags,
+// c CAS, t remaining TTL, s size, k key, O opaque, q quiet miss, T<ttl> touch.
+func (s *Server) metaGet(c *client, args [][]byte) {
+	if len(args) < 2 || !validKey(args[1]) {
+		c.w.WriteString("CLIENT_ERROR bad command line format\r\n")
+		return
+	}
+	key := string(args[1])
+	m := parseMetaFlags(args[2:])
+
+	s.mu.Lock()
+	s.cmdGet.Add(1)
+	it, ok := s.lookup(key)
+	if ok && m.has('T') {
+		ttl, err := strconv.ParseInt(m.tokens['T'], 10, 64)
+		if err != nil {
+			s.mu.Unlock()
+			c.w.WriteString("CLIENT_ERROR bad token in command line format\r\n")
+			return
+		}
+		it.exptime = absoluteExptime(ttl)
+		s.touchItem(key, it, it.exptime)
+	}
+	s.mu.Unlock()
+
+	if !ok {
+		s.getMisses.Add(1)
+		if !m.has('q') {
+			c.w.WriteString("EN\r\n")
+		}
+		return
+	}
+	s.getHits.Add(1)
+
+	var line []byte
+	if m.has('v') {
+		line = append(line, "VA "+strconv.Itoa(len(it.data))...)
+	} else {
+		line = append(line, "HD"...)
+	}
+	line = m.returned(line, key, func(b []byte, flag byte) []byte {
+		switch flag {
+		case 'f':
+			return append(b, " f"+strconv.FormatUint(uint64(it.flags), 10)...)
+		case 'c':
+			return append(b, " c"+strconv.FormatUint(it.cas, 10)...)
+		case 's':
+			return append(b, " s"+strconv.Itoa(len(it.data))...)
+		case 't':
+			ttl := int64(-1)
+			if it.exptime != 0 {
+				ttl = it.exptime - now().Unix()
+			}
+			return append(b, " t"+strconv.FormatInt(ttl, 10)...)
+		}
+		return b
+	})
+	c.w.Write(line)
+	c.w.WriteString("\r\n")
+	if m.has('v') {
+		c.w.Write(it.data)
+		c.w.WriteString("\r\n")
+	}
+}
+
+var metaModes = map[string]string{
+	"":  "set",
+	"S": "set", "s": "set",
+	"E": "add", "e": "add",
+	"A": "append", "a": "append",
+	"P": "prepend", "p": "prepend",
+	"R": "replace", "r": "replace",
+}
+
+// metaSet implements ms <key> <datalen> <flags>*. Flags: F<flags> client
+// flags, T<ttl>, C<cas> compare, M<mode> (S set, E add, A append, P prepend,
+// R replace), c return CAS, k key, O opaque, q quiet success.
+func (s *Server) metaSet(c *client, args [][]byte) error {
+	if len(args) < 3 {
+		c.w.WriteString("CLIENT_ERROR bad command line format\r\n")
+		return nil
+	}
+	size, err := strconv.Atoi(string(args[2]))
+	if err != nil || size < 0 {
+		c.w.WriteString("CLIENT_ERROR bad data chunk\r\n")
+		return nil
+	}
+	if size > maxItemSize {
+		if _, err := c.readData(size); err != nil {
+			return err
+		}
+		c.w.WriteString("SERVER_ERROR object too large for cache\r\n")
+		return nil
+	}
+	data, err := c.readData(size)
+	if err != nil {
+		return err
+	}
+
+	key := string(args[1])
+	m := parseMetaFlags(args[3:])
+	var (
+		flags, cas uint64
+		ttl        int64
+		err1, err2 error
+		err3       error
+	)
+	if m.has('F') {
+		flags, err1 = strconv.ParseUint(m.tokens['F'], 10, 32)
+	}
+	if m.has('T') {
+		ttl, err2 = strconv.ParseInt(m.tokens['T'], 10, 64)
+	}
+	if m.has('C') {
+		cas, err3 = strconv.ParseUint(m.tokens['C'], 10, 64)
+	}
+	mode, modeOK := metaModes[m.tokens['M']]
+	if !validKey(args[1]) || err1 != nil || err2 != nil || err3 != nil || !modeOK {
+		c.w.WriteString("CLIENT_ERROR bad command line format\r\n")
+		return nil
+	}
+
+	s.cmdSet.Add(1)
+	res, newCAS := s.storeItem(mode, key, item{flags: uint32(flags), exptime: absoluteExptime(ttl), data: data}, m.has('C'), cas)
+	if res == stored && m.has('q') {
+		return nil
+	}
+	line := append([]byte(nil), metaResults[res]...)
+	line = m.returned(line, key, func(b []byte, flag byte) []byte {
+		if flag == 'c' && res == stored {
+			return append(b, " c"+strconv.FormatUint(newCAS, 10)...)
+		}
+		return b
+	})
+	c.w.Write(line)
+	c.w.WriteString("\r\n")
+	return nil
+}
+
+// metaDelete implements md <key> <flags>*. Flags: C<cas> compare, k key,
+// O opaque, q quiet success and miss.
+func (s *Server) metaDelete(c *client, args [][]byte) {
+	if len(args) < 2 || !validKey(args[1]) {
+		c.w.WriteString("CLIENT_ERROR bad command line format\r\n")
+		return
+	}
+	key := string(args[1])
+	m := parseMetaFlags(args[2:])
+	var cas uint64
+	if m.has('C') {
+		var err error
+		if cas, err = strconv.ParseUint(m.tokens['C'], 10, 64); err != nil {
+			c.w.WriteString("CLIENT_ERROR bad token in command line format\r\n")
+			return
+		}
+	}
+
+	s.mu.Lock()
+	res := stored
+	it, ok := s.lookup(key)
+	switch {
+	case !ok:
+		res = notFound
+	case m.has('C') && it.cas != cas:
+		res = exists
+	default:
+		s.cache.Remove(key)
+	}
+	s.mu.Unlock()
+
+	if m.has('q') && res != exists {
+		return
+	}
+	c.w.Write(m.returned(append([]byte(nil), metaResults[res]...), key, nil))
+	c.w.WriteString("\r\n")
+}
@@ -0,0 +1,299 @@
+// Package memcache serves a cache over the memcached text protocol,
+// including the meta commands mg, ms, md and mn.
+//
+// The items live in a Cache chosen by the caller: a bounded StashList,
+// lru.Cache or sieve.Cache, so that the eviction policies can be compared
+// under real client traffic. Flags, expiry times and CAS values are kept
+// with the data, and expired items are dropped when they are read.
+package memcache
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	maxKeyLength = 250
+	maxItemSize  = 1 << 20
+	maxLineSize  = 8 << 10
+)
+
+// Server serves one Cache. Commands are executed one at a time.
+type Server struct {
+	// Policy names the eviction policy of the cache in the stats.
+	Policy string
+
+	mu    sync.Mutex
+	cache Cache
+	cas   uint64
+
+	started     time.Time
+	connections atomic.Int64
+	cmdGet      atomic.Int64
+	cmdSet      atomic.Int64
+	getHits     atomic.Int64
+	getMisses   atomic.Int64
+	evictions   atomic.Int64
+
+	connsMu sync.Mutex
+	conns   map[net.Conn]struct{}
+	ln      net.Listener
+	closed  bool
+	wg      sync.WaitGroup
+}
+
+// New returns a server for cache. The cache must not be used directly
+// while the server runs.
+func New(cache Cache) *Server {
+	return &Server{
+		cache:   cache,
+		started: time.Now(),
+		conns:   make(map[net.Conn]struct{}),
+	}
+}
+
+// Evicted counts an eviction in the stats. Install it with the
+// SetOnEvicted method of the cache, which only reports the entries evicted
+// to make room, or as the OnEvicted callback of a StashList.
+func (s *Server) Evicted(key string, value []byte) {
+	s.evictions.Add(1)
+}
+
+// ListenAndServe listens on the TCP address addr and calls Serve.
+func (s *Server) ListenAndServe(addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(ln)
+}
+
+// Serve accepts clients on ln until Close is called.
+func (s *Server) Serve(ln net.Listener) error {
+	s.connsMu.Lock()
+	if s.closed {
+		s.connsMu.Unlock()
+		return net.ErrClosed
+	}
+	s.ln = ln
+	s.connsMu.Unlock()
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			s.connsMu.Lock()
+			closed := s.closed
+			s.connsMu.Unlock()
+			if closed {
+				return nil
+			}
+			return err
+		}
+
+		s.connsMu.Lock()
+		if s.closed {
+			s.connsMu.Unlock()
+			conn.Close()
+			return nil
+		}
+		s.conns[conn] = struct{}{}
+		s.wg.Add(1)
+		s.connsMu.Unlock()
+
+		go func() {
+			defer s.wg.Done()
+			s.serveConn(conn)
+			s.connsMu.Lock()
+			delete(s.conns, conn)
+			s.connsMu.Unlock()
+			conn.Close()
+		}()
+	}
+}
+
+// Close stops the server and disconnects the clients.
+func (s *Server) Close() error {
+	s.connsMu.Lock()
+	if s.closed {
+		s.connsMu.Unlock()
+		return nil
+	}
+	s.closed = true
+	var err error
+	if s.ln != nil {
+		err = s.ln.Close()
+	}
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.connsMu.Unlock()
+
+	s.wg.Wait()
+	return err
+}
+
+// errClientData is returned when a data block is malformed; the connection
+// cannot be resynchronized after it.
+var errClientData = errors.New("bad data chunk")
+
+// client is the state of one connection.
+type client struct {
+	r    *bufio.Reader
+	w    *bufio.Writer
+	quit bool
+}
+
+func (s *Server) serveConn(conn net.Conn) {
+	s.connections.Add(1)
+	defer s.connections.Add(-1)
+
+	c := &client{r: bufio.NewReaderSize(conn, maxLineSize), w: bufio.NewWriter(conn)}
+	for !c.quit {
+		line, err := c.r.ReadSlice('\n')
+		if err == bufio.ErrBufferFull {
+			c.w.WriteString("CLIENT_ERROR line too long\r\n")
+			c.w.Flush()
+			return
+		}
+		if err != nil {
+			return
+		}
+		args := bytes.Fields(line)
+		if len(args) == 0 {
+			c.w.WriteString("ERROR\r\n")
+		} else if err := s.dispatch(c, args); err != nil {
+			c.w.WriteString("CLIENT_ERROR " + err.Error() + "\r\n")
+			c.w.Flush()
+			return
+		}
+
+		// answer a pipeline in one write
+		if c.r.Buffered() == 0 || c.quit {
+			if err := c.w.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (s *Server) dispatch(c *client, args [][]byte) error {
+	// args alias the read buffer, which the data block overwrites
+	for i, arg := range args {
+		args[i] = append([]byte(nil), arg...)
+	}
+
+	switch name := string(args[0]); name {
+	case "get", "gets":
+		s.get(c, args, name == "gets")
+	case "set", "add", "replace", "append", "prepend", "cas":
+		return s.store(c, args)
+	case "delete":
+		s.delete(c, args)
+	case "incr", "decr":
+		s.incr(c, args)
+	case "touch":
+		s.touch(c, args)
+	case "mg":
+		s.metaGet(c, args)
+	case "ms":
+		return s.metaSet(c, args)
+	case "md":
+		s.metaDelete(c, args)
+	case "mn":
+		c.w.WriteString("MN\r\n")
+	case "stats":
+		s.stats(c)
+	case "version":
+		c.w.WriteString("VERSION 1.6.21-stashlist\r\n")
+	case "verbosity":
+		c.w.WriteString("OK\r\n")
+	case "quit":
+		c.quit = true
+	default:
+		c.w.WriteString("ERROR\r\n")
+	}
+	return nil
+}
+
+// readData reads a data block of n bytes and its CRLF.
+func (c *client) readData(n int) ([]byte, error) {
+	b := make([]byte, n+2)
+	if _, err := io.ReadFull(c.r, b); err != nil {
+		return nil, err
+	}
+	if b[n] != '\r' || b[n+1] != '\n' {
+		return nil, errClientData
+	}
+	return b[:n], nil
+}
+
+// lookup returns the live item of key, dropping it if it expired.
+func (s *Server) lookup(key string) (item, bool) {
+	value, ok := s.cache.Get(key)
+	if !ok {
+		return item{}, false
+	}
+	it, ok := decodeItem(value)
+	if !ok || it.expired(now().Unix()) {
+		s.cache.Remove(key)
+		return item{}, false
+	}
+	return it, true
+}
+
+// put stores it under key with a new CAS value, which it returns.
+func (s *Server) put(key string, it item) uint64 {
+	s.cas++
+	it.cas = s.cas
+	s.cache.Add(key, it.encode())
+	return it.cas
+}
+
+// touchItem stores it back under key with a new expiry time, keeping its
+// CAS value: touching an item does not modify it.
+func (s *Server) touchItem(key string, it item, exptime int64) {
+	it.exptime = exptime
+	s.cache.Add(key, it.encode())
+}
+
+func validKey(key []byte) bool {
+	if len(key) == 0 || len(key) > maxKeyLength {
+		return false
+	}
+	for _, b := range key {
+		if b <= ' ' || b == 0x7f {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *Server) stats(c *client) {
+	s.mu.Lock()
+	items := s.cache.Len()
+	s.mu.Unlock()
+
+	stat := func(name string, value int64) {
+		c.w.WriteString("STAT " + name + " " + strconv.FormatInt(value, 10) + "\r\n")
+	}
+	stat("uptime", int64(time.Since(s.started).Seconds()))
+	stat("time", now().Unix())
+	stat("curr_connections", s.connections.Load())
+	stat("cmd_get", s.cmdGet.Load())
+	stat("cmd_set", s.cmdSet.Load())
+	stat("get_hits", s.getHits.Load())
+	stat("get_misses", s.getMisses.Load())
+	stat("curr_items", int64(items))
+	stat("evictions", s.evictions.Load())
+	if s.Policy != "" {
+		c.w.WriteString("STAT policy " + s.Policy + "\r\n")
+	}
+	c.w.WriteString("END\r\n")
+}
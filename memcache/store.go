@@ -0,0 +1,73 @@
+package memcache
+
+import (
+	"encoding/binary"
+	"time"
+)
+
+// Cache stores the items of the server. Any cache.Cache satisfies it, a
+// bounded StashList through cache.FromStashList.
+type Cache interface {
+	Add(key string, value []byte)
+	Get(key string) ([]byte, bool)
+	Remove(key string)
+	Len() int
+}
+
+// now is the clock of the expiry checks, replaced in tests.
+var now = time.Now
+
+// item is a stored value with its metadata. In the cache it is encoded as
+// [flags u32][exptime i64][cas u64][data].
+type item struct {
+	flags uint32
+	// exptime is when the item expires, in Unix seconds, or 0 if never.
+	exptime int64
+	cas     uint64
+	data    []byte
+}
+
+const itemHeaderSize = 20
+
+func (it item) encode() []byte {
+	b := make([]byte, itemHeaderSize+len(it.data))
+	binary.BigEndian.PutUint32(b, it.flags)
+	binary.BigEndian.PutUint64(b[4:], uint64(it.exptime))
+	binary.BigEndian.PutUint64(b[12:], it.cas)
+	copy(b[itemHeaderSize:], it.data)
+	return b
+}
+
+func decodeItem(b []byte) (item, bool) {
+	if len(b) < itemHeaderSize {
+		return item{}, false
+	}
+	return item{
+		flags:   binary.BigEndian.Uint32(b),
+		exptime: int64(binary.BigEndian.Uint64(b[4:])),
+		cas:     binary.BigEndian.Uint64(b[12:]),
+		data:    b[itemHeaderSize:],
+	}, true
+}
+
+func (it item) expired(t int64) bool {
+	return it.exptime != 0 && it.exptime <= t
+}
+
+// maxRelativeExptime is the largest exptime taken as relative to now;
+// larger ones are Unix times, as in memcached.
+const maxRelativeExptime = 60 * 60 * 24 * 30
+
+// absoluteExptime converts a protocol exptime to a Unix time. Negative
+// values expire the item at once.
+func absoluteExptime(exptime int64) int64 {
+	switch {
+	case exptime == 0:
+		return 0
+	case exptime < 0:
+		return now().Unix() - 1
+	case exptime <= maxRelativeExptime:
+		return now().Unix() + exptime
+	}
+	return exptime
+}
@@ -0,0 +1,251 @@
+package memcache
+
+import (
+	"strconv"
+)
+
+func noreply(args [][]byte, n int) bool {
+	return len(args) == n+1 && string(args[n]) == "noreply"
+}
+
+// get implements get and gets.
+func (s *Server) get(c *client, args [][]byte, withCAS bool) {
+	if len(args) < 2 {
+		c.w.WriteString("ERROR\r\n")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, key := range args[1:] {
+		s.cmdGet.Add(1)
+		it, ok := s.lookup(string(key))
+		if !ok {
+			s.getMisses.Add(1)
+			continue
+		}
+		s.getHits.Add(1)
+
+		c.w.WriteString("VALUE ")
+		c.w.Write(key)
+		c.w.WriteString(" " + strconv.FormatUint(uint64(it.flags), 10) + " " + strconv.Itoa(len(it.data)))
+		if withCAS {
+			c.w.WriteString(" " + strconv.FormatUint(it.cas, 10))
+		}
+		c.w.WriteString("\r\n")
+		c.w.Write(it.data)
+		c.w.WriteString("\r\n")
+	}
+	c.w.WriteString("END\r\n")
+}
+
+// store implements set, add, replace, append, prepend and cas:
+//
+//	<command> <key> <flags> <exptime> <bytes> [<cas unique>] [noreply]
+func (s *Server) store(c *client, args [][]byte) error {
+	name := string(args[0])
+	n := 5
+	if name == "cas" {
+		n = 6
+	}
+	if len(args) != n && !noreply(args, n) {
+		c.w.WriteString("ERROR\r\n")
+		return nil
+	}
+	quiet := len(args) > n
+
+	flags, err1 := strconv.ParseUint(string(args[2]), 10, 32)
+	exptime, err2 := strconv.ParseInt(string(args[3]), 10, 64)
+	size, err3 := strconv.Atoi(string(args[4]))
+	var cas uint64
+	var err4 error
+	if name == "cas" {
+		cas, err4 = strconv.ParseUint(string(args[5]), 10, 64)
+	}
+	if err1 != nil || err2 != nil || err3 != nil || err4 != nil || size < 0 {
+		c.w.WriteString("CLIENT_ERROR bad command line format\r\n")
+		return nil
+	}
+
+	if size > maxItemSize {
+		// swallow the data so that the next command is read correctly
+		if _, err := c.readData(size); err != nil {
+			return err
+		}
+		c.w.WriteString("SERVER_ERROR object too large for cache\r\n")
+		return nil
+	}
+	data, err := c.readData(size)
+	if err != nil {
+		return err
+	}
+	if !validKey(args[1]) {
+		c.w.WriteString("CLIENT_ERROR bad command line format\r\n")
+		return nil
+	}
+
+	s.cmdSet.Add(1)
+	mode := name
+	if name == "cas" {
+		mode = "set"
+	}
+	res, _ := s.storeItem(mode, string(args[1]), item{flags: uint32(flags), exptime: absoluteExptime(exptime), data: data}, name == "cas", cas)
+	if !quiet {
+		c.w.WriteString(textResults[res] + "\r\n")
+	}
+	return nil
+}
+
+// result is the outcome of a storage command.
+type result int
+
+const (
+	stored result = iota
+	notStored
+	exists
+	notFound
+)
+
+var textResults = [...]string{"STORED", "NOT_STORED", "EXISTS", "NOT_FOUND"}
+
+// storeItem applies a storage command: set, add, replace, append or
+// prepend. With checkCAS set, the item must exist and have the CAS value cas.
+// It returns the CAS value of the stored item.
+func (s *Server) storeItem(mode, key string, it item, checkCAS bool, cas uint64) (result, uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// a plain set does not read the old item, which would count as an access
+	var old item
+	var ok bool
+	if mode != "set" || checkCAS {
+		old, ok = s.lookup(key)
+	}
+	if checkCAS {
+		if !ok {
+			return notFound, 0
+		}
+		if old.cas != cas {
+			return exists, 0
+		}
+	}
+
+	switch mode {
+	case "add":
+		if ok {
+			return notStored, 0
+		}
+	case "replace":
+		if !ok {
+			return notStored, 0
+		}
+	case "append", "prepend":
+		if !ok {
+			return notStored, 0
+		}
+		data := make([]byte, 0, len(old.data)+len(it.data))
+		if mode == "append" {
+			data = append(append(data, old.data...), it.data...)
+		} else {
+			data = append(append(data, it.data...), old.data...)
+		}
+		// append and prepend keep the flags and expiry of the item
+		it = item{flags: old.flags, exptime: old.exptime, data: data}
+	}
+	return stored, s.put(key, it)
+}
+
+// delete implements delete <key> [noreply].
+func (s *Server) delete(c *client, args [][]byte) {
+	if len(args) != 2 && !noreply(args, 2) {
+		c.w.WriteString("CLIENT_ERROR bad command line format\r\n")
+		return
+	}
+
+	s.mu.Lock()
+	_, ok := s.lookup(string(args[1]))
+	if ok {
+		s.cache.Remove(string(args[1]))
+	}
+	s.mu.Unlock()
+
+	if len(args) == 2 {
+		if ok {
+			c.w.WriteString("DELETED\r\n")
+		} else {
+			c.w.WriteString("NOT_FOUND\r\n")
+		}
+	}
+}
+
+// incr implements incr and decr <key> <delta> [noreply]. The value must be
+// a decimal number; incr wraps around at 2^64, decr stops at 0.
+func (s *Server) incr(c *client, args [][]byte) {
+	if len(args) != 3 && !noreply(args, 3) {
+		c.w.WriteString("ERROR\r\n")
+		return
+	}
+	delta, err := strconv.ParseUint(string(args[2]), 10, 64)
+	if err != nil {
+		c.w.WriteString("CLIENT_ERROR invalid numeric delta argument\r\n")
+		return
+	}
+
+	reply := s.incrItem(string(args[1]), delta, string(args[0]) == "decr")
+	if len(args) == 3 {
+		c.w.WriteString(reply + "\r\n")
+	}
+}
+
+func (s *Server) incrItem(key string, delta uint64, decr bool) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	it, ok := s.lookup(key)
+	if !ok {
+		return "NOT_FOUND"
+	}
+	n, err := strconv.ParseUint(string(it.data), 10, 64)
+	if err != nil {
+		return "CLIENT_ERROR cannot increment or decrement non-numeric value"
+	}
+	switch {
+	case !decr:
+		n += delta
+	case delta > n:
+		n = 0
+	default:
+		n -= delta
+	}
+	it.data = strconv.AppendUint(nil, n, 10)
+	s.put(key, it)
+	return string(it.data)
+}
+
+// touch implements touch <key> <exptime> [noreply].
+func (s *Server) touch(c *client, args [][]byte) {
+	if len(args) != 3 && !noreply(args, 3) {
+		c.w.WriteString("ERROR\r\n")
+		return
+	}
+	exptime, err := strconv.ParseInt(string(args[2]), 10, 64)
+	if err != nil {
+		c.w.WriteString("CLIENT_ERROR invalid exptime argument\r\n")
+		return
+	}
+
+	s.mu.Lock()
+	it, ok := s.lookup(string(args[1]))
+	if ok {
+		s.touchItem(string(args[1]), it, absoluteExptime(exptime))
+	}
+	s.mu.Unlock()
+
+	if len(args) == 3 {
+		if ok {
+			c.w.WriteString("TOUCHED\r\n")
+		} else {
+			c.w.WriteString("NOT_FOUND\r\n")
+		}
+	}
+}
@@ -0,0 +1,288 @@
+// Package mrc computes miss ratio curves: the miss ratio of a cache policy
+// on a trace, as a function of the cache size.
+//
+// LRU is a stack algorithm: a request hits in a cache of size n if and only
+// if fewer than n distinct keys were requested since the previous request
+// of its key, its reuse distance. The whole LRU curve therefore takes a
+// single pass over the trace. SHARDS (Waldspurger et al., FAST 2015) makes
+// the pass scale to large traces by only following the keys whose hash
+// falls under a threshold, a fixed share of them: the reuse distances of
+// the sample, divided by the rate, estimate those of the whole trace.
+//
+// The other policies have no such property, and Approximate replays the
+// trace in the simulator at a few sizes instead, on a sample of the trace
+// and at sizes scaled by the rate if asked to.
+//
+// Both read their trace once, as a stream.
+//
+//	curve, err := mrc.Sample(r, 0.01)
+//	fmt.Println(curve.MissRatio(10000))
+package mrc
+
+import (
+	"errors"
+	"io"
+	"math"
+	"sort"
+
+	"github.com/hey-kong/stashlist/sim"
+	"github.com/hey-kong/stashlist/trace"
+)
+
+// ErrRate is returned for sampling rates outside of (0, 1].
+var ErrRate = errors.New("mrc: sampling rate must be in (0, 1]")
+
+// modulus is the hash space the sampling threshold is taken in.
+const modulus = 1 << 24
+
+// Point is the miss ratio of a cache size.
+type Point struct {
+	Size      int
+	MissRatio float64
+}
+
+// Curve is a miss ratio curve, by increasing size. Between two points, the
+// miss ratio is that of the smaller size.
+type Curve struct {
+	Name   string
+	Points []Point
+}
+
+// MissRatio returns the miss ratio of a cache of size entries, 1 below the
+// first point.
+func (c Curve) MissRatio(size int) float64 {
+	i := sort.Search(len(c.Points), func(i int) bool { return c.Points[i].Size > size })
+	if i == 0 {
+		return 1
+	}
+	return c.Points[i-1].MissRatio
+}
+
+// Compute returns the exact LRU miss ratio curve of the trace read from r.
+// A get request hits if its key is in the cache, and is added to the cache
+// otherwise. Set requests add their key, and are not counted in the miss
+// ratio. Delete requests remove their key from the stack of keys, which
+// brings back the keys that a cache of the size would have evicted: with
+// deletes, the curve is an approximation.
+func Compute(r trace.Reader) (Curve, error) {
+	return Sample(r, 1)
+}
+
+// Sample returns the LRU miss ratio curve of the trace read from r,
+// estimated by SHARDS from a rate of the keys. The memory used grows with
+// the number of requests sampled; a rate of 1 computes the exact curve. The
+// sizes below a few times 1/rate are poorly estimated, as they depend on
+// which of the most popular keys were sampled. As in SHARDS-adj, the
+// difference between the expected and the actual number of sampled get
+// requests is counted as hits of the smallest size, to correct for the
+// popular keys that happened to be sampled, or not.
+func Sample(r trace.Reader, rate float64) (Curve, error) {
+	if rate <= 0 || rate > 1 {
+		return Curve{}, ErrRate
+	}
+	threshold := uint64(rate * modulus)
+
+	// marks holds a 1 at the time of the last request of each key, so that
+	// the marks between two requests of a key count the distinct keys
+	// requested in between. Only the sampled requests take a time.
+	var marks fenwick
+	last := make(map[string]int)
+	// hits counts the get requests by reuse distance in the sample, from 1.
+	var hits []int
+	gets, sampled := 0, 0
+	for {
+		req, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return Curve{}, err
+		}
+		if req.Op == trace.Get {
+			gets++
+		}
+		if hash(req.Key)%modulus >= threshold {
+			continue
+		}
+		prev, ok := last[req.Key]
+		if req.Op == trace.Delete {
+			if ok {
+				marks.add(prev, -1)
+				delete(last, req.Key)
+			}
+			continue
+		}
+		if req.Op == trace.Get {
+			sampled++
+		}
+		now := marks.push()
+		if ok {
+			d := marks.sum(now-1) - marks.sum(prev) + 1
+			marks.add(prev, -1)
+			if req.Op == trace.Get {
+				for len(hits) <= d {
+					hits = append(hits, 0)
+				}
+				hits[d]++
+			}
+		}
+		marks.add(now, 1)
+		last[req.Key] = now
+	}
+
+	c := Curve{Name: "lru", Points: []Point{{0, 1}}}
+	expected := float64(gets) * rate
+	if expected == 0 {
+		return c, nil
+	}
+	adjust := expected - float64(sampled)
+	for len(hits) < 2 {
+		hits = append(hits, 0)
+	}
+	cum := 0.0
+	for d, n := range hits {
+		if d == 1 {
+			cum += adjust
+		} else if n == 0 {
+			continue
+		}
+		cum += float64(n)
+		c.Points = append(c.Points, Point{scale(d, rate), clamp(1 - cum/expected)})
+	}
+	return c, nil
+}
+
+// Approximate returns the miss ratio curve of policy at sizes, replaying
+// the trace read from r in the simulator, at every size in a single pass.
+// With a rate below 1, it replays the requests of a rate of the keys,
+// chosen as in Sample, in caches scaled down by the rate.
+func Approximate(policy string, r trace.Reader, sizes []int, rate float64, seed int64) (Curve, error) {
+	if rate <= 0 || rate > 1 {
+		return Curve{}, ErrRate
+	}
+	if rate < 1 {
+		r = &sampler{r: r, threshold: uint64(rate * modulus)}
+	}
+	sizes = append([]int(nil), sizes...)
+	sort.Ints(sizes)
+	scaled := make([]int, len(sizes))
+	for i, size := range sizes {
+		scaled[i] = int(math.Round(float64(size) * rate))
+		if scaled[i] < 1 {
+			scaled[i] = 1
+		}
+	}
+
+	results, err := sim.Sweep([]string{policy}, scaled, seed, r)
+	if err != nil {
+		return Curve{}, err
+	}
+	c := Curve{Name: policy}
+	for i, res := range results {
+		ratio := 1.0
+		if res.Requests > 0 {
+			ratio = 1 - res.HitRatio
+		}
+		c.Points = append(c.Points, Point{sizes[i], ratio})
+	}
+	return c, nil
+}
+
+// sampler reads the requests of the keys whose hash is below threshold.
+type sampler struct {
+	r         trace.Reader
+	threshold uint64
+}
+
+func (s *sampler) Read() (trace.Request, error) {
+	for {
+		req, err := s.r.Read()
+		if err != nil || hash(req.Key)%modulus < s.threshold {
+			return req, err
+		}
+	}
+}
+
+// Sizes returns up to n cache sizes from smallest to largest, spaced
+// geometrically, for Approximate.
+func Sizes(smallest, largest, n int) []int {
+	if smallest < 1 {
+		smallest = 1
+	}
+	if n < 2 || largest <= smallest {
+		return []int{largest}
+	}
+	var sizes []int
+	step := math.Pow(float64(largest)/float64(smallest), 1/float64(n-1))
+	for i := 0; i < n; i++ {
+		size := int(math.Round(float64(smallest) * math.Pow(step, float64(i))))
+		if len(sizes) == 0 || size > sizes[len(sizes)-1] {
+			sizes = append(sizes, size)
+		}
+	}
+	return sizes
+}
+
+// scale returns the size a reuse distance of the sample stands for.
+func scale(d int, rate float64) int {
+	if rate == 1 {
+		return d
+	}
+	return int(math.Ceil(float64(d) / rate))
+}
+
+func clamp(ratio float64) float64 {
+	if ratio < 0 {
+		return 0
+	}
+	if ratio > 1 {
+		return 1
+	}
+	return ratio
+}
+
+// hash is FNV-1a, finalized as in MurmurHash3 so that its low bits, which
+// the sampling looks at, depend on every byte of the key.
+func hash(key string) uint64 {
+	h := uint64(14695981039346656037)
+	for i := 0; i < len(key); i++ {
+		h ^= uint64(key[i])
+		h *= 1099511628211
+	}
+	h ^= h >> 33
+	h *= 0xff51afd7ed558ccd
+	h ^= h >> 33
+	h *= 0xc4ceb9fe1a85ec53
+	h ^= h >> 33
+	return h
+}
+
+// fenwick is a Fenwick tree of counts at times 1 to len-1, which grows as
+// times are pushed.
+type fenwick []int
+
+// push adds a time with a count of 0 and returns it.
+func (f *fenwick) push() int {
+	if len(*f) == 0 {
+		*f = append(*f, 0)
+	}
+	// the new node covers the times after i-lowbit(i), up to the new one
+	i := len(*f)
+	*f = append(*f, f.sum(i-1)-f.sum(i-i&-i))
+	return i
+}
+
+func (f fenwick) add(i, delta int) {
+	for ; i < len(f); i += i & -i {
+		f[i] += delta
+	}
+}
+
+// sum returns the sum of the counts at times 1 to i.
+func (f fenwick) sum(i int) int {
+	s := 0
+	for ; i > 0; i -= i & -i {
+		s += f[i]
+	}
+	return s
+}
@@ -0,0 +1,141 @@
+package mrc
+
+import (
+	"errors"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/hey-kong/stashlist/sim"
+	"github.com/hey-kong/stashlist/trace"
+)
+
+func TestCompute(t *testing.T) {
+	reqs := trace.Zipf(1, 1.1, 5000, 50000, 1, 1)
+	// mix in sets, which LRU replays as adds
+	for i := 3; i < len(reqs); i += 17 {
+		reqs[i].Op = trace.Set
+	}
+	c, err := Compute(trace.NewSliceReader(reqs))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, size := range []int{1, 10, 100, 1000, 5000} {
+		r, err := sim.Run("lru", size, 1, trace.NewSliceReader(reqs))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := c.MissRatio(size); math.Abs(got-(1-r.HitRatio)) > 1e-9 {
+			t.Fatalf("miss ratio at %d is %f, the simulator gives %f", size, got, 1-r.HitRatio)
+		}
+	}
+	if c.MissRatio(0) != 1 {
+		t.Fatal("an empty cache hits")
+	}
+	for i := 1; i < len(c.Points); i++ {
+		if c.Points[i].Size <= c.Points[i-1].Size || c.Points[i].MissRatio > c.Points[i-1].MissRatio {
+			t.Fatal("the curve is not decreasing at", c.Points[i])
+		}
+	}
+}
+
+func TestSample(t *testing.T) {
+	reqs := trace.Zipf(2, 1.05, 100000, 500000, 1, 1)
+	exact, err := Compute(trace.NewSliceReader(reqs))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := Sample(trace.NewZipfReader(2, 1.05, 100000, 500000, 1, 1), 0.05)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, size := range []int{1000, 10000, 50000} {
+		if d := math.Abs(c.MissRatio(size) - exact.MissRatio(size)); d > 0.02 {
+			t.Errorf("sampled miss ratio at %d is %f, want %f", size, c.MissRatio(size), exact.MissRatio(size))
+		}
+	}
+	for _, rate := range []float64{0, -1, 1.5} {
+		if _, err := Sample(trace.NewSliceReader(reqs), rate); !errors.Is(err, ErrRate) {
+			t.Fatal("a rate of", rate, "gave", err)
+		}
+	}
+}
+
+func TestApproximate(t *testing.T) {
+	reqs := trace.Zipf(3, 1.05, 50000, 300000, 1, 1)
+	sizes := Sizes(100, 10000, 5)
+	if len(sizes) != 5 || sizes[0] != 100 || sizes[4] != 10000 {
+		t.Fatal("sizes", sizes)
+	}
+	full, err := Approximate("sieve", trace.NewSliceReader(reqs), sizes, 1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range full.Points {
+		r, _ := sim.Run("sieve", p.Size, 1, trace.NewSliceReader(reqs))
+		if p.MissRatio != 1-r.HitRatio {
+			t.Fatalf("miss ratio at %d is %f, the simulator gives %f", p.Size, p.MissRatio, 1-r.HitRatio)
+		}
+	}
+	sampled, err := Approximate("sieve", trace.NewSliceReader(reqs), sizes, 0.1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, p := range sampled.Points {
+		if d := math.Abs(p.MissRatio - full.Points[i].MissRatio); d > 0.05 {
+			t.Errorf("sampled miss ratio at %d is %f, want %f", p.Size, p.MissRatio, full.Points[i].MissRatio)
+		}
+	}
+	if _, err := Approximate("missing", trace.NewSliceReader(reqs), sizes, 1, 1); !errors.Is(err, sim.ErrUnknownPolicy) {
+		t.Fatal("an unknown policy gave", err)
+	}
+}
+
+func TestFenwick(t *testing.T) {
+	var f fenwick
+	counts := make([]int, 1)
+	for i := 1; i <= 1000; i++ {
+		if got := f.push(); got != i {
+			t.Fatal("pushed time", got, "want", i)
+		}
+		counts = append(counts, i%7)
+		f.add(i, i%7)
+		if i%3 == 0 {
+			f.add(i/2+1, 1)
+			counts[i/2+1]++
+		}
+		sum := 0
+		for j := 1; j <= i; j++ {
+			sum += counts[j]
+			if j%97 == 0 || j == i {
+				if got := f.sum(j); got != sum {
+					t.Fatalf("sum to %d of %d times is %d, want %d", j, i, got, sum)
+				}
+			}
+		}
+	}
+}
+
+func TestWrite(t *testing.T) {
+	curves := []Curve{
+		{Name: "lru", Points: []Point{{0, 1}, {1, 0.5}, {10, 0.25}}},
+		{Name: "a<b", Points: []Point{{5, 0.4}}},
+	}
+	var b strings.Builder
+	if err := WriteCSV(&b, curves...); err != nil {
+		t.Fatal(err)
+	}
+	want := "curve,size,miss_ratio\nlru,0,1.000000\nlru,1,0.500000\nlru,10,0.250000\na<b,5,0.400000\n"
+	if b.String() != want {
+		t.Fatalf("CSV:\n%s", b.String())
+	}
+
+	b.Reset()
+	if err := WriteSVG(&b, curves...); err != nil {
+		t.Fatal(err)
+	}
+	svg := b.String()
+	if !strings.HasPrefix(svg, "<svg") || strings.Count(svg, "<polyline") != 2 || !strings.Contains(svg, "a&lt;b") {
+		t.Fatalf("SVG:\n%s", svg)
+	}
+}
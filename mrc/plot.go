@@ -0,0 +1,114 @@
+package mrc
+
+import (
+	"encoding/csv"
+	"fmt"
+	"html"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// WriteCSV writes curves to w as CSV, one line per point, under a header
+// of curve, size and miss_ratio.
+func WriteCSV(w io.Writer, curves ...Curve) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"curve", "size", "miss_ratio"})
+	for _, c := range curves {
+		for _, p := range c.Points {
+			cw.Write([]string{c.Name, strconv.Itoa(p.Size), strconv.FormatFloat(p.MissRatio, 'f', 6, 64)})
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// The layout of the plots, in pixels.
+const (
+	plotWidth  = 640
+	plotHeight = 400
+	marginLeft = 60
+	marginTop  = 20
+	marginEnd  = 20
+	marginBase = 50
+)
+
+var colors = []string{"#1f77b4", "#ff7f0e", "#2ca02c", "#d62728", "#9467bd", "#8c564b", "#e377c2", "#7f7f7f", "#bcbd22", "#17becf"}
+
+// WriteSVG plots curves to w as an SVG image, with the cache size on a log
+// scale. The points of size 0 are left out.
+func WriteSVG(w io.Writer, curves ...Curve) error {
+	lo, hi := math.Inf(1), math.Inf(-1)
+	for _, c := range curves {
+		for _, p := range c.Points {
+			if p.Size > 0 {
+				lo = math.Min(lo, math.Log10(float64(p.Size)))
+				hi = math.Max(hi, math.Log10(float64(p.Size)))
+			}
+		}
+	}
+	if lo > hi {
+		lo, hi = 0, 1
+	}
+	lo, hi = math.Floor(lo), math.Ceil(hi)
+	if hi == lo {
+		hi++
+	}
+	innerWidth := float64(plotWidth - marginLeft - marginEnd)
+	innerHeight := float64(plotHeight - marginTop - marginBase)
+	x := func(size int) float64 {
+		return marginLeft + (math.Log10(float64(size))-lo)/(hi-lo)*innerWidth
+	}
+	y := func(ratio float64) float64 {
+		return marginTop + (1-ratio)*innerHeight
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "<svg xmlns=\"http://www.w3.org/2000/svg\" width=\"%d\" height=\"%d\" font-family=\"sans-serif\" font-size=\"12\">\n", plotWidth, plotHeight)
+	fmt.Fprintf(&b, "<rect width=\"%d\" height=\"%d\" fill=\"white\"/>\n", plotWidth, plotHeight)
+	for e := lo; e <= hi; e++ {
+		px := marginLeft + (e-lo)/(hi-lo)*innerWidth
+		fmt.Fprintf(&b, "<line x1=\"%.1f\" y1=\"%d\" x2=\"%.1f\" y2=\"%.1f\" stroke=\"#ddd\"/>\n", px, marginTop, px, y(0))
+		fmt.Fprintf(&b, "<text x=\"%.1f\" y=\"%.1f\" text-anchor=\"middle\">%s</text>\n", px, y(0)+16, strconv.FormatFloat(math.Pow(10, e), 'g', -1, 64))
+	}
+	for i := 0; i <= 5; i++ {
+		ratio := float64(i) / 5
+		fmt.Fprintf(&b, "<line x1=\"%d\" y1=\"%.1f\" x2=\"%d\" y2=\"%.1f\" stroke=\"#ddd\"/>\n", marginLeft, y(ratio), plotWidth-marginEnd, y(ratio))
+		fmt.Fprintf(&b, "<text x=\"%d\" y=\"%.1f\" text-anchor=\"end\">%.1f</text>\n", marginLeft-6, y(ratio)+4, ratio)
+	}
+	fmt.Fprintf(&b, "<text x=\"%.1f\" y=\"%d\" text-anchor=\"middle\">cache size (entries)</text>\n", marginLeft+innerWidth/2, plotHeight-10)
+	fmt.Fprintf(&b, "<text x=\"14\" y=\"%.1f\" text-anchor=\"middle\" transform=\"rotate(-90 14 %.1f)\">miss ratio</text>\n", marginTop+innerHeight/2, marginTop+innerHeight/2)
+
+	for i, c := range curves {
+		color := colors[i%len(colors)]
+		// keep one point per pixel column, the last, so that exact curves
+		// of millions of points stay small
+		var xs, ys []float64
+		for _, p := range c.Points {
+			if p.Size <= 0 {
+				continue
+			}
+			px, py := x(p.Size), y(p.MissRatio)
+			if n := len(xs); n > 0 && math.Round(xs[n-1]) == math.Round(px) {
+				ys[n-1] = py
+				continue
+			}
+			xs, ys = append(xs, px), append(ys, py)
+		}
+		b.WriteString("<polyline fill=\"none\" stroke=\"" + color + "\" stroke-width=\"2\" points=\"")
+		for j := range xs {
+			if j > 0 {
+				b.WriteByte(' ')
+			}
+			fmt.Fprintf(&b, "%.1f,%.1f", xs[j], ys[j])
+		}
+		b.WriteString("\"/>\n")
+		ly := marginTop + 16 + 18*i
+		fmt.Fprintf(&b, "<line x1=\"%d\" y1=\"%d\" x2=\"%d\" y2=\"%d\" stroke=\"%s\" stroke-width=\"2\"/>\n", plotWidth-marginEnd-110, ly-4, plotWidth-marginEnd-90, ly-4, color)
+		fmt.Fprintf(&b, "<text x=\"%d\" y=\"%d\">%s</text>\n", plotWidth-marginEnd-84, ly, html.EscapeString(c.Name))
+	}
+	b.WriteString("</svg>\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
@@ -0,0 +1,108 @@
+package stashlist
+
+// Versions are not nodes of the list of their own. An Element holds the
+// newest version of its user key, and the older versions hang off it in a
+// chain, newest first; walking the elements, each followed by its chain,
+// yields the internal key order of CompareInternalKeys, as AscendVersions
+// does.
+//
+// The levels of a StashList follow the accesses to a key: reads promote its
+// tower, and writes demote the unvisited towers they pass. With a node per
+// version, a key rewritten often would own many towers, and only the one a
+// read lands on would be promoted. One tower per user key lets the levels
+// track the popularity of the key whatever its number of versions, and
+// keeps seeks and GC proportional to the number of keys.
+
+// InternalKey identifies one version of a user key. Versions are ordered by
+// user key ascending, then by sequence number descending, so that the newest
+// version of a key comes first.
+type InternalKey struct {
+	UserKey string
+	Seq     uint64
+	Deleted bool
+}
+
+// CompareInternalKeys returns -1, 0 or +1 depending on whether a sorts
+// before, together with or after b.
+func CompareInternalKeys(a, b InternalKey) int {
+	switch {
+	case a.UserKey < b.UserKey:
+		return -1
+	case a.UserKey > b.UserKey:
+		return 1
+	case a.Seq > b.Seq:
+		return -1
+	case a.Seq < b.Seq:
+		return 1
+	}
+	return 0
+}
+
+// AddAt writes value for key at sequence number seq. Versions written at
+// lower sequence numbers are kept until GC drops them.
+// All versions of a key share one tower, so promotion and demotion are
+// driven by accesses to the user key, not by the number of versions.
+func (list *StashList) AddAt(key string, value []byte, seq uint64) {
+	list.versioned = true
+	list.insert(key, value, seq, false, true)
+}
+
+// DeleteAt writes a tombstone for key at sequence number seq. The tombstone
+// is recorded even if the key is absent, so that it can shadow older data
+// kept outside of the list.
+func (list *StashList) DeleteAt(key string, seq uint64) {
+	list.versioned = true
+	list.insert(key, nil, seq, true, true)
+}
+
+// GetAt finds the value of key as of sequence number seq.
+// It returns false if the key did not exist or was deleted at that point.
+func (list *StashList) GetAt(key string, seq uint64) ([]byte, bool) {
+	element := list.seek(key)
+	if element == nil || element.key != key {
+		return nil, false
+	}
+
+	value, ok := element.versionAt(seq)
+	if ok && element.visited == false {
+		element.visited = true
+	}
+	return value, ok
+}
+
+// GC drops the versions that no reader at minLiveSeq or later can see: for
+// every key, all versions but the newest one at or below minLiveSeq. Keys whose
+// only remaining version is a tombstone are unlinked. Live snapshots still
+// hold on to what they can see.
+func (list *StashList) GC(minLiveSeq uint64) {
+	if minLiveSeq > list.gcSeq {
+		list.gcSeq = minLiveSeq
+	}
+	list.reclaim()
+}
+
+// NewIteratorAt returns an iterator over the list as of sequence number seq.
+func (list *StashList) NewIteratorAt(seq uint64) *Iterator {
+	return &Iterator{list: list, seq: seq}
+}
+
+// AscendVersions calls fn for every version of every key from start on, in
+// internal key order, until fn returns false. Tombstones are included, with
+// a nil value.
+func (list *StashList) AscendVersions(start string, fn func(ik InternalKey, value []byte) bool) {
+	for element := list.seek(start); element != nil; element = element.next[0] {
+		if !fn(InternalKey{UserKey: element.key, Seq: element.seq, Deleted: element.deleted}, element.value) {
+			return
+		}
+		for v := element.older; v != nil; v = v.older {
+			if !fn(InternalKey{UserKey: element.key, Seq: v.seq, Deleted: v.deleted}, v.value) {
+				return
+			}
+		}
+	}
+}
+
+// LastSeq returns the sequence number of the latest write.
+func (list *StashList) LastSeq() uint64 {
+	return list.seq
+}
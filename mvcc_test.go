@@ -0,0 +1,108 @@
+package stashlist
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+func TestVersionedReads(t *testing.T) {
+	list := NewStashList()
+	list.AddAt("a", []byte("a1"), 1)
+	list.AddAt("b", []byte("b2"), 2)
+	list.AddAt("a", []byte("a3"), 3)
+	list.DeleteAt("b", 4)
+	list.AddAt("a", []byte("a0"), 0)
+
+	cases := []struct {
+		key   string
+		seq   uint64
+		value string
+		ok    bool
+	}{
+		{"a", 0, "a0", true},
+		{"a", 2, "a1", true},
+		{"a", 9, "a3", true},
+		{"b", 1, "", false},
+		{"b", 3, "b2", true},
+		{"b", 4, "", false},
+		{"c", 9, "", false},
+	}
+	for _, c := range cases {
+		v, ok := list.GetAt(c.key, c.seq)
+		if ok != c.ok || !bytes.Equal(v, []byte(c.value)) && c.ok {
+			t.Fatalf("GetAt(%q, %d) = %q, %v (expected %q, %v)", c.key, c.seq, v, ok, c.value, c.ok)
+		}
+	}
+	if list.Length != 1 {
+		t.Fatal("wrong list length", list.Length)
+	}
+
+	var got []InternalKey
+	list.AscendVersions("", func(ik InternalKey, value []byte) bool {
+		got = append(got, ik)
+		return true
+	})
+	if len(got) != 5 {
+		t.Fatal("wrong number of versions", len(got))
+	}
+	for i := 1; i < len(got); i++ {
+		if CompareInternalKeys(got[i-1], got[i]) >= 0 {
+			t.Fatalf("versions out of order: %v before %v", got[i-1], got[i])
+		}
+	}
+}
+
+func TestVersionedGC(t *testing.T) {
+	list := NewStashList()
+	list.AddAt("a", []byte("a1"), 1)
+	list.AddAt("a", []byte("a2"), 2)
+	list.AddAt("a", []byte("a3"), 3)
+	list.AddAt("b", []byte("b1"), 1)
+	list.DeleteAt("b", 2)
+
+	list.GC(2)
+	if v, ok := list.GetAt("a", 2); !ok || !bytes.Equal(v, []byte("a2")) {
+		t.Fatalf(`GetAt("a", 2) = %q after GC(2)`, v)
+	}
+	if _, ok := list.GetAt("a", 1); ok {
+		t.Fatal(`version 1 of "a" survived GC(2)`)
+	}
+	if e := list.seek("b"); e != nil && e.key == "b" {
+		t.Fatal(`deleted key "b" is still linked after GC(2)`)
+	}
+
+	list.GC(3)
+	if e := list.seek("a"); e.older != nil {
+		t.Fatal(`old versions of "a" survived GC(3)`)
+	}
+}
+
+func TestVersionedGCMissingKeys(t *testing.T) {
+	list := NewStashList()
+	list.AddAt("a", []byte("a1"), 1)
+	for i := 0; i < 100; i++ {
+		list.DeleteAt(fmt.Sprintf("k%03d", i), uint64(i+2))
+	}
+
+	list.GC(50)
+	n := 0
+	for e := list.next[0]; e != nil; e = e.next[0] {
+		n++
+	}
+	// the tombstones above the watermark still shadow older data
+	if n != 1+51 {
+		t.Fatal("wrong number of linked elements after GC(50)", n)
+	}
+
+	list.GC(1000)
+	if e := list.next[0]; e == nil || e.key != "a" || e.next[0] != nil {
+		t.Fatal("tombstones of missing keys are still linked after GC(1000)")
+	}
+	if len(list.history) != 0 {
+		t.Fatal("tombstones are still in the history", len(list.history))
+	}
+	if v, ok := list.GetAt("a", 1000); !ok || !bytes.Equal(v, []byte("a1")) {
+		t.Fatalf(`GetAt("a", 1000) = %q`, v)
+	}
+}
@@ -0,0 +1,223 @@
+package replication
+
+import (
+	"bufio"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/hey-kong/stashlist"
+)
+
+const (
+	minBackoff = 100 * time.Millisecond
+	maxBackoff = 2 * time.Second
+)
+
+// Follower keeps a read-only copy of a leader's StashList. It connects in
+// the background and reconnects whenever the connection breaks, resuming
+// from the last change it applied. The copy serves its own reads, so its
+// towers adapt to the follower's read pattern, not the leader's: a key read
+// on the follower is promoted when the leader rewrites it, and the keys it
+// leaves unread are demoted as changes are applied.
+// A Follower is safe for concurrent use.
+type Follower struct {
+	// Heartbeat is the interval at which the leader sends heartbeats. The
+	// follower reconnects after three missed ones. It must be set before
+	// Start is called. Defaults to DefaultHeartbeat.
+	Heartbeat time.Duration
+
+	addr string
+
+	mu   sync.Mutex
+	list *stashlist.StashList
+	seq  uint64
+	conn net.Conn
+
+	done chan struct{}
+	wg   sync.WaitGroup
+	once sync.Once
+}
+
+// NewFollower creates a follower of the leader at addr. Call Start to
+// connect.
+func NewFollower(addr string) *Follower {
+	return &Follower{
+		Heartbeat: DefaultHeartbeat,
+		addr:      addr,
+		list:      stashlist.NewStashList(),
+		done:      make(chan struct{}),
+	}
+}
+
+// Start connects to the leader in the background.
+func (f *Follower) Start() {
+	f.wg.Add(1)
+	go f.run()
+}
+
+// Get finds the value of key in the copy.
+func (f *Follower) Get(key string) ([]byte, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.list.Get(key)
+}
+
+// Range calls fn for the keys in [start, end) in order, until fn returns
+// false. An empty end means no upper bound. The copy is locked during the
+// whole scan.
+func (f *Follower) Range(start, end string, fn func(key string, value []byte) bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	it := f.list.NewIterator()
+	for it.Seek(start); it.Valid() && (end == "" || it.Key() < end); it.Next() {
+		if !fn(it.Key(), it.Value()) {
+			return
+		}
+	}
+}
+
+// Len returns the number of keys in the copy.
+func (f *Follower) Len() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.list.Length
+}
+
+// Seq returns the leader's sequence number of the last change applied.
+func (f *Follower) Seq() uint64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.seq
+}
+
+// Close disconnects from the leader. The copy stays readable.
+func (f *Follower) Close() error {
+	f.once.Do(func() {
+		close(f.done)
+		f.mu.Lock()
+		if f.conn != nil {
+			f.conn.Close()
+		}
+		f.mu.Unlock()
+	})
+	f.wg.Wait()
+	return nil
+}
+
+func (f *Follower) run() {
+	defer f.wg.Done()
+
+	backoff := minBackoff
+	for {
+		applied, _ := f.sync()
+
+		// retry at once after making progress, back off otherwise
+		if applied {
+			backoff = minBackoff
+		}
+		select {
+		case <-f.done:
+			return
+		case <-time.After(backoff):
+		}
+		if !applied {
+			backoff *= 2
+			if backoff > maxBackoff {
+				backoff = maxBackoff
+			}
+		}
+	}
+}
+
+// sync runs one connection to the leader until it breaks. It reports
+// whether anything was received.
+func (f *Follower) sync() (bool, error) {
+	conn, err := net.DialTimeout("tcp", f.addr, 3*f.Heartbeat)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+
+	f.mu.Lock()
+	select {
+	case <-f.done:
+		f.mu.Unlock()
+		return false, net.ErrClosed
+	default:
+	}
+	f.conn = conn
+	seq := f.seq
+	f.mu.Unlock()
+	defer func() {
+		f.mu.Lock()
+		f.conn = nil
+		f.mu.Unlock()
+	}()
+
+	r := bufio.NewReader(conn)
+	w := bufio.NewWriter(conn)
+	if err := writeFrame(w, frameHello, encodeSeq(seq)); err != nil {
+		return false, err
+	}
+	if err := w.Flush(); err != nil {
+		return false, err
+	}
+
+	var (
+		applied bool
+		// the list being built from a snapshot, swapped in at its end
+		next    *stashlist.StashList
+		nextSeq uint64
+	)
+	for {
+		conn.SetReadDeadline(time.Now().Add(3 * f.Heartbeat))
+		typ, payload, err := readFrame(r)
+		if err != nil {
+			return applied, err
+		}
+		applied = true
+
+		switch typ {
+		case frameSnapshotBegin:
+			if nextSeq, err = decodeSeq(payload); err != nil {
+				return applied, err
+			}
+			next = stashlist.NewStashList()
+		case frameSnapshotEntry:
+			if next == nil {
+				return applied, errBadFrame
+			}
+			key, value, err := decodeEntry(payload)
+			if err != nil {
+				return applied, err
+			}
+			next.Apply(stashlist.Change{Type: stashlist.EventPut, Key: key, Value: value})
+		case frameSnapshotEnd:
+			if next == nil {
+				return applied, errBadFrame
+			}
+			f.mu.Lock()
+			f.list, f.seq = next, nextSeq
+			f.mu.Unlock()
+			next = nil
+		case frameChange:
+			if next != nil {
+				return applied, errBadFrame
+			}
+			c, err := decodeChange(payload)
+			if err != nil {
+				return applied, err
+			}
+			f.mu.Lock()
+			if c.Seq > f.seq {
+				f.list.Apply(c)
+				f.seq = c.Seq
+			}
+			f.mu.Unlock()
+		case frameHeartbeat:
+		default:
+			return applied, errBadFrame
+		}
+	}
+}
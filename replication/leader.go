@@ -0,0 +1,249 @@
+package replication
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/hey-kong/stashlist"
+)
+
+// DefaultHeartbeat is the interval between heartbeats of an idle leader.
+const DefaultHeartbeat = time.Second
+
+// snapshotChunk is the number of entries sent per pass over the snapshot.
+// The list is locked during each pass only.
+const snapshotChunk = 1024
+
+// Leader owns a StashList and serves its changes to followers.
+// All writes must go through the Leader, which serializes them with the
+// snapshot transfers. A Leader is safe for concurrent use.
+type Leader struct {
+	// Heartbeat is the interval between heartbeats. It must be set before
+	// Serve is called. Defaults to DefaultHeartbeat.
+	Heartbeat time.Duration
+
+	mu   sync.Mutex
+	list *stashlist.StashList
+	log  *stashlist.Changelog
+
+	connsMu sync.Mutex
+	conns   map[net.Conn]struct{}
+	ln      net.Listener
+	closed  bool
+	wg      sync.WaitGroup
+}
+
+// NewLeader makes list a replication leader, recording up to capacity
+// changes for followers that reconnect. Followers further behind than that
+// receive a full snapshot.
+func NewLeader(list *stashlist.StashList, capacity int) *Leader {
+	log := stashlist.NewChangelog(capacity)
+	list.SetChangelog(log)
+	return &Leader{
+		Heartbeat: DefaultHeartbeat,
+		list:      list,
+		log:       log,
+		conns:     make(map[net.Conn]struct{}),
+	}
+}
+
+// Add inserts or updates key.
+func (l *Leader) Add(key string, value []byte) {
+	l.mu.Lock()
+	l.list.Add(key, value)
+	l.mu.Unlock()
+}
+
+// Remove deletes key.
+func (l *Leader) Remove(key string) {
+	l.mu.Lock()
+	l.list.Remove(key)
+	l.mu.Unlock()
+}
+
+// Get finds the value of key.
+func (l *Leader) Get(key string) ([]byte, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.list.Get(key)
+}
+
+// LastSeq returns the sequence number of the latest change.
+func (l *Leader) LastSeq() uint64 {
+	return l.log.LastSeq()
+}
+
+// Serve accepts followers on ln until Close is called.
+func (l *Leader) Serve(ln net.Listener) error {
+	l.connsMu.Lock()
+	if l.closed {
+		l.connsMu.Unlock()
+		return net.ErrClosed
+	}
+	l.ln = ln
+	l.connsMu.Unlock()
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			l.connsMu.Lock()
+			closed := l.closed
+			l.connsMu.Unlock()
+			if closed {
+				return nil
+			}
+			return err
+		}
+
+		l.connsMu.Lock()
+		if l.closed {
+			l.connsMu.Unlock()
+			conn.Close()
+			return nil
+		}
+		l.conns[conn] = struct{}{}
+		l.wg.Add(1)
+		l.connsMu.Unlock()
+
+		go func() {
+			defer l.wg.Done()
+			l.serveConn(conn)
+			l.connsMu.Lock()
+			delete(l.conns, conn)
+			l.connsMu.Unlock()
+			conn.Close()
+		}()
+	}
+}
+
+// Close stops accepting followers and disconnects the current ones.
+func (l *Leader) Close() error {
+	l.connsMu.Lock()
+	l.closed = true
+	var err error
+	if l.ln != nil {
+		err = l.ln.Close()
+	}
+	l.closeConnsLocked()
+	l.connsMu.Unlock()
+
+	l.wg.Wait()
+	return err
+}
+
+func (l *Leader) closeConnsLocked() {
+	for conn := range l.conns {
+		conn.Close()
+	}
+}
+
+func (l *Leader) serveConn(conn net.Conn) {
+	r := bufio.NewReader(conn)
+	w := bufio.NewWriter(conn)
+
+	conn.SetReadDeadline(time.Now().Add(3 * l.Heartbeat))
+	typ, payload, err := readFrame(r)
+	if err != nil || typ != frameHello {
+		return
+	}
+	seq, err := decodeSeq(payload)
+	if err != nil {
+		return
+	}
+	conn.SetReadDeadline(time.Time{})
+
+	// a follower with nothing, or too far behind, starts from a snapshot
+	changes, err := l.log.ChangesSince(seq)
+	if seq == 0 || errors.Is(err, stashlist.ErrTruncated) || seq > l.log.LastSeq() {
+		if seq, err = l.sendSnapshot(conn, w); err != nil {
+			return
+		}
+		changes, err = l.log.ChangesSince(seq)
+	}
+
+	for err == nil {
+		for _, c := range changes {
+			if err = writeFrame(w, frameChange, encodeChange(c)); err != nil {
+				return
+			}
+			seq = c.Seq
+		}
+		if err = l.flush(conn, w); err != nil {
+			return
+		}
+
+		select {
+		case <-l.log.Wait(seq):
+		case <-time.After(l.Heartbeat):
+			if err = writeFrame(w, frameHeartbeat, encodeSeq(seq)); err != nil {
+				return
+			}
+		}
+		// a follower that fell out of the changelog reconnects and gets a snapshot
+		changes, err = l.log.ChangesSince(seq)
+	}
+}
+
+// sendSnapshot streams a consistent view of the list. Writes go on between
+// the chunks: the snapshot keeps what it sees stable, and the changes made
+// meanwhile are sent from the changelog afterwards.
+func (l *Leader) sendSnapshot(conn net.Conn, w *bufio.Writer) (uint64, error) {
+	l.mu.Lock()
+	snap := l.list.Snapshot()
+	l.mu.Unlock()
+	defer func() {
+		l.mu.Lock()
+		snap.Release()
+		l.mu.Unlock()
+	}()
+
+	seq := snap.Seq()
+	if err := writeFrame(w, frameSnapshotBegin, encodeSeq(seq)); err != nil {
+		return 0, err
+	}
+
+	var entries [][]byte
+	it := snap.NewIterator()
+	first, last := true, ""
+	for {
+		entries = entries[:0]
+		l.mu.Lock()
+		if first {
+			it.SeekToFirst()
+			first = false
+		} else {
+			it.Seek(last)
+			if it.Valid() && it.Key() == last {
+				it.Next()
+			}
+		}
+		for ; it.Valid() && len(entries) < snapshotChunk; it.Next() {
+			entries = append(entries, encodeEntry(nil, it.Key(), it.Value()))
+			last = it.Key()
+		}
+		done := !it.Valid()
+		l.mu.Unlock()
+
+		for _, e := range entries {
+			if err := writeFrame(w, frameSnapshotEntry, e); err != nil {
+				return 0, err
+			}
+		}
+		if done {
+			break
+		}
+	}
+
+	if err := writeFrame(w, frameSnapshotEnd, nil); err != nil {
+		return 0, err
+	}
+	return seq, l.flush(conn, w)
+}
+
+func (l *Leader) flush(conn net.Conn, w *bufio.Writer) error {
+	conn.SetWriteDeadline(time.Now().Add(3 * l.Heartbeat))
+	return w.Flush()
+}
@@ -0,0 +1,202 @@
+package replication
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/hey-kong/stashlist"
+)
+
+func startLeader(t *testing.T, list *stashlist.StashList, capacity int) (*Leader, string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := NewLeader(list, capacity)
+	l.Heartbeat = 50 * time.Millisecond
+	go l.Serve(ln)
+	t.Cleanup(func() { l.Close() })
+	return l, ln.Addr().String()
+}
+
+func startFollower(t *testing.T, addr string) *Follower {
+	t.Helper()
+	f := NewFollower(addr)
+	f.Heartbeat = 50 * time.Millisecond
+	f.Start()
+	t.Cleanup(func() { f.Close() })
+	return f
+}
+
+func waitSeq(t *testing.T, f *Follower, seq uint64) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for f.Seq() < seq {
+		if time.Now().After(deadline) {
+			t.Fatalf("follower stuck at seq %d, want %d", f.Seq(), seq)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func dropFollowers(l *Leader) {
+	l.connsMu.Lock()
+	l.closeConnsLocked()
+	l.connsMu.Unlock()
+}
+
+func checkSame(t *testing.T, l *Leader, f *Follower) {
+	t.Helper()
+	var want []string
+	l.mu.Lock()
+	it := l.list.NewIterator()
+	for it.SeekToFirst(); it.Valid(); it.Next() {
+		want = append(want, it.Key()+"="+string(it.Value()))
+	}
+	l.mu.Unlock()
+
+	var got []string
+	f.Range("", "", func(key string, value []byte) bool {
+		got = append(got, key+"="+string(value))
+		return true
+	})
+	if len(got) != len(want) || f.Len() != len(want) {
+		t.Fatalf("follower has %d keys (Len %d), leader %d", len(got), f.Len(), len(want))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("follower has %s at %d, leader %s", got[i], i, want[i])
+		}
+	}
+}
+
+func TestSnapshotThenStream(t *testing.T) {
+	list := stashlist.NewStashList()
+	for i := 0; i < 3000; i++ {
+		list.Add(strconv.Itoa(i), []byte("v"+strconv.Itoa(i)))
+	}
+	l, addr := startLeader(t, list, 1024)
+	f := startFollower(t, addr)
+
+	for i := 0; i < 100; i++ {
+		l.Add("k"+strconv.Itoa(i), []byte(strconv.Itoa(i)))
+	}
+	for i := 0; i < 3000; i += 3 {
+		l.Remove(strconv.Itoa(i))
+	}
+	waitSeq(t, f, l.LastSeq())
+	checkSame(t, l, f)
+
+	if v, ok := f.Get("k42"); !ok || string(v) != "42" {
+		t.Fatal("follower read returned", string(v), ok)
+	}
+	if _, ok := f.Get("3"); ok {
+		t.Fatal("follower still has a removed key")
+	}
+}
+
+func TestReconnectCatchesUp(t *testing.T) {
+	l, addr := startLeader(t, stashlist.NewStashList(), 1024)
+	f := startFollower(t, addr)
+
+	l.Add("a", []byte("1"))
+	waitSeq(t, f, l.LastSeq())
+
+	dropFollowers(l)
+	for i := 0; i < 50; i++ {
+		l.Add("b"+strconv.Itoa(i), []byte("x"))
+	}
+	l.Remove("a")
+	waitSeq(t, f, l.LastSeq())
+	checkSame(t, l, f)
+}
+
+func TestTruncatedResyncs(t *testing.T) {
+	l, addr := startLeader(t, stashlist.NewStashList(), 8)
+	f := startFollower(t, addr)
+
+	l.Add("a", []byte("1"))
+	waitSeq(t, f, l.LastSeq())
+
+	// stop the follower while more changes than the changelog keeps happen
+	f.Close()
+	for i := 0; i < 100; i++ {
+		l.Add("c"+strconv.Itoa(i%40), []byte(strconv.Itoa(i)))
+	}
+	l.Remove("a")
+
+	f2 := NewFollower(addr)
+	f2.Heartbeat = 50 * time.Millisecond
+	f2.seq, f2.list = f.seq, f.list
+	f2.Start()
+	defer f2.Close()
+
+	waitSeq(t, f2, l.LastSeq())
+	checkSame(t, l, f2)
+}
+
+func TestHeartbeatKeepsIdleConnection(t *testing.T) {
+	l, addr := startLeader(t, stashlist.NewStashList(), 16)
+	f := startFollower(t, addr)
+
+	l.Add("a", []byte("1"))
+	waitSeq(t, f, l.LastSeq())
+	f.mu.Lock()
+	conn := f.conn
+	f.mu.Unlock()
+
+	// several read deadlines pass without changes
+	time.Sleep(400 * time.Millisecond)
+	f.mu.Lock()
+	same := f.conn == conn
+	f.mu.Unlock()
+	if !same {
+		t.Fatal("idle follower reconnected")
+	}
+
+	l.Add("b", []byte("2"))
+	waitSeq(t, f, l.LastSeq())
+	checkSame(t, l, f)
+}
+
+func TestFollowerReadsPromote(t *testing.T) {
+	list := stashlist.NewStashList()
+	for i := 0; i < 3000; i++ {
+		list.Add(fmt.Sprintf("%04d", i), nil)
+	}
+	l, addr := startLeader(t, list, 1024)
+	f := startFollower(t, addr)
+	l.Add("x", nil)
+	waitSeq(t, f, l.LastSeq())
+
+	levels := func() map[string]int {
+		m := make(map[string]int)
+		f.mu.Lock()
+		f.list.Towers("2900", func(key string, level int, visited bool) bool {
+			m[key] = level
+			return key < "2901"
+		})
+		f.mu.Unlock()
+		return m
+	}
+	before := levels()
+
+	// the leader rewrites both keys, the follower only reads the first
+	for i := 0; i < 10; i++ {
+		f.Get("2900")
+		l.Add("2900", []byte(strconv.Itoa(i)))
+		l.Add("2901", []byte(strconv.Itoa(i)))
+		waitSeq(t, f, l.LastSeq())
+	}
+	after := levels()
+	if after["2900"] <= before["2900"] {
+		t.Fatalf("read key stayed at level %d", after["2900"])
+	}
+	if after["2901"] > before["2901"] {
+		t.Fatalf("unread key grew from level %d to %d", before["2901"], after["2901"])
+	}
+}
@@ -0,0 +1,118 @@
+// Package replication streams the mutations of a leader StashList to
+// read-only followers over TCP.
+//
+// A follower connects and sends the sequence number of the last change it
+// applied. The leader answers with the changes after it, read from its
+// changelog, or with a full snapshot when the follower is new or too far
+// behind. It then keeps streaming changes as they happen, and sends
+// heartbeats while it has none, so that followers notice a dead leader and
+// reconnect.
+//
+// Every message is a frame: [type u8][payload length u32][payload], with
+// big-endian integers.
+package replication
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/hey-kong/stashlist"
+)
+
+const (
+	// follower to leader: [last applied seq u64]
+	frameHello byte = iota + 1
+	// leader to follower: [seq u64], the snapshot contains every change up to seq
+	frameSnapshotBegin
+	// leader to follower: [key length uvarint][key][value]
+	frameSnapshotEntry
+	// leader to follower: empty
+	frameSnapshotEnd
+	// leader to follower: [seq u64][type u8][key length uvarint][key][value]
+	frameChange
+	// leader to follower: [last seq u64]
+	frameHeartbeat
+)
+
+const maxFrameSize = 64 << 20
+
+var errBadFrame = errors.New("replication: malformed frame")
+
+func writeFrame(w *bufio.Writer, typ byte, payload []byte) error {
+	var header [5]byte
+	header[0] = typ
+	binary.BigEndian.PutUint32(header[1:], uint32(len(payload)))
+	if _, err := w.Write(header[:]); err != nil {
+		return err
+	}
+	_, err := w.Write(payload)
+	return err
+}
+
+func readFrame(r *bufio.Reader) (byte, []byte, error) {
+	var header [5]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return 0, nil, err
+	}
+	n := binary.BigEndian.Uint32(header[1:])
+	if n > maxFrameSize {
+		return 0, nil, fmt.Errorf("replication: frame of %d bytes is too large", n)
+	}
+	payload := make([]byte, n)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return 0, nil, err
+	}
+	return header[0], payload, nil
+}
+
+func encodeSeq(seq uint64) []byte {
+	return binary.BigEndian.AppendUint64(nil, seq)
+}
+
+func decodeSeq(p []byte) (uint64, error) {
+	if len(p) != 8 {
+		return 0, errBadFrame
+	}
+	return binary.BigEndian.Uint64(p), nil
+}
+
+func encodeEntry(b []byte, key string, value []byte) []byte {
+	b = binary.AppendUvarint(b, uint64(len(key)))
+	b = append(b, key...)
+	return append(b, value...)
+}
+
+func decodeEntry(p []byte) (string, []byte, error) {
+	n, w := binary.Uvarint(p)
+	if w <= 0 || uint64(len(p)-w) < n {
+		return "", nil, errBadFrame
+	}
+	return string(p[w : w+int(n)]), p[w+int(n):], nil
+}
+
+func encodeChange(c stashlist.Change) []byte {
+	b := binary.BigEndian.AppendUint64(nil, c.Seq)
+	b = append(b, byte(c.Type))
+	return encodeEntry(b, c.Key, c.Value)
+}
+
+func decodeChange(p []byte) (stashlist.Change, error) {
+	var c stashlist.Change
+	if len(p) < 9 {
+		return c, errBadFrame
+	}
+	c.Seq = binary.BigEndian.Uint64(p)
+	c.Type = stashlist.EventType(p[8])
+	key, value, err := decodeEntry(p[9:])
+	if err != nil {
+		return c, err
+	}
+	c.Key = key
+	if c.Type == stashlist.EventPut {
+		c.Value = value
+	}
+	return c, nil
+}
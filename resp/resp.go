@@ -0,0 +1,283 @@
+// Package resp reads and writes the Redis serialization protocol, RESP2
+// and RESP3.
+package resp
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+const (
+	maxBulkSize  = 512 << 20
+	maxArraySize = 1 << 20
+	maxLineSize  = 64 << 10
+)
+
+// ErrProtocol is returned for malformed input.
+var ErrProtocol = errors.New("resp: protocol error")
+
+// Reader reads commands sent by clients, or replies sent by servers.
+type Reader struct {
+	r *bufio.Reader
+}
+
+// NewReader returns a Reader reading from r.
+func NewReader(r io.Reader) *Reader {
+	return &Reader{r: bufio.NewReader(r)}
+}
+
+// Buffered returns the number of bytes that can be read without blocking.
+// A server uses it to tell whether a client has pipelined more commands.
+func (r *Reader) Buffered() int {
+	return r.r.Buffered()
+}
+
+// ReadCommand reads one command: an array of bulk strings, or an inline
+// command made of space-separated words. An empty inline line yields an
+// empty command.
+func (r *Reader) ReadCommand() ([][]byte, error) {
+	line, err := r.readLine()
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 || line[0] != '*' {
+		return splitInline(line), nil
+	}
+
+	n, err := parseLength(line[1:], maxArraySize)
+	if err != nil {
+		return nil, err
+	}
+	args := make([][]byte, 0, n)
+	for i := 0; i < n; i++ {
+		line, err := r.readLine()
+		if err != nil {
+			return nil, err
+		}
+		if len(line) == 0 || line[0] != '$' {
+			return nil, ErrProtocol
+		}
+		arg, err := r.readBulk(line)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+	}
+	return args, nil
+}
+
+// Error is an error reply read by ReadReply.
+type Error string
+
+func (e Error) Error() string {
+	return string(e)
+}
+
+// ReadReply reads one reply sent by a server. Simple strings are returned
+// as string, errors as Error, integers as int64, bulk strings as []byte,
+// nulls as nil, booleans as bool, doubles as float64, and arrays, sets and
+// maps as []any, maps flattened into alternating keys and values.
+func (r *Reader) ReadReply() (any, error) {
+	line, err := r.readLine()
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 {
+		return nil, ErrProtocol
+	}
+	switch line[0] {
+	case '+':
+		return string(line[1:]), nil
+	case '-':
+		return Error(line[1:]), nil
+	case ':':
+		n, err := strconv.ParseInt(string(line[1:]), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%w: bad integer %q", ErrProtocol, line[1:])
+		}
+		return n, nil
+	case '_':
+		return nil, nil
+	case '#':
+		return string(line[1:]) == "t", nil
+	case ',':
+		f, err := strconv.ParseFloat(string(line[1:]), 64)
+		if err != nil {
+			return nil, fmt.Errorf("%w: bad double %q", ErrProtocol, line[1:])
+		}
+		return f, nil
+	case '$':
+		if string(line) == "$-1" {
+			return nil, nil
+		}
+		return r.readBulk(line)
+	case '*', '~', '%':
+		if string(line) == "*-1" {
+			return nil, nil
+		}
+		n, err := parseLength(line[1:], maxArraySize)
+		if err != nil {
+			return nil, err
+		}
+		if line[0] == '%' {
+			n *= 2
+		}
+		values := make([]any, n)
+		for i := range values {
+			if values[i], err = r.ReadReply(); err != nil {
+				return nil, err
+			}
+		}
+		return values, nil
+	}
+	return nil, fmt.Errorf("%w: unknown reply type %q", ErrProtocol, line[0])
+}
+
+func (r *Reader) readBulk(line []byte) ([]byte, error) {
+	n, err := parseLength(line[1:], maxBulkSize)
+	if err != nil {
+		return nil, err
+	}
+	b := make([]byte, n+2)
+	if _, err := io.ReadFull(r.r, b); err != nil {
+		return nil, err
+	}
+	if b[n] != '\r' || b[n+1] != '\n' {
+		return nil, ErrProtocol
+	}
+	return b[:n], nil
+}
+
+// readLine reads a line without its CRLF. The result is only valid until
+// the next read.
+func (r *Reader) readLine() ([]byte, error) {
+	line, err := r.r.ReadSlice('\n')
+	if err == bufio.ErrBufferFull {
+		return nil, fmt.Errorf("%w: line too long", ErrProtocol)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(line) > maxLineSize {
+		return nil, fmt.Errorf("%w: line too long", ErrProtocol)
+	}
+	line = line[:len(line)-1]
+	if len(line) > 0 && line[len(line)-1] == '\r' {
+		line = line[:len(line)-1]
+	}
+	return line, nil
+}
+
+func parseLength(b []byte, limit int) (int, error) {
+	n, err := strconv.Atoi(string(b))
+	if err != nil || n < 0 || n > limit {
+		return 0, fmt.Errorf("%w: bad length %q", ErrProtocol, b)
+	}
+	return n, nil
+}
+
+func splitInline(line []byte) [][]byte {
+	fields := bytes.Fields(line)
+	args := make([][]byte, len(fields))
+	for i, f := range fields {
+		args[i] = append([]byte(nil), f...)
+	}
+	return args
+}
+
+// Writer writes replies. Proto selects the protocol version, 2 or 3;
+// it decides how nulls and maps are encoded.
+type Writer struct {
+	Proto int
+
+	w   *bufio.Writer
+	buf []byte
+}
+
+// NewWriter returns a RESP2 Writer writing to w. Replies are buffered until
+// Flush is called.
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{Proto: 2, w: bufio.NewWriter(w)}
+}
+
+// Flush writes the buffered replies.
+func (w *Writer) Flush() error {
+	return w.w.Flush()
+}
+
+// WriteSimple writes a simple string such as OK.
+func (w *Writer) WriteSimple(s string) {
+	w.w.WriteByte('+')
+	w.w.WriteString(s)
+	w.w.WriteString("\r\n")
+}
+
+// WriteError writes an error. msg should start with an error code such as
+// ERR or WRONGTYPE.
+func (w *Writer) WriteError(msg string) {
+	w.w.WriteByte('-')
+	w.w.WriteString(msg)
+	w.w.WriteString("\r\n")
+}
+
+// WriteInt writes an integer.
+func (w *Writer) WriteInt(n int64) {
+	w.writeHeader(':', n)
+}
+
+// WriteBulk writes a bulk string.
+func (w *Writer) WriteBulk(b []byte) {
+	w.writeHeader('$', int64(len(b)))
+	w.w.Write(b)
+	w.w.WriteString("\r\n")
+}
+
+// WriteBulkString writes a bulk string.
+func (w *Writer) WriteBulkString(s string) {
+	w.writeHeader('$', int64(len(s)))
+	w.w.WriteString(s)
+	w.w.WriteString("\r\n")
+}
+
+// WriteNull writes a null bulk string in RESP2 and a null in RESP3.
+func (w *Writer) WriteNull() {
+	if w.Proto >= 3 {
+		w.w.WriteString("_\r\n")
+		return
+	}
+	w.w.WriteString("$-1\r\n")
+}
+
+// WriteArray writes the header of an array of n elements, which must follow.
+func (w *Writer) WriteArray(n int) {
+	w.writeHeader('*', int64(n))
+}
+
+// WriteMap writes the header of a map of n pairs, which must follow as
+// alternating keys and values. RESP2 has no maps: it gets a flat array.
+func (w *Writer) WriteMap(n int) {
+	if w.Proto >= 3 {
+		w.writeHeader('%', int64(n))
+		return
+	}
+	w.writeHeader('*', int64(2*n))
+}
+
+// WriteCommand writes a command as an array of bulk strings.
+func (w *Writer) WriteCommand(args ...[]byte) {
+	w.WriteArray(len(args))
+	for _, arg := range args {
+		w.WriteBulk(arg)
+	}
+}
+
+func (w *Writer) writeHeader(prefix byte, n int64) {
+	w.buf = append(w.buf[:0], prefix)
+	w.buf = strconv.AppendInt(w.buf, n, 10)
+	w.buf = append(w.buf, '\r', '\n')
+	w.w.Write(w.buf)
+}
@@ -0,0 +1,67 @@
+package resp
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadCommand(t *testing.T) {
+	r := NewReader(strings.NewReader("*2\r\n$3\r\nGET\r\n$3\r\nk\r\n\r\nPING  hello\r\n\r\n*1\r\n$4\r\nPING\r\n"))
+
+	args, err := r.ReadCommand()
+	if err != nil || len(args) != 2 || string(args[0]) != "GET" || string(args[1]) != "k\r\n" {
+		t.Fatalf("wrong command %q, %v", args, err)
+	}
+	args, err = r.ReadCommand()
+	if err != nil || len(args) != 2 || string(args[0]) != "PING" || string(args[1]) != "hello" {
+		t.Fatalf("wrong inline command %q, %v", args, err)
+	}
+	if args, err = r.ReadCommand(); err != nil || len(args) != 0 {
+		t.Fatalf("empty line read as %q, %v", args, err)
+	}
+	if args, err = r.ReadCommand(); err != nil || len(args) != 1 {
+		t.Fatalf("wrong command %q, %v", args, err)
+	}
+
+	r = NewReader(strings.NewReader("*1\r\n$-4\r\n"))
+	if _, err := r.ReadCommand(); !errors.Is(err, ErrProtocol) {
+		t.Fatal("negative length read with", err)
+	}
+}
+
+func TestWriter(t *testing.T) {
+	var b bytes.Buffer
+	w := NewWriter(&b)
+	w.WriteNull()
+	w.WriteMap(1)
+	w.WriteBulkString("k")
+	w.WriteInt(-3)
+	w.Proto = 3
+	w.WriteNull()
+	w.WriteMap(1)
+	w.WriteSimple("OK")
+	w.WriteError("ERR x")
+	w.Flush()
+
+	want := "$-1\r\n*2\r\n$1\r\nk\r\n:-3\r\n_\r\n%1\r\n+OK\r\n-ERR x\r\n"
+	if b.String() != want {
+		t.Fatalf("wrote %q, want %q", b.String(), want)
+	}
+}
+
+func TestReadReply(t *testing.T) {
+	r := NewReader(strings.NewReader("+OK\r\n-ERR x\r\n:-3\r\n$2\r\nhi\r\n$-1\r\n_\r\n#t\r\n,1.5\r\n*2\r\n:1\r\n*-1\r\n%1\r\n+k\r\n$0\r\n\r\n"))
+	want := []any{"OK", Error("ERR x"), int64(-3), []byte("hi"), nil, nil, true, 1.5, []any{int64(1), nil}, []any{"k", []byte{}}}
+	for _, w := range want {
+		got, err := r.ReadReply()
+		if err != nil || !reflect.DeepEqual(got, w) {
+			t.Fatalf("read %#v, %v, want %#v", got, err, w)
+		}
+	}
+	if _, err := NewReader(strings.NewReader("?\r\n")).ReadReply(); !errors.Is(err, ErrProtocol) {
+		t.Fatal("unknown type read with", err)
+	}
+}
@@ -0,0 +1,543 @@
+package server
+
+import (
+	"fmt"
+	"math"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hey-kong/stashlist"
+)
+
+type command struct {
+	run func(s *Server, c *client, args [][]byte)
+	// arity is the exact number of arguments, command name included, or
+	// minus the minimum number if it is negative.
+	arity int
+}
+
+var commands = map[string]command{
+	"ping":    {ping, -1},
+	"echo":    {echo, 2},
+	"hello":   {hello, -1},
+	"quit":    {quit, 1},
+	"select":  {selectDB, 2},
+	"command": {commandInfo, -1},
+	"config":  {config, -2},
+	"client":  {clientCmd, -2},
+
+	"get":     {get, 2},
+	"set":     {set, -3},
+	"del":     {del, -2},
+	"exists":  {exists, -2},
+	"expire":  {expire, 3},
+	"pexpire": {expire, 3},
+	"persist": {persist, 2},
+	"ttl":     {ttlCmd, 2},
+	"pttl":    {ttlCmd, 2},
+	"dbsize":  {dbsize, 1},
+	"keys":    {keys, 2},
+	"scan":    {scan, -2},
+	"range":   {rangeCmd, -3},
+	"info":    {info, -1},
+
+	"watchrange": {watchRange, 3},
+
+	"towers":  {towers, -2},
+	"promote": {promote, 2},
+	"demote":  {demote, 2},
+}
+
+const (
+	errSyntax     = "ERR syntax error"
+	errNotInteger = "ERR value is not an integer or out of range"
+)
+
+func ping(s *Server, c *client, args [][]byte) {
+	switch len(args) {
+	case 1:
+		c.w.WriteSimple("PONG")
+	case 2:
+		c.w.WriteBulk(args[1])
+	default:
+		c.w.WriteError("ERR wrong number of arguments for 'ping' command")
+	}
+}
+
+func echo(s *Server, c *client, args [][]byte) {
+	c.w.WriteBulk(args[1])
+}
+
+// hello switches the protocol version and describes the server.
+func hello(s *Server, c *client, args [][]byte) {
+	if len(args) > 1 {
+		proto, err := strconv.Atoi(string(args[1]))
+		if err != nil || proto < 2 || proto > 3 {
+			c.w.WriteError("NOPROTO unsupported protocol version")
+			return
+		}
+		c.w.Proto = proto
+	}
+
+	c.w.WriteMap(7)
+	c.w.WriteBulkString("server")
+	c.w.WriteBulkString("stashd")
+	c.w.WriteBulkString("version")
+	c.w.WriteBulkString("7.0.0")
+	c.w.WriteBulkString("proto")
+	c.w.WriteInt(int64(c.w.Proto))
+	c.w.WriteBulkString("id")
+	c.w.WriteInt(0)
+	c.w.WriteBulkString("mode")
+	c.w.WriteBulkString("standalone")
+	c.w.WriteBulkString("role")
+	c.w.WriteBulkString("master")
+	c.w.WriteBulkString("modules")
+	c.w.WriteArray(0)
+}
+
+func quit(s *Server, c *client, args [][]byte) {
+	c.w.WriteSimple("OK")
+	c.quit = true
+}
+
+func selectDB(s *Server, c *client, args [][]byte) {
+	if string(args[1]) != "0" {
+		c.w.WriteError("ERR DB index is out of range")
+		return
+	}
+	c.w.WriteSimple("OK")
+}
+
+// commandInfo answers the COMMAND introspection clients send on connect
+// with an empty reply.
+func commandInfo(s *Server, c *client, args [][]byte) {
+	if len(args) > 1 && strings.EqualFold(string(args[1]), "count") {
+		c.w.WriteInt(0)
+		return
+	}
+	c.w.WriteArray(0)
+}
+
+// config has no settings to report; redis-benchmark reads some on start.
+func config(s *Server, c *client, args [][]byte) {
+	if !strings.EqualFold(string(args[1]), "get") {
+		c.w.WriteError("ERR unsupported CONFIG subcommand")
+		return
+	}
+	c.w.WriteMap(0)
+}
+
+func clientCmd(s *Server, c *client, args [][]byte) {
+	switch strings.ToLower(string(args[1])) {
+	case "setname", "setinfo", "no-evict", "no-touch":
+		c.w.WriteSimple("OK")
+	case "getname":
+		c.w.WriteNull()
+	case "id":
+		c.w.WriteInt(0)
+	default:
+		c.w.WriteError("ERR unsupported CLIENT subcommand")
+	}
+}
+
+func get(s *Server, c *client, args [][]byte) {
+	if value, ok := s.list.Get(string(args[1])); ok {
+		c.w.WriteBulk(value)
+		return
+	}
+	c.w.WriteNull()
+}
+
+// set implements SET key value [NX | XX] [GET] [EX seconds | PX milliseconds | KEEPTTL].
+func set(s *Server, c *client, args [][]byte) {
+	key := string(args[1])
+	var (
+		nx, xx, getOld, keepTTL bool
+		ttl                     time.Duration
+	)
+	for i := 3; i < len(args); i++ {
+		switch opt := strings.ToLower(string(args[i])); opt {
+		case "nx":
+			nx = true
+		case "xx":
+			xx = true
+		case "get":
+			getOld = true
+		case "keepttl":
+			keepTTL = true
+		case "ex", "px":
+			if i+1 == len(args) || ttl != 0 {
+				c.w.WriteError(errSyntax)
+				return
+			}
+			i++
+			n, err := strconv.ParseInt(string(args[i]), 10, 64)
+			if err != nil {
+				c.w.WriteError(errNotInteger)
+				return
+			}
+			unit := time.Second
+			if opt == "px" {
+				unit = time.Millisecond
+			}
+			if n <= 0 || n > math.MaxInt64/int64(unit) {
+				c.w.WriteError("ERR invalid expire time in 'set' command")
+				return
+			}
+			ttl = time.Duration(n) * unit
+		default:
+			c.w.WriteError(errSyntax)
+			return
+		}
+	}
+	if nx && xx || keepTTL && ttl != 0 {
+		c.w.WriteError(errSyntax)
+		return
+	}
+
+	// only GET reads the value: a plain write must not mark the key visited
+	var old []byte
+	_, exists := s.list.TTL(key)
+	if getOld && exists {
+		old, _ = s.list.Get(key)
+	}
+	reply := func(done bool) {
+		switch {
+		case getOld && exists:
+			c.w.WriteBulk(old)
+		case getOld, !done:
+			c.w.WriteNull()
+		default:
+			c.w.WriteSimple("OK")
+		}
+	}
+	if nx && exists || xx && !exists {
+		reply(false)
+		return
+	}
+
+	var remaining time.Duration
+	if keepTTL {
+		remaining, _ = s.list.TTL(key)
+	}
+	s.list.Add(key, args[2])
+	switch {
+	case ttl > 0:
+		s.list.Expire(key, ttl)
+	case keepTTL && remaining > 0:
+		s.list.Expire(key, remaining)
+	}
+	reply(true)
+}
+
+func del(s *Server, c *client, args [][]byte) {
+	n := 0
+	for _, key := range args[1:] {
+		if s.list.Remove(string(key)) != nil {
+			n++
+		}
+	}
+	c.w.WriteInt(int64(n))
+}
+
+func exists(s *Server, c *client, args [][]byte) {
+	n := 0
+	for _, key := range args[1:] {
+		if _, ok := s.list.TTL(string(key)); ok {
+			n++
+		}
+	}
+	c.w.WriteInt(int64(n))
+}
+
+// expire implements EXPIRE and PEXPIRE.
+func expire(s *Server, c *client, args [][]byte) {
+	n, err := strconv.ParseInt(string(args[2]), 10, 64)
+	if err != nil {
+		c.w.WriteError(errNotInteger)
+		return
+	}
+	unit := time.Second
+	if strings.EqualFold(string(args[0]), "pexpire") {
+		unit = time.Millisecond
+	}
+	if n > math.MaxInt64/int64(unit) || n < math.MinInt64/int64(unit) {
+		c.w.WriteError("ERR invalid expire time in '" + strings.ToLower(string(args[0])) + "' command")
+		return
+	}
+	c.w.WriteInt(boolInt(s.list.Expire(string(args[1]), time.Duration(n)*unit)))
+}
+
+func persist(s *Server, c *client, args [][]byte) {
+	c.w.WriteInt(boolInt(s.list.Persist(string(args[1]))))
+}
+
+// ttlCmd implements TTL and PTTL: -2 for a missing key, -1 for a key without TTL.
+func ttlCmd(s *Server, c *client, args [][]byte) {
+	d, ok := s.list.TTL(string(args[1]))
+	switch {
+	case !ok:
+		c.w.WriteInt(-2)
+	case d < 0:
+		c.w.WriteInt(-1)
+	case strings.EqualFold(string(args[0]), "pttl"):
+		c.w.WriteInt(int64((d + time.Millisecond/2) / time.Millisecond))
+	default:
+		c.w.WriteInt(int64((d + time.Second/2) / time.Second))
+	}
+}
+
+func dbsize(s *Server, c *client, args [][]byte) {
+	c.w.WriteInt(int64(s.list.Length))
+}
+
+// keys returns the matching keys in order. Only the keys starting with the
+// literal prefix of the pattern are visited.
+func keys(s *Server, c *client, args [][]byte) {
+	pattern := string(args[1])
+	prefix := literalPrefix(pattern)
+
+	var matched []string
+	it := s.list.NewIterator()
+	for it.Seek(prefix); it.Valid() && strings.HasPrefix(it.Key(), prefix); it.Next() {
+		if match(pattern, it.Key()) {
+			matched = append(matched, it.Key())
+		}
+	}
+
+	c.w.WriteArray(len(matched))
+	for _, key := range matched {
+		c.w.WriteBulkString(key)
+	}
+}
+
+// scan implements SCAN cursor [MATCH pattern] [COUNT count]. Keys come in
+// order. Cursors stand for the key to resume from; they are kept by the
+// server and expire when too many scans run at once.
+func scan(s *Server, c *client, args [][]byte) {
+	cursor, err := strconv.ParseUint(string(args[1]), 10, 64)
+	if err != nil {
+		c.w.WriteError("ERR invalid cursor")
+		return
+	}
+	pattern, count := "*", 10
+	for i := 2; i < len(args); i += 2 {
+		if i+1 == len(args) {
+			c.w.WriteError(errSyntax)
+			return
+		}
+		switch strings.ToLower(string(args[i])) {
+		case "match":
+			pattern = string(args[i+1])
+		case "count":
+			count, err = strconv.Atoi(string(args[i+1]))
+			if err != nil || count < 1 {
+				c.w.WriteError(errSyntax)
+				return
+			}
+		case "type":
+			// every key is a string
+			if !strings.EqualFold(string(args[i+1]), "string") {
+				pattern = ""
+			}
+		default:
+			c.w.WriteError(errSyntax)
+			return
+		}
+	}
+
+	start := ""
+	if cursor != 0 {
+		var ok bool
+		if start, ok = s.cursors.lookup(cursor); !ok {
+			c.w.WriteError("ERR invalid cursor")
+			return
+		}
+	}
+
+	var matched []string
+	it := s.list.NewIterator()
+	it.Seek(start)
+	for n := 0; it.Valid() && n < count; it.Next() {
+		if pattern != "" && match(pattern, it.Key()) {
+			matched = append(matched, it.Key())
+		}
+		n++
+	}
+	next := uint64(0)
+	if it.Valid() {
+		next = s.cursors.put(it.Key())
+	}
+
+	c.w.WriteArray(2)
+	c.w.WriteBulkString(strconv.FormatUint(next, 10))
+	c.w.WriteArray(len(matched))
+	for _, key := range matched {
+		c.w.WriteBulkString(key)
+	}
+}
+
+// rangeCmd implements RANGE lo hi [LIMIT count]: the pairs with lo <= key < hi
+// in key order. An empty hi means no upper bound. The reply is a map in
+// RESP3 and a flat array of keys and values in RESP2.
+func rangeCmd(s *Server, c *client, args [][]byte) {
+	lo, hi := string(args[1]), string(args[2])
+	limit := -1
+	switch len(args) {
+	case 3:
+	case 5:
+		if !strings.EqualFold(string(args[3]), "limit") {
+			c.w.WriteError(errSyntax)
+			return
+		}
+		n, err := strconv.Atoi(string(args[4]))
+		if err != nil {
+			c.w.WriteError(errNotInteger)
+			return
+		}
+		limit = n
+	default:
+		c.w.WriteError(errSyntax)
+		return
+	}
+
+	var pairs [][2][]byte
+	it := s.list.NewIterator()
+	for it.Seek(lo); it.Valid() && (hi == "" || it.Key() < hi) && limit != 0; it.Next() {
+		pairs = append(pairs, [2][]byte{[]byte(it.Key()), it.Value()})
+		limit--
+	}
+
+	c.w.WriteMap(len(pairs))
+	for _, p := range pairs {
+		c.w.WriteBulk(p[0])
+		c.w.WriteBulk(p[1])
+	}
+}
+
+// watchRange implements WATCHRANGE start end. Once confirmed, the connection
+// streams the changes to the keys in [start, end) as [event, type, key,
+// value] arrays, type being put, delete, expire or evict and value null
+// unless it is put. An empty end means no upper bound. A client that falls
+// behind gets only the latest change of each key.
+func watchRange(s *Server, c *client, args [][]byte) {
+	c.events, c.cancel = s.list.WatchRange(string(args[1]), string(args[2]), stashlist.WatchOptions{
+		Buffer: watchBuffer,
+		Policy: stashlist.Coalesce,
+	})
+	c.w.WriteArray(3)
+	c.w.WriteBulkString("watchrange")
+	c.w.WriteBulk(args[1])
+	c.w.WriteBulk(args[2])
+}
+
+// towers implements TOWERS start [LIMIT n]: the towers of the keys from
+// start on, as [key, level, visited] triples.
+func towers(s *Server, c *client, args [][]byte) {
+	limit := 100
+	switch len(args) {
+	case 2:
+	case 4:
+		if !strings.EqualFold(string(args[2]), "limit") {
+			c.w.WriteError(errSyntax)
+			return
+		}
+		n, err := strconv.Atoi(string(args[3]))
+		if err != nil || n < 0 {
+			c.w.WriteError(errNotInteger)
+			return
+		}
+		limit = n
+	default:
+		c.w.WriteError(errSyntax)
+		return
+	}
+
+	type tower struct {
+		key     string
+		level   int
+		visited bool
+	}
+	var ts []tower
+	s.list.Towers(string(args[1]), func(key string, level int, visited bool) bool {
+		if len(ts) == limit {
+			return false
+		}
+		ts = append(ts, tower{key, level, visited})
+		return true
+	})
+
+	c.w.WriteArray(len(ts))
+	for _, t := range ts {
+		c.w.WriteArray(3)
+		c.w.WriteBulkString(t.key)
+		c.w.WriteInt(int64(t.level))
+		c.w.WriteInt(boolInt(t.visited))
+	}
+}
+
+// promote and demote grow and shrink the tower of a key by one level.
+func promote(s *Server, c *client, args [][]byte) {
+	c.w.WriteInt(boolInt(s.list.Promote(string(args[1]))))
+}
+
+func demote(s *Server, c *client, args [][]byte) {
+	c.w.WriteInt(boolInt(s.list.Demote(string(args[1]))))
+}
+
+// info reports the server, its clients, the command counters, the keyspace
+// and the shape of the list.
+func info(s *Server, c *client, args [][]byte) {
+	section := "all"
+	if len(args) > 1 {
+		section = strings.ToLower(string(args[1]))
+	}
+	want := func(name string) bool {
+		return section == "all" || section == "default" || section == "everything" || section == name
+	}
+
+	var b strings.Builder
+	if want("server") {
+		fmt.Fprintf(&b, "# Server\r\nredis_version:7.0.0\r\nstashd_version:1\r\ngo_version:%s\r\nprocess_id:0\r\nuptime_in_seconds:%d\r\n\r\n",
+			runtime.Version(), int64(time.Since(s.started).Seconds()))
+	}
+	if want("clients") {
+		fmt.Fprintf(&b, "# Clients\r\nconnected_clients:%d\r\n\r\n", s.connections.Load())
+	}
+	if want("stats") {
+		fmt.Fprintf(&b, "# Stats\r\ntotal_commands_processed:%d\r\n\r\n", s.commands.Load())
+	}
+	// Stats walks the whole list, only the last two sections need it
+	var stats stashlist.Stats
+	if want("keyspace") || want("stashlist") {
+		stats = s.list.Stats()
+	}
+	if want("keyspace") && stats.Length > 0 {
+		fmt.Fprintf(&b, "# Keyspace\r\ndb0:keys=%d,expires=%d\r\n\r\n", stats.Length, stats.Expiring)
+	}
+	if want("stashlist") {
+		visitedRatio := 0.0
+		if stats.Length > 0 {
+			visitedRatio = float64(stats.Visited) / float64(stats.Length)
+		}
+		fmt.Fprintf(&b, "# StashList\r\nlength:%d\r\nmax_level:%d\r\nvisited:%d\r\nvisited_ratio:%.4f\r\npromotions:%d\r\ndemotions:%d\r\nevictions:%d\r\n",
+			stats.Length, stats.MaxLevel, stats.Visited, visitedRatio, stats.Promotions, stats.Demotions, stats.Evictions)
+		for i, n := range stats.Levels {
+			if n > 0 {
+				fmt.Fprintf(&b, "level_%d:%d\r\n", i+1, n)
+			}
+		}
+		b.WriteString("\r\n")
+	}
+	c.w.WriteBulkString(b.String())
+}
+
+func boolInt(b bool) int64 {
+	if b {
+		return 1
+	}
+	return 0
+}
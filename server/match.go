@@ -0,0 +1,126 @@
+package server
+
+import "strings"
+
+// match reports whether s matches the Redis glob pattern: * matches any
+// sequence, ? any byte, [abc], [^abc] and [a-z] a set of bytes, and a
+// backslash escapes the next byte.
+func match(pattern, s string) bool {
+	// on a mismatch, backtrack to the last * and let it match one more byte
+	starP, starS := -1, 0
+	p, i := 0, 0
+	for i < len(s) {
+		if p < len(pattern) {
+			switch pattern[p] {
+			case '*':
+				starP, starS = p, i
+				p++
+				continue
+			case '?':
+				p++
+				i++
+				continue
+			case '[':
+				if end, ok := matchClass(pattern, p, s[i]); ok {
+					p = end
+					i++
+					continue
+				}
+			case '\\':
+				if p+1 < len(pattern) && pattern[p+1] == s[i] {
+					p += 2
+					i++
+					continue
+				}
+			default:
+				if pattern[p] == s[i] {
+					p++
+					i++
+					continue
+				}
+			}
+		}
+		if starP < 0 {
+			return false
+		}
+		starS++
+		p, i = starP+1, starS
+	}
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+	return p == len(pattern)
+}
+
+// matchClass matches b against the class starting at pattern[p] == '['.
+// It returns the index after the class.
+func matchClass(pattern string, p int, b byte) (int, bool) {
+	p++
+	negate := p < len(pattern) && pattern[p] == '^'
+	if negate {
+		p++
+	}
+	matched := false
+	for ; p < len(pattern) && pattern[p] != ']'; p++ {
+		c := pattern[p]
+		switch {
+		case c == '\\' && p+1 < len(pattern):
+			p++
+			matched = matched || pattern[p] == b
+		case p+2 < len(pattern) && pattern[p+1] == '-' && pattern[p+2] != ']':
+			lo, hi := c, pattern[p+2]
+			if lo > hi {
+				lo, hi = hi, lo
+			}
+			matched = matched || lo <= b && b <= hi
+			p += 2
+		default:
+			matched = matched || c == b
+		}
+	}
+	if p < len(pattern) {
+		p++ // the closing bracket
+	}
+	return p, matched != negate
+}
+
+// literalPrefix returns the part of pattern before its first special byte.
+// Every key matching the pattern starts with it.
+func literalPrefix(pattern string) string {
+	if i := strings.IndexAny(pattern, `*?[\`); i >= 0 {
+		return pattern[:i]
+	}
+	return pattern
+}
+
+// maxCursors bounds the number of SCAN cursors kept at once.
+const maxCursors = 4096
+
+// cursorTable maps SCAN cursors to the key to resume from. The oldest
+// cursors are dropped when it is full.
+type cursorTable struct {
+	next  uint64
+	keys  map[uint64]string
+	order []uint64
+}
+
+func (t *cursorTable) put(key string) uint64 {
+	if t.keys == nil {
+		t.keys = make(map[uint64]string)
+	}
+	for len(t.order) >= maxCursors {
+		delete(t.keys, t.order[0])
+		t.order = t.order[1:]
+	}
+	t.next++
+	t.keys[t.next] = key
+	t.order = append(t.order, t.next)
+	return t.next
+}
+
+// lookup returns the key of cursor. A cursor can be resumed more than once,
+// as clients retry; it is dropped when the table fills up.
+func (t *cursorTable) lookup(cursor uint64) (string, bool) {
+	key, ok := t.keys[cursor]
+	return key, ok
+}
@@ -0,0 +1,253 @@
+// Package server serves a StashList over the Redis protocol, so that redis
+// clients and redis-benchmark can drive it.
+//
+// It implements the key-value subset of Redis that maps onto an ordered
+// map: GET, SET, DEL, EXISTS, SCAN, EXPIRE, TTL, DBSIZE, KEYS and INFO,
+// plus RANGE, which returns the pairs of a key range in order. KEYS and SCAN
+// return keys in order too. WATCHRANGE turns the connection into a stream
+// of the changes to a key range. TOWERS, PROMOTE and DEMOTE expose the
+// towers of the list for debugging. See the command table for the full list.
+package server
+
+import (
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/hey-kong/stashlist"
+	"github.com/hey-kong/stashlist/resp"
+)
+
+// expiryInterval is how often keys whose TTL elapsed are removed in the
+// background, at most expiryBatch at a time.
+const (
+	expiryInterval = 100 * time.Millisecond
+	expiryBatch    = 1000
+)
+
+// watchBuffer is the number of changes a watching client may lag behind
+// before changes to the same key are coalesced.
+const watchBuffer = 1024
+
+// Server serves one StashList. Commands are executed one at a time.
+type Server struct {
+	mu      sync.Mutex
+	list    *stashlist.StashList
+	cursors cursorTable
+
+	started     time.Time
+	commands    atomic.Int64
+	connections atomic.Int64
+
+	connsMu sync.Mutex
+	conns   map[net.Conn]struct{}
+	ln      net.Listener
+	closed  bool
+	done    chan struct{}
+	wg      sync.WaitGroup
+}
+
+// New returns a server for list. The list must not be used directly while
+// the server runs.
+func New(list *stashlist.StashList) *Server {
+	return &Server{
+		list:    list,
+		started: time.Now(),
+		conns:   make(map[net.Conn]struct{}),
+		done:    make(chan struct{}),
+	}
+}
+
+// ListenAndServe listens on the TCP address addr and calls Serve.
+func (s *Server) ListenAndServe(addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(ln)
+}
+
+// Serve accepts clients on ln until Close is called.
+func (s *Server) Serve(ln net.Listener) error {
+	s.connsMu.Lock()
+	if s.closed {
+		s.connsMu.Unlock()
+		return net.ErrClosed
+	}
+	first := s.ln == nil
+	s.ln = ln
+	if first {
+		s.wg.Add(1)
+		go s.expire()
+	}
+	s.connsMu.Unlock()
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			s.connsMu.Lock()
+			closed := s.closed
+			s.connsMu.Unlock()
+			if closed {
+				return nil
+			}
+			return err
+		}
+
+		s.connsMu.Lock()
+		if s.closed {
+			s.connsMu.Unlock()
+			conn.Close()
+			return nil
+		}
+		s.conns[conn] = struct{}{}
+		s.wg.Add(1)
+		s.connsMu.Unlock()
+
+		go func() {
+			defer s.wg.Done()
+			s.serveConn(conn)
+			s.connsMu.Lock()
+			delete(s.conns, conn)
+			s.connsMu.Unlock()
+			conn.Close()
+		}()
+	}
+}
+
+// Close stops the server and disconnects the clients.
+func (s *Server) Close() error {
+	s.connsMu.Lock()
+	if s.closed {
+		s.connsMu.Unlock()
+		return nil
+	}
+	s.closed = true
+	close(s.done)
+	var err error
+	if s.ln != nil {
+		err = s.ln.Close()
+	}
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.connsMu.Unlock()
+
+	s.wg.Wait()
+	return err
+}
+
+// expire removes the keys whose TTL elapsed, so that keys nobody reads
+// again do not linger.
+func (s *Server) expire() {
+	defer s.wg.Done()
+	ticker := time.NewTicker(expiryInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+			s.mu.Lock()
+			s.list.RemoveExpired(expiryBatch)
+			s.mu.Unlock()
+		}
+	}
+}
+
+// client is the state of one connection.
+type client struct {
+	r    *resp.Reader
+	w    *resp.Writer
+	quit bool
+
+	// events is set once the client watches a range; the connection then
+	// streams changes until the client hangs up.
+	events <-chan stashlist.Event
+	cancel func()
+}
+
+func (s *Server) serveConn(conn net.Conn) {
+	s.connections.Add(1)
+	defer s.connections.Add(-1)
+
+	c := &client{r: resp.NewReader(conn), w: resp.NewWriter(conn)}
+	for !c.quit {
+		args, err := c.r.ReadCommand()
+		if err != nil {
+			if errors.Is(err, resp.ErrProtocol) {
+				c.w.WriteError("ERR " + err.Error())
+				c.w.Flush()
+			}
+			return
+		}
+		if len(args) == 0 {
+			continue
+		}
+		s.dispatch(c, args)
+		if c.events != nil {
+			s.stream(conn, c)
+			return
+		}
+
+		// answer a pipeline in one write
+		if c.r.Buffered() == 0 || c.quit {
+			if err := c.w.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// stream writes the changes a client watches until it hangs up or the
+// server closes.
+func (s *Server) stream(conn net.Conn, c *client) {
+	defer c.cancel()
+	if err := c.w.Flush(); err != nil {
+		return
+	}
+	// the client sends nothing more: its hanging up ends the stream
+	go func() {
+		io.Copy(io.Discard, conn)
+		c.cancel()
+	}()
+
+	for ev := range c.events {
+		c.w.WriteArray(4)
+		c.w.WriteBulkString("event")
+		c.w.WriteBulkString(ev.Type.String())
+		c.w.WriteBulkString(ev.Key)
+		if ev.Type == stashlist.EventPut {
+			c.w.WriteBulk(ev.NewValue)
+		} else {
+			c.w.WriteNull()
+		}
+		if len(c.events) == 0 {
+			if err := c.w.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (s *Server) dispatch(c *client, args [][]byte) {
+	s.commands.Add(1)
+	name := strings.ToLower(string(args[0]))
+	cmd, ok := commands[name]
+	if !ok {
+		c.w.WriteError("ERR unknown command '" + string(args[0]) + "'")
+		return
+	}
+	if cmd.arity > 0 && len(args) != cmd.arity || cmd.arity < 0 && len(args) < -cmd.arity {
+		c.w.WriteError("ERR wrong number of arguments for '" + name + "' command")
+		return
+	}
+
+	s.mu.Lock()
+	cmd.run(s, c, args)
+	s.mu.Unlock()
+}
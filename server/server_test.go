@@ -0,0 +1,239 @@
+package server
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/hey-kong/stashlist"
+	"github.com/hey-kong/stashlist/resp"
+)
+
+type testConn struct {
+	t    *testing.T
+	conn net.Conn
+	w    *resp.Writer
+	r    *bufio.Reader
+}
+
+func dial(t *testing.T) *testConn {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := New(stashlist.NewStashList())
+	go srv.Serve(ln)
+	t.Cleanup(func() { srv.Close() })
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return &testConn{t: t, conn: conn, w: resp.NewWriter(conn), r: bufio.NewReader(conn)}
+}
+
+// do sends a command and returns its reply: strings for simple and bulk
+// strings, "ERR..." for errors, int64, nil and []any for arrays and maps.
+func (c *testConn) do(args ...string) any {
+	c.t.Helper()
+	bargs := make([][]byte, len(args))
+	for i, a := range args {
+		bargs[i] = []byte(a)
+	}
+	c.w.WriteCommand(bargs...)
+	if err := c.w.Flush(); err != nil {
+		c.t.Fatal(err)
+	}
+	reply, err := c.read()
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	return reply
+}
+
+func (c *testConn) read() (any, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	switch line[0] {
+	case '+', '-':
+		return line[1:], nil
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '_':
+		return nil, nil
+	case '$':
+		n, _ := strconv.Atoi(line[1:])
+		if n < 0 {
+			return nil, nil
+		}
+		b := make([]byte, n+2)
+		if _, err := io.ReadFull(c.r, b); err != nil {
+			return nil, err
+		}
+		return string(b[:n]), nil
+	case '*', '%':
+		n, _ := strconv.Atoi(line[1:])
+		if line[0] == '%' {
+			n *= 2
+		}
+		values := []any{}
+		for i := 0; i < n; i++ {
+			v, err := c.read()
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, v)
+		}
+		return values, nil
+	}
+	return nil, fmt.Errorf("bad reply %q", line)
+}
+
+func (c *testConn) expect(want any, args ...string) {
+	c.t.Helper()
+	if got := c.do(args...); !reflect.DeepEqual(got, want) {
+		c.t.Fatalf("%v: got %#v, want %#v", args, got, want)
+	}
+}
+
+func TestStrings(t *testing.T) {
+	c := dial(t)
+	c.expect("PONG", "PING")
+	c.expect(nil, "GET", "a")
+	c.expect("OK", "SET", "a", "1")
+	c.expect("1", "GET", "a")
+	c.expect(nil, "SET", "a", "2", "NX")
+	c.expect("1", "SET", "a", "2", "GET")
+	c.expect(nil, "SET", "b", "1", "XX")
+	c.expect(int64(1), "EXISTS", "a", "b")
+	c.expect(int64(1), "DBSIZE")
+	c.expect(int64(1), "DEL", "a", "b")
+	c.expect(int64(0), "DBSIZE")
+	c.expect("ERR wrong number of arguments for 'get' command", "GET")
+	c.expect("ERR unknown command 'NOPE'", "NOPE")
+	c.expect("ERR syntax error", "SET", "a", "1", "NX", "XX")
+}
+
+func TestExpiry(t *testing.T) {
+	c := dial(t)
+	c.expect(int64(-2), "TTL", "a")
+	c.expect("OK", "SET", "a", "1", "EX", "100")
+	c.expect(int64(100), "TTL", "a")
+	c.expect(int64(1), "PERSIST", "a")
+	c.expect(int64(-1), "TTL", "a")
+	c.expect(int64(1), "EXPIRE", "a", "50")
+	c.expect("OK", "SET", "a", "2", "KEEPTTL")
+	c.expect(int64(50), "TTL", "a")
+	c.expect("OK", "SET", "a", "3")
+	c.expect(int64(-1), "TTL", "a")
+	c.expect(int64(1), "PEXPIRE", "a", "0")
+	c.expect(nil, "GET", "a")
+	c.expect(int64(0), "EXPIRE", "a", "10")
+	// times that overflow in nanoseconds are refused, not wrapped around
+	c.expect("OK", "SET", "a", "4")
+	c.expect("ERR invalid expire time in 'expire' command", "EXPIRE", "a", "-9223372036854775807")
+	c.expect("ERR invalid expire time in 'pexpire' command", "PEXPIRE", "a", "9223372036854775807")
+	c.expect(int64(-1), "TTL", "a")
+}
+
+func TestOrderedCommands(t *testing.T) {
+	c := dial(t)
+	for _, key := range []string{"user:3", "user:1", "post:1", "user:2", "user:10"} {
+		c.expect("OK", "SET", key, "v"+key)
+	}
+
+	c.expect([]any{"user:1", "user:10", "user:2", "user:3"}, "KEYS", "user:*")
+	c.expect([]any{"user:1", "user:2", "user:3"}, "KEYS", "user:?")
+	c.expect([]any{"post:1", "user:1"}, "KEYS", "*[^0-9]1")
+	c.expect([]any{"user:10", "vuser:10", "user:2", "vuser:2"}, "RANGE", "user:10", "user:3")
+	c.expect([]any{"user:2", "vuser:2"}, "RANGE", "user:2", "", "LIMIT", "1")
+
+	var keys []any
+	cursor := "0"
+	for {
+		reply := c.do("SCAN", cursor, "COUNT", "2", "MATCH", "user:*").([]any)
+		keys = append(keys, reply[1].([]any)...)
+		if cursor = reply[0].(string); cursor == "0" {
+			break
+		}
+	}
+	if !reflect.DeepEqual(keys, []any{"user:1", "user:10", "user:2", "user:3"}) {
+		t.Fatalf("SCAN returned %v", keys)
+	}
+}
+
+func TestHelloAndInfo(t *testing.T) {
+	c := dial(t)
+	reply := c.do("HELLO", "3").([]any)
+	if reply[0] != "server" || reply[1] != "stashd" || reply[5] != int64(3) {
+		t.Fatalf("wrong HELLO reply %v", reply)
+	}
+	c.expect(nil, "GET", "a")
+	c.expect("OK", "SET", "a", "1")
+	c.expect([]any{"a", "1"}, "RANGE", "", "")
+
+	info := c.do("INFO").(string)
+	for _, field := range []string{"# StashList", "length:1", "promotions:", "level_", "db0:keys=1"} {
+		if !strings.Contains(info, field) {
+			t.Fatalf("INFO lacks %q:\n%s", field, info)
+		}
+	}
+	if info := c.do("INFO", "stashlist").(string); strings.Contains(info, "# Server") {
+		t.Fatal("INFO stashlist returned other sections")
+	}
+	if info := c.do("INFO", "clients").(string); strings.Contains(info, "# Keyspace") || strings.Contains(info, "# StashList") {
+		t.Fatal("INFO clients returned other sections")
+	}
+}
+
+func TestPipelineAndInline(t *testing.T) {
+	c := dial(t)
+	for i := 0; i < 100; i++ {
+		c.w.WriteCommand([]byte("SET"), []byte(strconv.Itoa(i)), []byte("x"))
+	}
+	c.w.Flush()
+	for i := 0; i < 100; i++ {
+		if reply, err := c.read(); err != nil || reply != "OK" {
+			t.Fatal("pipelined SET returned", reply, err)
+		}
+	}
+
+	if _, err := fmt.Fprint(c.conn, "DBSIZE\r\n"); err != nil {
+		t.Fatal(err)
+	}
+	if reply, err := c.read(); err != nil || reply != int64(100) {
+		t.Fatal("inline DBSIZE returned", reply, err)
+	}
+}
+
+func TestTowers(t *testing.T) {
+	c := dial(t)
+	for _, key := range []string{"a", "b", "c"} {
+		c.expect("OK", "SET", key, "x")
+	}
+
+	reply := c.do("TOWERS", "b", "LIMIT", "1").([]any)
+	if len(reply) != 1 || reply[0].([]any)[0] != "b" {
+		t.Fatalf("wrong TOWERS reply %v", reply)
+	}
+	level := reply[0].([]any)[1].(int64)
+	for ; level > 1; level-- {
+		c.expect(int64(1), "DEMOTE", "b")
+	}
+	c.expect(int64(0), "DEMOTE", "b")
+	c.expect(int64(1), "PROMOTE", "b")
+	if reply := c.do("TOWERS", "b").([]any); reply[0].([]any)[1] != int64(2) || len(reply) != 2 {
+		t.Fatalf("wrong TOWERS reply %v", reply)
+	}
+	c.expect(int64(0), "PROMOTE", "nope")
+}
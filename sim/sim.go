@@ -0,0 +1,267 @@
+// Package sim replays traces against cache policies and reports how they
+// fare. A get request is a Get, and a miss is followed by an Add of the key,
+// as a cache in front of a store would do. Set and delete requests are an
+// Add and a Remove, and are not counted as requests.
+//
+// Traces are streamed: the requests are read and replayed a batch at a
+// time, so that traces larger than the memory can be replayed.
+//
+//	r := trace.NewZipfReader(1, 1.01, 100000, 1000000, 64, 64)
+//	res, err := sim.Run("sieve", 10000, 1, r)
+//	fmt.Println(res.HitRatio)
+package sim
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/hey-kong/stashlist"
+	"github.com/hey-kong/stashlist/cache"
+	"github.com/hey-kong/stashlist/cache/arc"
+	"github.com/hey-kong/stashlist/cache/clock"
+	"github.com/hey-kong/stashlist/cache/clockpro"
+	"github.com/hey-kong/stashlist/cache/lfu"
+	"github.com/hey-kong/stashlist/cache/lirs"
+	"github.com/hey-kong/stashlist/cache/lru"
+	"github.com/hey-kong/stashlist/cache/opt"
+	"github.com/hey-kong/stashlist/cache/s3fifo"
+	"github.com/hey-kong/stashlist/cache/sieve"
+	"github.com/hey-kong/stashlist/cache/slru"
+	"github.com/hey-kong/stashlist/cache/tinylfu"
+	"github.com/hey-kong/stashlist/trace"
+)
+
+// Factory returns an empty cache of size entries. Policies with random
+// choices draw them from seed.
+type Factory func(size int, seed int64) cache.Cache
+
+var policies = map[string]Factory{
+	"arc":      func(size int, _ int64) cache.Cache { return arc.New(size) },
+	"clock":    func(size int, _ int64) cache.Cache { return clock.New(size) },
+	"clockpro": func(size int, _ int64) cache.Cache { return clockpro.New(size) },
+	"lfu":      func(size int, _ int64) cache.Cache { return lfu.New(size) },
+	"lirs":     func(size int, _ int64) cache.Cache { return lirs.New(size) },
+	"lru":      func(size int, _ int64) cache.Cache { return lru.New(size) },
+	"s3fifo":   func(size int, _ int64) cache.Cache { return s3fifo.New(size) },
+	"sieve":    func(size int, _ int64) cache.Cache { return sieve.New(size) },
+	"slru":     func(size int, _ int64) cache.Cache { return slru.New(size) },
+	"tinylfu":  func(size int, _ int64) cache.Cache { return tinylfu.New(size) },
+	"stashlist": func(size int, seed int64) cache.Cache {
+		list := stashlist.NewStashList()
+		list.Seed(seed)
+		list.MaxEntries = size
+		return cache.FromStashList(list)
+	},
+}
+
+// ErrUnknownPolicy is returned for policies that were not registered.
+var ErrUnknownPolicy = errors.New("sim: unknown policy")
+
+// Register adds a policy under name, replacing any policy of that name.
+// It is not safe to call concurrently with simulations.
+func Register(name string, f Factory) {
+	policies[name] = f
+}
+
+// Policies returns the names of the registered policies, sorted.
+func Policies() []string {
+	names := make([]string, 0, len(policies))
+	for name := range policies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Result is the outcome of a replay.
+type Result struct {
+	Policy    string `json:"policy"`
+	Size      int    `json:"size"`
+	Requests  int    `json:"requests"`
+	Hits      int    `json:"hits"`
+	Evictions int    `json:"evictions"`
+	// Bytes and HitBytes sum the sizes of the requests and of the hits.
+	Bytes        int64   `json:"bytes"`
+	HitBytes     int64   `json:"hit_bytes"`
+	HitRatio     float64 `json:"hit_ratio"`
+	ByteHitRatio float64 `json:"byte_hit_ratio"`
+	// OpsPerSec is the number of requests replayed per second. Unlike the
+	// other fields, it varies from run to run.
+	OpsPerSec float64 `json:"ops_per_sec"`
+	// OptHitRatio is the hit ratio of Belady's optimal policy at the same
+	// size, if AddOpt computed it. It only takes the get requests into
+	// account, so it is not a bound on the traces with sets.
+	OptHitRatio float64 `json:"opt_hit_ratio,omitempty"`
+}
+
+// batchSize is the number of requests read at once. Each cache replays a
+// whole batch before the next one, so that it is timed in one go.
+const batchSize = 4096
+
+// maxValueSize bounds the values added, so that a huge size in a trace does
+// not exhaust the memory. The caches count entries, not bytes, and the byte
+// ratios are worked out from the sizes of the requests.
+const maxValueSize = 1 << 20
+
+// Run replays the requests of r against a cache of policy holding size
+// entries.
+func Run(policy string, size int, seed int64, r trace.Reader) (Result, error) {
+	results, err := Sweep([]string{policy}, []int{size}, seed, r)
+	if err != nil {
+		return Result{}, err
+	}
+	return results[0], nil
+}
+
+// Replay replays the requests of r against c. The values added are zeroed
+// slices of the size of the requests, up to 1 MiB.
+func Replay(c cache.Cache, r trace.Reader) (Result, error) {
+	p := newPlayer(c)
+	if err := replay(r, []*player{p}); err != nil {
+		return Result{}, err
+	}
+	return p.result(), nil
+}
+
+// Sweep replays the requests of r against every policy at every size, in a
+// single pass over r. The results come by policy, then by size.
+func Sweep(names []string, sizes []int, seed int64, r trace.Reader) ([]Result, error) {
+	var players []*player
+	for _, policy := range names {
+		f, ok := policies[policy]
+		if !ok {
+			return nil, fmt.Errorf("%w %q", ErrUnknownPolicy, policy)
+		}
+		for _, size := range sizes {
+			p := newPlayer(f(size, seed))
+			p.r.Policy, p.r.Size = policy, size
+			players = append(players, p)
+		}
+	}
+	if err := replay(r, players); err != nil {
+		return nil, err
+	}
+	results := make([]Result, len(players))
+	for i, p := range players {
+		results[i] = p.result()
+	}
+	return results, nil
+}
+
+// AddOpt sets the OptHitRatio of results, the replays of reqs, to the hit
+// ratio of the optimal policy at their size. Unlike the replays, it needs
+// the whole trace in memory.
+func AddOpt(results []Result, reqs []trace.Request) {
+	var keys []string
+	for _, req := range reqs {
+		if req.Op == trace.Get {
+			keys = append(keys, req.Key)
+		}
+	}
+	t := opt.NewTrace(keys)
+	best := make(map[int]float64)
+	for i := range results {
+		size := results[i].Size
+		if _, ok := best[size]; !ok {
+			best[size] = t.Simulate(size).HitRatio()
+		}
+		results[i].OptHitRatio = best[size]
+	}
+}
+
+// replay reads r to the end, replaying each batch of requests against
+// every player.
+func replay(r trace.Reader, players []*player) error {
+	batch := make([]trace.Request, 0, batchSize)
+	var buf []byte
+	for {
+		batch = batch[:0]
+		var err error
+		for len(batch) < batchSize {
+			var req trace.Request
+			if req, err = r.Read(); err != nil {
+				break
+			}
+			batch = append(batch, req)
+			if n := valueSize(req.Size); n > len(buf) {
+				buf = make([]byte, n)
+			}
+		}
+		for _, p := range players {
+			p.play(batch, buf)
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// valueSize is the length of the value added for a request of size bytes.
+func valueSize(size int) int {
+	if size > maxValueSize {
+		return maxValueSize
+	}
+	return size
+}
+
+// player replays requests against a cache and keeps the score.
+type player struct {
+	c       cache.Cache
+	r       Result
+	elapsed time.Duration
+}
+
+func newPlayer(c cache.Cache) *player {
+	p := &player{c: c}
+	c.SetOnEvicted(func(string, []byte) { p.r.Evictions++ })
+	return p
+}
+
+// play replays reqs. The values added are slices of buf.
+func (p *player) play(reqs []trace.Request, buf []byte) {
+	start := time.Now()
+	for _, req := range reqs {
+		switch req.Op {
+		case trace.Set:
+			p.c.Add(req.Key, buf[:valueSize(req.Size)])
+		case trace.Delete:
+			p.c.Remove(req.Key)
+		default:
+			if _, ok := p.c.Get(req.Key); ok {
+				p.r.Hits++
+				p.r.HitBytes += int64(req.Size)
+			} else {
+				p.c.Add(req.Key, buf[:valueSize(req.Size)])
+			}
+		}
+	}
+	p.elapsed += time.Since(start)
+
+	for _, req := range reqs {
+		if req.Op == trace.Get {
+			p.r.Requests++
+			p.r.Bytes += int64(req.Size)
+		}
+	}
+}
+
+// result returns the score, with the ratios worked out.
+func (p *player) result() Result {
+	r := p.r
+	if r.Requests > 0 {
+		r.HitRatio = float64(r.Hits) / float64(r.Requests)
+	}
+	if r.Bytes > 0 {
+		r.ByteHitRatio = float64(r.HitBytes) / float64(r.Bytes)
+	}
+	if p.elapsed > 0 {
+		r.OpsPerSec = float64(r.Requests) / p.elapsed.Seconds()
+	}
+	return r
+}
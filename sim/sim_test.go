@@ -0,0 +1,82 @@
+package sim
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/hey-kong/stashlist/cache/lru"
+	"github.com/hey-kong/stashlist/trace"
+)
+
+func TestReplay(t *testing.T) {
+	reqs := []trace.Request{{Key: "a", Size: 10}, {Key: "b", Size: 20}, {Key: "a", Size: 10}, {Key: "c", Size: 30}, {Key: "b", Size: 20}, {Key: "a", Size: 10}}
+	r, err := Replay(lru.New(2), trace.NewSliceReader(reqs))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a hits once, then c, b and a each evict the oldest key
+	if r.Requests != 6 || r.Hits != 1 || r.Evictions != 3 {
+		t.Fatalf("%+v", r)
+	}
+	if r.Bytes != 100 || r.HitBytes != 10 || r.ByteHitRatio != 0.1 {
+		t.Fatalf("%+v", r)
+	}
+
+	reqs = []trace.Request{{Key: "a", Size: 10, Op: trace.Set}, {Key: "a", Size: 10}, {Key: "a", Op: trace.Delete}, {Key: "a", Size: 10}}
+	r, _ = Replay(lru.New(2), trace.NewSliceReader(reqs))
+	if r.Requests != 2 || r.Hits != 1 || r.Evictions != 0 {
+		t.Fatalf("%+v", r)
+	}
+
+	// sizes far beyond the memory are counted, not allocated
+	reqs = []trace.Request{{Key: "a", Size: 1 << 50}, {Key: "a", Size: 1 << 50}}
+	r, _ = Replay(lru.New(2), trace.NewSliceReader(reqs))
+	if r.Hits != 1 || r.Bytes != 1<<51 || r.HitBytes != 1<<50 {
+		t.Fatalf("%+v", r)
+	}
+}
+
+func TestSweep(t *testing.T) {
+	reqs := trace.Zipf(1, 1.1, 2000, 20000, 1, 1000)
+	sizes := []int{50, 500}
+	a, err := Sweep(Policies(), sizes, 3, trace.NewSliceReader(reqs))
+	if err != nil {
+		t.Fatal(err)
+	}
+	AddOpt(a, reqs)
+	b, err := Sweep(Policies(), sizes, 3, trace.NewZipfReader(1, 1.1, 2000, 20000, 1, 1000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	AddOpt(b, reqs)
+	if len(a) != len(Policies())*len(sizes) {
+		t.Fatal(len(a), "results")
+	}
+	for i := range a {
+		a[i].OpsPerSec, b[i].OpsPerSec = 0, 0
+		if a[i] != b[i] {
+			t.Fatalf("replays differ:\n%+v\n%+v", a[i], b[i])
+		}
+		if a[i].HitRatio > a[i].OptHitRatio {
+			t.Fatalf("%s beats the optimal policy at %d", a[i].Policy, a[i].Size)
+		}
+		if a[i].Hits+a[i].Evictions > a[i].Requests {
+			t.Fatalf("%s: %d hits and %d evictions out of %d", a[i].Policy, a[i].Hits, a[i].Evictions, a[i].Requests)
+		}
+	}
+
+	// a single replay gives the same result as the sweep
+	r, err := Run("lru", 50, 3, trace.NewSliceReader(reqs))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range a {
+		if s.Policy == "lru" && s.Size == 50 && s.Hits != r.Hits {
+			t.Fatalf("%+v\n%+v", r, s)
+		}
+	}
+
+	if _, err := Run("missing", 10, 1, trace.NewSliceReader(reqs)); !errors.Is(err, ErrUnknownPolicy) {
+		t.Fatal("an unknown policy gave", err)
+	}
+}
@@ -0,0 +1,169 @@
+package stashlist
+
+import "math"
+
+// Snapshot is a read-only view of a StashList as of the moment it was taken.
+// Writes made to the list afterwards are not visible through it. Reading from
+// a snapshot never marks elements as visited and never demotes them.
+//
+// A snapshot keeps the versions it can see alive, so it must be released
+// with Release once it is no longer needed. Like the list itself, it is not
+// safe for concurrent access.
+type Snapshot struct {
+	list *StashList
+	seq  uint64
+}
+
+// Snapshot returns a point-in-time view of the list. It is O(1): no element
+// is copied, superseded values are kept on per-element version chains instead.
+func (list *StashList) Snapshot() *Snapshot {
+	if list.snapshots == nil {
+		list.snapshots = make(map[uint64]int)
+	}
+	list.snapshots[list.seq]++
+	return &Snapshot{list: list, seq: list.seq}
+}
+
+// Get finds the value of key as of the snapshot.
+func (s *Snapshot) Get(key string) ([]byte, bool) {
+	if s.list == nil {
+		return nil, false
+	}
+	if element := s.list.seek(key); element != nil && element.key == key {
+		return element.versionAt(s.seq)
+	}
+	return nil, false
+}
+
+// NewIterator returns an iterator over the snapshot in key order.
+// The iterator must not be used after the snapshot is released.
+func (s *Snapshot) NewIterator() *Iterator {
+	return &Iterator{list: s.list, seq: s.seq}
+}
+
+// Release frees the versions only this snapshot could see.
+// Releasing a snapshot more than once is a no-op.
+func (s *Snapshot) Release() {
+	list := s.list
+	if list == nil {
+		return
+	}
+	s.list = nil
+
+	if list.snapshots[s.seq]--; list.snapshots[s.seq] == 0 {
+		delete(list.snapshots, s.seq)
+	}
+	list.reclaim()
+}
+
+// horizon returns the sequence number of the oldest live snapshot, or the
+// latest sequence number if there is none. For a versioned list it never
+// goes past the GC watermark.
+func (list *StashList) horizon() uint64 {
+	horizon := list.seq
+	if list.versioned && list.gcSeq < horizon {
+		horizon = list.gcSeq
+	}
+	for seq := range list.snapshots {
+		if seq < horizon {
+			horizon = seq
+		}
+	}
+	return horizon
+}
+
+// reclaim drops the versions that no live snapshot can see any more and
+// unlinks tombstones that became invisible.
+func (list *StashList) reclaim() {
+	horizon := list.horizon()
+
+	kept := list.history[:0]
+	for _, element := range list.history {
+		element.prune(horizon)
+		if element.older != nil || element.deleted && element.seq > horizon {
+			kept = append(kept, element)
+		} else if element.deleted {
+			list.unlink(element)
+		}
+	}
+	for i := len(kept); i < len(list.history); i++ {
+		list.history[i] = nil
+	}
+	list.history = kept
+}
+
+// prune keeps the versions newer than horizon plus the newest one at or below
+// it, which is what a snapshot taken at horizon sees.
+func (element *Element) prune(horizon uint64) {
+	if element.seq <= horizon {
+		element.older = nil
+		return
+	}
+	for v := element.older; v != nil; v = v.older {
+		if v.seq <= horizon {
+			v.older = nil
+			return
+		}
+	}
+}
+
+// Iterator walks a StashList or a Snapshot in key order. It only ever reads
+// the list: it does not mark elements as visited.
+type Iterator struct {
+	list    *StashList
+	seq     uint64
+	element *Element
+	value   []byte
+}
+
+// NewIterator returns an iterator over the latest state of the list.
+// The list must not be modified while the iterator is in use.
+func (list *StashList) NewIterator() *Iterator {
+	return &Iterator{list: list, seq: math.MaxUint64}
+}
+
+// Valid reports whether the iterator is positioned at an element.
+func (it *Iterator) Valid() bool {
+	return it.element != nil
+}
+
+// Key returns the key at the current position.
+func (it *Iterator) Key() string {
+	return it.element.key
+}
+
+// Value returns the value at the current position.
+func (it *Iterator) Value() []byte {
+	return it.value
+}
+
+// SeekToFirst moves the iterator to the smallest key.
+func (it *Iterator) SeekToFirst() {
+	it.settle(it.list.next[0])
+}
+
+// Seek moves the iterator to the first key greater than or equal to key.
+func (it *Iterator) Seek(key string) {
+	it.settle(it.list.seek(key))
+}
+
+// Next moves the iterator to the following key.
+func (it *Iterator) Next() {
+	it.settle(it.element.next[0])
+}
+
+// settle positions the iterator at the first element from element on that
+// is visible at the iterator's sequence number.
+func (it *Iterator) settle(element *Element) {
+	for ; element != nil; element = element.next[0] {
+		// the latest state hides the keys whose TTL has elapsed
+		if it.seq == math.MaxUint64 && it.list.expired(element) {
+			continue
+		}
+		if value, ok := element.versionAt(it.seq); ok {
+			it.element, it.value = element, value
+			return
+		}
+	}
+	it.element, it.value = nil, nil
+}
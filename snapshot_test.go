@@ -0,0 +1,145 @@
+package stashlist
+
+import (
+	"bytes"
+	"math/rand"
+	"strconv"
+	"testing"
+)
+
+func TestSnapshotIsolation(t *testing.T) {
+	list := NewStashList()
+	for i := 0; i < 100; i++ {
+		list.Add(strconv.Itoa(i), []byte(strconv.Itoa(i)))
+	}
+
+	snap := list.Snapshot()
+	defer snap.Release()
+	list.Add("5", []byte("new"))
+	list.Remove("7")
+	list.Add("x", []byte("x"))
+
+	if v, ok := snap.Get("5"); !ok || !bytes.Equal(v, []byte("5")) {
+		t.Fatalf(`snapshot sees %q for "5" (expected "5")`, v)
+	}
+	if _, ok := snap.Get("7"); !ok {
+		t.Fatal(`snapshot lost "7" after it was removed from the list`)
+	}
+	if _, ok := snap.Get("x"); ok {
+		t.Fatal(`snapshot sees "x", which was added after it`)
+	}
+	if _, ok := list.Get("7"); ok {
+		t.Fatal(`list still has "7" after Remove`)
+	}
+	if list.Length != 100 {
+		t.Fatal("wrong list length", list.Length)
+	}
+
+	cnt := 0
+	it := snap.NewIterator()
+	for it.SeekToFirst(); it.Valid(); it.Next() {
+		if it.Key() == "x" {
+			t.Fatal(`snapshot iterator returned "x"`)
+		}
+		cnt++
+	}
+	if cnt != 100 {
+		t.Fatal("wrong snapshot iteration count", cnt)
+	}
+
+	cnt = 0
+	for c := list.Front(); c != nil; c = c.Next() {
+		if c.key == "7" {
+			t.Fatal(`list iteration returned removed key "7"`)
+		}
+		cnt++
+	}
+	if cnt != list.Length {
+		t.Fatal("wrong list iteration count", cnt)
+	}
+}
+
+func TestSnapshotDoesNotVisit(t *testing.T) {
+	list := NewStashList()
+	list.Add("a", []byte("a"))
+	list.Front().visited = false
+
+	snap := list.Snapshot()
+	defer snap.Release()
+	snap.Get("a")
+	if list.Front().visited {
+		t.Fatal("snapshot read marked the element as visited")
+	}
+}
+
+func TestSnapshotRelease(t *testing.T) {
+	list := NewStashList()
+	list.Add("a", []byte("1"))
+	list.Add("b", []byte("1"))
+
+	s1 := list.Snapshot()
+	list.Add("a", []byte("2"))
+	s2 := list.Snapshot()
+	list.Add("a", []byte("3"))
+	list.Remove("b")
+
+	s1.Release()
+	if v, _ := s2.Get("a"); !bytes.Equal(v, []byte("2")) {
+		t.Fatalf(`second snapshot sees %q for "a" (expected "2")`, v)
+	}
+	if _, ok := s2.Get("b"); !ok {
+		t.Fatal(`second snapshot lost "b"`)
+	}
+
+	s2.Release()
+	s2.Release()
+	if len(list.history) != 0 {
+		t.Fatal("versions were not reclaimed after all snapshots were released", len(list.history))
+	}
+	if e := list.seek("b"); e != nil && e.key == "b" {
+		t.Fatal(`tombstone for "b" is still linked`)
+	}
+	if e := list.seek("a"); e.older != nil {
+		t.Fatal(`old versions of "a" were not dropped`)
+	}
+	if _, ok := s1.Get("a"); ok {
+		t.Fatal("released snapshot still serves reads")
+	}
+}
+
+func TestRemoveAfterDemotion(t *testing.T) {
+	list := NewStashList()
+	list.randSource = rand.NewSource(1)
+	for i := 0; i < 100; i++ {
+		list.Add(strconv.Itoa(i), nil)
+	}
+	// the searches of the removes demote the unvisited towers before the
+	// removed keys, which must still be unlinked on every level
+	for i := 0; i < 100; i += 3 {
+		key := strconv.Itoa(i)
+		list.Remove(key)
+		checkLevels(t, list, key)
+		list.Add(key, nil)
+		checkLevels(t, list, "")
+	}
+}
+
+// checkLevels checks that every level of list is sorted and only links
+// towers that tall, none of them for key.
+func checkLevels(t *testing.T, list *StashList, key string) {
+	t.Helper()
+	for i := 0; i < list.maxLevel; i++ {
+		prev := ""
+		n := 0
+		for e := list.next[i]; e != nil; e = e.next[i] {
+			if e.key == key || e.level <= i || (n > 0 && e.key <= prev) {
+				t.Fatalf("level %d links %q of height %d after %q", i, e.key, e.level, prev)
+			}
+			prev = e.key
+			n++
+		}
+		if i == 0 && n != list.Length {
+			t.Fatalf("%d elements for a length of %d", n, list.Length)
+		}
+	}
+}
@@ -0,0 +1,310 @@
+package sstable
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+	"os"
+	"sort"
+)
+
+// Reader queries a table file in place. Only the sparse index is held in
+// memory. A Reader is safe for concurrent use; its iterators are not.
+type Reader struct {
+	f     *os.File
+	index []blockHandle
+	count int
+}
+
+// Open opens the table at path and loads its index.
+func Open(path string) (*Reader, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	r, err := newReader(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return r, nil
+}
+
+func newReader(f *os.File) (*Reader, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	size := uint64(info.Size())
+	if size < footerSize {
+		return nil, ErrCorrupt
+	}
+
+	footer := make([]byte, footerSize)
+	if _, err := f.ReadAt(footer, int64(size-footerSize)); err != nil {
+		return nil, err
+	}
+	if binary.LittleEndian.Uint64(footer[24:]) != magic {
+		return nil, ErrCorrupt
+	}
+	indexOff := binary.LittleEndian.Uint64(footer[0:])
+	indexLen := binary.LittleEndian.Uint64(footer[8:])
+	if indexLen < 4 || indexOff+indexLen+footerSize != size {
+		return nil, ErrCorrupt
+	}
+
+	index := make([]byte, indexLen)
+	if _, err := f.ReadAt(index, int64(indexOff)); err != nil {
+		return nil, err
+	}
+	p, err := checkCRC(index)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Reader{f: f, count: int(binary.LittleEndian.Uint64(footer[16:]))}
+	for len(p) > 0 {
+		var h blockHandle
+		var n uint64
+		if n, p, err = readUvarint(p); err != nil {
+			return nil, err
+		}
+		if uint64(len(p)) < n {
+			return nil, ErrCorrupt
+		}
+		h.lastKey, p = string(p[:n]), p[n:]
+		if h.offset, p, err = readUvarint(p); err != nil {
+			return nil, err
+		}
+		if h.size, p, err = readUvarint(p); err != nil {
+			return nil, err
+		}
+		if h.offset+h.size > indexOff {
+			return nil, ErrCorrupt
+		}
+		r.index = append(r.index, h)
+	}
+	return r, nil
+}
+
+// Close closes the underlying file.
+func (r *Reader) Close() error {
+	return r.f.Close()
+}
+
+// Len returns the number of entries in the table.
+func (r *Reader) Len() int {
+	return r.count
+}
+
+// Get returns the value of key, or ErrNotFound.
+func (r *Reader) Get(key string) ([]byte, error) {
+	it := r.NewIterator()
+	it.Seek(key)
+	if err := it.Err(); err != nil {
+		return nil, err
+	}
+	if !it.Valid() || string(it.key) != key {
+		return nil, ErrNotFound
+	}
+	return it.Value(), nil
+}
+
+// NewIterator returns an unpositioned iterator over the table.
+func (r *Reader) NewIterator() *Iterator {
+	return &Iterator{r: r}
+}
+
+// readBlock reads and verifies the i-th data block.
+func (r *Reader) readBlock(i int) (*block, error) {
+	h := r.index[i]
+	b := make([]byte, h.size)
+	if _, err := r.f.ReadAt(b, int64(h.offset)); err != nil {
+		return nil, err
+	}
+	b, err := checkCRC(b)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) < 4 {
+		return nil, ErrCorrupt
+	}
+	n := int(binary.LittleEndian.Uint32(b[len(b)-4:]))
+	end := len(b) - 4 - 4*n
+	if n < 1 || end < 0 {
+		return nil, ErrCorrupt
+	}
+	return &block{data: b[:end], restarts: b[end : len(b)-4]}, nil
+}
+
+// checkCRC verifies the CRC32C that ends b and returns the rest of b.
+func checkCRC(b []byte) ([]byte, error) {
+	if len(b) < 4 {
+		return nil, ErrCorrupt
+	}
+	data := b[:len(b)-4]
+	if crc32.Checksum(data, castagnoli) != binary.LittleEndian.Uint32(b[len(b)-4:]) {
+		return nil, ErrCorrupt
+	}
+	return data, nil
+}
+
+func readUvarint(p []byte) (uint64, []byte, error) {
+	v, n := binary.Uvarint(p)
+	if n <= 0 {
+		return 0, nil, ErrCorrupt
+	}
+	return v, p[n:], nil
+}
+
+type block struct {
+	data     []byte
+	restarts []byte
+}
+
+func (b *block) numRestarts() int {
+	return len(b.restarts) / 4
+}
+
+func (b *block) restart(i int) int {
+	return int(binary.LittleEndian.Uint32(b.restarts[4*i:]))
+}
+
+// Iterator walks a table in key order.
+type Iterator struct {
+	r     *Reader
+	index int
+	blk   *block
+	off   int
+	key   []byte
+	value []byte
+	valid bool
+	err   error
+}
+
+// Valid reports whether the iterator is positioned at an entry.
+func (it *Iterator) Valid() bool {
+	return it.valid
+}
+
+// Err returns the error that stopped the iteration, if any.
+func (it *Iterator) Err() error {
+	return it.err
+}
+
+// Key returns the key at the current position.
+func (it *Iterator) Key() string {
+	return string(it.key)
+}
+
+// Value returns the value at the current position. It stays valid after
+// the iterator moves.
+func (it *Iterator) Value() []byte {
+	return it.value
+}
+
+// SeekToFirst moves the iterator to the first entry.
+func (it *Iterator) SeekToFirst() {
+	it.load(0)
+}
+
+// Seek moves the iterator to the first entry whose key is greater than or
+// equal to key. Only the block that may hold key is read.
+func (it *Iterator) Seek(key string) {
+	i := sort.Search(len(it.r.index), func(i int) bool { return it.r.index[i].lastKey >= key })
+	it.load(i)
+	if !it.valid {
+		return
+	}
+
+	// binary search the restart points, whose keys are stored in full
+	blk := it.blk
+	j := sort.Search(blk.numRestarts(), func(j int) bool {
+		k, ok := restartKey(blk, blk.restart(j))
+		return !ok || k >= key
+	})
+	if j > 0 {
+		it.key = it.key[:0]
+		it.off = blk.restart(j - 1)
+		it.Next()
+	}
+	for it.valid && string(it.key) < key {
+		it.Next()
+	}
+}
+
+// Next moves the iterator to the following entry.
+func (it *Iterator) Next() {
+	if it.blk == nil || it.err != nil {
+		it.valid = false
+		return
+	}
+	if it.off >= len(it.blk.data) {
+		it.load(it.index + 1)
+		return
+	}
+
+	p := it.blk.data[it.off:]
+	shared, p, err := readUvarint(p)
+	if err != nil {
+		it.fail(err)
+		return
+	}
+	unshared, p, err := readUvarint(p)
+	if err != nil {
+		it.fail(err)
+		return
+	}
+	vlen, p, err := readUvarint(p)
+	if err != nil {
+		it.fail(err)
+		return
+	}
+	if shared > uint64(len(it.key)) || uint64(len(p)) < unshared+vlen {
+		it.fail(ErrCorrupt)
+		return
+	}
+
+	it.key = append(it.key[:shared], p[:unshared]...)
+	it.value = p[unshared : unshared+vlen : unshared+vlen]
+	it.off = len(it.blk.data) - len(p) + int(unshared+vlen)
+	it.valid = true
+}
+
+// load positions the iterator at the first entry of block i.
+func (it *Iterator) load(i int) {
+	it.index, it.valid, it.key, it.err = i, false, it.key[:0], nil
+	if i >= len(it.r.index) {
+		it.blk = nil
+		return
+	}
+	if it.blk, it.err = it.r.readBlock(i); it.err != nil {
+		return
+	}
+	it.off = 0
+	it.Next()
+}
+
+func (it *Iterator) fail(err error) {
+	it.err, it.valid = err, false
+}
+
+// restartKey decodes the full key stored at a restart point.
+func restartKey(blk *block, off int) (string, bool) {
+	if off >= len(blk.data) {
+		return "", false
+	}
+	p := blk.data[off:]
+	_, p, err := readUvarint(p)
+	if err != nil {
+		return "", false
+	}
+	unshared, p, err := readUvarint(p)
+	if err != nil {
+		return "", false
+	}
+	_, p, err = readUvarint(p)
+	if err != nil || uint64(len(p)) < unshared {
+		return "", false
+	}
+	return string(p[:unshared]), true
+}
@@ -0,0 +1,200 @@
+// Package sstable reads and writes immutable sorted-table files.
+//
+// A table is written once from an ordered source, such as the level-0 order
+// of a StashList, and can then be queried in place: only the sparse index is
+// loaded in memory, data blocks are read on demand.
+//
+// File layout:
+//
+//	data block 0..n  prefix-compressed entries, restart points, CRC32C
+//	index block      last key, offset and size of every data block, CRC32C
+//	footer           index offset, index size, entry count, magic
+//
+// In a block, an entry is [shared uvarint][unshared uvarint][value length
+// uvarint][unshared key bytes][value], where shared is the length of the
+// prefix it has in common with the previous key. Every RestartInterval
+// entries the full key is stored, and the offsets of those restart points
+// end the block as little-endian u32s, followed by their count. The CRC32C
+// (Castagnoli) of the block follows it. The footer is four little-endian u64s.
+package sstable
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+)
+
+const (
+	// BlockSize is the size data blocks are cut at.
+	BlockSize = 4 << 10
+
+	// RestartInterval is the number of entries between two full keys.
+	RestartInterval = 16
+
+	footerSize = 32
+	magic      = 0x5354415348535354 // "STASHSST"
+)
+
+var (
+	// ErrNotFound is returned by Get when the key is not in the table.
+	ErrNotFound = errors.New("sstable: not found")
+	// ErrCorrupt is returned when a checksum or the file structure is invalid.
+	ErrCorrupt = errors.New("sstable: corrupt table")
+	// ErrUnordered is returned by Write when keys are not strictly increasing.
+	ErrUnordered = errors.New("sstable: keys out of order")
+)
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// Source is an ordered sequence of key-value pairs, such as the iterator
+// returned by StashList.NewIterator or Snapshot.NewIterator.
+type Source interface {
+	SeekToFirst()
+	Valid() bool
+	Key() string
+	Value() []byte
+	Next()
+}
+
+// Write serializes every pair of iter, from the first one on, to w.
+// It returns the number of entries written.
+func Write(w io.Writer, iter Source) (int, error) {
+	tw := &writer{w: bufio.NewWriter(w)}
+	for iter.SeekToFirst(); iter.Valid(); iter.Next() {
+		if err := tw.add(iter.Key(), iter.Value()); err != nil {
+			return tw.count, err
+		}
+	}
+	return tw.count, tw.finish()
+}
+
+type blockHandle struct {
+	lastKey string
+	offset  uint64
+	size    uint64
+}
+
+type writer struct {
+	w      *bufio.Writer
+	offset uint64
+	count  int
+
+	block    blockBuilder
+	lastKey  string
+	index    []blockHandle
+	hasFirst bool
+}
+
+func (w *writer) add(key string, value []byte) error {
+	if w.hasFirst && key <= w.lastKey {
+		return ErrUnordered
+	}
+	w.hasFirst = true
+
+	w.block.add(key, value)
+	w.lastKey = key
+	w.count++
+
+	if w.block.size() >= BlockSize {
+		return w.flushBlock()
+	}
+	return nil
+}
+
+func (w *writer) flushBlock() error {
+	if w.block.empty() {
+		return nil
+	}
+	b := w.block.finish()
+	if _, err := w.w.Write(b); err != nil {
+		return err
+	}
+	w.index = append(w.index, blockHandle{lastKey: w.lastKey, offset: w.offset, size: uint64(len(b))})
+	w.offset += uint64(len(b))
+	w.block.reset()
+	return nil
+}
+
+func (w *writer) finish() error {
+	if err := w.flushBlock(); err != nil {
+		return err
+	}
+
+	var index []byte
+	for _, h := range w.index {
+		index = binary.AppendUvarint(index, uint64(len(h.lastKey)))
+		index = append(index, h.lastKey...)
+		index = binary.AppendUvarint(index, h.offset)
+		index = binary.AppendUvarint(index, h.size)
+	}
+	index = binary.LittleEndian.AppendUint32(index, crc32.Checksum(index, castagnoli))
+
+	footer := make([]byte, 0, footerSize)
+	footer = binary.LittleEndian.AppendUint64(footer, w.offset)
+	footer = binary.LittleEndian.AppendUint64(footer, uint64(len(index)))
+	footer = binary.LittleEndian.AppendUint64(footer, uint64(w.count))
+	footer = binary.LittleEndian.AppendUint64(footer, magic)
+
+	if _, err := w.w.Write(index); err != nil {
+		return err
+	}
+	if _, err := w.w.Write(footer); err != nil {
+		return err
+	}
+	return w.w.Flush()
+}
+
+// blockBuilder accumulates the prefix-compressed entries of a data block.
+type blockBuilder struct {
+	buf      []byte
+	restarts []uint32
+	counter  int
+	prevKey  string
+}
+
+func (b *blockBuilder) add(key string, value []byte) {
+	shared := 0
+	if b.counter < RestartInterval && len(b.restarts) > 0 {
+		for shared < len(key) && shared < len(b.prevKey) && key[shared] == b.prevKey[shared] {
+			shared++
+		}
+	} else {
+		b.restarts = append(b.restarts, uint32(len(b.buf)))
+		b.counter = 0
+	}
+
+	b.buf = binary.AppendUvarint(b.buf, uint64(shared))
+	b.buf = binary.AppendUvarint(b.buf, uint64(len(key)-shared))
+	b.buf = binary.AppendUvarint(b.buf, uint64(len(value)))
+	b.buf = append(b.buf, key[shared:]...)
+	b.buf = append(b.buf, value...)
+	b.prevKey = key
+	b.counter++
+}
+
+func (b *blockBuilder) empty() bool {
+	return len(b.buf) == 0
+}
+
+func (b *blockBuilder) size() int {
+	return len(b.buf) + 4*len(b.restarts) + 8
+}
+
+// finish appends the restart points and the checksum, and returns the block.
+func (b *blockBuilder) finish() []byte {
+	for _, r := range b.restarts {
+		b.buf = binary.LittleEndian.AppendUint32(b.buf, r)
+	}
+	b.buf = binary.LittleEndian.AppendUint32(b.buf, uint32(len(b.restarts)))
+	b.buf = binary.LittleEndian.AppendUint32(b.buf, crc32.Checksum(b.buf, castagnoli))
+	return b.buf
+}
+
+func (b *blockBuilder) reset() {
+	b.buf = b.buf[:0]
+	b.restarts = b.restarts[:0]
+	b.counter = 0
+	b.prevKey = ""
+}
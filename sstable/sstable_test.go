@@ -0,0 +1,100 @@
+package sstable
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hey-kong/stashlist"
+)
+
+func writeTable(t *testing.T, n int) string {
+	list := stashlist.NewStashList()
+	for i := 0; i < n; i++ {
+		list.Add(fmt.Sprintf("key_%07d", i), []byte(fmt.Sprint(i)))
+	}
+
+	path := filepath.Join(t.TempDir(), "test.sst")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	written, err := Write(f, list.NewIterator())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if written != n {
+		t.Fatal("wrong number of entries written", written)
+	}
+	return path
+}
+
+func TestWriteAndRead(t *testing.T) {
+	const n = 10000
+	r, err := Open(writeTable(t, n))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	if r.Len() != n {
+		t.Fatal("wrong table length", r.Len())
+	}
+	if len(r.index) < 2 {
+		t.Fatal("expected more than one data block", len(r.index))
+	}
+
+	for i := 0; i < n; i += 7 {
+		v, err := r.Get(fmt.Sprintf("key_%07d", i))
+		if err != nil || !bytes.Equal(v, []byte(fmt.Sprint(i))) {
+			t.Fatalf("Get(%d) = %q, %v", i, v, err)
+		}
+	}
+	if _, err := r.Get("key_"); err != ErrNotFound {
+		t.Fatal("Get of a missing key returned", err)
+	}
+	if _, err := r.Get("zzz"); err != ErrNotFound {
+		t.Fatal("Get past the last key returned", err)
+	}
+
+	it := r.NewIterator()
+	it.Seek("key_0004999x")
+	if !it.Valid() || it.Key() != "key_0005000" {
+		t.Fatalf("Seek landed on %q", it.Key())
+	}
+
+	cnt := 0
+	for it.SeekToFirst(); it.Valid(); it.Next() {
+		if it.Key() != fmt.Sprintf("key_%07d", cnt) {
+			t.Fatalf("iteration returned %q at position %d", it.Key(), cnt)
+		}
+		cnt++
+	}
+	if it.Err() != nil || cnt != n {
+		t.Fatal("iteration stopped early", cnt, it.Err())
+	}
+}
+
+func TestCorruptBlock(t *testing.T) {
+	path := writeTable(t, 1000)
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b[10] ^= 0xff
+	if err := os.WriteFile(path, b, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if _, err := r.Get("key_0000000"); err != ErrCorrupt {
+		t.Fatal("reading a corrupt block returned", err)
+	}
+}
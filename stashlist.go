@@ -21,66 +21,195 @@ type Element struct {
 	elementNode
 	key   string
 	value []byte
+
+	// seq is the sequence number of the write that produced value.
+	seq uint64
+	// deleted marks a tombstone kept around for live snapshots.
+	deleted bool
+	// older holds superseded versions, newest first. It is only
+	// populated while snapshots that may still see them are alive.
+	older *version
+	// expireAt is the time the element expires, in Unix nanoseconds,
+	// or 0 if it never does.
+	expireAt int64
+	// expiry is the position of the element in the expiring heap plus one,
+	// or 0 if it is not in the heap.
+	expiry int
+}
+
+// version is a superseded value of an Element.
+type version struct {
+	seq     uint64
+	value   []byte
+	deleted bool
+	older   *version
 }
 
 // Next returns the following Element or nil if we're at the end of the list.
 // Only operates on the bottom level of the skip list (a fully linked list).
 func (element *Element) Next() *Element {
-	return element.next[0]
+	next := element.next[0]
+	for next != nil && next.deleted {
+		next = next.next[0]
+	}
+	return next
+}
+
+// versionAt returns the value of the element as of sequence number seq.
+func (element *Element) versionAt(seq uint64) ([]byte, bool) {
+	if element.seq <= seq {
+		return element.value, !element.deleted
+	}
+	for v := element.older; v != nil; v = v.older {
+		if v.seq <= seq {
+			return v.value, !v.deleted
+		}
+	}
+	return nil, false
+}
+
+// pushVersion moves the current value of the element onto its version chain.
+// Returns true if the element had no history before.
+func (element *Element) pushVersion() bool {
+	first := element.older == nil
+	element.older = &version{
+		seq:     element.seq,
+		value:   element.value,
+		deleted: element.deleted,
+		older:   element.older,
+	}
+	return first
 }
 
 type StashList struct {
 	elementNode
-	maxLevel       int
-	Length         int
+	maxLevel int
+	Length   int
+
+	// MaxEntries is the maximum number of keys before one is evicted.
+	// Zero means no limit.
+	MaxEntries int
+	// OnEvicted optionally specifies a callback function to be
+	// executed when a key is evicted.
+	OnEvicted func(key string, value []byte)
+	// Admission optionally estimates the frequency of the keys added and
+	// read, for instance with a tinylfu.Sketch. A full bounded list then
+	// turns away a new key unless it is more frequent than the key it would
+	// evict, and a rewritten key is promoted while its frequency exceeds
+	// its height, rather than on every rewrite once visited.
+	Admission Frequency
+
 	randSource     rand.Source
 	probability    float64
 	probTable      []float64
 	prevNodesCache []*elementNode
+
+	// seq is the sequence number of the latest write.
+	seq uint64
+	// snapshots counts the live snapshots by their sequence number.
+	snapshots map[uint64]int
+	// history lists the elements that carry old versions or tombstones.
+	history []*Element
+	// versioned is set once the list is written with explicit sequence
+	// numbers. Old versions are then only dropped by GC, below gcSeq.
+	versioned bool
+	gcSeq     uint64
+
+	// watch holds the change subscriptions.
+	watch watchHub
+	// changelog records the mutations, if set.
+	changelog *Changelog
+	// expiring holds the elements with a TTL, soonest first.
+	expiring expiryHeap
+
+	// hand is where the next eviction sweep starts.
+	hand *Element
+
+	promotions, demotions, evictions, rejections uint64
 }
 
 // Front returns the head node of the list.
 func (list *StashList) Front() *Element {
-	return list.next[0]
+	front := list.next[0]
+	for front != nil && front.deleted {
+		front = front.next[0]
+	}
+	return front
 }
 
 // Add inserts a value in the list with the specified key, ordered by the key.
 // If the key exists, it updates the value in the existing node.
 // Returns a pointer to the new element.
 func (list *StashList) Add(key string, value []byte) {
+	if list.Admission != nil {
+		list.Admission.Increment(key)
+	}
+	list.insert(key, value, list.seq+1, false, len(list.snapshots) > 0 || list.versioned)
+}
+
+// insert writes a version of key at sequence number seq. If keep is set,
+// the version it replaces is kept on the element's version chain.
+// Promotion is driven by the user key, whatever the number of versions.
+func (list *StashList) insert(key string, value []byte, seq uint64, deleted, keep bool) {
 	var element *Element
 	prevs := list.getPrevElementNodes(key)
 
+	if seq > list.seq {
+		list.seq = seq
+	}
+
 	if element = prevs[0].next[0]; element != nil && element.key <= key {
+		promote := element.visited
+		if list.Admission != nil {
+			promote = list.Admission.Estimate(key) > element.level
+		}
 		if element.visited == false {
 			element.visited = true
-		} else {
-			// Promote
-			level := element.level
-			if level < list.maxLevel && prevs[level] != &list.elementNode {
-				element.next[level] = prevs[level].next[level]
-				prevs[level].next[level] = element
-				if prevs[level].visited == true {
-					prevs[level].visited = false
-				}
-
-				level = level + 1
-				element.level = level
-			}
 		}
-		element.value = value
+		if promote {
+			list.promote(prevs, element)
+		}
+		list.setVersion(element, value, seq, deleted, keep)
 		return
 	}
 
+	if !deleted && !list.admit(key) {
+		return
+	}
+	list.link(prevs, key, value, seq, deleted)
+}
+
+// promote raises the tower of element by one level, linking it after
+// prevs. The tower only grows under a taller predecessor, not the head.
+// Returns false if it did not grow.
+func (list *StashList) promote(prevs []*elementNode, element *Element) bool {
+	level := element.level
+	if level >= list.maxLevel || prevs[level] == &list.elementNode {
+		return false
+	}
+	element.next[level] = prevs[level].next[level]
+	prevs[level].next[level] = element
+	if prevs[level].visited == true {
+		prevs[level].visited = false
+	}
+	element.level = level + 1
+	list.promotions++
+	return true
+}
+
+// link creates an element for key and links it after prevs.
+func (list *StashList) link(prevs []*elementNode, key string, value []byte, seq uint64, deleted bool) *Element {
 	level := list.randLevel()
-	element = &Element{
+	element := &Element{
 		elementNode: elementNode{
 			next:    make([]*Element, list.maxLevel),
 			level:   level,
 			visited: false,
 		},
-		key:   key,
-		value: value,
+		key:     key,
+		value:   value,
+		seq:     seq,
+		deleted: deleted,
 	}
 	if level == 1 {
 		element.visited = true
@@ -91,24 +220,70 @@ func (list *StashList) Add(key string, value []byte) {
 		prevs[i].next[i] = element
 	}
 
+	if deleted {
+		// a tombstone of an absent key is history of its own, for GC
+		list.history = append(list.history, element)
+		return element
+	}
 	list.Length++
+	list.notify(EventPut, key, nil, value)
+	list.evict(element)
+	return element
 }
 
-// Get finds an element by key. It returns element pointer if found, nil if not found.
-func (list *StashList) Get(key string) ([]byte, bool) {
-	var prev = &list.elementNode
-	var next *Element
+// setVersion records a new version of an existing element.
+func (list *StashList) setVersion(element *Element, value []byte, seq uint64, deleted, keep bool) {
+	if seq < element.seq {
+		// an older version arriving late goes into the chain in seq order
+		link := &element.older
+		for *link != nil && (*link).seq > seq {
+			link = &(*link).older
+		}
+		if *link != nil && (*link).seq == seq {
+			(*link).value, (*link).deleted = value, deleted
+			return
+		}
+		if element.older == nil {
+			list.history = append(list.history, element)
+		}
+		*link = &version{seq: seq, value: value, deleted: deleted, older: *link}
+		return
+	}
 
-	for i := list.maxLevel - 1; i >= 0; i-- {
-		next = prev.next[i]
+	if keep && seq != element.seq && element.pushVersion() {
+		list.history = append(list.history, element)
+	}
+	old, existed := element.value, !element.deleted
+	element.value = value
+	element.seq = seq
+	element.deleted = deleted
+	element.expireAt = 0
+
+	switch {
+	case !deleted && existed:
+		list.notify(EventPut, element.key, old, value)
+	case !deleted:
+		list.Length++
+		list.notify(EventPut, element.key, nil, value)
+		list.evict(element)
+	case existed:
+		list.Length--
+		list.notify(EventDelete, element.key, old, nil)
+	}
+}
 
-		for next != nil && key > next.key {
-			prev = &next.elementNode
-			next = next.next[i]
-		}
+// Get finds an element by key. It returns element pointer if found, nil if not found.
+func (list *StashList) Get(key string) ([]byte, bool) {
+	if list.Admission != nil {
+		list.Admission.Increment(key)
 	}
+	next := list.seek(key)
 
-	if next != nil && next.key <= key {
+	if next != nil && next.key <= key && !next.deleted {
+		if list.expired(next) {
+			list.removeKey(key, EventExpire)
+			return nil, false
+		}
 		if next.visited == false {
 			next.visited = true
 		}
@@ -118,22 +293,150 @@ func (list *StashList) Get(key string) ([]byte, bool) {
 	return nil, false
 }
 
+// Peek finds the value of key like Get, but leaves its visited mark alone.
+// It never modifies the list.
+func (list *StashList) Peek(key string) ([]byte, bool) {
+	next := list.seek(key)
+	if next != nil && next.key == key && !next.deleted && !list.expired(next) {
+		return next.value, true
+	}
+	return nil, false
+}
+
 // Remove deletes an element from the list.
 // Returns removed element pointer if found, nil if not found.
 func (list *StashList) Remove(key string) *Element {
 	prevs := list.getPrevElementNodes(key)
 
 	// found the element, remove it
-	if element := prevs[0].next[0]; element != nil && element.key <= key {
-		for k, v := range element.next {
+	if element := prevs[0].next[0]; element != nil && element.key <= key && !element.deleted {
+		list.removeElement(prevs, element, EventDelete)
+		return element
+	}
+
+	return nil
+}
+
+// Promote raises the tower of key by one level, as a repeated Add would.
+// Returns false if the key does not exist or its tower is already at
+// the maximum height.
+func (list *StashList) Promote(key string) bool {
+	prevs := list.findPrevElementNodes(key)
+	element := prevs[0].next[0]
+	if element == nil || element.key != key || element.deleted || element.level >= list.maxLevel {
+		return false
+	}
+
+	level := element.level
+	element.next[level] = prevs[level].next[level]
+	prevs[level].next[level] = element
+	element.level++
+	list.promotions++
+	return true
+}
+
+// Demote lowers the tower of key by one level. Returns false if the key
+// does not exist or its tower has a single level.
+func (list *StashList) Demote(key string) bool {
+	prevs := list.findPrevElementNodes(key)
+	element := prevs[0].next[0]
+	if element == nil || element.key != key || element.deleted || element.level <= 1 {
+		return false
+	}
+
+	top := element.level - 1
+	prevs[top].next[top] = element.next[top]
+	element.next[top] = nil
+	element.level--
+	list.demotions++
+	return true
+}
+
+// removeElement removes a live element whose predecessors are prevs,
+// reporting it as a change of type t.
+func (list *StashList) removeElement(prevs []*elementNode, element *Element, t EventType) {
+	list.Length--
+	seq := list.nextSeq()
+	list.notify(t, element.key, element.value, nil)
+	element.expireAt = 0
+
+	// keep a tombstone while snapshots may still see the element
+	if len(list.snapshots) > 0 || list.versioned {
+		if element.pushVersion() {
+			list.history = append(list.history, element)
+		}
+		element.deleted = true
+		element.value = nil
+		element.seq = seq
+		return
+	}
+
+	list.moveHand(element)
+	for k, v := range element.next {
+		if prevs[k].next[k] == element {
 			prevs[k].next[k] = v
 		}
+	}
+}
 
-		list.Length--
-		return element
+// seek returns the first element whose key is greater than or equal to key.
+// Unlike getPrevElementNodes it never modifies the list.
+func (list *StashList) seek(key string) *Element {
+	var prev = &list.elementNode
+	var next *Element
+
+	for i := list.maxLevel - 1; i >= 0; i-- {
+		next = prev.next[i]
+
+		for next != nil && key > next.key {
+			prev = &next.elementNode
+			next = next.next[i]
+		}
 	}
 
-	return nil
+	return next
+}
+
+// findPrevElementNodes is getPrevElementNodes without demotion.
+func (list *StashList) findPrevElementNodes(key string) []*elementNode {
+	var prev = &list.elementNode
+	var next *Element
+
+	prevs := list.prevNodesCache
+
+	for i := list.maxLevel - 1; i >= 0; i-- {
+		next = prev.next[i]
+
+		for next != nil && key > next.key {
+			prev = &next.elementNode
+			next = next.next[i]
+		}
+
+		prevs[i] = prev
+	}
+
+	return prevs
+}
+
+// unlink removes element from every level it is linked on, without demoting
+// anything along the way.
+func (list *StashList) unlink(element *Element) {
+	list.moveHand(element)
+	var prev = &list.elementNode
+
+	for i := list.maxLevel - 1; i >= 0; i-- {
+		for next := prev.next[i]; next != nil && next.key < element.key; next = prev.next[i] {
+			prev = &next.elementNode
+		}
+		if prev.next[i] == element {
+			prev.next[i] = element.next[i]
+		}
+	}
+}
+
+func (list *StashList) nextSeq() uint64 {
+	list.seq++
+	return list.seq
 }
 
 // getPrevElementNodes is the private search mechanism that other functions use.
@@ -159,6 +462,8 @@ func (list *StashList) getPrevElementNodes(key string) []*elementNode {
 				before.next[i] = next
 				prev.next[i] = nil
 				prev.level = prev.level - 1
+				prev = before
+				list.demotions++
 				break
 			}
 			// TODO: flush unvisited items
@@ -171,6 +476,12 @@ func (list *StashList) getPrevElementNodes(key string) []*elementNode {
 	return prevs
 }
 
+// Seed reseeds the generator of tower heights, so that a list built by
+// the same operations always gets the same shape.
+func (list *StashList) Seed(seed int64) {
+	list.randSource = rand.NewSource(seed)
+}
+
 // SetProbability changes the current P value of the list.
 // It doesn't alter any existing data, only changes how future insert heights are calculated.
 func (list *StashList) SetProbability(newProbability float64) {
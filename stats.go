@@ -0,0 +1,60 @@
+package stashlist
+
+// Stats describes the shape of a StashList.
+type Stats struct {
+	// Length is the number of live keys.
+	Length int
+	// MaxLevel is the maximum height of a tower.
+	MaxLevel int
+	// Levels counts the elements by height: Levels[i] elements have i+1 levels.
+	Levels []int
+	// Visited is the number of elements marked as visited.
+	Visited int
+	// Promotions and Demotions count the tower adjustments made so far.
+	Promotions uint64
+	Demotions  uint64
+	// Evictions counts the keys evicted to respect MaxEntries.
+	Evictions uint64
+	// Rejections counts the new keys turned away by Admission.
+	Rejections uint64
+	// Expiring is the number of keys with a TTL.
+	Expiring int
+}
+
+// Stats walks the list and reports its shape. It is O(n) and does not
+// modify the list.
+func (list *StashList) Stats() Stats {
+	stats := Stats{
+		Length:     list.Length,
+		MaxLevel:   list.maxLevel,
+		Levels:     make([]int, list.maxLevel),
+		Promotions: list.promotions,
+		Demotions:  list.demotions,
+		Evictions:  list.evictions,
+		Rejections: list.rejections,
+	}
+	for element := list.Front(); element != nil; element = element.Next() {
+		stats.Levels[element.level-1]++
+		if element.visited {
+			stats.Visited++
+		}
+		if element.expireAt != 0 {
+			stats.Expiring++
+		}
+	}
+	return stats
+}
+
+// Towers calls fn for the live elements from the first key greater than or
+// equal to start on, in key order, with the height of their tower and their
+// visited mark, until fn returns false. It does not modify the list.
+func (list *StashList) Towers(start string, fn func(key string, level int, visited bool) bool) {
+	for element := list.seek(start); element != nil; element = element.next[0] {
+		if element.deleted {
+			continue
+		}
+		if !fn(element.key, element.level, element.visited) {
+			return
+		}
+	}
+}
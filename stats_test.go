@@ -0,0 +1,102 @@
+package stashlist
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestStats(t *testing.T) {
+	list := NewStashList()
+	for round := 0; round < 4; round++ {
+		for i := 0; i < 100; i++ {
+			list.Add(strconv.Itoa(i), nil)
+		}
+	}
+
+	stats := list.Stats()
+	total := 0
+	for _, n := range stats.Levels {
+		total += n
+	}
+	if stats.Length != 100 || total != 100 || stats.MaxLevel != DefaultMaxLevel {
+		t.Fatalf("wrong stats: %+v", stats)
+	}
+	if stats.Promotions == 0 {
+		t.Fatal("repeated writes did not promote")
+	}
+}
+
+func TestTowers(t *testing.T) {
+	list := NewStashList()
+	for _, key := range []string{"a", "b", "c"} {
+		list.Add(key, nil)
+	}
+	list.Remove("b")
+
+	var keys []string
+	list.Towers("b", func(key string, level int, visited bool) bool {
+		if level < 1 || level > DefaultMaxLevel {
+			t.Fatal("tower of", key, "has", level, "levels")
+		}
+		keys = append(keys, key)
+		return true
+	})
+	if len(keys) != 1 || keys[0] != "c" {
+		t.Fatal("Towers visited", keys)
+	}
+}
+
+func TestPromoteDemote(t *testing.T) {
+	list := NewWithMaxLevel(4)
+	for i := 0; i < 100; i++ {
+		list.Add(strconv.Itoa(i), []byte{byte(i)})
+	}
+	height := func(key string) (h int) {
+		list.Towers(key, func(_ string, level int, _ bool) bool {
+			h = level
+			return false
+		})
+		return
+	}
+
+	for height("50") > 1 {
+		if !list.Demote("50") {
+			t.Fatal("Demote failed at height", height("50"))
+		}
+	}
+	if list.Demote("50") || list.Demote("missing") {
+		t.Fatal("Demote succeeded on a single level tower or a missing key")
+	}
+	for height("50") < 4 {
+		if !list.Promote("50") {
+			t.Fatal("Promote failed at height", height("50"))
+		}
+	}
+	if list.Promote("50") {
+		t.Fatal("Promote went past the maximum level")
+	}
+
+	// every key must still be found through the reshaped towers
+	for i := 0; i < 100; i++ {
+		if v, ok := list.Get(strconv.Itoa(i)); !ok || v[0] != byte(i) {
+			t.Fatal("lost key", i)
+		}
+	}
+}
+
+func TestSeed(t *testing.T) {
+	shape := func() []int {
+		list := NewStashList()
+		list.Seed(42)
+		for i := 0; i < 1000; i++ {
+			list.Add(strconv.Itoa(i), nil)
+		}
+		return list.Stats().Levels
+	}
+	a, b := shape(), shape()
+	for i := range a {
+		if a[i] != b[i] {
+			t.Fatal("lists seeded alike have different shapes:", a, b)
+		}
+	}
+}
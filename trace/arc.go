@@ -0,0 +1,60 @@
+package trace
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// ARCBlockSize is the size of the blocks of the ARC traces.
+const ARCBlockSize = 512
+
+// arcReader reads an ARC trace.
+type arcReader struct {
+	scanner *bufio.Scanner
+	line    int
+	// next and end are the blocks left of the current line.
+	next, end uint64
+}
+
+// NewARCReader returns a Reader of the ARC trace in r, in the text format
+// of the traces of Megiddo and Modha, from the UMass repository. Each line
+// holds the first block, the number of blocks, an ignored field and the
+// request number, and stands for a request to each of the blocks. The keys
+// are the block numbers and the sizes ARCBlockSize.
+func NewARCReader(r io.Reader) Reader {
+	return &arcReader{scanner: bufio.NewScanner(r)}
+}
+
+func (r *arcReader) Read() (Request, error) {
+	for r.next == r.end {
+		if !r.scanner.Scan() {
+			if err := r.scanner.Err(); err != nil {
+				return Request{}, err
+			}
+			return Request{}, io.EOF
+		}
+		r.line++
+		fields := strings.Fields(r.scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) < 2 {
+			return Request{}, fmt.Errorf("trace: line %d: %d fields", r.line, len(fields))
+		}
+		start, err := strconv.ParseUint(fields[0], 10, 64)
+		if err != nil {
+			return Request{}, fmt.Errorf("trace: line %d: bad block %q", r.line, fields[0])
+		}
+		n, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil || start+n < start {
+			return Request{}, fmt.Errorf("trace: line %d: bad block count %q", r.line, fields[1])
+		}
+		r.next, r.end = start, start+n
+	}
+	block := r.next
+	r.next++
+	return Request{Key: strconv.FormatUint(block, 10), Size: ARCBlockSize}, nil
+}
@@ -0,0 +1,163 @@
+package trace
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// csvReader reads a libCacheSim CSV trace.
+type csvReader struct {
+	r                     *csv.Reader
+	key, size, op, fields int
+	time, next            int
+	// first is the first record, when it turned out not to be a header.
+	first []string
+}
+
+// NewCSVReader returns a Reader of the CSV trace in r, in the layout of
+// libCacheSim. A header names the columns: the key is obj_id (or object,
+// id, key), the size obj_size (or size), and the operation op, the
+// timestamp (or time) and next_access_vtime (or next_access), if present.
+// Without a header, the columns are the timestamp, the key and the size.
+func NewCSVReader(r io.Reader) Reader {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.ReuseRecord = true
+	cr.TrimLeadingSpace = true
+	return &csvReader{r: cr, key: -1}
+}
+
+func (r *csvReader) Read() (Request, error) {
+	if r.key < 0 {
+		if err := r.header(); err != nil {
+			return Request{}, err
+		}
+	}
+	record := r.first
+	r.first = nil
+	if record == nil {
+		var err error
+		if record, err = r.r.Read(); err != nil {
+			return Request{}, csvError(err)
+		}
+	}
+	line, _ := r.r.FieldPos(0)
+	if len(record) < r.fields {
+		return Request{}, fmt.Errorf("trace: line %d: %d fields, want %d", line, len(record), r.fields)
+	}
+	req := Request{Key: record[r.key]}
+	if r.size >= 0 {
+		size, err := strconv.Atoi(record[r.size])
+		if err != nil || size < 0 {
+			return Request{}, fmt.Errorf("trace: line %d: bad size %q", line, record[r.size])
+		}
+		req.Size = size
+	}
+	if r.op >= 0 {
+		op, ok := parseOp(record[r.op])
+		if !ok {
+			return Request{}, fmt.Errorf("trace: line %d: bad op %q", line, record[r.op])
+		}
+		req.Op = op
+	}
+	if r.time >= 0 {
+		t, err := strconv.ParseInt(record[r.time], 10, 64)
+		if err != nil {
+			return Request{}, fmt.Errorf("trace: line %d: bad timestamp %q", line, record[r.time])
+		}
+		req.Timestamp = t
+	}
+	if r.next >= 0 {
+		next, err := strconv.ParseInt(record[r.next], 10, 64)
+		if err != nil {
+			return Request{}, fmt.Errorf("trace: line %d: bad next access %q", line, record[r.next])
+		}
+		req.NextAccess = next
+	}
+	return req, nil
+}
+
+// header reads the first record and finds the columns from it.
+func (r *csvReader) header() error {
+	record, err := r.r.Read()
+	if err != nil {
+		return csvError(err)
+	}
+	r.size, r.op, r.time, r.next = -1, -1, -1, -1
+	for i, name := range record {
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "obj_id", "object", "id", "key":
+			r.key = i
+		case "obj_size", "size":
+			r.size = i
+		case "op", "operation":
+			r.op = i
+		case "timestamp", "time":
+			r.time = i
+		case "next_access_vtime", "next_access":
+			r.next = i
+		}
+	}
+	if r.key < 0 {
+		r.time, r.key, r.size = 0, 1, 2
+		r.first = append([]string(nil), record...)
+	}
+	for _, i := range [...]int{r.key, r.size, r.op, r.time, r.next} {
+		if i+1 > r.fields {
+			r.fields = i + 1
+		}
+	}
+	return nil
+}
+
+// twitterReader reads a Twitter cache trace.
+type twitterReader struct {
+	r *csv.Reader
+}
+
+// NewTwitterReader returns a Reader of the Twitter cache trace in r. Its
+// records are the timestamp, the anonymized key, the key size, the value
+// size, the client id, the operation and the TTL. The size of a request is
+// that of its key and value.
+func NewTwitterReader(r io.Reader) Reader {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = 7
+	cr.ReuseRecord = true
+	return &twitterReader{r: cr}
+}
+
+func (r *twitterReader) Read() (Request, error) {
+	record, err := r.r.Read()
+	if err != nil {
+		return Request{}, csvError(err)
+	}
+	line, _ := r.r.FieldPos(0)
+	keySize, err := strconv.Atoi(record[2])
+	if err != nil || keySize < 0 {
+		return Request{}, fmt.Errorf("trace: line %d: bad key size %q", line, record[2])
+	}
+	valueSize, err := strconv.Atoi(record[3])
+	if err != nil || valueSize < 0 {
+		return Request{}, fmt.Errorf("trace: line %d: bad value size %q", line, record[3])
+	}
+	op, ok := parseOp(record[5])
+	if !ok {
+		return Request{}, fmt.Errorf("trace: line %d: bad op %q", line, record[5])
+	}
+	t, err := strconv.ParseInt(record[0], 10, 64)
+	if err != nil {
+		return Request{}, fmt.Errorf("trace: line %d: bad timestamp %q", line, record[0])
+	}
+	return Request{Key: record[1], Size: keySize + valueSize, Op: op, Timestamp: t}, nil
+}
+
+// csvError prefixes the errors of encoding/csv with the package name.
+func csvError(err error) error {
+	if err == io.EOF {
+		return err
+	}
+	return fmt.Errorf("trace: %w", err)
+}
@@ -0,0 +1,125 @@
+package trace
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+)
+
+var (
+	// ErrUnknownFormat is returned for trace formats that have no reader.
+	ErrUnknownFormat = errors.New("trace: unknown format")
+	// ErrZstd is returned for zstd compressed traces, which the standard
+	// library cannot read. Decompress them with zstd -d first.
+	ErrZstd = errors.New("trace: zstd compression is not supported, decompress with zstd -d")
+)
+
+var formats = map[string]func(io.Reader) Reader{
+	"arc":     NewARCReader,
+	"csv":     NewCSVReader,
+	"oracle":  NewOracleReader,
+	"plain":   NewPlainReader,
+	"twitter": NewTwitterReader,
+}
+
+// Formats returns the names of the formats NewReader reads, sorted.
+func Formats() []string {
+	names := make([]string, 0, len(formats))
+	for name := range formats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NewReader returns a Reader of the trace in r, in format: arc, csv,
+// oracle, plain or twitter.
+func NewReader(format string, r io.Reader) (Reader, error) {
+	f, ok := formats[format]
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownFormat, format)
+	}
+	return f(r), nil
+}
+
+var (
+	gzipMagic  = []byte{0x1f, 0x8b}
+	bzip2Magic = []byte("BZh")
+	zstdMagic  = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// Decompress returns a reader of the decompressed content of r if it is
+// compressed with gzip or bzip2, known by its first bytes, or of r as it is
+// otherwise. If the returned reader is an io.Closer, it must be closed
+// after use.
+func Decompress(r io.Reader) (io.Reader, error) {
+	br := bufio.NewReaderSize(r, 1<<16)
+	magic, err := br.Peek(4)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		return gzip.NewReader(br)
+	case bytes.HasPrefix(magic, bzip2Magic):
+		return bzip2.NewReader(br), nil
+	case bytes.HasPrefix(magic, zstdMagic):
+		return nil, ErrZstd
+	}
+	return br, nil
+}
+
+// ReadCloser is a Reader of a file, that must be closed after use.
+type ReadCloser interface {
+	Reader
+	io.Closer
+}
+
+type file struct {
+	Reader
+	closers []io.Closer
+}
+
+func (f *file) Close() error {
+	var err error
+	for i := len(f.closers) - 1; i >= 0; i-- {
+		if e := f.closers[i].Close(); err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// Open opens the trace file name, - for the standard input, in format.
+// Compressed files are decompressed as they are read.
+func Open(name, format string) (ReadCloser, error) {
+	if _, ok := formats[format]; !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownFormat, format)
+	}
+	f := &file{}
+	var in io.Reader = os.Stdin
+	if name != "-" {
+		osf, err := os.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		f.closers = append(f.closers, osf)
+		in = osf
+	}
+	r, err := Decompress(in)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if c, ok := r.(io.Closer); ok {
+		f.closers = append(f.closers, c)
+	}
+	f.Reader, _ = NewReader(format, r)
+	return f, nil
+}
@@ -0,0 +1,46 @@
+package trace
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// oracleRecordSize is the size of a record of an oracleGeneral trace.
+const oracleRecordSize = 24
+
+// oracleReader reads a libCacheSim oracleGeneral trace.
+type oracleReader struct {
+	r      *bufio.Reader
+	record [oracleRecordSize]byte
+	n      int64
+}
+
+// NewOracleReader returns a Reader of the oracleGeneral binary trace in r,
+// the format of the libCacheSim trace collection. Its records are packed
+// little-endian structs of a 32-bit timestamp, a 64-bit object id, a 32-bit
+// object size and the 64-bit position of the next request to the object.
+// The keys are the object ids in decimal.
+func NewOracleReader(r io.Reader) Reader {
+	return &oracleReader{r: bufio.NewReaderSize(r, 1<<16)}
+}
+
+func (r *oracleReader) Read() (Request, error) {
+	if _, err := io.ReadFull(r.r, r.record[:]); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return Request{}, fmt.Errorf("trace: record %d is truncated", r.n)
+		}
+		return Request{}, err
+	}
+	r.n++
+	id := binary.LittleEndian.Uint64(r.record[4:12])
+	size := binary.LittleEndian.Uint32(r.record[12:16])
+	return Request{
+		Key:        strconv.FormatUint(id, 10),
+		Size:       int(size),
+		Timestamp:  int64(binary.LittleEndian.Uint32(r.record[0:4])),
+		NextAccess: int64(binary.LittleEndian.Uint64(r.record[16:24])),
+	}, nil
+}
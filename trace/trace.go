@@ -0,0 +1,217 @@
+// Package trace reads and generates cache request traces, for replay by the
+// sim package. The readers stream their input, so that traces larger than
+// the memory can be replayed, and Open decompresses gzip and bzip2 files.
+// zstd is not supported: the standard library has no zstd decoder, so Open
+// turns zstd files away with ErrZstd, and they must be decompressed first.
+//
+//	r, err := trace.Open("w01.oracleGeneral.bin.gz", "oracle")
+//	if err != nil {
+//		return err
+//	}
+//	defer r.Close()
+//	reqs, err := trace.ReadAll(r)
+package trace
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math/rand"
+	"strconv"
+	"strings"
+)
+
+// Op is the operation of a request.
+type Op uint8
+
+const (
+	// Get reads the object, and fetches it into the cache on a miss.
+	Get Op = iota
+	// Set writes the object into the cache.
+	Set
+	// Delete drops the object from the cache.
+	Delete
+)
+
+var opNames = [...]string{Get: "get", Set: "set", Delete: "delete"}
+
+func (op Op) String() string {
+	if int(op) < len(opNames) {
+		return opNames[op]
+	}
+	return "op(" + strconv.Itoa(int(op)) + ")"
+}
+
+// parseOp parses the names of the operations used by the trace formats.
+// Updates of any kind are sets.
+func parseOp(s string) (Op, bool) {
+	switch strings.ToLower(s) {
+	case "get", "gets", "read":
+		return Get, true
+	case "set", "add", "replace", "cas", "append", "prepend", "incr", "decr", "write":
+		return Set, true
+	case "delete", "del":
+		return Delete, true
+	}
+	return Get, false
+}
+
+// Request is a request of a trace.
+type Request struct {
+	Key string
+	// Size is the size of the object in bytes, 0 if unknown.
+	Size int
+	Op   Op
+	// Timestamp is the time of the request in the unit of the trace, 0 if
+	// the format has none.
+	Timestamp int64
+	// NextAccess is the position in the trace of the next request to the
+	// object, -1 if there is none, as recorded by the oracleGeneral format.
+	// It is 0 if the format has none.
+	NextAccess int64
+}
+
+// Reader reads the requests of a trace in order. Read returns io.EOF at the
+// end of the trace.
+type Reader interface {
+	Read() (Request, error)
+}
+
+// ReadAll reads the remaining requests of r.
+func ReadAll(r Reader) ([]Request, error) {
+	var reqs []Request
+	for {
+		req, err := r.Read()
+		if err == io.EOF {
+			return reqs, nil
+		}
+		if err != nil {
+			return reqs, err
+		}
+		reqs = append(reqs, req)
+	}
+}
+
+// sliceReader reads requests from memory.
+type sliceReader struct {
+	reqs []Request
+}
+
+// NewSliceReader returns a Reader of reqs.
+func NewSliceReader(reqs []Request) Reader {
+	return &sliceReader{reqs}
+}
+
+func (r *sliceReader) Read() (Request, error) {
+	if len(r.reqs) == 0 {
+		return Request{}, io.EOF
+	}
+	req := r.reqs[0]
+	r.reqs = r.reqs[1:]
+	return req, nil
+}
+
+// Keys returns the keys of reqs.
+func Keys(reqs []Request) []string {
+	keys := make([]string, len(reqs))
+	for i, req := range reqs {
+		keys[i] = req.Key
+	}
+	return keys
+}
+
+// plainReader reads a plain text trace. Blank lines and lines starting
+// with # are skipped.
+type plainReader struct {
+	scanner *bufio.Scanner
+	line    int
+}
+
+// NewPlainReader returns a Reader of the plain text trace in r, one request
+// per line: the key, then optionally the size and the operation, separated
+// by commas or spaces, as in "key,size,op". The operation defaults to get.
+func NewPlainReader(r io.Reader) Reader {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1<<20)
+	return &plainReader{scanner: scanner}
+}
+
+func (r *plainReader) Read() (Request, error) {
+	for r.scanner.Scan() {
+		r.line++
+		text := strings.TrimSpace(r.scanner.Text())
+		if text == "" || text[0] == '#' {
+			continue
+		}
+		var fields []string
+		if strings.Contains(text, ",") {
+			fields = strings.Split(text, ",")
+			for i := range fields {
+				fields[i] = strings.TrimSpace(fields[i])
+			}
+		} else {
+			fields = strings.Fields(text)
+		}
+		if len(fields) > 3 {
+			return Request{}, fmt.Errorf("trace: line %d: %d fields", r.line, len(fields))
+		}
+		req := Request{Key: fields[0]}
+		if len(fields) > 1 && fields[1] != "" {
+			size, err := strconv.Atoi(fields[1])
+			if err != nil || size < 0 {
+				return Request{}, fmt.Errorf("trace: line %d: bad size %q", r.line, fields[1])
+			}
+			req.Size = size
+		}
+		if len(fields) > 2 {
+			op, ok := parseOp(fields[2])
+			if !ok {
+				return Request{}, fmt.Errorf("trace: line %d: bad op %q", r.line, fields[2])
+			}
+			req.Op = op
+		}
+		return req, nil
+	}
+	if err := r.scanner.Err(); err != nil {
+		return Request{}, err
+	}
+	return Request{}, io.EOF
+}
+
+// zipfReader generates a Zipf trace.
+type zipfReader struct {
+	z     *rand.Zipf
+	sizes []int
+	n     int
+}
+
+// NewZipfReader returns a Reader of n requests over keys keys, whose
+// popularity follows a Zipf law of parameter s > 1. Each key has a size
+// drawn once between minSize and maxSize. The trace only depends on the
+// arguments.
+func NewZipfReader(seed int64, s float64, keys uint64, n int, minSize, maxSize int) Reader {
+	r := rand.New(rand.NewSource(seed))
+	sizes := make([]int, keys)
+	for i := range sizes {
+		sizes[i] = minSize
+		if maxSize > minSize {
+			sizes[i] += r.Intn(maxSize - minSize + 1)
+		}
+	}
+	return &zipfReader{z: rand.NewZipf(r, s, 1, keys-1), sizes: sizes, n: n}
+}
+
+func (r *zipfReader) Read() (Request, error) {
+	if r.n == 0 {
+		return Request{}, io.EOF
+	}
+	r.n--
+	k := r.z.Uint64()
+	return Request{Key: strconv.FormatUint(k, 10), Size: r.sizes[k]}, nil
+}
+
+// Zipf returns the requests of NewZipfReader.
+func Zipf(seed int64, s float64, keys uint64, n int, minSize, maxSize int) []Request {
+	reqs, _ := ReadAll(NewZipfReader(seed, s, keys, n, minSize, maxSize))
+	return reqs
+}
@@ -0,0 +1,154 @@
+package trace
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// expect reads r and checks its requests against want.
+func expect(t *testing.T, r Reader, want ...Request) {
+	t.Helper()
+	reqs, err := ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reqs) != len(want) {
+		t.Fatalf("read %v, want %v", reqs, want)
+	}
+	for i := range want {
+		if reqs[i] != want[i] {
+			t.Fatalf("request %d is %v, want %v", i, reqs[i], want[i])
+		}
+	}
+}
+
+func TestPlainReader(t *testing.T) {
+	in := "# a comment\na\nb 100\n\n  c   7  \nd,5,set\ne, ,DELETE\nf 3 get\n"
+	expect(t, NewPlainReader(strings.NewReader(in)),
+		Request{Key: "a"}, Request{Key: "b", Size: 100}, Request{Key: "c", Size: 7},
+		Request{Key: "d", Size: 5, Op: Set}, Request{Key: "e", Op: Delete}, Request{Key: "f", Size: 3, Op: Get})
+
+	for _, bad := range []string{"a\nb -1\n", "a\nb,1,put\n", "a\nb,1,get,2\n"} {
+		_, err := ReadAll(NewPlainReader(strings.NewReader(bad)))
+		if err == nil || !strings.Contains(err.Error(), "line 2") {
+			t.Fatalf("%q was read with %v", bad, err)
+		}
+	}
+}
+
+func TestCSVReader(t *testing.T) {
+	in := "timestamp,obj_id,obj_size,op,next_access_vtime\n1,a,10,get,3\n2,b,20,set,-1\n3,a,10,delete,-1\n"
+	expect(t, NewCSVReader(strings.NewReader(in)),
+		Request{Key: "a", Size: 10, Timestamp: 1, NextAccess: 3}, Request{Key: "b", Size: 20, Op: Set, Timestamp: 2, NextAccess: -1},
+		Request{Key: "a", Size: 10, Op: Delete, Timestamp: 3, NextAccess: -1})
+
+	// without a header
+	expect(t, NewCSVReader(strings.NewReader("1,a,10,4\n2,b,20,-1\n")),
+		Request{Key: "a", Size: 10, Timestamp: 1}, Request{Key: "b", Size: 20, Timestamp: 2})
+
+	_, err := ReadAll(NewCSVReader(strings.NewReader("time,key,size\n1,a,10\n2,b\n")))
+	if err == nil || !strings.Contains(err.Error(), "line 3") {
+		t.Fatal("a short record was read with", err)
+	}
+}
+
+func TestTwitterReader(t *testing.T) {
+	in := "0,key1,6,100,1,get,0\n0,key2,6,200,2,cas,3600\n1,key1,6,0,1,delete,0\n"
+	expect(t, NewTwitterReader(strings.NewReader(in)),
+		Request{Key: "key1", Size: 106}, Request{Key: "key2", Size: 206, Op: Set}, Request{Key: "key1", Size: 6, Op: Delete, Timestamp: 1})
+
+	_, err := ReadAll(NewTwitterReader(strings.NewReader("0,key1,6,100,1,get\n")))
+	if err == nil {
+		t.Fatal("a record of 6 fields was read")
+	}
+}
+
+func TestOracleReader(t *testing.T) {
+	var buf bytes.Buffer
+	for i, id := range []uint64{7, 1 << 40, 7} {
+		var record [oracleRecordSize]byte
+		binary.LittleEndian.PutUint32(record[0:], uint32(10*i))
+		binary.LittleEndian.PutUint64(record[4:], id)
+		binary.LittleEndian.PutUint32(record[12:], uint32(100*i))
+		next := int64(-1)
+		if i == 0 {
+			next = 2
+		}
+		binary.LittleEndian.PutUint64(record[16:], uint64(next))
+		buf.Write(record[:])
+	}
+	data := buf.Bytes()
+	expect(t, NewOracleReader(bytes.NewReader(data)),
+		Request{Key: "7", NextAccess: 2}, Request{Key: "1099511627776", Size: 100, Timestamp: 10, NextAccess: -1},
+		Request{Key: "7", Size: 200, Timestamp: 20, NextAccess: -1})
+
+	_, err := ReadAll(NewOracleReader(bytes.NewReader(data[:len(data)-1])))
+	if err == nil || !strings.Contains(err.Error(), "record 2") {
+		t.Fatal("a truncated record was read with", err)
+	}
+}
+
+func TestARCReader(t *testing.T) {
+	in := "100 3 0 1\n\n7 1 0 2\n5 0 0 3\n"
+	expect(t, NewARCReader(strings.NewReader(in)),
+		Request{Key: "100", Size: ARCBlockSize}, Request{Key: "101", Size: ARCBlockSize},
+		Request{Key: "102", Size: ARCBlockSize}, Request{Key: "7", Size: ARCBlockSize})
+}
+
+func TestOpen(t *testing.T) {
+	dir := t.TempDir()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write([]byte("a,1\nb,2\n"))
+	zw.Close()
+	name := filepath.Join(dir, "trace.gz")
+	if err := os.WriteFile(name, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	r, err := Open(name, "plain")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect(t, r, Request{Key: "a", Size: 1}, Request{Key: "b", Size: 2})
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Open(name, "bogus"); !errors.Is(err, ErrUnknownFormat) {
+		t.Fatal("an unknown format gave", err)
+	}
+	name = filepath.Join(dir, "trace.zst")
+	if err := os.WriteFile(name, []byte{0x28, 0xb5, 0x2f, 0xfd, 0}, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Open(name, "plain"); err != ErrZstd {
+		t.Fatal("a zstd file gave", err)
+	}
+}
+
+func TestZipf(t *testing.T) {
+	a := Zipf(7, 1.2, 1000, 10000, 10, 20)
+	b := Zipf(7, 1.2, 1000, 10000, 10, 20)
+	sizes := make(map[string]int)
+	for i := range a {
+		if a[i] != b[i] {
+			t.Fatal("traces of the same seed differ at", i)
+		}
+		if a[i].Size < 10 || a[i].Size > 20 {
+			t.Fatal("size out of range:", a[i].Size)
+		}
+		if s, ok := sizes[a[i].Key]; ok && s != a[i].Size {
+			t.Fatal("key", a[i].Key, "changed size")
+		}
+		sizes[a[i].Key] = a[i].Size
+	}
+	if c := Zipf(8, 1.2, 1000, 10000, 10, 20); c[0] == a[0] && c[1] == a[1] && c[2] == a[2] {
+		t.Fatal("another seed gave the same trace")
+	}
+}
@@ -0,0 +1,134 @@
+package stashlist
+
+import (
+	"container/heap"
+	"time"
+)
+
+// now is the clock of the expiry checks, replaced in tests.
+var now = time.Now
+
+// Expire sets a time to live on key. Writing the key again with Add clears
+// it. A ttl of zero or less removes the key at once. Expired keys are
+// removed lazily when they are read, or by RemoveExpired, and are reported
+// as EventExpire changes. Returns false if the key does not exist.
+func (list *StashList) Expire(key string, ttl time.Duration) bool {
+	element := list.seek(key)
+	if element == nil || element.key != key || element.deleted {
+		return false
+	}
+	if list.expired(element) || ttl <= 0 {
+		list.removeKey(key, EventExpire)
+		return ttl <= 0
+	}
+
+	element.expireAt = now().Add(ttl).UnixNano()
+	if i := element.expiry - 1; i >= 0 {
+		list.expiring[i].at = element.expireAt
+		heap.Fix(&list.expiring, i)
+	} else {
+		heap.Push(&list.expiring, expiry{at: element.expireAt, element: element})
+	}
+	return true
+}
+
+// Persist clears the time to live of key. Returns false if the key does not
+// exist or has no time to live.
+func (list *StashList) Persist(key string) bool {
+	element := list.seek(key)
+	if element == nil || element.key != key || element.deleted || element.expireAt == 0 {
+		return false
+	}
+	if list.expired(element) {
+		list.removeKey(key, EventExpire)
+		return false
+	}
+	element.expireAt = 0
+	return true
+}
+
+// TTL returns the remaining time to live of key, or a negative duration if
+// the key never expires. It returns false if the key does not exist.
+func (list *StashList) TTL(key string) (time.Duration, bool) {
+	element := list.seek(key)
+	if element == nil || element.key != key || element.deleted {
+		return 0, false
+	}
+	if element.expireAt == 0 {
+		return -1, true
+	}
+	ttl := time.Duration(element.expireAt - now().UnixNano())
+	if ttl <= 0 {
+		list.removeKey(key, EventExpire)
+		return 0, false
+	}
+	return ttl, true
+}
+
+// RemoveExpired removes up to limit keys whose time to live has elapsed,
+// soonest first, and returns how many it removed. A limit of zero or less
+// means no limit.
+func (list *StashList) RemoveExpired(limit int) int {
+	t := now().UnixNano()
+	n := 0
+	for len(list.expiring) > 0 && (limit <= 0 || n < limit) {
+		e := list.expiring[0]
+		if e.at > t {
+			break
+		}
+		heap.Pop(&list.expiring)
+		// skip the entries of keys written or persisted since
+		if e.element.expireAt != e.at || e.element.deleted {
+			continue
+		}
+		list.removeKey(e.element.key, EventExpire)
+		n++
+	}
+	return n
+}
+
+func (list *StashList) expired(element *Element) bool {
+	return element.expireAt != 0 && element.expireAt <= now().UnixNano()
+}
+
+// removeKey removes the live element of key without demoting anything.
+func (list *StashList) removeKey(key string, t EventType) {
+	prevs := list.findPrevElementNodes(key)
+	if element := prevs[0].next[0]; element != nil && element.key == key && !element.deleted {
+		list.removeElement(prevs, element, t)
+	}
+}
+
+type expiry struct {
+	at      int64
+	element *Element
+}
+
+// expiryHeap is a min-heap of expiries holding each element at most once.
+// A new TTL moves the entry of its element; entries go stale when their key
+// is written, persisted or removed, and are dropped when they reach the top.
+type expiryHeap []expiry
+
+func (h expiryHeap) Len() int           { return len(h) }
+func (h expiryHeap) Less(i, j int) bool { return h[i].at < h[j].at }
+
+func (h expiryHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].element.expiry = i + 1
+	h[j].element.expiry = j + 1
+}
+
+func (h *expiryHeap) Push(x any) {
+	e := x.(expiry)
+	e.element.expiry = len(*h) + 1
+	*h = append(*h, e)
+}
+
+func (h *expiryHeap) Pop() any {
+	old := *h
+	e := old[len(old)-1]
+	e.element.expiry = 0
+	old[len(old)-1] = expiry{}
+	*h = old[:len(old)-1]
+	return e
+}
@@ -0,0 +1,115 @@
+package stashlist
+
+import (
+	"testing"
+	"time"
+)
+
+func fakeClock(t *testing.T) *time.Time {
+	clock := time.Unix(1000, 0)
+	now = func() time.Time { return clock }
+	t.Cleanup(func() { now = time.Now })
+	return &clock
+}
+
+func TestExpire(t *testing.T) {
+	clock := fakeClock(t)
+	list := NewStashList()
+	events, cancel := list.WatchPrefix("", WatchOptions{})
+	defer cancel()
+
+	list.Add("a", []byte("1"))
+	list.Add("b", []byte("2"))
+	if list.Expire("missing", time.Second) {
+		t.Fatal("Expire on a missing key returned true")
+	}
+	if !list.Expire("a", time.Second) || !list.Expire("b", 2*time.Second) {
+		t.Fatal("Expire on a live key returned false")
+	}
+	if ttl, ok := list.TTL("a"); !ok || ttl != time.Second {
+		t.Fatal("wrong TTL", ttl, ok)
+	}
+
+	*clock = clock.Add(time.Second)
+	if _, ok := list.Get("a"); ok {
+		t.Fatal("expired key is still readable")
+	}
+	if list.Length != 1 {
+		t.Fatal("expired key is still counted", list.Length)
+	}
+	it := list.NewIterator()
+	if it.SeekToFirst(); !it.Valid() || it.Key() != "b" {
+		t.Fatal("iterator does not start after the expired key")
+	}
+
+	*clock = clock.Add(time.Second)
+	it.SeekToFirst()
+	if it.Valid() {
+		t.Fatal("iterator returns an expired key")
+	}
+	if n := list.RemoveExpired(0); n != 1 || list.Length != 0 {
+		t.Fatal("RemoveExpired removed", n, "keys, left", list.Length)
+	}
+
+	var expired []string
+	for i := 0; i < 4; i++ {
+		if ev := <-events; ev.Type == EventExpire {
+			expired = append(expired, ev.Key)
+		}
+	}
+	if len(expired) != 2 || expired[0] != "a" || expired[1] != "b" {
+		t.Fatal("wrong expire events", expired)
+	}
+}
+
+func TestAddClearsTTL(t *testing.T) {
+	clock := fakeClock(t)
+	list := NewStashList()
+
+	list.Add("a", []byte("1"))
+	list.Expire("a", time.Second)
+	list.Add("a", []byte("2"))
+	if ttl, ok := list.TTL("a"); !ok || ttl >= 0 {
+		t.Fatal("Add kept the TTL", ttl, ok)
+	}
+
+	list.Expire("a", time.Second)
+	if !list.Persist("a") || list.Persist("a") {
+		t.Fatal("Persist does not report the cleared TTL")
+	}
+	*clock = clock.Add(time.Hour)
+	if n := list.RemoveExpired(0); n != 0 {
+		t.Fatal("stale expiry removed", n, "keys")
+	}
+	if v, ok := list.Get("a"); !ok || string(v) != "2" {
+		t.Fatal("persisted key was lost", string(v), ok)
+	}
+	if !list.Expire("a", 0) || list.Length != 0 {
+		t.Fatal("Expire with no TTL does not remove the key")
+	}
+}
+
+func TestExpireReusesEntry(t *testing.T) {
+	clock := fakeClock(t)
+	list := NewStashList()
+	list.Add("a", nil)
+	list.Add("b", nil)
+	for i := 1; i <= 100; i++ {
+		list.Expire("a", time.Duration(i)*time.Second)
+		list.Expire("b", time.Duration(101-i)*time.Second)
+	}
+	if len(list.expiring) != 2 {
+		t.Fatal("repeated Expire calls grew the heap to", len(list.expiring))
+	}
+
+	*clock = clock.Add(time.Second)
+	if n := list.RemoveExpired(0); n != 1 || list.Length != 1 {
+		t.Fatal("RemoveExpired removed", n, "keys")
+	}
+	if _, ok := list.Get("a"); !ok {
+		t.Fatal("the key with the later TTL expired")
+	}
+	if len(list.expiring) != 1 {
+		t.Fatal("the expired entry is still in the heap")
+	}
+}
@@ -0,0 +1,253 @@
+package stashlist
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// EventType is the kind of change an Event reports.
+type EventType int
+
+const (
+	// EventPut reports that a key was added or its value replaced.
+	EventPut EventType = iota
+	// EventDelete reports that a key was removed.
+	EventDelete
+	// EventExpire reports that a key was removed because its TTL elapsed.
+	EventExpire
+	// EventEvict reports that a key was removed to make room for another.
+	EventEvict
+)
+
+func (t EventType) String() string {
+	switch t {
+	case EventPut:
+		return "put"
+	case EventDelete:
+		return "delete"
+	case EventExpire:
+		return "expire"
+	case EventEvict:
+		return "evict"
+	}
+	return "unknown"
+}
+
+// Event describes a change to a watched key. OldValue is nil if the key did
+// not exist before, NewValue is nil unless Type is EventPut. The values are
+// shared with the list and must not be modified.
+type Event struct {
+	Type     EventType
+	Key      string
+	OldValue []byte
+	NewValue []byte
+}
+
+// OverflowPolicy decides what happens to events a subscriber is too slow for.
+type OverflowPolicy int
+
+const (
+	// Drop discards the events that do not fit in the channel buffer.
+	Drop OverflowPolicy = iota
+	// Block makes writers to the list wait until the subscriber catches up.
+	Block
+	// Coalesce keeps one pending event per key: a newer change to a key
+	// replaces the pending one, keeping its OldValue. Pending events are
+	// delivered in the order their keys first changed.
+	Coalesce
+)
+
+// WatchOptions configures a subscription.
+type WatchOptions struct {
+	// Buffer is the capacity of the event channel. Defaults to 64.
+	Buffer int
+	// Policy applies when the channel is full. Defaults to Drop.
+	Policy OverflowPolicy
+}
+
+// WatchPrefix subscribes to the changes of the keys starting with prefix.
+// The returned function cancels the subscription and closes the channel;
+// it may be called from any goroutine, more than once.
+func (list *StashList) WatchPrefix(prefix string, opts WatchOptions) (<-chan Event, func()) {
+	return list.WatchRange(prefix, prefixEnd(prefix), opts)
+}
+
+// WatchRange subscribes to the changes of the keys in [start, end).
+// An empty end means no upper bound. See WatchPrefix.
+func (list *StashList) WatchRange(start, end string, opts WatchOptions) (<-chan Event, func()) {
+	if opts.Buffer <= 0 {
+		opts.Buffer = 64
+	}
+
+	w := &watcher{
+		start:  start,
+		end:    end,
+		policy: opts.Policy,
+		ch:     make(chan Event, opts.Buffer),
+		done:   make(chan struct{}),
+	}
+	if w.policy == Coalesce {
+		w.events = make(map[string]Event)
+		w.wake = make(chan struct{}, 1)
+		go w.pump()
+	}
+
+	list.watch.add(w)
+	return w.ch, func() { list.watch.cancel(w) }
+}
+
+// prefixEnd returns the smallest key greater than every key starting with
+// prefix, or "" if there is none.
+func prefixEnd(prefix string) string {
+	end := []byte(prefix)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return string(end[:i+1])
+		}
+	}
+	return ""
+}
+
+// notify records a change in the changelog and publishes it to the
+// subscribers interested in key.
+func (list *StashList) notify(t EventType, key string, oldValue, newValue []byte) {
+	if list.changelog != nil {
+		list.changelog.append(Change{Seq: list.seq, Type: t, Key: key, Value: newValue})
+	}
+	if list.watch.n.Load() == 0 {
+		return
+	}
+	list.watch.publish(Event{Type: t, Key: key, OldValue: oldValue, NewValue: newValue})
+}
+
+// watchHub holds the subscriptions of a list. Subscriptions may be added
+// and cancelled from other goroutines than the one writing to the list.
+type watchHub struct {
+	n        atomic.Int32
+	mu       sync.Mutex
+	watchers []*watcher
+}
+
+func (h *watchHub) add(w *watcher) {
+	h.mu.Lock()
+	h.watchers = append(h.watchers, w)
+	h.n.Store(int32(len(h.watchers)))
+	h.mu.Unlock()
+}
+
+func (h *watchHub) cancel(w *watcher) {
+	w.once.Do(func() {
+		// unblock a writer waiting on the subscriber before taking locks
+		close(w.done)
+
+		w.mu.Lock()
+		w.closed = true
+		if w.policy != Coalesce {
+			close(w.ch)
+		}
+		w.mu.Unlock()
+
+		h.mu.Lock()
+		for i, x := range h.watchers {
+			if x == w {
+				h.watchers = append(h.watchers[:i], h.watchers[i+1:]...)
+				break
+			}
+		}
+		h.n.Store(int32(len(h.watchers)))
+		h.mu.Unlock()
+	})
+}
+
+func (h *watchHub) publish(ev Event) {
+	h.mu.Lock()
+	for _, w := range h.watchers {
+		if ev.Key >= w.start && (w.end == "" || ev.Key < w.end) {
+			w.send(ev)
+		}
+	}
+	h.mu.Unlock()
+}
+
+type watcher struct {
+	start, end string
+	policy     OverflowPolicy
+	ch         chan Event
+	done       chan struct{}
+	once       sync.Once
+
+	mu     sync.Mutex
+	closed bool
+
+	// pending events of a Coalesce subscription, delivered by pump
+	pending []string
+	events  map[string]Event
+	wake    chan struct{}
+}
+
+func (w *watcher) send(ev Event) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return
+	}
+
+	switch w.policy {
+	case Block:
+		select {
+		case w.ch <- ev:
+		case <-w.done:
+		}
+	case Coalesce:
+		if prev, ok := w.events[ev.Key]; ok {
+			ev.OldValue = prev.OldValue
+		} else {
+			w.pending = append(w.pending, ev.Key)
+		}
+		w.events[ev.Key] = ev
+		select {
+		case w.wake <- struct{}{}:
+		default:
+		}
+	default:
+		select {
+		case w.ch <- ev:
+		default:
+		}
+	}
+}
+
+// pump delivers the pending events of a Coalesce subscription. It owns the
+// channel and closes it once the subscription is cancelled.
+func (w *watcher) pump() {
+	defer close(w.ch)
+
+	for {
+		w.mu.Lock()
+		if w.closed {
+			w.mu.Unlock()
+			return
+		}
+		if len(w.pending) == 0 {
+			w.mu.Unlock()
+			select {
+			case <-w.wake:
+				continue
+			case <-w.done:
+				return
+			}
+		}
+		key := w.pending[0]
+		ev := w.events[key]
+		w.pending = w.pending[1:]
+		delete(w.events, key)
+		w.mu.Unlock()
+
+		select {
+		case w.ch <- ev:
+		case <-w.done:
+			return
+		}
+	}
+}
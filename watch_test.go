@@ -0,0 +1,106 @@
+package stashlist
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestWatchPrefix(t *testing.T) {
+	list := NewStashList()
+	list.Add("user:1", []byte("a"))
+
+	events, cancel := list.WatchPrefix("user:", WatchOptions{})
+	list.Add("user:1", []byte("b"))
+	list.Add("group:1", []byte("x"))
+	list.Add("user:2", []byte("c"))
+	list.Remove("user:1")
+	list.Remove("user:3")
+	cancel()
+	cancel()
+
+	expected := []Event{
+		{Type: EventPut, Key: "user:1", OldValue: []byte("a"), NewValue: []byte("b")},
+		{Type: EventPut, Key: "user:2", NewValue: []byte("c")},
+		{Type: EventDelete, Key: "user:1", OldValue: []byte("b")},
+	}
+	var got []Event
+	for ev := range events {
+		got = append(got, ev)
+	}
+	if len(got) != len(expected) {
+		t.Fatalf("got %d events (expected %d): %v", len(got), len(expected), got)
+	}
+	for i, ev := range got {
+		e := expected[i]
+		if ev.Type != e.Type || ev.Key != e.Key || !bytes.Equal(ev.OldValue, e.OldValue) || !bytes.Equal(ev.NewValue, e.NewValue) {
+			t.Fatalf("event %d is %+v (expected %+v)", i, ev, e)
+		}
+	}
+}
+
+func TestWatchDrop(t *testing.T) {
+	list := NewStashList()
+	events, cancel := list.WatchRange("a", "b", WatchOptions{Buffer: 2, Policy: Drop})
+	defer cancel()
+
+	for i := 0; i < 10; i++ {
+		list.Add("a", []byte{byte(i)})
+	}
+	if len(events) != 2 {
+		t.Fatal("wrong number of buffered events", len(events))
+	}
+	if ev := <-events; ev.NewValue[0] != 0 {
+		t.Fatal("Drop kept a later event instead of the first one", ev)
+	}
+}
+
+func TestWatchBlock(t *testing.T) {
+	list := NewStashList()
+	events, cancel := list.WatchPrefix("", WatchOptions{Buffer: 1, Policy: Block})
+
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 100; i++ {
+			list.Add("k", []byte{byte(i)})
+		}
+		close(done)
+	}()
+	for i := 0; i < 100; i++ {
+		if ev := <-events; ev.NewValue[0] != byte(i) {
+			t.Fatalf("event %d carries value %d", i, ev.NewValue[0])
+		}
+	}
+	<-done
+	cancel()
+}
+
+func TestWatchCoalesce(t *testing.T) {
+	list := NewStashList()
+	list.Add("k", []byte("0"))
+	events, cancel := list.WatchPrefix("k", WatchOptions{Buffer: 1, Policy: Coalesce})
+	defer cancel()
+
+	// one event fits in the channel and one is held by the delivering
+	// goroutine, the others are merged while the subscriber is away
+	for _, v := range []string{"1", "2", "3"} {
+		list.Add("k", []byte(v))
+	}
+	list.Remove("k")
+
+	var got []Event
+	for len(got) == 0 || got[len(got)-1].Type != EventDelete {
+		select {
+		case ev := <-events:
+			got = append(got, ev)
+		case <-time.After(time.Second):
+			t.Fatal("missing delete event, got", got)
+		}
+	}
+	if len(got) > 3 {
+		t.Fatal("events were not coalesced", got)
+	}
+	if !bytes.Equal(got[0].OldValue, []byte("0")) {
+		t.Fatalf("first event lost its old value: %+v", got[0])
+	}
+}
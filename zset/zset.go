@@ -0,0 +1,393 @@
+// Package zset implements Redis-style sorted sets: members ordered by score,
+// then by member, with rank queries.
+//
+// Members live in a skip list whose links carry spans, the number of
+// members each link skips, so that ranks are found in O(log n). A map from
+// member to element serves score lookups in O(1). Optionally, the list
+// adapts its towers the way StashList does: a member written again after
+// being read is promoted one level, and unvisited members standing just
+// before a written member are demoted.
+package zset
+
+import (
+	"math"
+	"math/rand"
+	"time"
+)
+
+const (
+	DefaultMaxLevel    int     = 18
+	DefaultProbability float64 = 1 / math.E
+)
+
+type elementNode struct {
+	next []*Element
+	// span[i] is the number of elements next[i] skips, itself included.
+	// For a nil link it is the number of elements after the node.
+	span    []int
+	level   int
+	visited bool
+}
+
+// Element is a member of a sorted set.
+type Element struct {
+	elementNode
+	member string
+	score  float64
+}
+
+// Member returns the member name.
+func (element *Element) Member() string {
+	return element.member
+}
+
+// Score returns the score of the member.
+func (element *Element) Score() float64 {
+	return element.score
+}
+
+// Next returns the following Element or nil if we're at the end of the set.
+func (element *Element) Next() *Element {
+	return element.next[0]
+}
+
+// less reports whether element sorts before (score, member).
+func (element *Element) less(score float64, member string) bool {
+	return element.score < score || element.score == score && element.member < member
+}
+
+// Entry is a member and its score, as returned by range queries.
+type Entry struct {
+	Member string
+	Score  float64
+}
+
+// ZSet is a sorted set. It is not safe for concurrent access.
+type ZSet struct {
+	elementNode
+	// Promote enables StashList-style tower adaptation, so that hot members
+	// move up and are found in fewer steps. It may be changed at any time.
+	Promote bool
+
+	maxLevel       int
+	Length         int
+	dict           map[string]*Element
+	randSource     rand.Source
+	probability    float64
+	probTable      []float64
+	prevNodesCache []*elementNode
+	rankCache      []int
+}
+
+// Front returns the member with the lowest score.
+func (z *ZSet) Front() *Element {
+	return z.next[0]
+}
+
+// Len returns the number of members.
+func (z *ZSet) Len() int {
+	return z.Length
+}
+
+// ZAdd sets the score of member, adding it if needed. Returns true if the
+// member was added. NaN scores are ignored.
+func (z *ZSet) ZAdd(member string, score float64) bool {
+	if math.IsNaN(score) {
+		return false
+	}
+	if element, ok := z.dict[member]; ok {
+		z.update(element, score)
+		return false
+	}
+
+	prevs, ranks := z.getPrevElementNodes(score, member)
+	level := z.randLevel()
+	element := &Element{
+		elementNode: elementNode{
+			next:  make([]*Element, level),
+			span:  make([]int, level),
+			level: level,
+		},
+		member: member,
+		score:  score,
+	}
+	if level == 1 {
+		element.visited = true
+	}
+	z.link(element, prevs, ranks)
+	z.dict[member] = element
+	z.Length++
+	return true
+}
+
+// ZIncrBy adds delta to the score of member, adding it with a score of
+// delta if needed, and returns the new score.
+func (z *ZSet) ZIncrBy(member string, delta float64) float64 {
+	score := delta
+	if element, ok := z.dict[member]; ok {
+		score += element.score
+	}
+	z.ZAdd(member, score)
+	return score
+}
+
+// ZScore returns the score of member.
+func (z *ZSet) ZScore(member string) (float64, bool) {
+	element, ok := z.dict[member]
+	if !ok {
+		return 0, false
+	}
+	element.visited = true
+	return element.score, true
+}
+
+// ZRem removes member. Returns false if it was not in the set.
+func (z *ZSet) ZRem(member string) bool {
+	element, ok := z.dict[member]
+	if !ok {
+		return false
+	}
+	prevs, _ := z.getPrevElementNodes(element.score, member)
+	z.unlink(element, prevs)
+	delete(z.dict, member)
+	z.Length--
+	return true
+}
+
+// ZRank returns the 0-based rank of member, by ascending score.
+func (z *ZSet) ZRank(member string) (int, bool) {
+	element, ok := z.dict[member]
+	if !ok {
+		return 0, false
+	}
+	element.visited = true
+
+	rank := 0
+	prev := &z.elementNode
+	for i := z.maxLevel - 1; i >= 0; i-- {
+		for next := prev.next[i]; next != nil && (next.less(element.score, member) || next == element); next = prev.next[i] {
+			rank += prev.span[i]
+			prev = &next.elementNode
+		}
+		if prev == &element.elementNode {
+			return rank - 1, true
+		}
+	}
+	return 0, false
+}
+
+// ZRevRank returns the 0-based rank of member, by descending score.
+func (z *ZSet) ZRevRank(member string) (int, bool) {
+	rank, ok := z.ZRank(member)
+	if !ok {
+		return 0, false
+	}
+	return z.Length - 1 - rank, true
+}
+
+// ZRangeByScore returns the members with min <= score <= max, in order.
+func (z *ZSet) ZRangeByScore(min, max float64) []Entry {
+	prev := &z.elementNode
+	for i := z.maxLevel - 1; i >= 0; i-- {
+		for next := prev.next[i]; next != nil && next.score < min; next = prev.next[i] {
+			prev = &next.elementNode
+		}
+	}
+
+	var entries []Entry
+	for element := prev.next[0]; element != nil && element.score <= max; element = element.next[0] {
+		entries = append(entries, Entry{Member: element.member, Score: element.score})
+	}
+	return entries
+}
+
+// ZRangeByRank returns the members with ranks in [start, stop], in order.
+// Negative ranks count from the end: -1 is the last member.
+func (z *ZSet) ZRangeByRank(start, stop int) []Entry {
+	if start < 0 {
+		start += z.Length
+	}
+	if stop < 0 {
+		stop += z.Length
+	}
+	if start < 0 {
+		start = 0
+	}
+	if stop >= z.Length {
+		stop = z.Length - 1
+	}
+	if start > stop {
+		return nil
+	}
+
+	entries := make([]Entry, 0, stop-start+1)
+	element := z.elementByRank(start + 1)
+	for ; element != nil && len(entries) < cap(entries); element = element.next[0] {
+		entries = append(entries, Entry{Member: element.member, Score: element.score})
+	}
+	return entries
+}
+
+// elementByRank returns the element with the 1-based rank.
+func (z *ZSet) elementByRank(rank int) *Element {
+	traversed := 0
+	prev := &z.elementNode
+	var element *Element
+	for i := z.maxLevel - 1; i >= 0; i-- {
+		for next := prev.next[i]; next != nil && traversed+prev.span[i] <= rank; next = prev.next[i] {
+			traversed += prev.span[i]
+			prev = &next.elementNode
+			element = next
+		}
+		if traversed == rank {
+			return element
+		}
+	}
+	return nil
+}
+
+// update moves element to its new score. With Promote set, an element
+// written again after being read also gains a level.
+func (z *ZSet) update(element *Element, score float64) {
+	promote := z.Promote && element.visited && element.level < z.maxLevel
+	if !promote {
+		element.visited = true
+		if score == element.score {
+			return
+		}
+	}
+
+	prevs, _ := z.getPrevElementNodes(element.score, element.member)
+	z.unlink(element, prevs)
+
+	element.score = score
+	if promote {
+		element.level++
+		if len(element.next) < element.level {
+			element.next = append(element.next, nil)
+			element.span = append(element.span, 0)
+		}
+	}
+	prevs, ranks := z.getPrevElementNodes(score, element.member)
+	z.link(element, prevs, ranks)
+
+	// the predecessor on the new level has to earn its place again
+	if promote {
+		prevs[element.level-1].visited = false
+	}
+}
+
+// link inserts element after prevs, whose 1-based ranks are ranks.
+func (z *ZSet) link(element *Element, prevs []*elementNode, ranks []int) {
+	for i := 0; i < element.level; i++ {
+		element.next[i] = prevs[i].next[i]
+		prevs[i].next[i] = element
+		element.span[i] = prevs[i].span[i] - (ranks[0] - ranks[i])
+		prevs[i].span[i] = ranks[0] - ranks[i] + 1
+	}
+	for i := element.level; i < z.maxLevel; i++ {
+		prevs[i].span[i]++
+	}
+}
+
+// unlink removes element, whose predecessors are prevs.
+func (z *ZSet) unlink(element *Element, prevs []*elementNode) {
+	for i := 0; i < z.maxLevel; i++ {
+		if i < element.level && prevs[i].next[i] == element {
+			prevs[i].span[i] += element.span[i] - 1
+			prevs[i].next[i] = element.next[i]
+			element.next[i] = nil
+		} else {
+			prevs[i].span[i]--
+		}
+	}
+}
+
+// getPrevElementNodes finds the last node before (score, member) on each
+// level and its 1-based rank. With Promote set, it demotes the unvisited
+// elements that stand right before (score, member) on their top level,
+// like StashList does.
+func (z *ZSet) getPrevElementNodes(score float64, member string) ([]*elementNode, []int) {
+	prevs, ranks := z.prevNodesCache, z.rankCache
+	prev := &z.elementNode
+	rank := 0
+
+	for i := z.maxLevel - 1; i >= 0; i-- {
+		var before *elementNode
+		beforeRank := 0
+
+		next := prev.next[i]
+		for next != nil && next.less(score, member) {
+			before, beforeRank = prev, rank
+			rank += prev.span[i]
+			prev = &next.elementNode
+			next = next.next[i]
+
+			if z.Promote && i > 0 && next != nil && next.score == score && next.member == member && !prev.visited {
+				// Demote
+				before.next[i] = next
+				before.span[i] += prev.span[i]
+				prev.next[i] = nil
+				prev.span[i] = 0
+				prev.level--
+				prev, rank = before, beforeRank
+				break
+			}
+		}
+
+		prevs[i], ranks[i] = prev, rank
+	}
+
+	return prevs, ranks
+}
+
+// SetProbability changes the current P value of the set.
+// It doesn't alter any existing data, only changes how future insert heights are calculated.
+func (z *ZSet) SetProbability(newProbability float64) {
+	z.probability = newProbability
+	z.probTable = probabilityTable(z.probability, z.maxLevel)
+}
+
+func (z *ZSet) randLevel() (level int) {
+	r := float64(z.randSource.Int63()) / (1 << 63)
+
+	level = 1
+	for level < z.maxLevel && r < z.probTable[level] {
+		level++
+	}
+	return
+}
+
+func probabilityTable(probability float64, maxLevel int) (table []float64) {
+	for i := 1; i <= maxLevel; i++ {
+		table = append(table, math.Pow(probability, float64(i-1)))
+	}
+	return table
+}
+
+// NewWithMaxLevel creates a new sorted set whose towers are at most maxLevel high.
+func NewWithMaxLevel(maxLevel int) *ZSet {
+	if maxLevel < 1 || maxLevel > 64 {
+		panic("maxLevel for a ZSet must be a positive integer <= 64")
+	}
+
+	return &ZSet{
+		elementNode: elementNode{
+			next:  make([]*Element, maxLevel),
+			span:  make([]int, maxLevel),
+			level: maxLevel,
+		},
+		maxLevel:       maxLevel,
+		dict:           make(map[string]*Element),
+		randSource:     rand.New(rand.NewSource(time.Now().UnixNano())),
+		probability:    DefaultProbability,
+		probTable:      probabilityTable(DefaultProbability, maxLevel),
+		prevNodesCache: make([]*elementNode, maxLevel),
+		rankCache:      make([]int, maxLevel),
+	}
+}
+
+// New creates a new sorted set with default parameters.
+func New() *ZSet {
+	return NewWithMaxLevel(DefaultMaxLevel)
+}
@@ -0,0 +1,170 @@
+package zset
+
+import (
+	"math/rand"
+	"reflect"
+	"sort"
+	"strconv"
+	"testing"
+)
+
+// checkSpans verifies the order of the set and the span of every link.
+func checkSpans(t *testing.T, z *ZSet) {
+	t.Helper()
+	pos := map[*elementNode]int{&z.elementNode: 0}
+	n := 0
+	for e := z.Front(); e != nil; e = e.Next() {
+		n++
+		pos[&e.elementNode] = n
+		if next := e.Next(); next != nil && !e.less(next.score, next.member) {
+			t.Fatalf("%s is not before %s", e.member, next.member)
+		}
+	}
+	if n != z.Length || len(z.dict) != n {
+		t.Fatalf("length %d, dict %d, %d elements", z.Length, len(z.dict), n)
+	}
+
+	for i := 0; i < z.maxLevel; i++ {
+		node := &z.elementNode
+		for {
+			next := node.next[i]
+			want := n - pos[node]
+			if next != nil {
+				want = pos[&next.elementNode] - pos[node]
+			}
+			if node.span[i] != want {
+				t.Fatalf("span at level %d after rank %d is %d, want %d", i, pos[node], node.span[i], want)
+			}
+			if next == nil {
+				break
+			}
+			if next.level <= i {
+				t.Fatalf("%s linked at level %d above its height %d", next.member, i, next.level)
+			}
+			node = &next.elementNode
+		}
+	}
+}
+
+func TestZSetAgainstModel(t *testing.T) {
+	for _, promote := range []bool{false, true} {
+		z := New()
+		z.Promote = promote
+		rng := rand.New(rand.NewSource(1))
+		model := make(map[string]float64)
+
+		for op := 0; op < 5000; op++ {
+			member := strconv.Itoa(rng.Intn(200))
+			switch rng.Intn(6) {
+			case 0, 1:
+				score := float64(rng.Intn(50))
+				_, existed := model[member]
+				if added := z.ZAdd(member, score); added == existed {
+					t.Fatal("ZAdd reported", added, "for", member)
+				}
+				model[member] = score
+			case 2:
+				model[member] += 1.5
+				if got := z.ZIncrBy(member, 1.5); got != model[member] {
+					t.Fatal("ZIncrBy returned", got)
+				}
+			case 3:
+				_, existed := model[member]
+				if z.ZRem(member) != existed {
+					t.Fatal("ZRem disagrees on", member)
+				}
+				delete(model, member)
+			default:
+				score, ok := z.ZScore(member)
+				if want, exists := model[member]; ok != exists || score != want {
+					t.Fatal("ZScore of", member, "is", score, ok)
+				}
+			}
+		}
+		checkSpans(t, z)
+
+		var want []Entry
+		for member, score := range model {
+			want = append(want, Entry{member, score})
+		}
+		sort.Slice(want, func(i, j int) bool {
+			return want[i].Score < want[j].Score || want[i].Score == want[j].Score && want[i].Member < want[j].Member
+		})
+
+		if got := z.ZRangeByRank(0, -1); !reflect.DeepEqual(got, want) {
+			t.Fatalf("promote=%v: ZRangeByRank(0, -1) differs from the model", promote)
+		}
+		for i, e := range want {
+			if rank, ok := z.ZRank(e.Member); !ok || rank != i {
+				t.Fatal("ZRank of", e.Member, "is", rank, "want", i)
+			}
+			if rank, _ := z.ZRevRank(e.Member); rank != len(want)-1-i {
+				t.Fatal("ZRevRank of", e.Member, "is", rank)
+			}
+		}
+		if got := z.ZRangeByRank(-3, -2); !reflect.DeepEqual(got, want[len(want)-3:len(want)-1]) {
+			t.Fatal("negative ranks returned", got)
+		}
+
+		var inRange []Entry
+		for _, e := range want {
+			if e.Score >= 10 && e.Score <= 20 {
+				inRange = append(inRange, e)
+			}
+		}
+		if got := z.ZRangeByScore(10, 20); !reflect.DeepEqual(got, inRange) {
+			t.Fatal("ZRangeByScore(10, 20) returned", got)
+		}
+	}
+}
+
+func TestZSetPromotion(t *testing.T) {
+	z := New()
+	z.Promote = true
+	for i := 0; i < 1000; i++ {
+		z.ZAdd(strconv.Itoa(i), float64(i))
+	}
+
+	hot := z.dict["500"]
+	level := hot.level
+	for i := 0; i < 6; i++ {
+		z.ZScore("500")
+		z.ZIncrBy("500", 0)
+	}
+	if hot.level <= level {
+		t.Fatal("hot member stayed at level", hot.level)
+	}
+	checkSpans(t, z)
+	if rank, _ := z.ZRank("500"); rank != 500 {
+		t.Fatal("promoted member has rank", rank)
+	}
+
+	z.Promote = false
+	level = hot.level
+	for i := 0; i < 6; i++ {
+		z.ZScore("500")
+		z.ZIncrBy("500", 0)
+	}
+	if hot.level != level {
+		t.Fatal("member promoted with promotion off")
+	}
+}
+
+func TestZSetEdges(t *testing.T) {
+	z := New()
+	if z.ZRangeByRank(0, -1) != nil || z.ZRem("x") {
+		t.Fatal("empty set returned members")
+	}
+	if _, ok := z.ZRank("x"); ok {
+		t.Fatal("ZRank of a missing member")
+	}
+	z.ZAdd("b", 1)
+	z.ZAdd("a", 1)
+	z.ZAdd("c", 0)
+	if got := z.ZRangeByRank(0, 10); len(got) != 3 || got[0].Member != "c" || got[1].Member != "a" {
+		t.Fatal("ties are not ordered by member", got)
+	}
+	if got := z.ZRangeByRank(2, 1); got != nil {
+		t.Fatal("inverted range returned", got)
+	}
+}